@@ -0,0 +1,40 @@
+package jwt
+
+import (
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// Stack returns the middlewares of stack with the middleware inserted after the access log
+// middlewares of go-json-rest and those they depend on, e.g.
+//
+//	api.Use(authMiddleware.Stack(rest.DefaultDevStack...)...)
+//
+// The access logs record request.Env["REMOTE_USER"] once the wrapped middlewares return, so that
+// the middleware must run inside of them for them to record the authenticated user, and for the
+// requests it rejects to be logged and timed as well. Without any of them, the middleware is
+// appended to the stack.
+func (mw *JWTMiddleware) Stack(stack ...rest.Middleware) []rest.Middleware {
+	position := 0
+	for i, middleware := range stack {
+		switch middleware.(type) {
+		case *rest.AccessLogApacheMiddleware, *rest.AccessLogJsonMiddleware, *rest.TimerMiddleware, *rest.RecorderMiddleware:
+			position = i + 1
+		}
+	}
+	if position == 0 {
+		position = len(stack)
+	}
+
+	middlewares := make([]rest.Middleware, 0, len(stack)+1)
+	middlewares = append(middlewares, stack[:position]...)
+	middlewares = append(middlewares, mw)
+	return append(middlewares, stack[position:]...)
+}
+
+// exposeIssuedUser makes the user a token is issued for available as request.Env["REMOTE_USER"] if
+// LogIssuedUser is set, as the middleware does for the requests it authenticates.
+func (mw *JWTMiddleware) exposeIssuedUser(request *rest.Request, userId string) {
+	if mw.LogIssuedUser {
+		request.Env["REMOTE_USER"] = userId
+	}
+}
@@ -0,0 +1,111 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func accessLogRecords(t *testing.T, buffer *bytes.Buffer) []rest.AccessLogJsonRecord {
+	records := []rest.AccessLogJsonRecord{}
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		record := rest.AccessLogJsonRecord{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	buffer.Reset()
+	return records
+}
+
+func TestStack(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: rejectLogin,
+	}
+
+	buffer := &bytes.Buffer{}
+	accessLog := &rest.AccessLogJsonMiddleware{Logger: log.New(buffer, "", 0)}
+	recoverMiddleware := &rest.RecoverMiddleware{}
+	stack := authMiddleware.Stack(accessLog, &rest.TimerMiddleware{}, &rest.RecorderMiddleware{}, recoverMiddleware)
+	if len(stack) != 5 || stack[3] != authMiddleware || stack[4] != recoverMiddleware {
+		t.Fatalf("The middleware should run inside of the access log, got %v", stack)
+	}
+	if stack := authMiddleware.Stack(recoverMiddleware); len(stack) != 2 || stack[1] != authMiddleware {
+		t.Errorf("The middleware should be appended to stacks without access log, got %v", stack)
+	}
+
+	api := rest.NewApi()
+	api.Use(stack...)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"user": r.Env["REMOTE_USER"].(string)})
+	}))
+	handler := api.MakeHandler()
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	test.RunRequest(t, handler, req).CodeIs(200)
+	records := accessLogRecords(t, buffer)
+	if len(records) != 1 || records[0].RemoteUser != "admin" || records[0].StatusCode != 200 {
+		t.Errorf("The access log should record the authenticated user, got %+v", records)
+	}
+
+	// rejected requests are logged too
+	test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/", nil)).CodeIs(401)
+	records = accessLogRecords(t, buffer)
+	if len(records) != 1 || records[0].RemoteUser != "" || records[0].StatusCode != 401 {
+		t.Errorf("The access log should record rejected requests, got %+v", records)
+	}
+}
+
+func TestLogIssuedUser(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:      "test zone",
+		Key:        key,
+		Timeout:    time.Hour,
+		MaxRefresh: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return userId == "admin" && password == "admin"
+		},
+		LogIssuedUser: true,
+	}
+
+	buffer := &bytes.Buffer{}
+	api := rest.NewApi()
+	api.Use(&rest.AccessLogJsonMiddleware{Logger: log.New(buffer, "", 0)}, &rest.TimerMiddleware{}, &rest.RecorderMiddleware{})
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"}))
+	recorded.CodeIs(200)
+	token := DecoderToken{}
+	recorded.DecodeJsonPayload(&token)
+	if records := accessLogRecords(t, buffer); records[0].RemoteUser != "admin" {
+		t.Errorf("The access log should record the user logging in, got %+v", records)
+	}
+
+	test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "wrong"})).CodeIs(401)
+	if records := accessLogRecords(t, buffer); records[0].RemoteUser != "" {
+		t.Errorf("The access log shouldn't record users failing to log in, got %+v", records)
+	}
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	test.RunRequest(t, handler, req).CodeIs(200)
+	if records := accessLogRecords(t, buffer); records[0].RemoteUser != "admin" {
+		t.Errorf("The access log should record the user refreshing a token, got %+v", records)
+	}
+}
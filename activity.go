@@ -0,0 +1,80 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrInactiveToken is returned for tokens that haven't been used for longer than InactivityTimeout.
+var ErrInactiveToken = errors.New("Token inactive")
+
+// ActivityStore remembers when tokens were last used, to enforce InactivityTimeout.
+// Deployments running several instances should use a shared implementation, e.g. backed by Redis.
+// Implementations must be safe for concurrent use.
+type ActivityStore interface {
+	// LastSeen returns the time the token stored under key was last used, if it hasn't expired yet.
+	LastSeen(key string) (time.Time, bool)
+
+	// SetLastSeen stores the time the token stored under key was last used for ttl.
+	SetLastSeen(key string, lastSeen time.Time, ttl time.Duration)
+}
+
+type memoryActivityStore struct {
+	cache *ttlCache
+}
+
+// NewMemoryActivityStore returns an ActivityStore keeping the last-seen times in memory.
+func NewMemoryActivityStore() ActivityStore {
+	return &memoryActivityStore{cache: newTTLCache()}
+}
+
+func (s *memoryActivityStore) memoryCache() *ttlCache {
+	return s.cache
+}
+
+func (s *memoryActivityStore) LastSeen(key string) (time.Time, bool) {
+	lastSeen, ok := s.cache.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return lastSeen.(time.Time), true
+}
+
+func (s *memoryActivityStore) SetLastSeen(key string, lastSeen time.Time, ttl time.Duration) {
+	s.cache.Set(key, lastSeen, ttl)
+}
+
+// activityStoreKey avoids keeping usable tokens in the ActivityStore.
+func activityStoreKey(rawToken string) string {
+	return tokenId(rawToken)
+}
+
+// recordActivity marks a newly issued token as used now.
+func (mw *JWTMiddleware) recordActivity(tokenString string) {
+	if mw.InactivityTimeout == 0 {
+		return
+	}
+	mw.ActivityStore.SetLastSeen(activityStoreKey(tokenString), mw.Clock.Now(), mw.InactivityTimeout)
+}
+
+// checkActivity rejects tokens that have been idle for longer than InactivityTimeout, and
+// updates the last-seen time of the others. To limit the writes to the ActivityStore, the
+// last-seen time is only updated once per ActivityUpdateInterval.
+func (mw *JWTMiddleware) checkActivity(token *jwt.Token) error {
+	if mw.InactivityTimeout == 0 {
+		return nil
+	}
+
+	key := activityStoreKey(token.Raw)
+	lastSeen, ok := mw.ActivityStore.LastSeen(key)
+	now := mw.Clock.Now()
+	if !ok || now.Sub(lastSeen) > mw.InactivityTimeout {
+		return ErrInactiveToken
+	}
+	if now.Sub(lastSeen) >= mw.ActivityUpdateInterval {
+		mw.ActivityStore.SetLastSeen(key, now, mw.InactivityTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+type countingActivityStore struct {
+	ActivityStore
+	writes int
+}
+
+func (s *countingActivityStore) SetLastSeen(key string, lastSeen time.Time, ttl time.Duration) {
+	s.writes++
+	s.ActivityStore.SetLastSeen(key, lastSeen, ttl)
+}
+
+func TestInactivityTimeout(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+	store := &countingActivityStore{ActivityStore: NewMemoryActivityStore()}
+
+	authMiddleware := &JWTMiddleware{
+		Realm:             "test zone",
+		Key:               key,
+		Timeout:           time.Hour * 24,
+		InactivityTimeout: time.Hour,
+		ActivityStore:     store,
+		Clock:             clock,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	loginCreds := map[string]string{"username": "admin", "password": "admin"}
+	recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	recorded.CodeIs(200)
+	nToken := DecoderToken{}
+	test.DecodeJsonPayload(recorded.Recorder, &nToken)
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+
+	request := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	// tokens that weren't issued by the middleware are unknown
+	request(makeTokenString("admin", key)).CodeIs(401)
+
+	// requests within the update interval don't write
+	clock.now = clock.now.Add(time.Minute)
+	request(nToken.Token).CodeIs(200)
+	if store.writes != 1 {
+		t.Errorf("Expected only the login to be recorded, got %d writes", store.writes)
+	}
+
+	// activity keeps the token alive beyond the inactivity timeout
+	for i := 0; i < 3; i++ {
+		clock.now = clock.now.Add(45 * time.Minute)
+		request(nToken.Token).CodeIs(200)
+	}
+	if store.writes != 4 {
+		t.Errorf("Expected 4 writes, got %d", store.writes)
+	}
+
+	// idle tokens are rejected although they haven't expired
+	clock.now = clock.now.Add(61 * time.Minute)
+	request(nToken.Token).CodeIs(401)
+}
@@ -0,0 +1,88 @@
+package jwt
+
+import (
+	"crypto"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// asymmetricAlgorithm reports whether algorithm signs tokens with a private key and verifies them
+// with its public key, i.e. is one of the RSA and ECDSA algorithms.
+func asymmetricAlgorithm(algorithm string) bool {
+	switch jwt.GetSigningMethod(algorithm).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		return true
+	}
+	return false
+}
+
+// parsePrivateKey returns the PEM encoded private key signing the tokens of an asymmetric
+// algorithm. It returns nil for the other algorithms and for keys that aren't private keys.
+func parsePrivateKey(algorithm string, key []byte) crypto.Signer {
+	switch jwt.GetSigningMethod(algorithm).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(key); err == nil {
+			return privateKey
+		}
+	case *jwt.SigningMethodECDSA:
+		if privateKey, err := jwt.ParseECPrivateKeyFromPEM(key); err == nil {
+			return privateKey
+		}
+	}
+	return nil
+}
+
+// parsePublicKey returns the key verifying the tokens of an asymmetric algorithm: the PEM encoded
+// publicKey, or else the public half of key, which may be a private or a public key. It returns
+// nil for the other algorithms and for keys that can't be parsed.
+func parsePublicKey(algorithm string, key, publicKey []byte) crypto.PublicKey {
+	if publicKey == nil {
+		if privateKey := parsePrivateKey(algorithm, key); privateKey != nil {
+			return privateKey.Public()
+		}
+		publicKey = key
+	}
+	switch jwt.GetSigningMethod(algorithm).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if parsed, err := jwt.ParseRSAPublicKeyFromPEM(publicKey); err == nil {
+			return parsed
+		}
+	case *jwt.SigningMethodECDSA:
+		if parsed, err := jwt.ParseECPublicKeyFromPEM(publicKey); err == nil {
+			return parsed
+		}
+	}
+	return nil
+}
+
+// samePublicKey reports whether the parsed public keys a and b are equal.
+func samePublicKey(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// signingKey returns the key signing the tokens of format: the parsed private key of the
+// asymmetric algorithms, which jwt-go only accepts parsed for PS* and ES*, or else Key.
+func (format *TokenFormat) signingKey() interface{} {
+	if privateKey, _ := format.parsedKeys(); privateKey != nil {
+		return privateKey
+	}
+	return format.Key
+}
+
+// parsedKeys returns the parsed keys of format. Formats that don't come with them, e.g. a
+// CanaryFormat, get them parsed from Key once rather than on every signature and verification.
+func (format *TokenFormat) parsedKeys() (crypto.Signer, crypto.PublicKey) {
+	format.parseKeys.Do(func() {
+		if format.privateKey != nil || format.publicKey != nil {
+			return
+		}
+		format.privateKey = parsePrivateKey(format.SigningAlgorithm, format.Key)
+		if format.privateKey != nil {
+			format.publicKey = format.privateKey.Public()
+		} else {
+			format.publicKey = parsePublicKey(format.SigningAlgorithm, format.Key, nil)
+		}
+	})
+	return format.privateKey, format.publicKey
+}
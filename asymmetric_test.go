@@ -0,0 +1,190 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func rsaKeyPair(t *testing.T) ([]byte, []byte) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+}
+
+func ecKeyPair(t *testing.T) ([]byte, []byte) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateBytes, _ := x509.MarshalECPrivateKey(privateKey)
+	publicKey, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateBytes}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	rsaPrivate, rsaPublic := rsaKeyPair(t)
+	ecPrivate, ecPublic := ecKeyPair(t)
+	cases := []struct {
+		algorithm             string
+		privateKey, publicKey []byte
+	}{
+		{"RS256", rsaPrivate, rsaPublic},
+		{"PS384", rsaPrivate, rsaPublic},
+		{"ES256", ecPrivate, ecPublic},
+	}
+
+	for _, c := range cases {
+		loginMiddleware := &JWTMiddleware{
+			Realm:            "test zone",
+			SigningAlgorithm: c.algorithm,
+			Key:              c.privateKey,
+			Timeout:          time.Hour,
+			MaxRefresh:       24 * time.Hour,
+			Authenticator: func(userId string, password string) bool {
+				return true
+			},
+		}
+		if problems := loginMiddleware.Validate(); len(problems) != 0 {
+			t.Errorf("%s: A private key should be valid, got %v", c.algorithm, problems)
+		}
+		loginApi := rest.NewApi()
+		loginApi.Use(&rest.IfMiddleware{
+			Condition: func(request *rest.Request) bool {
+				return request.URL.Path != "/login"
+			},
+			IfTrue: loginMiddleware,
+		})
+		router, _ := rest.MakeRouter(
+			rest.Post("/login", loginMiddleware.LoginHandler),
+			rest.Get("/refresh", loginMiddleware.RefreshHandler),
+		)
+		loginApi.SetApp(router)
+		loginHandler := loginApi.MakeHandler()
+
+		recorded := test.RunRequest(t, loginHandler, test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"}))
+		recorded.CodeIs(200)
+		token := DecoderToken{}
+		recorded.DecodeJsonPayload(&token)
+
+		// the login service verifies its tokens with the public half of its key
+		req := test.MakeSimpleRequest("GET", "http://localhost/refresh", nil)
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+		test.RunRequest(t, loginHandler, req).CodeIs(200)
+
+		// other services only need the public key
+		verifyingMiddleware := &JWTMiddleware{
+			Realm:            "test zone",
+			SigningAlgorithm: c.algorithm,
+			PublicKey:        c.publicKey,
+		}
+		api := rest.NewApi()
+		api.Use(verifyingMiddleware.AsVerifier())
+		api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+			w.WriteJson(map[string]string{"user": r.Env["REMOTE_USER"].(string)})
+		}))
+		req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+		recorded = test.RunRequest(t, api.MakeHandler(), req)
+		recorded.CodeIs(200)
+		recorded.BodyIs(`{"user":"admin"}`)
+		if problems := verifyingMiddleware.Validate(); len(problems) != 0 {
+			t.Errorf("%s: A public key should be valid for verifying, got %v", c.algorithm, problems)
+		}
+
+		// tokens signed with another key or algorithm are rejected
+		req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+		test.RunRequest(t, api.MakeHandler(), req).CodeIs(401)
+	}
+}
+
+func TestValidatePublicKey(t *testing.T) {
+	rsaPrivate, rsaPublic := rsaKeyPair(t)
+	otherPrivate, _ := rsaKeyPair(t)
+	ecPrivate, _ := ecKeyPair(t)
+	cases := []struct {
+		mw       *JWTMiddleware
+		expected string
+	}{
+		{&JWTMiddleware{SigningAlgorithm: "HS256", PublicKey: rsaPublic}, "PublicKey is only used by RSA and ECDSA algorithms, not HS256"},
+		{&JWTMiddleware{SigningAlgorithm: "RS256", PublicKey: rsaPrivate}, "PublicKey is a private key, which services verifying tokens shouldn't hold"},
+		{&JWTMiddleware{SigningAlgorithm: "ES256", PublicKey: rsaPublic}, "PublicKey isn't a PEM encoded public key as required by ES256"},
+		{&JWTMiddleware{SigningAlgorithm: "RS256", Key: otherPrivate, PublicKey: rsaPublic}, "PublicKey doesn't match Key, tokens signed with Key are rejected"},
+		{&JWTMiddleware{SigningAlgorithm: "RS256", PublicKey: rsaPublic}, "Key required to issue tokens, PublicKey only verifies them"},
+		{&JWTMiddleware{SigningAlgorithm: "ES256", Key: ecPrivate, PublicKey: rsaPublic}, "PublicKey isn't a PEM encoded public key as required by ES256"},
+	}
+	for _, c := range cases {
+		found := false
+		problems := c.mw.Validate()
+		for _, problem := range problems {
+			found = found || strings.Contains(problem.Error(), c.expected)
+		}
+		if !found {
+			t.Errorf("Validate should report %q, got %v", c.expected, problems)
+		}
+	}
+}
+
+func TestAsymmetricCanaryFormat(t *testing.T) {
+	ecPrivate, _ := ecKeyPair(t)
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Timeout:          time.Hour,
+		CanaryFormat:     &TokenFormat{SigningAlgorithm: "ES256", Key: ecPrivate},
+		CanaryPercentage: 100,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/login"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Get("/", func(w rest.ResponseWriter, r *rest.Request) {}),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	login := func() string {
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"}))
+		recorded.CodeIs(200)
+		token := DecoderToken{}
+		recorded.DecodeJsonPayload(&token)
+		return token.Token
+	}
+	get := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	get(login()).CodeIs(200)
+
+	// the keys of the format are parsed once, not on every signature and verification
+	if authMiddleware.CanaryFormat.privateKey == nil || authMiddleware.CanaryFormat.publicKey == nil {
+		t.Fatal("The keys of the canary format should be parsed")
+	}
+	authMiddleware.CanaryFormat.Key = []byte("not a key")
+	get(login()).CodeIs(200)
+}
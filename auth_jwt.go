@@ -5,29 +5,85 @@ import (
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/dgrijalva/jwt-go"
 
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // JWTMiddleware provides a Json-Web-Token authentication implementation. On failure, a 401 HTTP response
 // is returned. On success, the wrapped middleware is called, and the userId is made available as
-// request.Env["REMOTE_USER"].(string).
+// request.Env["REMOTE_USER"].(string), which the access log middlewares record when it runs inside
+// of them, see Stack.
 // Users can get a token by posting a json request to LoginHandler. The token then needs to be passed in
 // the Authentication header. Example: Authorization:Bearer XXX_TOKEN_XXX
+// A JWTMiddleware may be used by several rest.Api concurrently. Its configuration must not be
+// changed after Init, which the first MiddlewareFunc or handler call does otherwise; the key is
+// rotated with SetKey.
+// Services that only verify or only issue tokens can use the Verifier or the Issuer of the
+// configuration instead, see AsVerifier and AsIssuer.
 type JWTMiddleware struct {
 	// Realm name to display to the user. Required.
 	Realm string
 
-	// signing algorithm - possible values are HS256, HS384, HS512
+	// signing algorithm - possible values are HS256, HS384, HS512, and the RSA and ECDSA algorithms
+	// RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384 and ES512, which require a PEM encoded
+	// Key or PublicKey, or a KeySet.
 	// Optional, default is HS256.
 	SigningAlgorithm string
 
-	// Secret key used for signing. Required.
+	// Secret key used for signing, or the PEM encoded private key of the RSA and ECDSA algorithms.
+	// Required unless PublicKey, KeySet or SecretProvider is set.
+	// Use SetKey to rotate it once the middleware is in use.
 	Key []byte
 
+	// PEM encoded public key verifying the tokens signed with the RSA and ECDSA algorithms, so that
+	// services which only verify tokens don't hold the private Key of the login service.
+	// Optional, by default tokens are verified with the public half of Key.
+	PublicKey []byte
+
+	// JSON Web Key Set of an external identity provider used to verify tokens instead of Key. The
+	// verification key is selected by the "kid" header of the token.
+	// Optional, by default tokens are verified with Key.
+	KeySet *KeySet
+
+	// Provider of the secret key used instead of Key, e.g. a VaultSecretProvider, so that the
+	// secret can be rotated centrally. Tokens signed with the previous secret are still accepted
+	// for Timeout plus MaxRefresh after a new version is fetched, so that a rotation doesn't log
+	// out all users and instances that fetch the new version later don't issue rejected tokens.
+	// Optional, by default Key is used.
+	SecretProvider SecretProvider
+
+	// Duration after which the secret of the SecretProvider is fetched again.
+	// Optional, defaults to 5 minutes.
+	SecretRefreshInterval time.Duration
+
+	// Expected "iss" claim of the tokens. It is also set on the tokens issued by LoginHandler.
+	// Optional, by default the issuer is not validated.
+	Issuer string
+
+	// Expected "aud" claim of the tokens. It is also set on the tokens issued by LoginHandler.
+	// Optional, by default the audience is not validated.
+	Audience string
+
 	// Duration that a jwt token is valid. Optional, defaults to one hour.
 	Timeout time.Duration
 
@@ -37,15 +93,55 @@ type JWTMiddleware struct {
 	// Optional, defaults to 0 meaning not refreshable.
 	MaxRefresh time.Duration
 
+	// Registry of the first-party applications that may obtain tokens. If set, LoginHandler requires
+	// the "client_id" (and "client_secret" for confidential clients) of a registered client allowed
+	// to use GrantPassword, and applies its token policy. ClientCredentialsHandler requires it.
+	// Optional, by default all logins get the same tokens.
+	Clients ClientRegistry
+
+	// Callback function that returns the MaxRefresh of a token, e.g. to let mobile clients stay
+	// logged in longer than web clients based on a "client_type" claim set by PayloadFunc.
+	// Optional, by default MaxRefresh applies to all tokens.
+	MaxRefreshFunc func(claims map[string]interface{}) time.Duration
+
+	// Maximum number of times a token can be refreshed, counted by the "refresh_count" claim.
+	// Tokens refreshed too often, like tokens older than MaxRefresh, are rejected by RefreshHandler
+	// with a 401 and the "refresh_exhausted" error code.
+	// Optional, defaults to 0 meaning no limit.
+	MaxRefreshCount int
+
 	// Callback function that should perform the authentication of the user based on userId and
 	// password. Must return true on success, false on failure. Required.
 	Authenticator func(userId string, password string) bool
 
+	// Callback function that verifies the second factor of a login, e.g. a TOTP code, sent as "otp"
+	// along with the username and password, once the Authenticator succeeded. It returns the
+	// authentication methods (RFC 8176) of the second factor, e.g. []string{"otp"}, and false if
+	// the code is invalid, which fails the login. LoginHandler then stamps the "amr" claim, with
+	// "pwd", these methods and "mfa", and the "auth_time" claim, which RequireMFA checks. Logins
+	// without "otp" get "amr" ["pwd"]. Optional, by default "amr" is left to PayloadFunc.
+	SecondFactorAuthenticator func(userId string, otp string) ([]string, bool)
+
 	// Callback function that should perform the authorization of the authenticated user. Called
 	// only after an authentication success. Must return true on success, false on failure.
 	// Optional, default to success.
 	Authorizator func(userId string, request *rest.Request) bool
 
+	// Authorization checks run in order after the Authorizator. The first that fails denies the
+	// request with a 403 naming the check and, unless SuppressErrorDetail is set, its reason, so
+	// that denials can be understood without reading the code. Optional.
+	AuthorizationChecks []AuthorizationCheck
+
+	// Callback function called with the explanation of each request denied by the
+	// AuthorizationChecks or a guard returned by RequireChecks, e.g. to write an audit log.
+	// Optional.
+	DenialCallback func(denial *Denial, request *rest.Request)
+
+	// Lets trusted internal tooling skip the Authorizator, AuthorizationChecks and
+	// RouteAuthorizator with signed override tokens in staging environments.
+	// Optional, must not be enabled in production.
+	OverridePolicy *OverridePolicy
+
 	// Callback function to store a token in case you want to have it checked within Authorizator in some sort of
 	// database as an additional security measure
 	StoreToken func(timeout time.Duration) func(username, token string)
@@ -53,6 +149,13 @@ type JWTMiddleware struct {
 	// Remove token when refreshing/logging out
 	RemoveToken func(userId, token string)
 
+	// Pass the token id of ExtractTokenId, i.e. the sha256 hash of the token, to StoreToken and
+	// RemoveToken instead of the token itself, so that a leaked token store doesn't yield usable
+	// tokens. The Authorizator then looks up ExtractTokenId(request) and compares the stored ids
+	// with TokenIdsEqual.
+	// Optional, defaults to false.
+	HashStoredTokens bool
+
 	// Callback function that will be called during login.
 	// Using this function it is possible to add additional payload data to the webtoken.
 	// The data is then made available during requests via request.Env["JWT_PAYLOAD"].
@@ -64,231 +167,2019 @@ type JWTMiddleware struct {
 	// Function that extracts token string from whichever source
 	TokenExtractor func(request *rest.Request) (string, error)
 
-	// Name of the token header to parse
-	TokenName string
+	// Name of the token header to parse
+	TokenName string
+
+	// Steps undoing the encodings legacy clients wrap tokens in, run in order on the token of the
+	// TokenExtractor before it is parsed, e.g. []TokenDecoder{URLDecodeToken, UnquoteToken}.
+	// Optional.
+	TokenDecoders []TokenDecoder
+
+	// Reject tokens lacking an encoding expected by one of the TokenDecoders, or with a malformed
+	// one, with ErrInvalidTokenEncoding instead of passing them on as they are. The decoded token
+	// must then consist of base64url segments.
+	// Optional, defaults to false.
+	StrictTokenDecoding bool
+
+	// Headers the default TokenExtractor reads the token from, in order, e.g.
+	// []TokenHeader{{Name: "Authorization", Scheme: "Bearer"}, {Name: "X-Access-Token"}}. The first
+	// header that is present with the expected scheme is used.
+	// Optional, defaults to TokenName with the "Bearer" scheme.
+	TokenHeaders []TokenHeader
+
+	// Name of the environment variable that holds the token within the rest.Request if
+	// ExposeRawToken is set.
+	TokenEnvName string
+
+	// Mark the responses to authenticated requests as private to the user, with
+	// "Cache-Control: private" and a Vary header on the token source, so that shared caches such as
+	// CDNs and proxies don't serve the response of one user to another. Handlers setting their own
+	// Cache-Control, e.g. "public" for responses that don't depend on the user, take precedence.
+	// Optional, defaults to false.
+	PrivateResponses bool
+
+	// Headers the responses vary on with PrivateResponses, e.g. []string{"Cookie"} for a
+	// TokenExtractor reading a cookie. Optional, defaults to the names of the TokenHeaders.
+	VaryHeaders []string
+
+	// Store the raw token in request.Env[TokenEnvName]. Any handler or logging middleware can then
+	// read and replay it, prefer the token id of ExtractTokenId to correlate requests.
+	// Optional, defaults to false.
+	ExposeRawToken bool
+
+	// Whether LoginHandler and RefreshHandler set request.Env["REMOTE_USER"] to the user they issue
+	// a token for, so that the access log middlewares record who logged in. The handlers usually
+	// aren't behind the middleware, which sets it for the requests it authenticates.
+	// Optional, defaults to false.
+	LogIssuedUser bool
+
+	// Callback function that returns the Branding of the error responses to a request, e.g. by
+	// its Host or Accept-Language header, for white-labeled deployments serving several brands
+	// from one API. Optional, by default responses carry no branding and the Realm.
+	BrandingFunc func(request *rest.Request) *Branding
+
+	// Lifetime of the write tokens issued along with the tokens of LoginHandler. When set, the
+	// token of a login is a read token, which is rejected with a 403 and the
+	// "write_token_required" error code for requests other than GET, HEAD and OPTIONS, and a
+	// short-lived write token is returned in the "write_token" field, or by ExtractWriteToken,
+	// for the other requests. Write tokens can't be refreshed, so that a leaked read token of a
+	// mostly-read client can't be used to change anything, and a leaked write token only briefly.
+	// Optional, defaults to 0 meaning tokens are valid for all requests.
+	WriteTokenTimeout time.Duration
+
+	// Functions that return the token to a client, allows customising the output, e.g. return
+	// a cookie instead of json body
+	LoginCallback func(tokenString string, request *rest.Request, writer rest.ResponseWriter)
+	RefreshCallback func(tokenString string, request *rest.Request, writer rest.ResponseWriter)
+
+	// Alternative token format issued to the users selected by CanaryPercentage and CanaryUsers,
+	// e.g. to roll out a new claims schema or signing algorithm. Tokens in both formats are
+	// accepted during verification.
+	// Optional, by default every user gets tokens in the regular format.
+	CanaryFormat *TokenFormat
+
+	// Percentage (0-100) of users that get tokens in CanaryFormat. Users are bucketed by a hash
+	// of their userId, so a user keeps getting the same format on login and refresh.
+	// Optional, defaults to 0.
+	CanaryPercentage int
+
+	// Users that always get tokens in CanaryFormat, regardless of CanaryPercentage. Optional.
+	CanaryUsers []string
+
+	// Decode the numbers of claims as json.Number instead of float64, so that integers beyond 2^53,
+	// e.g. large user ids, keep their precision. Read numeric claims with GetInt64 and GetTime,
+	// which handle both. Optional, defaults to false.
+	UseJSONNumber bool
+
+	// Migrations applied in order to the claims of the tokens verified by the middleware, right
+	// after their signature, so that the validation, the IdentityHandler and the application only
+	// deal with the current claims schema while tokens issued with older ones are still accepted,
+	// e.g. []jwt.ClaimMigration{jwt.RenameClaim("uid", "id"), jwt.SplitClaim("roles", ",")}.
+	// Refreshed tokens are issued with the migrated claims. Each migration counts the tokens it
+	// changes every time they are verified, or once per VerificationCacheTTL for cached tokens,
+	// telling when it can be removed. Optional.
+	ClaimMigrations []ClaimMigration
+
+	// Accept tokens without an "exp" claim, which never expire, or without an "iat" claim. Tokens
+	// issued by LoginHandler and RefreshHandler always carry both, so this is only needed for
+	// tokens issued elsewhere. Optional, defaults to false, i.e. tokens without "exp" are rejected
+	// with ErrMissingExpiration and tokens without "iat" with ErrMissingIssuedAt, both reported
+	// with the CodeClaimMissing code.
+	AllowMissingExpiration bool
+
+	// Values of the "token_use" claim accepted by the middleware. LoginHandler and RefreshHandler
+	// issue tokens with TokenUseAccess, tokens with other uses like TokenUseRefresh are rejected
+	// with ErrInvalidTokenUse. Tokens without "token_use" claim are accepted.
+	// Optional, defaults to TokenUseAccess.
+	AcceptedTokenUses []string
+
+	// Callback function that validates the claims of a token, e.g. against a schema. It is called for
+	// every token with a valid signature, and for the claims of new tokens before they are signed so
+	// that malformed tokens (e.g. caused by a faulty PayloadFunc) are never issued. Tokens failing
+	// validation are rejected with ErrInvalidClaims.
+	// Optional, by default claims are not validated.
+	ClaimsValidator func(claims map[string]interface{}) error
+
+	// Callback function that derives the userId made available as request.Env["REMOTE_USER"] from
+	// the claims of a verified token, e.g. from "sub", "email" or a combination of claims.
+	// Optional, by default the "id" claim set by LoginHandler is used.
+	IdentityHandler func(claims map[string]interface{}) (string, error)
+
+	// Callback function that returns the scopes granted by the claims of a verified token. The
+	// scopes are made available as request.Env["JWT_SCOPES"] and are checked by RequireScopes.
+	// Optional, by default the space separated "scope" claim and the "scopes" array claim are used.
+	ScopesFunc func(claims map[string]interface{}) []string
+
+	// Mapper translating the groups of a token into additional scopes. Optional.
+	GroupMapper *GroupMapper
+
+	// Matcher deciding whether the granted scopes satisfy the scopes required by RequireScopes and
+	// RouteScopes, e.g. to encode an organization's scope grammar.
+	// Optional, defaults to NewScopeMatcher(nil), supporting exact matches and wildcards.
+	ScopeMatcher ScopeMatcher
+
+	// Additional middlewares whose tokens are accepted by this one as well, e.g. one created by
+	// NewCognitoMiddleware to accept the tokens of an external identity provider next to the tokens
+	// issued by LoginHandler. Tokens are verified by this middleware first and then by each
+	// additional verifier in order. The IdentityHandler and ScopesFunc of the verifier that accepted
+	// the token are used, so both kinds of tokens end up in the same REMOTE_USER/JWT_PAYLOAD contract.
+	// Optional, by default only tokens verified by this middleware are accepted.
+	AdditionalVerifiers []*JWTMiddleware
+
+	// Maximum size in bytes of the json payload accepted by LoginHandler. Larger payloads are
+	// rejected with 413 before they are decoded, and before they are read if their Content-Length
+	// announces it. The payload is buffered as it is read, so memory use follows its actual size
+	// rather than the limit. Payloads with another Content-Type than JSON are rejected with 415.
+	// Optional, defaults to 4096.
+	MaxLoginPayloadSize int64
+
+	// Maximum size in bytes of the body of requests whose token is bound to it, see
+	// MintBodyBoundToken. Larger bodies are rejected with a 401 before they are hashed.
+	// Optional, defaults to 1 MiB.
+	MaxBoundBodySize int64
+
+	// Receives the metric events of the middleware.
+	// Optional, by default no metrics are recorded.
+	Metrics MetricsRecorder
+
+	// Maximum number of entries of each in-memory store and cache used by the middleware, beyond
+	// which the least recently used entries are evicted. Security state is only dropped once it
+	// expires: the in-memory RevocationStore, QuarantineStore, ActivityStore and QuotaStore and the
+	// login lockouts are never evicted from, as filling them would otherwise let revoked tokens
+	// through, log out active users, reset quotas or lift lockouts.
+	// Sizes and hits are reported to Metrics, e.g. as "activity_cache_entries".
+	// Optional, defaults to 100000.
+	MaxCacheEntries int
+
+	// Callback function called with the value recovered from a panic in the middleware or the
+	// handlers, e.g. caused by one of the callbacks. The client gets a generic 500 response
+	// either way and the "panics" counter is incremented.
+	// Optional, by default the panic and its stack trace are logged.
+	PanicHandler func(request *rest.Request, recovered interface{})
+
+	// Put the claims map of the parsed token as is into request.Env["JWT_PAYLOAD"] instead of a deep
+	// copy of it. This saves an allocation per request, but handlers mutating the payload then
+	// change the claims seen by the middleware and by other handlers.
+	// Optional, defaults to false.
+	ShareClaims bool
+
+	// Key id set as "kid" header of the issued tokens, so that gateways can select the key to verify
+	// them with. Optional, by default no kid header is set.
+	KeyId string
+
+	// Token type set as "typ" header of the issued tokens, e.g. "at+jwt" (RFC 9068).
+	// Optional, defaults to "JWT".
+	TokenType string
+
+	// Callback function returning additional JOSE header fields of the tokens issued to userId, e.g.
+	// "cty". They take precedence over KeyId and TokenType, the "alg" header can't be overridden.
+	// Optional, by default no additional header fields are set.
+	HeaderFunc func(userId string) map[string]interface{}
+
+	// Issue and accept only tokens following the JWT profile for OAuth 2.0 access tokens (RFC 9068):
+	// the "typ" header is "at+jwt", the iss, exp, aud, sub, iat, jti and client_id claims are
+	// required, and the "scope" claim is a space separated string. Issuer, Audience and ClientId
+	// are required in this mode.
+	// Optional, defaults to false.
+	AccessTokenProfile bool
+
+	// OAuth 2.0 client id set as "client_id" claim of the tokens issued in AccessTokenProfile mode.
+	ClientId string
+
+	// Duration for which RefreshHandler remembers the token issued for a request with an
+	// Idempotency-Key header. Retries with the same key and the same token get the same new token
+	// instead of rotating it again, which would invalidate the token the client just stored.
+	// Optional, defaults to 0 meaning the Idempotency-Key header is ignored.
+	RefreshIdempotencyTTL time.Duration
+
+	// Store for the tokens remembered for RefreshIdempotencyTTL.
+	// Optional, defaults to an in-memory store.
+	IdempotencyStore IdempotencyStore
+
+	// Callback function that returns when the password of a user expires, which LoginHandler adds
+	// as "pwd_exp" claim. Once a token's "pwd_exp" has passed, the middleware rejects all requests
+	// with a 403 and the "password_expired" error code, except those to PasswordChangeRoutes.
+	// Optional, a zero time means the password doesn't expire.
+	PasswordExpiryFunc func(userId string) time.Time
+
+	// Paths that remain accessible with an expired password, e.g. the password change endpoint.
+	// Optional.
+	PasswordChangeRoutes []string
+
+	// Version of the terms of service users must have consented to. Requests with tokens whose
+	// "consent_version" claim is missing or lower are rejected with a 403 and the
+	// "consent_required" error code, except those to ConsentRoutes.
+	// Optional, defaults to 0 meaning consent isn't checked.
+	RequiredConsentVersion int
+
+	// Callback function that returns the version of the terms of service a user consented to,
+	// which LoginHandler adds as "consent_version" claim. Optional.
+	ConsentVersionFunc func(userId string) int
+
+	// Paths that remain accessible without the required consent, e.g. the endpoint recording it.
+	// Optional.
+	ConsentRoutes []string
+
+	// Reject requests with tokens whose EmailVerifiedClaim isn't true with a 403 and the
+	// "email_not_verified" error code, except those to EmailVerificationRoutes. Use
+	// RequireVerifiedEmail instead to require a verified email on some routes only.
+	// Optional, defaults to false.
+	RequireEmailVerified bool
+
+	// Name of the claim attesting that the email of the user was verified, either a boolean or
+	// the string "true" as sent by some identity providers.
+	// Optional, defaults to "email_verified".
+	EmailVerifiedClaim string
+
+	// URL of the email verification flow, returned as "verification_url" along with the
+	// "email_not_verified" error code. Optional.
+	EmailVerificationURL string
+
+	// Paths that remain accessible without a verified email, e.g. the endpoint resending the
+	// verification email. Optional.
+	EmailVerificationRoutes []string
+
+	// Restrictions of when tokens may be used, e.g. contractor tokens only on weekdays from 08:00
+	// to 18:00 in the time zone of their "tz" claim. Requests outside of the schedule of a policy
+	// that applies to their token are rejected with a 403. Optional.
+	TemporalPolicies []TemporalPolicy
+
+	// Callback function that returns the scopes the user consented to grant to the client (which
+	// is "" without registered Clients), given the space separated scopes requested with the
+	// "scope" field of the login. Only the requested scopes it returns are set as "scope" claim,
+	// restricted further by the Scopes of the client, and logins getting none of them are rejected
+	// with a 403 and the "invalid_scope" error code.
+	// Optional, if not set the scopes requested by logins are ignored.
+	ConsentFunc func(userId string, clientId string, requested []string) []string
+
+	// Callback function that should perform the authorization of the authenticated user for the
+	// route matched by the request, given as method and path pattern, e.g. "GET /users/:id".
+	// Called only for the routes wrapped by AuthorizeRoutes, after the Authorizator.
+	// Optional, by default all routes are allowed.
+	RouteAuthorizator func(userId string, route string, request *rest.Request) bool
+
+	// Scopes required for the routes wrapped by AuthorizeRoutes, by method and path pattern, e.g.
+	// {"DELETE /users/:id": {"users:admin"}}, and for the actions checked with Check. Optional.
+	RouteScopes map[string][]string
+
+	// Scopes required by method and path pattern, enforced by the middleware for all requests so
+	// that the requirements can be audited in one table instead of in every handler, e.g. loaded
+	// from a configuration file with ParseScopeTable. The first matching rule applies, requests
+	// lacking its scopes get a 403 with an insufficient_scope challenge. Patterns are matched
+	// against the paths as seen by the middleware, before any prefix is stripped.
+	// Optional, by default only the guards of the handlers check scopes.
+	ScopeTable []ScopeRule
+
+	// Whether requests matching no rule of the ScopeTable are rejected with a 403, so that new
+	// routes aren't exposed by forgetting to list them. Optional, defaults to false.
+	DenyUnlistedRoutes bool
+
+	// Callback function that should perform the authorization of the actions on resources checked
+	// with Check outside of HTTP, e.g. "send" on a WebSocket channel.
+	// Optional, by default all actions are allowed.
+	ActionAuthorizator func(info *AuthInfo, action string, resource string) bool
+
+	// Callback function that returns the attributes of a request the tokens are bound to, e.g. its
+	// User-Agent, a device id header or a TLS fingerprint. A hash of it is added as "fpt" claim by
+	// LoginHandler and RefreshHandler, and tokens used by requests with another fingerprint are
+	// rejected with ErrFingerprintMismatch.
+	// Optional, by default tokens aren't bound to requests.
+	FingerprintFunc func(request *rest.Request) string
+
+	// Claims copied into request.Env of authenticated requests, by claim name, e.g.
+	// {"tenant": "TENANT_ID"}. Optional.
+	ClaimsToEnv map[string]string
+
+	// Claims copied into request headers of authenticated requests, by claim name, e.g.
+	// {"tenant": "X-Tenant-Id"}, for downstream middlewares and reverse proxied services.
+	// AuthRequestHandler also sets them on the response for the proxy. Headers of these names sent
+	// by clients are always removed.
+	// Optional.
+	ClaimsToHeaders map[string]string
+
+	// Number of consecutive failed logins after which a user is locked out for LockoutDuration.
+	// Failed logins are answered with the attempts remaining, logins during the lockout with a 429
+	// and the time at which to retry.
+	// Optional, defaults to 0 meaning users are never locked out.
+	MaxLoginAttempts int
+
+	// Duration of the lockout after MaxLoginAttempts failed logins, which is also the time after
+	// which failed logins are forgotten. Optional, defaults to 15 minutes.
+	LockoutDuration time.Duration
+
+	// Duration after which a token that hasn't been used is rejected with ErrInactiveToken, even if
+	// it hasn't expired yet. Tokens are tracked from the moment LoginHandler or RefreshHandler issue
+	// them, tokens issued elsewhere are always rejected.
+	// Optional, defaults to 0 meaning tokens are valid until they expire.
+	InactivityTimeout time.Duration
+
+	// Minimal interval between updates of the last-seen time of a token, which trades accuracy of
+	// the InactivityTimeout for fewer writes to the ActivityStore.
+	// Optional, defaults to a tenth of InactivityTimeout.
+	ActivityUpdateInterval time.Duration
+
+	// Store for the last-seen times of the tokens tracked for InactivityTimeout.
+	// Optional, defaults to an in-memory store.
+	ActivityStore ActivityStore
+
+	// Headers from which AuthRequestHandler reads the method and URI of the original request.
+	// Optional, default to "X-Original-Method" and "X-Original-URI".
+	OriginalMethodHeader string
+	OriginalURIHeader    string
+
+	// Header in which AuthRequestHandler returns the userId of the authenticated user.
+	// Optional, defaults to "X-Auth-User".
+	IdentityHeader string
+
+	// Origins of the web applications allowed to log in, e.g. "https://app.example.com". If set,
+	// LoginHandler and RefreshHandler reject requests whose Origin header, or Referer header if
+	// there is none, names another origin with a 403, so that other sites can't post credentials
+	// (login CSRF). Requests with neither header don't come from browsers and are accepted.
+	// Optional, by default origins aren't checked.
+	AllowedOrigins []string
+
+	// Cross-origin resource sharing for the handlers, for web applications on the AllowedOrigins.
+	// Preflight requests are answered by the handlers, which must also be routed for OPTIONS,
+	// and are passed through by the middleware, as browsers send them without token.
+	// Optional, by default the handlers don't support CORS.
+	CORS *CORS
+
+	// Pass CORS preflight requests through without authentication even if CORS isn't set, e.g.
+	// for go-json-rest's CorsMiddleware wrapped by the middleware, as browsers send them without
+	// token. Optional, defaults to false meaning they are rejected with a 401 unless CORS is set.
+	PassPreflightRequests bool
+
+	// Check HEAD requests with the rules of GET requests, i.e. the ScopeTable and the RouteScopes
+	// and RouteAuthorizator of AuthorizeRoutes, so that the routes registered for both methods
+	// don't need their rules twice. Optional, defaults to false.
+	HeadAsGet bool
+
+	// Maximum number of tokens issued per user by LoginHandler, and per client with Clients, in
+	// each IssuanceQuotaWindow, e.g. 30 per hour. Further logins are rejected with a 429 even with
+	// valid credentials, to contain scripted token minting.
+	// Optional, defaults to 0 meaning no quota.
+	IssuanceQuota int
+
+	// Window of the IssuanceQuota. Optional, defaults to one hour.
+	IssuanceQuotaWindow time.Duration
+
+	// Store of the IssuanceQuota and refresh rate limit counters. Optional, defaults to an
+	// in-memory store.
+	QuotaStore QuotaStore
+
+	// Callback function receiving the logout tickets minted by LogoutHandler, e.g. to publish them
+	// to sibling services through a message broker or webhooks. The services pass them to
+	// AcceptLogoutTicket to reject the logged out tokens without a shared RevocationStore.
+	// Optional, by default no tickets are minted.
+	LogoutPublisher func(ticket string)
+
+	// Callback function called by BackchannelLogoutHandler with the "sub" and "sid" claims of each
+	// accepted logout token, one of which may be empty, e.g. to end the sessions of the
+	// application. Optional.
+	BackchannelLogoutCallback func(sub string, sid string)
+
+	// Validity of the logout tickets, after which they are rejected by AcceptLogoutTicket.
+	// Optional, defaults to 5 minutes.
+	LogoutTicketTTL time.Duration
+
+	// Cookies cleared by FrontchannelLogoutHandler, e.g. the cookie holding the token set by the
+	// LoginCallback. Only their Name, Path, Domain, Secure, HttpOnly and SameSite are used.
+	// Optional.
+	LogoutCookies []http.Cookie
+
+	// URLs FrontchannelLogoutHandler redirects to after the logout, as requested by the
+	// "post_logout_redirect_uri" query parameter, which must match one of them exactly. Without
+	// the parameter, the first one is used.
+	// Optional, by default FrontchannelLogoutHandler doesn't redirect.
+	PostLogoutRedirectURIs []string
+
+	// Scope of the cookies holding tokens, whose Domain attribute is returned by CookieDomain:
+	// CookieScopeHost or CookieScopeParent. LogoutCookies without Domain are cleared with it.
+	// Optional, defaults to CookieScopeHost.
+	CookieScope string
+
+	// Public suffix list used by CookieScopeParent to find the registrable domain of a host, e.g.
+	// publicsuffix.List of golang.org/x/net/publicsuffix, and to keep the CookieDomainOverrides
+	// from scoping cookies to a public suffix such as "co.uk".
+	// Optional, without it CookieScopeParent falls back to host-only cookies.
+	PublicSuffixList cookiejar.PublicSuffixList
+
+	// Cookie domains by host, overriding the CookieScope for the requests to the host or its
+	// subdomains, e.g. {"staging.example.com": "staging.example.com", "localhost": ""} to keep
+	// the cookies of a staging environment away from production. The most specific host wins,
+	// and an empty domain means host-only cookies. Domains that don't cover the host of the
+	// request or are public suffixes are ignored. Optional.
+	CookieDomainOverrides map[string]string
+
+	// Maximum number of refreshes of a token family, i.e. the tokens refreshed from the same login,
+	// in each RefreshRateWindow. Further refreshes are rejected with a 429 and a jittered
+	// Retry-After, so that clients stuck in a retry loop don't hammer the stores.
+	// Optional, defaults to 0 meaning no limit.
+	RefreshRateLimit int
+
+	// Maximum number of refreshes of all the tokens of a user in each RefreshRateWindow.
+	// Optional, defaults to 0 meaning no limit.
+	RefreshUserRateLimit int
+
+	// Window of RefreshRateLimit and RefreshUserRateLimit. Optional, defaults to one minute.
+	RefreshRateWindow time.Duration
+
+	// List of revoked tokens, pulled periodically by every instance.
+	// Optional, by default tokens are valid until they expire.
+	RevocationList *RevocationList
+
+	// Store of the tokens revoked with RevokeToken. A bloom filter of the revoked tokens is kept in
+	// front of it, so that the store is only asked for tokens that may be revoked.
+	// Optional, by default RevokeToken has no effect.
+	RevocationStore RevocationStore
+
+	// Interval in which the bloom filter is rebuilt from the RevocationStore. Tokens revoked by
+	// other instances are only rejected after the next rebuild.
+	// Optional, defaults to one minute.
+	RevocationFilterInterval time.Duration
+
+	// Batch functions by name, whose lookups are shared and batched per request by the Loader
+	// returned by RequestLoader. Optional.
+	Loaders map[string]BatchFunc
+
+	// Store of the sessions listed by SessionsHandler. Tokens issued at login get a "sid" claim
+	// identifying their session, which is kept when they are refreshed.
+	// Optional, by default sessions aren't tracked.
+	SessionStore SessionStore
+
+	// Callback returning the metadata stored with the session at login and refresh, e.g. the IP,
+	// user agent, app version or location of the client, for "active devices" pages.
+	// Optional, by default sessions have no metadata.
+	SessionMetadataFunc func(userId string, request *rest.Request) map[string]string
+
+	// Callback of SwitchTenantHandler reporting whether the user belongs to tenant, along with the
+	// claims of the user within the tenant, e.g. its roles.
+	// Optional, SwitchTenantHandler responds with a 404 if it isn't set.
+	TenantFunc func(userId string, tenant string) (map[string]interface{}, bool)
+
+	// Claim holding the tenant of tokens issued by SwitchTenantHandler.
+	// Optional, defaults to "tenant".
+	TenantClaim string
+
+	// Revoke the current token when SwitchTenantHandler issues a token for another tenant, so that
+	// a user is only active in one tenant at a time. Requires RevocationStore.
+	// Optional, defaults to false meaning both tokens stay valid.
+	RevokeOnTenantSwitch bool
+
+	// Store of the users and tokens quarantined with QuarantineUser and QuarantineToken.
+	// Optional, defaults to an in-memory store.
+	QuarantineStore QuarantineStore
+
+	// Callback function called for requests of quarantined users or tokens, which returns whether
+	// the request may proceed. Otherwise it must write the response, e.g. a redirect to a
+	// verification flow.
+	// Optional, defaults to QuarantineReadOnly.
+	QuarantinePolicy func(writer rest.ResponseWriter, request *rest.Request) bool
+
+	// Name of the claim marking the tokens of suspended users, which is true or "true".
+	// Optional, defaults to "suspended".
+	SuspendedClaim string
+
+	// Callback function that reports whether the account of a user is suspended. It is called for
+	// every authenticated request so that suspensions take effect immediately. Requests of users
+	// suspended by it or by the SuspendedClaim are rejected with a 403 and the "account_suspended"
+	// error code. Optional, by default only the SuspendedClaim is checked.
+	SuspensionChecker func(userId string) bool
+
+	// Revoke the tokens suspended users make requests with, and reject the tokens refreshed from
+	// them, so that users have to log in again once their suspension is lifted. Tokens are only
+	// revoked across instances with a RevocationStore, those accepted by the AdditionalVerifiers
+	// aren't. Optional, defaults to false.
+	RevokeSuspendedTokens bool
+
+	// Callback function delivering the password reset tokens minted by ForgotPasswordHandler, e.g.
+	// by emailing the user a link to the reset page of the application, which passes the token to
+	// ResetPasswordHandler. It is called for every requested user so that the responses don't
+	// reveal which accounts exist, and must silently ignore unknown users. Slow deliveries should
+	// be queued rather than made during the call, which would reveal them by the response time.
+	// Optional, ForgotPasswordHandler responds with a 404 if it isn't set.
+	PasswordResetSender func(userId string, token string)
+
+	// Callback function of ResetPasswordHandler setting the new password of a user, which returns
+	// an error if the password is rejected, e.g. by a password policy.
+	// Optional, ResetPasswordHandler responds with a 404 if it isn't set.
+	PasswordResetter func(userId string, password string) error
+
+	// Validity of the password reset tokens. Optional, defaults to 15 minutes.
+	PasswordResetTTL time.Duration
+
+	// Removes the headers of the request that could be used to spoof identities or client IPs
+	// before the middleware or the application trusts them: IdentityHeader, and the X-Forwarded-*,
+	// X-Real-IP and Forwarded headers unless the request comes from one of the TrustedProxies. The
+	// client IP is then available through ExtractClientIP.
+	// Optional, defaults to false.
+	SanitizeProxyHeaders bool
+
+	// IPs and CIDR ranges of the reverse proxies in front of the application, e.g. "10.0.0.0/8",
+	// whose forwarding headers are trusted with SanitizeProxyHeaders.
+	// Optional, by default no proxy is trusted.
+	TrustedProxies []string
+
+	// Source of the current time used for the exp, iat and orig_iat claims and their verification.
+	// Optional, defaults to the system clock.
+	Clock Clock
+
+	// Duration for which tokens whose signature has been verified are cached by their sha256 hash,
+	// so that expensive signatures such as RSA ones are verified once per token rather than on
+	// every request. The claims, revocation, fingerprint and activity of cached tokens are still
+	// checked on every request, and tokens are dropped from the cache when they expire, are
+	// revoked with RevokeToken or the key is rotated with SetKey. Tokens signed with a key that has
+	// been removed from the KeySet stay accepted for up to this duration.
+	// Optional, defaults to 0 meaning signatures are verified on every request.
+	VerificationCacheTTL time.Duration
+
+	// Stages verifying the token of requests, in order. The first failing stage rejects the request
+	// with a 401, before the Authorizator is called.
+	// Optional, defaults to DefaultVerificationStages().
+	VerificationStages []VerificationStage
+
+	// Header of the correlation id of requests, e.g. "X-Request-ID". The id of the request, or a
+	// generated one if it is missing or malformed, is returned in the same response header, added
+	// as "request_id" to the error responses and the log lines of the middleware, and available
+	// through ExtractRequestId, so that the errors seen by clients can be matched to server logs.
+	// Optional, by default requests aren't correlated.
+	RequestIdHeader string
+
+	// Source of randomness used for generated claims such as jti.
+	// Optional, defaults to crypto/rand.Reader.
+	RandReader io.Reader
+
+	// Maximum duration to wait for the Authenticator, SecondFactorAuthenticator and Authorizator.
+	// Requests whose callback doesn't return in time, e.g. because of a database outage, are
+	// answered with a 503 and the "callback_timeout" error code instead of tying up the server. The
+	// callback itself can't be interrupted and keeps running in the background.
+	// Optional, defaults to 0 meaning no timeout.
+	CallbackTimeout time.Duration
+
+	// Scope that keeps tokens valid in MaintenanceOpsOnly mode.
+	// Optional, defaults to "ops".
+	MaintenanceScope string
+
+	// Encoder of the json responses of the middleware and its handlers, e.g. EnvelopeEncoder, or
+	// ProblemDetailsEncoder and JSONAPIEncoder for standard error formats.
+	// Optional, by default responses are encoded by the rest.ResponseWriter.
+	ResponseEncoder ResponseEncoder
+
+	// Encoders by media type, e.g. {"application/xml": XMLEncoder, "application/msgpack":
+	// MsgpackEncoder}, for clients that don't speak json. The encoder is chosen by the Accept header
+	// of the request, ResponseEncoder is used if json is preferred or no other encoder matches.
+	// Optional.
+	ResponseEncoders map[string]ResponseEncoder
+
+	// Leaves the "detail" out of 401 responses, which explains why a token was rejected. The
+	// machine readable "code" is kept. Recommended in production.
+	// Optional, defaults to false.
+	SuppressErrorDetail bool
+
+	// Scope callers of TokenDebugHandler need. Optional, TokenDebugHandler is disabled unless set.
+	DebugScope string
+
+	// Records the verification steps of each request (token extraction, signing algorithm and key,
+	// claim checks, fingerprint, revocation and activity checks) in request.Env["JWT_TRACE"] as
+	// []TokenCheck.
+	// Tokens are verified a second time for the trace, so it's meant for debugging.
+	// Optional, defaults to false.
+	Trace bool
+
+	// Response header the trace is written to if Trace is set, e.g. "X-JWT-Trace". The trace reveals
+	// why tokens are rejected, so it shouldn't be set in production.
+	// Optional, by default the trace is only recorded in request.Env.
+	TraceHeader string
+
+	// set by AsVerifier, the middleware never issues tokens
+	verifyOnly bool
+
+	loginThrottle    *loginThrottle
+	loggedOut        *ttlCache
+	trustedProxies   []*net.IPNet
+	revocationFilter *revocationFilter
+	scopeTable       *scopeTable
+
+	// set by Init once the configuration is complete
+	initialized uint32
+
+	// signingKeys of Key or SetKey
+	keys atomic.Value
+
+	// maintenanceState of SetMaintenanceMode
+	maintenance atomic.Value
+
+	// version and fetch time of the secret of the SecretProvider, and whether it is being fetched
+	secretVersion    atomic.Value
+	secretFetchedAt  atomic.Value
+	secretRefreshing uint32
+}
+
+var (
+	// ErrInvalidClaims is returned for tokens that have a valid signature but are rejected by ClaimsValidator.
+	ErrInvalidClaims = errors.New("Invalid token claims")
+
+	// ErrMissingExpiration is returned for tokens without an "exp" claim, unless AllowMissingExpiration is set.
+	ErrMissingExpiration = errors.New("Missing token expiration")
+
+	// ErrMissingIssuedAt is returned for tokens without an "iat" claim, unless
+	// AllowMissingExpiration is set.
+	ErrMissingIssuedAt = errors.New("Missing token issue time")
+
+	// ErrInvalidIssuer is returned for tokens that were not issued by Issuer.
+	ErrInvalidIssuer = errors.New("Invalid token issuer")
+
+	// ErrInvalidAudience is returned for tokens that are not meant for Audience.
+	ErrInvalidAudience = errors.New("Invalid token audience")
+)
+
+// TokenFormat describes how tokens are signed and which additional claims they carry.
+type TokenFormat struct {
+	// signing algorithm - same values as JWTMiddleware.SigningAlgorithm
+	SigningAlgorithm string
+
+	// Secret key used for signing, or PEM encoded private key. It must not be changed once the
+	// format is in use, as the parsed private key is kept.
+	Key []byte
+
+	// Same as JWTMiddleware.KeyId, used for tokens issued in this format.
+	KeyId string
+
+	// Same as JWTMiddleware.PayloadFunc, used for tokens issued in this format.
+	PayloadFunc func(userId string) map[string]interface{}
+
+	// parsed keys of the asymmetric algorithms, derived from Key once if both are nil
+	privateKey crypto.Signer
+	publicKey  crypto.PublicKey
+	parseKeys  sync.Once
+}
+
+// MiddlewareFunc makes JWTMiddleware implement the Middleware interface.
+func (mw *JWTMiddleware) MiddlewareFunc(handler rest.HandlerFunc) rest.HandlerFunc {
+	mw.initDefaults()
+
+	return func(writer rest.ResponseWriter, request *rest.Request) { mw.middlewareImpl(writer, request, handler) }
+}
+
+// Init validates the configuration and fills in the defaults. MiddlewareFunc and the handlers
+// call it themselves and log.Fatal on an invalid configuration, call it at startup to handle the
+// error instead.
+// Init is safe for concurrent use, but only completes the configuration once.
+func (mw *JWTMiddleware) Init() error {
+	initMutex.Lock()
+	defer initMutex.Unlock()
+
+	if atomic.LoadUint32(&mw.initialized) == 1 {
+		return nil
+	}
+	if err := mw.configure(); err != nil {
+		return err
+	}
+	atomic.StoreUint32(&mw.initialized, 1)
+	return nil
+}
+
+// initMutex serializes Init, which is rare enough to share a lock between all middlewares.
+var initMutex sync.Mutex
+
+func (mw *JWTMiddleware) configure() error {
+	if mw.TokenName == "" {
+		mw.TokenName = "Authorization"
+	}
+	if len(mw.TokenHeaders) == 0 {
+		mw.TokenHeaders = []TokenHeader{{Name: mw.TokenName, Scheme: "Bearer"}}
+	}
+	if mw.TokenEnvName == "" {
+		mw.TokenEnvName = "AUTH_TOKEN"
+	}
+	if mw.Realm == "" {
+		if !mw.verifyOnly {
+			return errors.New("Realm is required")
+		}
+		mw.Realm = "jwt"
+	}
+	if mw.SigningAlgorithm == "" {
+		mw.SigningAlgorithm = "HS256"
+	}
+	if mw.Key == nil && mw.PublicKey == nil && mw.KeySet == nil && mw.SecretProvider == nil {
+		return errors.New("Key required")
+	}
+	if mw.Timeout == 0 {
+		mw.Timeout = time.Hour
+	}
+	if mw.Authenticator == nil && !mw.verifyOnly {
+		return errors.New("Authenticator is required")
+	}
+	if mw.TokenExtractor == nil {
+		mw.TokenExtractor = defaultTokenExtractor(mw)
+	}
+	if mw.PrivateResponses && mw.VaryHeaders == nil {
+		for _, header := range mw.TokenHeaders {
+			if !containsString(mw.VaryHeaders, header.Name) {
+				mw.VaryHeaders = append(mw.VaryHeaders, header.Name)
+			}
+		}
+	}
+	if mw.VerificationStages == nil {
+		mw.VerificationStages = DefaultVerificationStages()
+	}
+	if mw.Authorizator == nil {
+		mw.Authorizator = func(userId string, request *rest.Request) bool {
+			return true
+		}
+	}
+	if mw.AcceptedTokenUses == nil {
+		mw.AcceptedTokenUses = []string{TokenUseAccess}
+	}
+
+
+	if mw.Clock == nil {
+		mw.Clock = systemClock{}
+	}
+	if mw.RandReader == nil {
+		mw.RandReader = rand.Reader
+	}
+	if mw.Metrics == nil {
+		mw.Metrics = noopMetrics{}
+	}
+	if mw.MaxCacheEntries == 0 {
+		mw.MaxCacheEntries = 100000
+	}
+	if mw.KeySet != nil && mw.KeySet.Metrics == nil {
+		mw.KeySet.Metrics = mw.Metrics
+	}
+	if mw.PanicHandler == nil {
+		mw.PanicHandler = defaultPanicHandler
+	}
+	if mw.RefreshIdempotencyTTL != 0 && mw.IdempotencyStore == nil {
+		mw.IdempotencyStore = NewMemoryIdempotencyStore()
+	}
+	if mw.MaintenanceScope == "" {
+		mw.MaintenanceScope = "ops"
+	}
+	if mw.MaxLoginAttempts != 0 {
+		if mw.LockoutDuration == 0 {
+			mw.LockoutDuration = 15 * time.Minute
+		}
+		if mw.loginThrottle == nil {
+			mw.loginThrottle = newLoginThrottle()
+		}
+	}
+	if mw.RevocationStore != nil {
+		if mw.RevocationFilterInterval == 0 {
+			mw.RevocationFilterInterval = time.Minute
+		}
+		if mw.revocationFilter == nil {
+			mw.revocationFilter = &revocationFilter{}
+		}
+	}
+	if mw.SecretProvider != nil && mw.Key == nil {
+		if mw.SecretRefreshInterval == 0 {
+			mw.SecretRefreshInterval = 5 * time.Minute
+		}
+		if err := mw.fetchSecretKey(); err != nil {
+			return err
+		}
+	}
+	if mw.keys.Load() == nil {
+		mw.keys.Store(mw.newSigningKeys(mw.Key))
+	}
+	if mw.QuarantineStore == nil {
+		mw.QuarantineStore = NewMemoryQuarantineStore()
+	}
+	if mw.QuarantinePolicy == nil {
+		mw.QuarantinePolicy = QuarantineReadOnly
+	}
+	if mw.IssuanceQuota != 0 {
+		if mw.IssuanceQuotaWindow == 0 {
+			mw.IssuanceQuotaWindow = time.Hour
+		}
+		if mw.QuotaStore == nil {
+			mw.QuotaStore = NewMemoryQuotaStore()
+		}
+	}
+	if mw.LogoutTicketTTL == 0 {
+		mw.LogoutTicketTTL = 5 * time.Minute
+	}
+	if mw.PasswordResetTTL == 0 {
+		mw.PasswordResetTTL = 15 * time.Minute
+	}
+
+	if mw.SuspendedClaim == "" {
+		mw.SuspendedClaim = "suspended"
+	}
+	if mw.EmailVerifiedClaim == "" {
+		mw.EmailVerifiedClaim = "email_verified"
+	}
+	for i := range mw.TemporalPolicies {
+		if mw.TemporalPolicies[i].TimeZoneClaim == "" {
+			mw.TemporalPolicies[i].TimeZoneClaim = "tz"
+		}
+		if mw.TemporalPolicies[i].Location == nil {
+			mw.TemporalPolicies[i].Location = time.UTC
+		}
+	}
+	if mw.scopeTable == nil && (mw.ScopeTable != nil || mw.DenyUnlistedRoutes) {
+		table, err := newScopeTable(mw.ScopeTable)
+		if err != nil {
+			return err
+		}
+		mw.scopeTable = table
+	}
+	if mw.loggedOut == nil {
+		mw.loggedOut = newTTLCache()
+	}
+	if mw.RefreshRateLimit != 0 || mw.RefreshUserRateLimit != 0 {
+		if mw.RefreshRateWindow == 0 {
+			mw.RefreshRateWindow = time.Minute
+		}
+		if mw.QuotaStore == nil {
+			mw.QuotaStore = NewMemoryQuotaStore()
+		}
+	}
+	if mw.InactivityTimeout != 0 {
+		if mw.ActivityUpdateInterval == 0 {
+			mw.ActivityUpdateInterval = mw.InactivityTimeout / 10
+		}
+		if mw.ActivityStore == nil {
+			mw.ActivityStore = NewMemoryActivityStore()
+		}
+	}
+	if mw.OriginalMethodHeader == "" {
+		mw.OriginalMethodHeader = "X-Original-Method"
+	}
+	if mw.OriginalURIHeader == "" {
+		mw.OriginalURIHeader = "X-Original-URI"
+	}
+	if mw.IdentityHeader == "" {
+		mw.IdentityHeader = "X-Auth-User"
+	}
+	if mw.trustedProxies == nil {
+		trustedProxies, err := parseTrustedProxies(mw.TrustedProxies)
+		if err != nil {
+			return err
+		}
+		mw.trustedProxies = trustedProxies
+	}
+	if mw.MaxLoginPayloadSize == 0 {
+		mw.MaxLoginPayloadSize = 4096
+	}
+	if mw.MaxBoundBodySize == 0 {
+		mw.MaxBoundBodySize = 1 << 20
+	}
+	if mw.IdentityHandler == nil {
+		mw.IdentityHandler = defaultIdentityHandler
+	}
+	if mw.ScopesFunc == nil {
+		mw.ScopesFunc = defaultScopesFunc
+	}
+	if mw.GroupMapper != nil {
+		mw.GroupMapper.initDefaults()
+	}
+	if mw.ScopeMatcher == nil {
+		mw.ScopeMatcher = NewScopeMatcher(nil)
+	}
+
+	if mw.LoginCallback == nil {
+		mw.LoginCallback = defaultResponseCallback
+	}
+	if mw.RefreshCallback == nil {
+		mw.RefreshCallback = defaultResponseCallback
+	}
+	if mw.TenantClaim == "" {
+		mw.TenantClaim = "tenant"
+	}
+	if mw.RevokeOnTenantSwitch && mw.RevocationStore == nil {
+		return errors.New("RevocationStore is required for RevokeOnTenantSwitch")
+	}
+	if mw.CORS != nil && len(mw.AllowedOrigins) == 0 {
+		return errors.New("AllowedOrigins are required for CORS")
+	}
+	if mw.AccessTokenProfile {
+		if mw.Issuer == "" || mw.Audience == "" || mw.ClientId == "" {
+			return errors.New("Issuer, Audience and ClientId are required for AccessTokenProfile")
+		}
+		mw.TokenType = accessTokenType
+	}
+	for _, verifier := range mw.AdditionalVerifiers {
+		// verifiers are configured under the lock already held by Init
+		if atomic.LoadUint32(&verifier.initialized) == 1 {
+			continue
+		}
+		if err := verifier.configure(); err != nil {
+			return err
+		}
+		atomic.StoreUint32(&verifier.initialized, 1)
+	}
+	if mw.CanaryFormat != nil {
+		if mw.CanaryFormat.SigningAlgorithm == "" {
+			mw.CanaryFormat.SigningAlgorithm = mw.SigningAlgorithm
+		}
+		if mw.CanaryFormat.Key == nil {
+			return errors.New("Key required for CanaryFormat")
+		}
+	}
+	mw.instrumentCaches()
+	return nil
+}
+
+// initDefaults checks the required fields and fills in the defaults of the optional ones.
+// It is called by MiddlewareFunc and by the handlers, which may be used without the middleware.
+func (mw *JWTMiddleware) initDefaults() {
+	if atomic.LoadUint32(&mw.initialized) == 1 {
+		return
+	}
+	if err := mw.Init(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func defaultResponseCallback(tokenString string, request *rest.Request, writer rest.ResponseWriter) {
+	writer.WriteJson(resultToken{Token:tokenString, WriteToken:ExtractWriteToken(request)})
+}
+
+func defaultPanicHandler(request *rest.Request, recovered interface{}) {
+	log.Printf("%sRecovered panic in JWT middleware handling %s %s: %v\n%s", logPrefix(request), request.Method, request.URL.Path, recovered, debug.Stack())
+}
+
+// recoverPanic turns a recovered panic into a sanitized 500 response, it must be called with the
+// result of recover() from a deferred function.
+func (mw *JWTMiddleware) recoverPanic(writer rest.ResponseWriter, request *rest.Request, recovered interface{}) {
+	mw.Metrics.IncCounter("panics")
+	mw.PanicHandler(request, recovered)
+	rest.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+}
+
+// recoverHandlerPanic is deferred by the handlers to recover their panics.
+func (mw *JWTMiddleware) recoverHandlerPanic(writer rest.ResponseWriter, request *rest.Request) {
+	if recovered := recover(); recovered != nil {
+		mw.recoverPanic(writer, request, recovered)
+	}
+}
+
+// defaultIdentityHandler returns the "id" claim, which is a string or an integer.
+func defaultIdentityHandler(claims map[string]interface{}) (string, error) {
+	id, ok := claimString(claims["id"])
+	if !ok {
+		return "", errors.New("Invalid id claim")
+	}
+	return id, nil
+}
+
+// TokenHeader is a header the default TokenExtractor reads the token from.
+type TokenHeader struct {
+	// Name of the header, e.g. "Authorization".
+	Name string
+
+	// Authentication scheme preceding the token, e.g. "Bearer". Optional, by default the header
+	// contains just the token.
+	Scheme string
+}
+
+// token returns the token of the header value, which must use the scheme of the header.
+func (h TokenHeader) token(value string) (string, bool) {
+	if h.Scheme == "" {
+		return value, true
+	}
+	parts := strings.SplitN(value, " ", 2)
+	if !(len(parts) == 2 && parts[0] == h.Scheme) {
+		return "", false
+	}
+	return parts[1], true
+}
+
+func defaultTokenExtractor(mw *JWTMiddleware) func(request *rest.Request) (string, error) {
+	return func(request *rest.Request) (string, error) {
+		err := errors.New("Auth header empty")
+		for _, header := range mw.TokenHeaders {
+			authHeader := request.Header.Get(header.Name)
+			if authHeader == "" {
+				continue
+			}
+			if token, ok := header.token(authHeader); ok {
+				return token, nil
+			}
+			err = errors.New("Invalid auth header")
+		}
+		return "", err
+	}
+}
+
+func (mw *JWTMiddleware) middlewareImpl(writer rest.ResponseWriter, request *rest.Request, handler rest.HandlerFunc) {
+	if (mw.CORS != nil || mw.PassPreflightRequests) && isPreflight(request) {
+		handler(writer, request)
+		return
+	}
+	if mw.authenticateRequest(writer, request) {
+		mw.markPrivate(writer)
+		handler(writer, request)
+	}
+}
+
+// authenticateRequest verifies and authorizes the request. If it fails, the error response has been
+// written and false is returned. Panics are recovered here rather than in middlewareImpl, so that
+// panics of the wrapped handler are left to the application.
+func (mw *JWTMiddleware) authenticateRequest(writer rest.ResponseWriter, request *rest.Request) (ok bool) {
+	writer = mw.encodeResponses(writer, request)
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			mw.recoverPanic(writer, request, recovered)
+			ok = false
+		}
+	}()
+
+	if mw.Trace {
+		mw.traceRequest(writer, request)
+	}
+
+	id, err := mw.identifyRequest(request)
+
+	if err != nil {
+		mw.unauthorizedError(writer, err)
+		return false
+	}
+
+	if mw.requestRestricted(writer, request) {
+		return false
+	}
+
+	if mw.authorizationOverridden(id, request) {
+		return true
+	}
+
+	authorized, ok := mw.authorize(id, request)
+	if !ok {
+		callbackTimedOut(writer)
+		return false
+	}
+	if !authorized {
+		mw.unauthorized(writer)
+		return false
+	}
+
+	if mw.deniedByChecks(writer, request, mw.AuthorizationChecks) {
+		return false
+	}
+
+	return true
+}
+
+// requestRestricted applies the checks rejecting the requests of identified users before they are
+// authorized, e.g. of suspended accounts or during maintenance. It is shared by the middleware and
+// AuthRequestHandler, so that edge proxies enforce the same restrictions.
+func (mw *JWTMiddleware) requestRestricted(writer rest.ResponseWriter, request *rest.Request) bool {
+	return mw.requestUnavailable(writer, request) ||
+		mw.accountSuspended(writer, request) ||
+		mw.passwordRotationRequired(writer, request) ||
+		mw.consentRequired(writer, request) ||
+		mw.emailVerificationRequired(writer, request) ||
+		mw.outsideSchedule(writer, request) ||
+		mw.quarantineRestricted(writer, request) ||
+		mw.writeTokenRequired(writer, request) ||
+		mw.scopeTableRestricted(writer, request)
+}
+
+// identifyRequest verifies the token of the request and makes the identity of the user and the
+// claims of the token available in request.Env.
+func (mw *JWTMiddleware) identifyRequest(request *rest.Request) (string, error) {
+	mw.sanitizeProxyHeaders(request)
+	mw.stripClaimHeaders(request.Header)
+
+	token, verifier, err := mw.verifyToken(request)
+
+	if err != nil {
+		return "", err
+	}
+
+	id, err := verifier.IdentityHandler(token.Claims)
+
+	if err != nil {
+		return "", err
+	}
+
+	request.Env["REMOTE_USER"] = id
+	if mw.ShareClaims {
+		request.Env["JWT_PAYLOAD"] = token.Claims
+	} else {
+		request.Env["JWT_PAYLOAD"] = copyClaims(token.Claims)
+	}
+	request.Env["JWT_SCOPES"] = verifier.scopes(token.Claims)
+	request.Env["JWT_SCOPE_MATCHER"] = mw.ScopeMatcher
+	request.Env["JWT_TOKEN_ID"] = tokenId(token.Raw)
+	if mw.ExposeRawToken {
+		request.Env[mw.TokenEnvName] = token.Raw
+	}
+	mw.propagateClaims(token.Claims, request.Env, request.Header)
+
+	return id, nil
+}
+
+// scopes returns the scopes granted by claims according to ScopesFunc and GroupMapper.
+func (mw *JWTMiddleware) scopes(claims map[string]interface{}) []string {
+	scopes := mw.ScopesFunc(claims)
+	if mw.GroupMapper != nil {
+		for _, scope := range mw.GroupMapper.Scopes(claims) {
+			if !containsString(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// ExtractClaims allows to retrieve the payload
+func ExtractClaims(request *rest.Request) map[string]interface{} {
+	if request.Env["JWT_PAYLOAD"] == nil {
+		emptyClaims := make(map[string]interface{})
+		return emptyClaims
+	}
+	jwtClaims := request.Env["JWT_PAYLOAD"].(map[string]interface{})
+	return jwtClaims
+}
+
+// ExtractTokenId returns the id of the token of the request, a hash of the token that can be
+// logged to correlate requests without exposing the token itself.
+func ExtractTokenId(request *rest.Request) string {
+	id, _ := request.Env["JWT_TOKEN_ID"].(string)
+	return id
+}
+
+// TokenIdsEqual compares two token ids in constant time, so that looking up stored ids doesn't
+// leak how much of an id matched.
+func TokenIdsEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// storeToken hands a newly issued token to StoreToken.
+func (mw *JWTMiddleware) storeToken(userId, tokenString string) {
+	if mw.StoreToken == nil {
+		return
+	}
+	if mw.HashStoredTokens {
+		tokenString = tokenId(tokenString)
+	}
+	mw.StoreToken(mw.Timeout)(userId, tokenString)
+}
+
+// removeToken hands a replaced token to RemoveToken.
+func (mw *JWTMiddleware) removeToken(userId, tokenString string) {
+	if mw.RemoveToken == nil {
+		return
+	}
+	if mw.HashStoredTokens {
+		tokenString = tokenId(tokenString)
+	}
+	mw.RemoveToken(userId, tokenString)
+}
+
+// tokenId returns the hex encoded sha256 hash of rawToken.
+func tokenId(rawToken string) string {
+	hash := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(hash[:])
+}
+
+// copyClaims returns a deep copy of claims, copying the nested objects and arrays decoded from json.
+func copyClaims(claims map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(claims))
+	for key, value := range claims {
+		copied[key] = copyClaimValue(value)
+	}
+	return copied
+}
+
+func copyClaimValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyClaims(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyClaimValue(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+type resultToken struct {
+	Token      string `json:"token"`
+	WriteToken string `json:"write_token,omitempty"`
+}
+
+type login struct {
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Scope        string `json:"scope"`
+	OTP          string `json:"otp"`
+}
+
+// String keeps the password out of logs and panic messages formatting the login with %v or %+v.
+func (l login) String() string {
+	return fmt.Sprintf("{Username:%s Password:[REDACTED]}", l.Username)
+}
+
+// GoString keeps the password out of logs and panic messages formatting the login with %#v.
+func (l login) GoString() string {
+	return fmt.Sprintf("jwt.login{Username:%q, Password:\"[REDACTED]\"}", l.Username)
+}
+
+// decodeLogin reads at most MaxLoginPayloadSize bytes of login payload into loginVals, e.g. a
+// login or clientCredentials. Payloads that aren't JSON, or whose Content-Length exceeds the
+// limit, are rejected before anything is read. The raw payload, which contains the password in
+// clear text, is zeroed once it is decoded.
+func (mw *JWTMiddleware) decodeLogin(request *rest.Request, loginVals interface{}) (int, error) {
+	defer request.Body.Close()
+	if !jsonMediaType(request.Header.Get("Content-Type")) {
+		return http.StatusUnsupportedMediaType, errors.New("Login payload must be JSON")
+	}
+	if request.ContentLength > mw.MaxLoginPayloadSize {
+		return http.StatusRequestEntityTooLarge, errors.New("Login payload too large")
+	}
+
+	payload, err := readScrubbed(request.Body, mw.MaxLoginPayloadSize, request.ContentLength)
+	defer scrub(payload)
+
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+	if int64(len(payload)) > mw.MaxLoginPayloadSize {
+		return http.StatusRequestEntityTooLarge, errors.New("Login payload too large")
+	}
+	if len(payload) == 0 {
+		return http.StatusUnauthorized, rest.ErrJsonPayloadEmpty
+	}
+	if err := json.Unmarshal(payload, loginVals); err != nil {
+		return http.StatusUnauthorized, err
+	}
+	return http.StatusOK, nil
+}
+
+// readScrubbed reads at most limit+1 bytes of reader into a buffer growing with the data read,
+// starting at the size announced by the Content-Length, if any. Outgrown buffers are zeroed, so
+// that no copy of the data is left behind.
+func readScrubbed(reader io.Reader, limit int64, contentLength int64) ([]byte, error) {
+	size := int64(512)
+	if contentLength >= 0 {
+		size = contentLength + 1
+	}
+	if size > limit+1 {
+		size = limit + 1
+	}
+
+	buffer := make([]byte, 0, size)
+	for {
+		if len(buffer) == cap(buffer) {
+			if int64(len(buffer)) > limit {
+				return buffer, nil
+			}
+			size = 2 * int64(cap(buffer))
+			if size > limit+1 {
+				size = limit + 1
+			}
+			grown := make([]byte, len(buffer), size)
+			copy(grown, buffer)
+			scrub(buffer)
+			buffer = grown
+		}
+		n, err := reader.Read(buffer[len(buffer):cap(buffer)])
+		buffer = buffer[:len(buffer)+n]
+		if err == io.EOF {
+			return buffer, nil
+		}
+		if err != nil {
+			return buffer, err
+		}
+	}
+}
+
+func scrub(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
+
+// jsonMediaType reports whether a Content-Type is JSON, e.g. "application/json; charset=utf-8"
+// or "application/vnd.api+json". Requests without Content-Type are assumed to be JSON.
+func jsonMediaType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// LoginHandler can be used by clients to get a jwt token.
+// Payload needs to be json in the form of {"username": "USERNAME", "password": "PASSWORD"}.
+// Reply will be of the form {"token": "TOKEN"}.
+func (mw *JWTMiddleware) LoginHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
 
-	// Name of the environment variable that holds the token within the rest.Request
-	TokenEnvName string
+	// verifiers don't issue tokens
+	if mw.Authenticator == nil {
+		rest.NotFound(writer, request)
+		return
+	}
 
-	// Functions that return the token to a client, allows customising the output, e.g. return
-	// a cookie instead of json body
-	LoginCallback func(tokenString string, request *rest.Request, writer rest.ResponseWriter)
-	RefreshCallback func(tokenString string, request *rest.Request, writer rest.ResponseWriter)
-}
+	mw.sanitizeProxyHeaders(request)
 
+	if mw.handleCORS(writer, request) {
+		return
+	}
 
-// MiddlewareFunc makes JWTMiddleware implement the Middleware interface.
-func (mw *JWTMiddleware) MiddlewareFunc(handler rest.HandlerFunc) rest.HandlerFunc {
-	if mw.TokenName == "" {
-		mw.TokenName = "Authorization"
+	if mw.loginUnavailable(writer) {
+		return
 	}
-	if mw.TokenEnvName == "" {
-		mw.TokenEnvName = "AUTH_TOKEN"
+
+	if mw.crossSiteRequest(writer, request) {
+		return
 	}
-	if mw.Realm == "" {
-		log.Fatal("Realm is required")
+
+	loginVals := login{}
+	status, err := mw.decodeLogin(request, &loginVals)
+
+	if status == http.StatusRequestEntityTooLarge || status == http.StatusUnsupportedMediaType {
+		rest.Error(writer, err.Error(), status)
+		return
 	}
-	if mw.SigningAlgorithm == "" {
-		mw.SigningAlgorithm = "HS256"
+	if err != nil {
+		mw.unauthorized(writer)
+		return
 	}
-	if mw.Key == nil {
-		log.Fatal("Key required")
+
+	var client *Client
+	if mw.Clients != nil {
+		var ok bool
+		client, ok = mw.authenticateClient(loginVals.ClientId, loginVals.ClientSecret, GrantPassword)
+		loginVals.ClientSecret = ""
+		// users can't take the identity of a client
+		if !ok || strings.HasPrefix(loginVals.Username, ClientSubjectPrefix) {
+			mw.unauthorized(writer)
+			return
+		}
 	}
-	if mw.Timeout == 0 {
-		mw.Timeout = time.Hour
+
+	if mw.MaxLoginAttempts != 0 {
+		if lockedUntil := mw.loginThrottle.lockedUntil(loginVals.Username); mw.Clock.Now().Before(lockedUntil) {
+			mw.loginLocked(writer, lockedUntil)
+			return
+		}
 	}
-	if mw.Authenticator == nil {
-		log.Fatal("Authenticator is required")
+
+	authenticated, ok := mw.authenticate(loginVals.Username, loginVals.Password)
+	// drop the password as soon as it isn't needed anymore
+	loginVals.Password = ""
+
+	var amr []string
+	if ok && authenticated && mw.SecondFactorAuthenticator != nil {
+		amr, authenticated, ok = mw.authenticateSecondFactor(loginVals.Username, loginVals.OTP)
 	}
-	if mw.TokenExtractor == nil {
-		mw.TokenExtractor = defaultTokenExtractor(mw)
+	loginVals.OTP = ""
+
+	if !ok {
+		callbackTimedOut(writer)
+		return
 	}
-	if mw.Authorizator == nil {
-		mw.Authorizator = func(userId string, request *rest.Request) bool {
-			return true
+
+	if !authenticated && mw.MaxLoginAttempts != 0 {
+		remaining, lockedUntil := mw.loginThrottle.fail(loginVals.Username, mw.Clock.Now(), mw.MaxLoginAttempts, mw.LockoutDuration)
+		if remaining == 0 {
+			mw.loginLocked(writer, lockedUntil)
+		} else {
+			mw.loginFailed(writer, remaining)
 		}
+		return
+	}
+	if !authenticated {
+		mw.unauthorized(writer)
+		return
+	}
+	if mw.MaxLoginAttempts != 0 {
+		mw.loginThrottle.reset(loginVals.Username)
 	}
 
-
-	if mw.LoginCallback == nil {
-		mw.LoginCallback = defaultResponseCallback
+	consentClaims, ok := mw.consentScopes(writer, loginVals.Username, client, loginVals.Scope)
+	if !ok {
+		return
 	}
-	if mw.RefreshCallback == nil {
-		mw.RefreshCallback = defaultResponseCallback
+	if amr != nil {
+		consentClaims = mw.authenticationClaims(consentClaims, amr)
 	}
 
-	return func(writer rest.ResponseWriter, request *rest.Request) { mw.middlewareImpl(writer, request, handler) }
+	mw.issueToken(writer, request, loginVals.Username, client, consentClaims)
 }
 
-func defaultResponseCallback(tokenString string, request *rest.Request, writer rest.ResponseWriter) {
-	writer.WriteJson(resultToken{Token:tokenString})
-}
+// issueToken mints a token for an authenticated user, stores it and returns it with
+// LoginCallback. extraClaims are set along with the claims of PayloadFunc.
+func (mw *JWTMiddleware) issueToken(writer rest.ResponseWriter, request *rest.Request, userId string, client *Client, extraClaims map[string]interface{}) {
+	quotaKeys := []string{"user:" + userId}
+	if client != nil {
+		quotaKeys = append(quotaKeys, ClientSubjectPrefix+client.Id)
+	}
+	if mw.quotaExceeded(writer, quotaKeys...) {
+		return
+	}
 
-func defaultTokenExtractor (mw *JWTMiddleware) func(request *rest.Request) (string, error) {
-	return func(request *rest.Request) (string, error) {
-		authHeader := request.Header.Get(mw.TokenName)
+	format := mw.tokenFormat(userId)
+	token := jwt.New(jwt.GetSigningMethod(format.SigningAlgorithm))
 
-		if authHeader == "" {
-			return "", errors.New("Auth header empty")
+	if format.PayloadFunc != nil {
+		for key, value := range format.PayloadFunc(userId) {
+			token.Claims[key] = value
 		}
+	}
+	for key, value := range extraClaims {
+		token.Claims[key] = value
+	}
 
-		parts := strings.SplitN(authHeader, " ", 2)
-		if !(len(parts) == 2 && parts[0] == "Bearer") {
-			return "", errors.New("Invalid auth header")
+	if mw.PasswordExpiryFunc != nil {
+		if pwdExp := mw.PasswordExpiryFunc(userId); !pwdExp.IsZero() {
+			token.Claims["pwd_exp"] = pwdExp.Unix()
 		}
-		return parts[1], nil
 	}
-}
-func (mw *JWTMiddleware) middlewareImpl(writer rest.ResponseWriter, request *rest.Request, handler rest.HandlerFunc) {
-	token, err := mw.parseToken(request)
 
-	if err != nil {
+	if mw.ConsentVersionFunc != nil {
+		token.Claims["consent_version"] = mw.ConsentVersionFunc(userId)
+	}
+
+	token.Claims["id"] = userId
+	token.Claims["token_use"] = TokenUseAccess
+	now := mw.Clock.Now()
+	token.Claims["exp"] = now.Add(mw.Timeout).Unix()
+	token.Claims["iat"] = now.Unix()
+	if mw.MaxRefresh != 0 {
+		token.Claims["orig_iat"] = now.Unix()
+	}
+	if mw.Issuer != "" {
+		token.Claims["iss"] = mw.Issuer
+	}
+	mw.setFingerprint(token, request)
+	if client != nil {
+		mw.setClientClaims(token, client)
+	}
+	if mw.Audience != "" {
+		token.Claims["aud"] = mw.Audience
+	}
+	if mw.AccessTokenProfile {
+		if err := mw.setAccessTokenProfileClaims(token, userId); err != nil {
+			mw.unauthorized(writer)
+			return
+		}
+	}
+	if err := mw.setSessionId(token); err != nil {
 		mw.unauthorized(writer)
 		return
 	}
+	if mw.WriteTokenTimeout != 0 {
+		token.Claims["token_access"] = TokenAccessRead
+	}
 
-	id := token.Claims["id"].(string)
+	if !mw.validIssuedClaims(writer, request, token.Claims) {
+		return
+	}
 
-	request.Env["REMOTE_USER"] = id
-	request.Env["JWT_PAYLOAD"] = token.Claims
-	request.Env[mw.TokenEnvName] = token.Raw
+	tokenString, err := mw.signToken(token, format, userId)
 
-	if !mw.Authorizator(id, request) {
+	if err != nil {
 		mw.unauthorized(writer)
 		return
 	}
 
-	handler(writer, request)
-}
-
-// ExtractClaims allows to retrieve the payload
-func ExtractClaims(request *rest.Request) map[string]interface{} {
-	if request.Env["JWT_PAYLOAD"] == nil {
-		emptyClaims := make(map[string]interface{})
-		return emptyClaims
+	if mw.WriteTokenTimeout != 0 {
+		if err := mw.issueWriteToken(request, token, format, userId); err != nil {
+			mw.unauthorized(writer)
+			return
+		}
 	}
-	jwtClaims := request.Env["JWT_PAYLOAD"].(map[string]interface{})
-	return jwtClaims
+
+	mw.storeToken(userId, tokenString)
+	mw.recordActivity(tokenString)
+	mw.saveSession(userId, token, request)
+
+	mw.exposeIssuedUser(request, userId)
+	mw.LoginCallback(tokenString, request, writer)
 }
 
-type resultToken struct {
-	Token string `json:"token"`
+// verifyToken verifies the token of the request with the VerificationStages, and returns the
+// middleware that accepted it, i.e. this one or one of the AdditionalVerifiers.
+func (mw *JWTMiddleware) verifyToken(request *rest.Request) (*jwt.Token, *JWTMiddleware, error) {
+	state := &VerificationState{Middleware: mw}
+	for _, stage := range mw.VerificationStages {
+		if err := stage.VerifyRequest(request, state); err != nil {
+			return state.Token, state.Verifier, err
+		}
+	}
+	if state.Token == nil || state.Verifier == nil {
+		return nil, nil, ErrTokenNotVerified
+	}
+	return state.Token, state.Verifier, nil
 }
 
-type login struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+// signToken sets the JOSE header fields of a token issued to userId and signs it.
+func (mw *JWTMiddleware) signToken(token *jwt.Token, format *TokenFormat, userId string) (string, error) {
+	if mw.TokenType != "" {
+		token.Header["typ"] = mw.TokenType
+	}
+	if format.KeyId != "" {
+		token.Header["kid"] = format.KeyId
+	}
+	if mw.HeaderFunc != nil {
+		for key, value := range mw.HeaderFunc(userId) {
+			if key != "alg" {
+				token.Header[key] = value
+			}
+		}
+	}
+	return token.SignedString(format.signingKey())
 }
 
-// LoginHandler can be used by clients to get a jwt token.
-// Payload needs to be json in the form of {"username": "USERNAME", "password": "PASSWORD"}.
-// Reply will be of the form {"token": "TOKEN"}.
-func (mw *JWTMiddleware) LoginHandler(writer rest.ResponseWriter, request *rest.Request) {
-	loginVals := login{}
-	err := request.DecodeJsonPayload(&loginVals)
+func (mw *JWTMiddleware) parseToken(request *rest.Request) (*jwt.Token, error) {
+	tokenString, err := mw.extractToken(request)
 
 	if err != nil {
-		mw.unauthorized(writer)
-		return
+		return nil, err
 	}
 
-	if !mw.Authenticator(loginVals.Username, loginVals.Password) {
-		mw.unauthorized(writer)
-		return
+	return mw.parseTokenString(tokenString)
+}
+
+// parseTokenString verifies the signature and the claims of a token.
+func (mw *JWTMiddleware) parseTokenString(tokenString string) (*jwt.Token, error) {
+	token, err := mw.parseSignedToken(tokenString)
+	if err != nil {
+		return token, err
 	}
+	return token, mw.validateClaims(token)
+}
 
-	token := jwt.New(jwt.GetSigningMethod(mw.SigningAlgorithm))
+// parseWithVerifiers verifies the signature of a token with this middleware, or else with the
+// AdditionalVerifiers, and returns the middleware that accepted it.
+func (mw *JWTMiddleware) parseWithVerifiers(tokenString string) (*jwt.Token, *JWTMiddleware, error) {
+	token, err := mw.parseSignedToken(tokenString)
+	if err == nil {
+		return token, mw, nil
+	}
+	for _, verifier := range mw.AdditionalVerifiers {
+		if verifiedToken, verifierErr := verifier.parseSignedToken(tokenString); verifierErr == nil {
+			return verifiedToken, verifier, nil
+		}
+	}
+	return token, nil, err
+}
 
-	if mw.PayloadFunc != nil {
-		for key, value := range mw.PayloadFunc(loginVals.Username) {
-			token.Claims[key] = value
+// parseSignedToken verifies the signature of a token issued in the default or the canary format,
+// or signed with the secret replaced by the last rotation, and its exp and nbf claims, and
+// migrates its claims.
+func (mw *JWTMiddleware) parseSignedToken(tokenString string) (*jwt.Token, error) {
+	token, err := mw.parseWithFormat(tokenString, mw.defaultTokenFormat())
+	if err != nil && !isSignatureVerified(err) {
+		if format := mw.previousTokenFormat(); format != nil {
+			if previousToken, previousErr := mw.parseWithFormat(tokenString, format); previousErr == nil || isSignatureVerified(previousErr) {
+				token, err = previousToken, previousErr
+			}
+		}
+	}
+	if err != nil && mw.CanaryFormat != nil && !isSignatureVerified(err) {
+		// the token may have been issued in the canary format
+		if canaryToken, canaryErr := mw.parseWithFormat(tokenString, mw.CanaryFormat); canaryErr == nil || isSignatureVerified(canaryErr) {
+			token, err = canaryToken, canaryErr
 		}
 	}
+	if err == nil {
+		mw.migrateClaims(token)
+	}
+	return token, err
+}
 
-	token.Claims["id"] = loginVals.Username
-	token.Claims["exp"] = time.Now().Add(mw.Timeout).Unix()
-	if mw.MaxRefresh != 0 {
-		token.Claims["orig_iat"] = time.Now().Unix()
+// checkRequiredTimes rejects tokens without "exp" claim, or without "iat" claim and "orig_iat"
+// claim, which tokens issued before "iat" was set carry instead, unless AllowMissingExpiration is
+// set.
+func (mw *JWTMiddleware) checkRequiredTimes(claims map[string]interface{}) error {
+	if mw.AllowMissingExpiration {
+		return nil
 	}
-	tokenString, err := token.SignedString(mw.Key)
+	if _, ok := claims["exp"]; !ok {
+		return ErrMissingExpiration
+	}
+	if _, ok := claims["iat"]; !ok {
+		if _, ok := claims["orig_iat"]; !ok {
+			return ErrMissingIssuedAt
+		}
+	}
+	return nil
+}
 
-	if err != nil {
-		mw.unauthorized(writer)
-		return
+// validateClaims checks the claims of a token whose signature has been verified.
+func (mw *JWTMiddleware) validateClaims(token *jwt.Token) error {
+	if err := mw.checkRequiredTimes(token.Claims); err != nil {
+		return err
+	}
+	if !mw.validTokenUse(token.Claims) {
+		return ErrInvalidTokenUse
+	}
+	if mw.Issuer != "" && token.Claims["iss"] != mw.Issuer {
+		return ErrInvalidIssuer
+	}
+	if mw.Audience != "" && !hasAudience(token.Claims, mw.Audience) {
+		return ErrInvalidAudience
+	}
+	if mw.AccessTokenProfile && !isAccessTokenProfile(token) {
+		return ErrInvalidClaims
+	}
+	if mw.ClaimsValidator != nil && mw.ClaimsValidator(token.Claims) != nil {
+		return ErrInvalidClaims
 	}
+	return nil
+}
 
-	if mw.StoreToken != nil {
-		mw.StoreToken(mw.Timeout)(loginVals.Username, tokenString)
+// hasAudience reports whether the "aud" claim, which is either a string or an array of strings,
+// contains audience.
+func hasAudience(claims map[string]interface{}, audience string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	mw.LoginCallback(tokenString, request, writer)
+// validIssuedClaims runs ClaimsValidator on the claims of a token that is about to be issued. An
+// invalid token is a server side bug, so the error is logged and answered with a 500.
+func (mw *JWTMiddleware) validIssuedClaims(writer rest.ResponseWriter, request *rest.Request, claims map[string]interface{}) bool {
+	if mw.ClaimsValidator == nil {
+		return true
+	}
+	if err := mw.ClaimsValidator(claims); err != nil {
+		log.Printf("%sRefusing to issue token with invalid claims: %v", logPrefix(request), err)
+		rest.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	return true
 }
 
-func (mw *JWTMiddleware) parseToken(request *rest.Request) (*jwt.Token, error) {
-	tokenString, err := mw.TokenExtractor(request)
+// parseWithFormat parses and verifies a token of the given format. The exp and nbf claims are
+// checked against Clock rather than by jwt-go, which always uses the system time, and must be
+// numeric dates as required by RFC 7519.
+// Valid tokens signed with Key by an HMAC algorithm take the faster path of hmacVerifier.
+func (mw *JWTMiddleware) parseWithFormat(tokenString string, format *TokenFormat) (*jwt.Token, error) {
+	var token *jwt.Token
+	verified := false
+	if hmacVerifier := mw.signingKeys().hmacVerifier; hmacVerifier.handles(format) {
+		token, verified = hmacVerifier.parse(tokenString)
+	}
+	if !verified {
+		var err error
+		parser := &jwt.Parser{UseJSONNumber: mw.UseJSONNumber}
+		token, err = parser.Parse(tokenString, mw.keyFunc(format))
+		if err != nil && !isSignatureVerified(err) {
+			return token, err
+		}
+	}
 
-	if(err != nil) {
-		return nil, err
+	// compare as float64, converting exp values beyond the range of int64 is undefined
+	now := float64(mw.Clock.Now().Unix())
+	validationErr := &jwt.ValidationError{}
+	if exp, ok := token.Claims["exp"]; ok {
+		if exp, ok := numericValue(exp); !ok {
+			validationErr.Errors |= jwt.ValidationErrorMalformed
+		} else if now > exp {
+			validationErr.Errors |= jwt.ValidationErrorExpired
+		}
+	}
+	if nbf, ok := token.Claims["nbf"]; ok {
+		if nbf, ok := numericValue(nbf); !ok {
+			validationErr.Errors |= jwt.ValidationErrorMalformed
+		} else if now < nbf {
+			validationErr.Errors |= jwt.ValidationErrorNotValidYet
+		}
+	}
+	if validationErr.Errors != 0 {
+		token.Valid = false
+		return token, validationErr
 	}
 
+	token.Valid = true
+	return token, nil
+}
 
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if jwt.GetSigningMethod(mw.SigningAlgorithm) != token.Method {
+func (mw *JWTMiddleware) keyFunc(format *TokenFormat) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if jwt.GetSigningMethod(format.SigningAlgorithm) != token.Method {
 			return nil, errors.New("Invalid signing algorithm")
 		}
-		return mw.Key, nil
-	})
+		if _, publicKey := format.parsedKeys(); publicKey != nil {
+			return publicKey, nil
+		}
+		if format.Key == nil && mw.KeySet != nil {
+			kid, _ := token.Header["kid"].(string)
+			return mw.KeySet.Key(kid)
+		}
+		return format.Key, nil
+	}
+}
+
+// isSignatureVerified reports whether a parse error happened after the signature of the token
+// was checked successfully, e.g. because the token is expired.
+func isSignatureVerified(err error) bool {
+	validationErr, ok := err.(*jwt.ValidationError)
+	if !ok {
+		return false
+	}
+	return validationErr.Errors&(jwt.ValidationErrorMalformed|jwt.ValidationErrorUnverifiable|jwt.ValidationErrorSignatureInvalid) == 0
+}
+
+func (mw *JWTMiddleware) defaultTokenFormat() *TokenFormat {
+	keys := mw.signingKeys()
+	return &TokenFormat{
+		SigningAlgorithm: mw.SigningAlgorithm,
+		Key:              keys.key,
+		KeyId:            mw.KeyId,
+		PayloadFunc:      mw.PayloadFunc,
+		privateKey:       keys.privateKey,
+		publicKey:        keys.publicKey,
+	}
+}
+
+// previousTokenFormat returns the default format with the key replaced by the last rotation of
+// the secret, or nil if there is none or it is no longer accepted.
+func (mw *JWTMiddleware) previousTokenFormat() *TokenFormat {
+	keys := mw.signingKeys()
+	if keys.previous == nil || !mw.Clock.Now().Before(keys.previousUntil) {
+		return nil
+	}
+	return &TokenFormat{
+		SigningAlgorithm: mw.SigningAlgorithm,
+		Key:              keys.previous.key,
+		KeyId:            mw.KeyId,
+		PayloadFunc:      mw.PayloadFunc,
+		privateKey:       keys.previous.privateKey,
+		publicKey:        keys.previous.publicKey,
+	}
+}
+
+// tokenFormat returns the format of the tokens issued to userId.
+func (mw *JWTMiddleware) tokenFormat(userId string) *TokenFormat {
+	if mw.CanaryFormat == nil {
+		return mw.defaultTokenFormat()
+	}
+	for _, canaryUser := range mw.CanaryUsers {
+		if canaryUser == userId {
+			return mw.CanaryFormat
+		}
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(userId))
+	if int(hash.Sum32()%100) < mw.CanaryPercentage {
+		return mw.CanaryFormat
+	}
+	return mw.defaultTokenFormat()
 }
 
 // RefreshHandler can be used to refresh a token. The token still needs to be valid on refresh.
 // Shall be put under an endpoint that is using the JWTMiddleware.
 // Reply will be of the form {"token": "TOKEN"}.
 func (mw *JWTMiddleware) RefreshHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	if mw.handleCORS(writer, request) {
+		return
+	}
+
+	if mw.crossSiteRequest(writer, request) {
+		return
+	}
+
 	token, err := mw.parseToken(request)
 
 	// Token should be valid anyway as the RefreshHandler is authed
 	if err != nil {
+		mw.unauthorizedError(writer, err)
+		return
+	}
+
+	if mw.refreshRateLimited(writer, token) {
+		return
+	}
+
+	idempotencyKey := ""
+	if mw.RefreshIdempotencyTTL != 0 && request.Header.Get("Idempotency-Key") != "" {
+		idempotencyKey = idempotencyStoreKey(request.Header.Get("Idempotency-Key"), token.Raw)
+		if tokenString, ok := mw.IdempotencyStore.Get(idempotencyKey); ok {
+			if userId, err := mw.IdentityHandler(token.Claims); err == nil {
+				mw.exposeIssuedUser(request, userId)
+			}
+			mw.RefreshCallback(tokenString, request, writer)
+			return
+		}
+	}
+
+	origIatClaim, ok := GetTime(token.Claims, "orig_iat")
+	// write tokens are only issued at login
+	if !ok || token.Claims["token_access"] == TokenAccessWrite {
 		mw.unauthorized(writer)
 		return
 	}
+	origIat := origIatClaim.Unix()
+
+	client, hasClient := mw.tokenClient(token.Claims)
+	maxRefresh := mw.MaxRefresh
+	if mw.MaxRefreshFunc != nil {
+		maxRefresh = mw.MaxRefreshFunc(token.Claims)
+	}
+	if hasClient && client.MaxRefresh != 0 {
+		maxRefresh = client.MaxRefresh
+	}
+	refreshCount, _ := GetInt64(token.Claims, "refresh_count")
+
+	if origIat < mw.Clock.Now().Add(-maxRefresh).Unix() || (mw.MaxRefreshCount != 0 && int(refreshCount) >= mw.MaxRefreshCount) {
+		mw.challenge(writer, "")
+		errorWithCode(writer, "Token can't be refreshed anymore", "refresh_exhausted", http.StatusUnauthorized)
+		return
+	}
 
-	origIat := int64(token.Claims["orig_iat"].(float64))
+	userId, err := mw.IdentityHandler(token.Claims)
 
-	if origIat < time.Now().Add(-mw.MaxRefresh).Unix() {
+	if err != nil {
 		mw.unauthorized(writer)
 		return
 	}
 
-	newToken := jwt.New(jwt.GetSigningMethod(mw.SigningAlgorithm))
+	format := mw.tokenFormat(userId)
+	newToken := jwt.New(jwt.GetSigningMethod(format.SigningAlgorithm))
 
 	for key := range token.Claims {
 		newToken.Claims[key] = token.Claims[key]
 	}
 
-	newToken.Claims["id"] = token.Claims["id"]
-	newToken.Claims["exp"] = time.Now().Add(mw.Timeout).Unix()
+	newToken.Claims["exp"] = mw.Clock.Now().Add(mw.Timeout).Unix()
+	if hasClient && client.Timeout != 0 {
+		newToken.Claims["exp"] = mw.Clock.Now().Add(client.Timeout).Unix()
+	}
 	newToken.Claims["orig_iat"] = origIat
-	tokenString, err := newToken.SignedString(mw.Key)
+	if mw.MaxRefreshCount != 0 {
+		newToken.Claims["refresh_count"] = int(refreshCount) + 1
+	}
+	newToken.Claims["token_use"] = TokenUseAccess
+	mw.setFingerprint(newToken, request)
+	if mw.AccessTokenProfile {
+		if err := mw.setAccessTokenProfileClaims(newToken, userId); err != nil {
+			mw.unauthorized(writer)
+			return
+		}
+	}
+
+	if !mw.validIssuedClaims(writer, request, newToken.Claims) {
+		return
+	}
+
+	tokenString, err := mw.signToken(newToken, format, userId)
 
 	if err != nil {
 		mw.unauthorized(writer)
 		return
 	}
 
-	userId := newToken.Claims["id"].(string)
+	mw.storeToken(userId, tokenString)
+	mw.recordActivity(tokenString)
+	mw.saveSession(userId, newToken, request)
 
-	if mw.StoreToken != nil {
-		mw.StoreToken(mw.Timeout)(userId, tokenString)
-	}
+	mw.removeToken(userId, token.Raw)
 
-	if mw.RemoveToken != nil {
-		mw.RemoveToken(userId, token.Raw)
+	if idempotencyKey != "" {
+		mw.IdempotencyStore.Set(idempotencyKey, tokenString, mw.RefreshIdempotencyTTL)
 	}
 
+	mw.exposeIssuedUser(request, userId)
 	mw.RefreshCallback(tokenString, request, writer)
 }
 
-func (mw *JWTMiddleware) unauthorized(writer rest.ResponseWriter) {
-	writer.Header().Set("WWW-Authenticate", "JWT realm="+mw.Realm)
-	rest.Error(writer, "Not Authorized", http.StatusUnauthorized)
+// VerifyHandler can be used to check the validity of a token without running any business handler,
+// e.g. by single page applications on startup, or by gateways for auth subrequests. The token is
+// verified like the middleware does, without calling the Authorizator.
+// It doesn't need to be put under an endpoint that is using the JWTMiddleware.
+// Reply will be a 204 with the X-Token-Expires header set to the expiry of the token as unix
+// timestamp and X-Token-Expires-In to its remaining validity in seconds, a 401, or a 403 if the
+// account of the user is suspended.
+func (mw *JWTMiddleware) VerifyHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	token, verifier, err := mw.verifyToken(request)
+
+	if err != nil {
+		mw.unauthorizedError(writer, err)
+		return
+	}
+
+	id, err := verifier.IdentityHandler(token.Claims)
+	if err != nil {
+		mw.unauthorized(writer)
+		return
+	}
+
+	if mw.suspended(id, token.Claims) {
+		mw.Metrics.IncCounter("suspended_requests")
+		errorWithCode(writer, errAccountSuspended.Message, errAccountSuspended.Code, http.StatusForbidden)
+		return
+	}
+
+	writer.Header().Set("Cache-Control", "no-store")
+	if exp, ok := GetTime(token.Claims, "exp"); ok {
+		writer.Header().Set("X-Token-Expires", strconv.FormatInt(exp.Unix(), 10))
+		writer.Header().Set("X-Token-Expires-In", strconv.FormatInt(exp.Unix()-mw.Clock.Now().Unix(), 10))
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// AuthRequestHandler lets the middleware act as authentication service for subrequests of edge
+// proxies, e.g. nginx auth_request or Envoy ext_authz. The method and URI of the original request
+// are taken from OriginalMethodHeader and OriginalURIHeader, the token is verified and the original
+// request goes through the same checks as in the middleware, e.g. suspension, maintenance and
+// scopes, before the Authorizator and the AuthorizationChecks are called with it.
+// Reply will be a 200 with the userId in IdentityHeader, a 401 if the token is invalid or a 403 if
+// the Authorizator denies the original request, or the status of the check rejecting it.
+func (mw *JWTMiddleware) AuthRequestHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	if method := request.Header.Get(mw.OriginalMethodHeader); method != "" {
+		request.Method = method
+	}
+	if uri := request.Header.Get(mw.OriginalURIHeader); uri != "" {
+		originalURL, err := url.ParseRequestURI(uri)
+		if err != nil {
+			rest.Error(writer, "Invalid original URI", http.StatusBadRequest)
+			return
+		}
+		request.URL = request.URL.ResolveReference(originalURL)
+	}
+
+	id, err := mw.identifyRequest(request)
+
+	if err != nil {
+		mw.unauthorizedError(writer, err)
+		return
+	}
+
+	if mw.requestRestricted(writer, request) {
+		return
+	}
+
+	if !mw.authorizationOverridden(id, request) {
+		authorized, ok := mw.authorize(id, request)
+		if !ok {
+			callbackTimedOut(writer)
+			return
+		}
+		if !authorized {
+			rest.Error(writer, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if mw.deniedByChecks(writer, request, mw.AuthorizationChecks) {
+			return
+		}
+	}
+
+	writer.Header().Set(mw.IdentityHeader, id)
+	mw.propagateClaims(ExtractClaims(request), map[string]interface{}{}, writer.Header())
+	writer.WriteHeader(http.StatusOK)
+}
+
+// errorWithCode is like rest.Error, but adds a machine readable error code to the response.
+func errorWithCode(writer rest.ResponseWriter, error string, code string, status int) {
+	writer.WriteHeader(status)
+	writer.WriteJson(map[string]string{"Error": error, "code": code})
 }
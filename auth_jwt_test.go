@@ -1,6 +1,14 @@
 package jwt
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -112,6 +120,7 @@ func TestAuthJWT(t *testing.T) {
 	tokenBadSigning := jwt.New(jwt.GetSigningMethod("HS384"))
 	tokenBadSigning.Claims["id"] = "admin"
 	tokenBadSigning.Claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+	tokenBadSigning.Claims["iat"] = time.Now().Unix()
 	tokenBadSigningString, _ := tokenBadSigning.SignedString(key)
 
 	BadSigningReq := test.MakeSimpleRequest("GET", "http://localhost/", nil)
@@ -174,7 +183,7 @@ func TestAuthJWT(t *testing.T) {
 	})
 
 	if err != nil {
-		t.Errorf("Received new token with wrong signature", err)
+		t.Errorf("Received new token with wrong signature: %v", err)
 	}
 
 	if newToken.Claims["id"].(string) != "admin" ||
@@ -222,7 +231,7 @@ func TestAuthJWT(t *testing.T) {
 	})
 
 	if err != nil {
-		t.Errorf("Received refreshed token with wrong signature", err)
+		t.Errorf("Received refreshed token with wrong signature: %v", err)
 	}
 
 	if refreshToken.Claims["id"].(string) != "admin" ||
@@ -269,7 +278,7 @@ func TestAuthJWTPayload(t *testing.T) {
 	})
 
 	if err != nil {
-		t.Errorf("Received new token with wrong signature", err)
+		t.Errorf("Received new token with wrong signature: %v", err)
 	}
 
 	if newToken.Claims["testkey"].(string) != "testval" || newToken.Claims["exp"].(float64) == 0 {
@@ -301,7 +310,7 @@ func TestAuthJWTPayload(t *testing.T) {
 	})
 
 	if err != nil {
-		t.Errorf("Received refreshed token with wrong signature", err)
+		t.Errorf("Received refreshed token with wrong signature: %v", err)
 	}
 
 	if refreshToken.Claims["testkey"].(string) != "testval" {
@@ -403,3 +412,825 @@ func TestClaimsDuringAuthorization(t *testing.T) {
 	recorded.CodeIs(200)
 	recorded.ContentTypeIsJson()
 }
+
+func TestCanaryTokenFormat(t *testing.T) {
+	canaryKey := []byte("canary key")
+
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		CanaryFormat: &TokenFormat{
+			SigningAlgorithm: "HS512",
+			Key:              canaryKey,
+			PayloadFunc: func(userId string) map[string]interface{} {
+				return map[string]interface{}{"schema": 2}
+			},
+		},
+		CanaryUsers: []string{"canary"},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+
+	verifyApi := rest.NewApi()
+	verifyApi.Use(authMiddleware)
+	verifyApi.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"user": r.Env["REMOTE_USER"].(string)})
+	}))
+
+	login := func(username string) string {
+		loginCreds := map[string]string{"username": username, "password": "secret"}
+		recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+		recorded.CodeIs(200)
+
+		nToken := DecoderToken{}
+		test.DecodeJsonPayload(recorded.Recorder, &nToken)
+		return nToken.Token
+	}
+
+	// canary users get the canary format
+	canaryToken, err := jwt.Parse(login("canary"), func(token *jwt.Token) (interface{}, error) {
+		return canaryKey, nil
+	})
+	if err != nil {
+		t.Fatalf("Received canary token with wrong signature: %v", err)
+	}
+	if canaryToken.Method.Alg() != "HS512" || canaryToken.Claims["schema"].(float64) != 2 {
+		t.Errorf("Received canary token in the wrong format")
+	}
+
+	// everybody else keeps the regular format
+	regularToken, err := jwt.Parse(login("admin"), func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	if err != nil {
+		t.Fatalf("Received regular token with wrong signature: %v", err)
+	}
+	if regularToken.Method.Alg() != "HS256" || regularToken.Claims["schema"] != nil {
+		t.Errorf("Received regular token in the wrong format")
+	}
+
+	// both formats are accepted side by side
+	for _, tokenString := range []string{canaryToken.Raw, regularToken.Raw} {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		recorded := test.RunRequest(t, verifyApi.MakeHandler(), req)
+		recorded.CodeIs(200)
+	}
+
+	// everybody gets the canary format at 100%
+	authMiddleware.CanaryUsers = nil
+	authMiddleware.CanaryPercentage = 100
+	percentageToken, _ := jwt.Parse(login("admin"), func(token *jwt.Token) (interface{}, error) {
+		return canaryKey, nil
+	})
+	if !percentageToken.Valid || percentageToken.Method.Alg() != "HS512" {
+		t.Errorf("Received token in the wrong format with CanaryPercentage 100")
+	}
+}
+
+func TestClaimsValidator(t *testing.T) {
+	validator := func(claims map[string]interface{}) error {
+		if _, ok := claims["role"].(string); !ok {
+			return errors.New("role must be a string")
+		}
+		return nil
+	}
+
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		PayloadFunc: func(userId string) map[string]interface{} {
+			if userId == "broken" {
+				return map[string]interface{}{"role": 42}
+			}
+			return map[string]interface{}{"role": "user"}
+		},
+		ClaimsValidator: validator,
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+
+	// valid payload is issued
+	loginCreds := map[string]string{"username": "admin", "password": "admin"}
+	recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	recorded.CodeIs(200)
+	recorded.ContentTypeIsJson()
+
+	// malformed payload is never issued
+	brokenCreds := map[string]string{"username": "broken", "password": "admin"}
+	recorded = test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", brokenCreds))
+	recorded.CodeIs(500)
+	recorded.ContentTypeIsJson()
+
+	// validly signed token violating the schema is rejected
+	invalidToken := jwt.New(jwt.GetSigningMethod("HS256"))
+	invalidToken.Claims["id"] = "admin"
+	invalidToken.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	invalidToken.Claims["iat"] = time.Now().Unix()
+	invalidToken.Claims["role"] = []string{"admin"}
+	tokenString, _ := invalidToken.SignedString(key)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	_, err := authMiddleware.parseToken(&rest.Request{Request: req, Env: map[string]interface{}{}})
+	if err != ErrInvalidClaims {
+		t.Errorf("Expected ErrInvalidClaims, got %v", err)
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		t.Error("Should never be executed")
+	}))
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(401)
+	recorded.ContentTypeIsJson()
+}
+
+func TestIdentityHandler(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		IdentityHandler: func(claims map[string]interface{}) (string, error) {
+			email, ok := claims["email"].(string)
+			if !ok {
+				return "", errors.New("email claim missing")
+			}
+			return email, nil
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"user": r.Env["REMOTE_USER"].(string)})
+	}))
+
+	// identity is derived from the email claim
+	emailToken := jwt.New(jwt.GetSigningMethod("HS256"))
+	emailToken.Claims["email"] = "admin@example.com"
+	emailToken.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	emailToken.Claims["iat"] = time.Now().Unix()
+	tokenString, _ := emailToken.SignedString(key)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+
+	payload := map[string]string{}
+	test.DecodeJsonPayload(recorded.Recorder, &payload)
+	if payload["user"] != "admin@example.com" {
+		t.Errorf("REMOTE_USER is expected to be 'admin@example.com', got %q", payload["user"])
+	}
+
+	// tokens the identity can't be derived from are rejected
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(401)
+	recorded.ContentTypeIsJson()
+}
+
+func TestLoginPayload(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:               "test zone",
+		Key:                 key,
+		MaxLoginPayloadSize: 128,
+		Authenticator: func(userId string, password string) bool {
+			return userId == "admin" && password == "admin"
+		},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+
+	// payload within the limit
+	loginCreds := map[string]string{"username": "admin", "password": "admin"}
+	recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	recorded.CodeIs(200)
+
+	// payload above the limit
+	hugeCreds := map[string]string{"username": "admin", "password": strings.Repeat("x", 256)}
+	recorded = test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", hugeCreds))
+	recorded.CodeIs(413)
+	recorded.ContentTypeIsJson()
+
+	// payload announced above the limit isn't read
+	req, _ := http.NewRequest("POST", "http://localhost/", unreadableBody{})
+	req.ContentLength = 1 << 30
+	recorded = test.RunRequest(t, loginApi.MakeHandler(), req)
+	recorded.CodeIs(413)
+
+	// payload of unknown length above the limit
+	req, _ = http.NewRequest("POST", "http://localhost/", strings.NewReader(`{"username":"admin","password":"`+strings.Repeat("x", 256)+`"}`))
+	req.ContentLength = -1
+	recorded = test.RunRequest(t, loginApi.MakeHandler(), req)
+	recorded.CodeIs(413)
+
+	// payload that isn't JSON
+	req, _ = http.NewRequest("POST", "http://localhost/", strings.NewReader("username=admin&password=admin"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorded = test.RunRequest(t, loginApi.MakeHandler(), req)
+	recorded.CodeIs(415)
+	recorded.BodyIs(`{"Error":"Login payload must be JSON"}`)
+	req, _ = http.NewRequest("POST", "http://localhost/", strings.NewReader(`{"username":"admin","password":"admin"}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	test.RunRequest(t, loginApi.MakeHandler(), req).CodeIs(200)
+
+	// password never shows up when a login is formatted
+	loginVals := login{Username: "admin", Password: "hunter2"}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if formatted := fmt.Sprintf(format, loginVals); strings.Contains(formatted, "hunter2") {
+			t.Errorf("Password leaked by %s: %s", format, formatted)
+		}
+	}
+}
+
+// unreadableBody fails the test reading it.
+type unreadableBody struct{}
+
+func (unreadableBody) Read(p []byte) (int, error) {
+	panic("The body shouldn't be read")
+}
+
+func TestReadScrubbed(t *testing.T) {
+	data := strings.Repeat("x", 3000)
+	payload, err := readScrubbed(strings.NewReader(data), 4096, -1)
+	if err != nil || string(payload) != data {
+		t.Errorf("The payload should be read whole, got %d bytes and %v", len(payload), err)
+	}
+	payload, _ = readScrubbed(strings.NewReader(data), 1000, -1)
+	if len(payload) != 1001 {
+		t.Errorf("At most limit+1 bytes should be read, got %d", len(payload))
+	}
+	payload, _ = readScrubbed(strings.NewReader(data), 4096, 3000)
+	if cap(payload) != 3001 {
+		t.Errorf("The buffer should be sized by the Content-Length, got %d", cap(payload))
+	}
+}
+
+type countingMetrics struct {
+	mutex    sync.Mutex
+	counters map[string]int
+	gauges   map[string]float64
+}
+
+func newCountingMetrics() *countingMetrics {
+	return &countingMetrics{counters: map[string]int{}, gauges: map[string]float64{}}
+}
+
+func (m *countingMetrics) IncCounter(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.counters[name]++
+}
+
+func (m *countingMetrics) SetGauge(name string, value float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.gauges[name] = value
+}
+
+func (m *countingMetrics) counter(name string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.counters[name]
+}
+
+func (m *countingMetrics) gauge(name string) (float64, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	value, ok := m.gauges[name]
+	return value, ok
+}
+
+func TestPanicRecovery(t *testing.T) {
+	metrics := newCountingMetrics()
+	var recoveredValues []interface{}
+
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			panic("authenticator failed for " + userId)
+		},
+		Authorizator: func(userId string, request *rest.Request) bool {
+			panic("authorizator failed")
+		},
+		Metrics: metrics,
+		PanicHandler: func(request *rest.Request, recovered interface{}) {
+			recoveredValues = append(recoveredValues, recovered)
+		},
+	}
+
+	// panicking Authenticator
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	loginCreds := map[string]string{"username": "admin", "password": "admin"}
+	recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	recorded.CodeIs(500)
+	recorded.ContentTypeIsJson()
+	recorded.BodyIs(`{"Error":"Internal Server Error"}`)
+
+	// panicking Authorizator
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		t.Error("Should never be executed")
+	}))
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(500)
+	recorded.ContentTypeIsJson()
+
+	if len(recoveredValues) != 2 || recoveredValues[0] != "authenticator failed for admin" {
+		t.Errorf("Unexpected recovered values %v", recoveredValues)
+	}
+	if metrics.counter("panics") != 2 {
+		t.Errorf("Expected 2 panics to be counted, got %d", metrics.counter("panics"))
+	}
+}
+
+func TestClaimsCopy(t *testing.T) {
+	claims := map[string]interface{}{
+		"id":    "admin",
+		"roles": []interface{}{"user", map[string]interface{}{"org": "acme"}},
+		"org":   map[string]interface{}{"id": "acme"},
+	}
+
+	copied := copyClaims(claims)
+	copied["id"] = "root"
+	copied["roles"].([]interface{})[0] = "admin"
+	copied["roles"].([]interface{})[1].(map[string]interface{})["org"] = "evil"
+	copied["org"].(map[string]interface{})["id"] = "evil"
+
+	if claims["id"] != "admin" ||
+		claims["roles"].([]interface{})[0] != "user" ||
+		claims["roles"].([]interface{})[1].(map[string]interface{})["org"] != "acme" ||
+		claims["org"].(map[string]interface{})["id"] != "acme" {
+		t.Errorf("Mutating the copy changed the original claims: %v", claims)
+	}
+
+	// handlers get their own copy unless ShareClaims is set
+	for _, shareClaims := range []bool{false, true} {
+		var authorizatorClaims map[string]interface{}
+
+		authMiddleware := &JWTMiddleware{
+			Realm: "test zone",
+			Key:   key,
+			Authenticator: func(userId string, password string) bool {
+				return true
+			},
+			Authorizator: func(userId string, request *rest.Request) bool {
+				authorizatorClaims = ExtractClaims(request)
+				return true
+			},
+			ShareClaims: shareClaims,
+		}
+
+		api := rest.NewApi()
+		api.Use(authMiddleware)
+		api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+			ExtractClaims(r)["id"] = "root"
+			w.WriteJson(map[string]string{"Id": "123"})
+		}))
+
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+		recorded := test.RunRequest(t, api.MakeHandler(), req)
+		recorded.CodeIs(200)
+
+		if authorizatorClaims["id"] != "root" {
+			t.Errorf("Authorizator and handler should see the same payload")
+		}
+	}
+}
+
+func TestTokenHeader(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:     "test zone",
+		Key:       key,
+		KeyId:     "key-2024",
+		TokenType: "at+jwt",
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		HeaderFunc: func(userId string) map[string]interface{} {
+			return map[string]interface{}{"cty": "custom", "alg": "none"}
+		},
+		CanaryFormat: &TokenFormat{Key: []byte("canary key"), KeyId: "canary-2024"},
+		CanaryUsers:  []string{"canary"},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+
+	for username, kid := range map[string]string{"admin": "key-2024", "canary": "canary-2024"} {
+		loginCreds := map[string]string{"username": username, "password": "admin"}
+		recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+		recorded.CodeIs(200)
+
+		nToken := DecoderToken{}
+		test.DecodeJsonPayload(recorded.Recorder, &nToken)
+		token, _ := jwt.Parse(nToken.Token, func(token *jwt.Token) (interface{}, error) {
+			return nil, nil
+		})
+
+		if token.Header["kid"] != kid || token.Header["typ"] != "at+jwt" || token.Header["cty"] != "custom" || token.Header["alg"] != "HS256" {
+			t.Errorf("Received token with wrong header %v", token.Header)
+		}
+	}
+}
+
+func TestVerifyHandler(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		Authorizator: func(userId string, request *rest.Request) bool {
+			t.Error("Authorizator should not be called")
+			return false
+		},
+	}
+
+	verifyApi := rest.NewApi()
+	verifyApi.SetApp(rest.AppSimple(authMiddleware.VerifyHandler))
+
+	// valid token
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "admin"
+	exp := time.Now().Add(time.Hour).Unix()
+	token.Claims["exp"] = exp
+	token.Claims["iat"] = time.Now().Unix()
+	tokenString, _ := token.SignedString(key)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	recorded := test.RunRequest(t, verifyApi.MakeHandler(), req)
+	recorded.CodeIs(204)
+	recorded.HeaderIs("X-Token-Expires", strconv.FormatInt(exp, 10))
+	if expiresIn, _ := strconv.Atoi(recorded.Recorder.Header().Get("X-Token-Expires-In")); expiresIn < 3590 || expiresIn > 3600 {
+		t.Errorf("Unexpected X-Token-Expires-In %d", expiresIn)
+	}
+
+	// invalid token
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", []byte("sekret key")))
+	recorded = test.RunRequest(t, verifyApi.MakeHandler(), req)
+	recorded.CodeIs(401)
+	recorded.ContentTypeIsJson()
+
+	// no token
+	recorded = test.RunRequest(t, verifyApi.MakeHandler(), test.MakeSimpleRequest("GET", "http://localhost/", nil))
+	recorded.CodeIs(401)
+}
+
+func TestAuthRequestHandler(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		Authorizator: func(userId string, request *rest.Request) bool {
+			return request.Method == "GET" && strings.HasPrefix(request.URL.Path, "/public/")
+		},
+	}
+
+	authApi := rest.NewApi()
+	authApi.SetApp(rest.AppSimple(authMiddleware.AuthRequestHandler))
+
+	authRequest := func(tokenString, method, uri string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/auth", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		req.Header.Set("X-Original-Method", method)
+		req.Header.Set("X-Original-URI", uri)
+		return test.RunRequest(t, authApi.MakeHandler(), req)
+	}
+
+	// allowed original request
+	recorded := authRequest(makeTokenString("admin", key), "GET", "/public/index.html?lang=en")
+	recorded.CodeIs(200)
+	recorded.HeaderIs("X-Auth-User", "admin")
+
+	// denied original request
+	recorded = authRequest(makeTokenString("admin", key), "DELETE", "/public/index.html")
+	recorded.CodeIs(403)
+	recorded = authRequest(makeTokenString("admin", key), "GET", "/private/")
+	recorded.CodeIs(403)
+
+	// invalid token
+	recorded = authRequest(makeTokenString("admin", []byte("sekret key")), "GET", "/public/index.html")
+	recorded.CodeIs(401)
+	recorded.HeaderIs("X-Auth-User", "")
+}
+
+func TestMissingExpiration(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "admin"
+	tokenString, _ := token.SignedString(key)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(401)
+
+	if _, err := authMiddleware.parseTokenString(tokenString); err != ErrMissingExpiration {
+		t.Errorf("Expected ErrMissingExpiration, got %v", err)
+	}
+
+	authMiddleware.AllowMissingExpiration = true
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+}
+
+func TestTokenUse(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+
+	request := func(tokenUse interface{}) *test.Recorded {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "admin"
+		token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token.Claims["iat"] = time.Now().Unix()
+		if tokenUse != nil {
+			token.Claims["token_use"] = tokenUse
+		}
+		tokenString, _ := token.SignedString(key)
+
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request(nil).CodeIs(200)
+	request(TokenUseAccess).CodeIs(200)
+	request(TokenUseRefresh).CodeIs(401)
+	request(TokenUseAction).CodeIs(401)
+	request(1).CodeIs(401)
+
+	authMiddleware.AcceptedTokenUses = []string{TokenUseAccess, TokenUseAction}
+	request(TokenUseAction).CodeIs(200)
+}
+
+func TestRefreshLimits(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		MaxRefresh:      time.Hour,
+		MaxRefreshCount: 2,
+		MaxRefreshFunc: func(claims map[string]interface{}) time.Duration {
+			if claims["client_type"] == "mobile" {
+				return 30 * 24 * time.Hour
+			}
+			return time.Hour
+		},
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.SetApp(rest.AppSimple(authMiddleware.RefreshHandler))
+
+	refresh := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+	makeToken := func(clientType string, origIat time.Time) string {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "admin"
+		token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token.Claims["orig_iat"] = origIat.Unix()
+		token.Claims["client_type"] = clientType
+		tokenString, _ := token.SignedString(key)
+		return tokenString
+	}
+
+	// the refresh chain is limited
+	tokenString := makeToken("web", time.Now())
+	for i := 0; i < 2; i++ {
+		recorded := refresh(tokenString)
+		recorded.CodeIs(200)
+		rToken := DecoderToken{}
+		test.DecodeJsonPayload(recorded.Recorder, &rToken)
+		tokenString = rToken.Token
+	}
+	recorded := refresh(tokenString)
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Token can't be refreshed anymore","code":"refresh_exhausted"}`)
+
+	// per client type family TTL
+	refresh(makeToken("web", time.Now().Add(-2*time.Hour))).CodeIs(401)
+	refresh(makeToken("mobile", time.Now().Add(-2*time.Hour))).CodeIs(200)
+	refresh(makeToken("mobile", time.Now().Add(-31*24*time.Hour))).CodeIs(401)
+}
+
+func TestTokenHeaders(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		TokenHeaders: []TokenHeader{{Name: "Authorization", Scheme: "Bearer"}, {Name: "X-Access-Token"}},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "user"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	userToken, _ := token.SignedString(key)
+
+	request := func(headers map[string]string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request(map[string]string{"Authorization": "Bearer " + makeTokenString("admin", key)}).BodyIs(`{"Id":"admin"}`)
+	request(map[string]string{"X-Access-Token": userToken}).BodyIs(`{"Id":"user"}`)
+
+	// the first header wins
+	request(map[string]string{
+		"Authorization":  "Bearer " + makeTokenString("admin", key),
+		"X-Access-Token": userToken,
+	}).BodyIs(`{"Id":"admin"}`)
+
+	// headers with another scheme are skipped
+	request(map[string]string{
+		"Authorization":  "Basic YWRtaW46YWRtaW4=",
+		"X-Access-Token": userToken,
+	}).BodyIs(`{"Id":"user"}`)
+
+	recorded := request(map[string]string{"Authorization": "Basic YWRtaW46YWRtaW4="})
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"token_missing","detail":"Invalid auth header"}`)
+
+	recorded = request(map[string]string{"X-Token": makeTokenString("admin", key)})
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"token_missing","detail":"Auth header empty"}`)
+}
+
+func TestExposeRawToken(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]interface{}{"Token": r.Env["AUTH_TOKEN"], "TokenId": ExtractTokenId(r)})
+	}))
+	tokenString := makeTokenString("admin", key)
+	hash := sha256.Sum256([]byte(tokenString))
+	tokenId := hex.EncodeToString(hash[:])
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"Token":null,"TokenId":"` + tokenId + `"}`)
+
+	authMiddleware = &JWTMiddleware{
+		Realm:          "test zone",
+		Key:            key,
+		Timeout:        time.Hour,
+		ExposeRawToken: true,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+	api = rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]interface{}{"Token": r.Env["AUTH_TOKEN"], "TokenId": ExtractTokenId(r)})
+	}))
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"Token":"` + tokenString + `","TokenId":"` + tokenId + `"}`)
+}
+
+func TestHashStoredTokens(t *testing.T) {
+	stored := map[string]string{}
+	clock := &frozenClock{now: time.Now()}
+	authMiddleware := &JWTMiddleware{
+		Clock:            clock,
+		Realm:            "test zone",
+		Key:              key,
+		Timeout:          time.Hour,
+		MaxRefresh:       time.Hour * 24,
+		HashStoredTokens: true,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		StoreToken: func(timeout time.Duration) func(username, token string) {
+			return func(username, token string) {
+				stored[username] = token
+			}
+		},
+		RemoveToken: func(userId, token string) {
+			if TokenIdsEqual(stored[userId], token) {
+				delete(stored, userId)
+			}
+		},
+		Authorizator: func(userId string, request *rest.Request) bool {
+			return TokenIdsEqual(stored[userId], ExtractTokenId(request))
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/login"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"}))
+	recorded.CodeIs(200)
+	token := DecoderToken{}
+	recorded.DecodeJsonPayload(&token)
+
+	hash := sha256.Sum256([]byte(token.Token))
+	if stored["admin"] != hex.EncodeToString(hash[:]) {
+		t.Errorf("Only the hash of the token should be stored, got %q", stored["admin"])
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	refreshReq := test.MakeSimpleRequest("GET", "http://localhost/refresh", nil)
+	refreshReq.Header.Set("Authorization", "Bearer "+token.Token)
+	recorded = test.RunRequest(t, handler, refreshReq)
+	recorded.CodeIs(200)
+	newToken := DecoderToken{}
+	recorded.DecodeJsonPayload(&newToken)
+
+	// the refreshed token replaced the old one
+	recorded = test.RunRequest(t, handler, refreshReq)
+	recorded.CodeIs(401)
+	refreshReq.Header.Set("Authorization", "Bearer "+newToken.Token)
+	recorded = test.RunRequest(t, handler, refreshReq)
+	recorded.CodeIs(200)
+}
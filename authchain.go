@@ -0,0 +1,103 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// AuthorizationCheck is a named link of a chain of authorization checks, see AuthorizationChecks
+// and RequireChecks.
+type AuthorizationCheck struct {
+	// Name of the check reported in denials, e.g. "invoice_owner".
+	Name string
+
+	// Callback function that returns nil if the authenticated user may make the request, and
+	// otherwise an error explaining why not, e.g. "Invoice 42 belongs to another account".
+	Check func(userId string, request *rest.Request) error
+}
+
+// Denial explains why a request was denied by an AuthorizationCheck. It is passed to the
+// DenialCallback and made available through ExtractDenial.
+type Denial struct {
+	// Name of the check that denied the request.
+	Check string `json:"check"`
+
+	// Error message of the check.
+	Reason string `json:"reason"`
+
+	// REMOTE_USER of the request.
+	UserId string `json:"user_id"`
+
+	// Method and path of the request.
+	Method string `json:"method"`
+	Path   string `json:"path"`
+
+	// Id of the request as returned by ExtractRequestId.
+	RequestId string `json:"request_id,omitempty"`
+}
+
+// denialBody is the body of 403 responses to denied requests.
+type denialBody struct {
+	Error  string `json:"Error"`
+	Code   string `json:"code"`
+	Check  string `json:"check"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// RequireChecks returns a guard that only calls the wrapped handler if all checks allow the
+// request. They are run in order, and the first that fails denies the request like the
+// AuthorizationChecks do. It must be used behind the middleware, usually on a per route basis
+// with rest.WrapMiddlewares.
+func (mw *JWTMiddleware) RequireChecks(checks ...AuthorizationCheck) rest.MiddlewareSimple {
+	return func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(writer rest.ResponseWriter, request *rest.Request) {
+			if mw.deniedByChecks(mw.encodeResponses(writer, request), request, checks) {
+				return
+			}
+			handler(writer, request)
+		}
+	}
+}
+
+// ExtractDenial returns the explanation of why a request was denied by an AuthorizationCheck, or
+// nil if it wasn't. It can be used by the middlewares wrapping the middleware, e.g. to log it.
+func ExtractDenial(request *rest.Request) *Denial {
+	denial, _ := request.Env["JWT_DENIAL"].(*Denial)
+	return denial
+}
+
+// deniedByChecks runs the checks in order until one fails, in which case the request is denied
+// with a 403 explaining which check failed and why.
+func (mw *JWTMiddleware) deniedByChecks(writer rest.ResponseWriter, request *rest.Request, checks []AuthorizationCheck) bool {
+	userId, _ := request.Env["REMOTE_USER"].(string)
+	for _, check := range checks {
+		err := check.Check(userId, request)
+		if err == nil {
+			continue
+		}
+
+		denial := &Denial{
+			Check:     check.Name,
+			Reason:    err.Error(),
+			UserId:    userId,
+			Method:    request.Method,
+			Path:      request.URL.Path,
+			RequestId: ExtractRequestId(request),
+		}
+		request.Env["JWT_DENIAL"] = denial
+		mw.Metrics.IncCounter("authorization_denials")
+		if mw.DenialCallback != nil {
+			mw.DenialCallback(denial, request)
+		}
+
+		body := denialBody{Error: errForbidden.Message, Code: errForbidden.Code, Check: check.Name}
+		if !mw.SuppressErrorDetail {
+			body.Reason = denial.Reason
+		}
+		writer.WriteHeader(http.StatusForbidden)
+		writer.WriteJson(body)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestAuthorizationChecks(t *testing.T) {
+	calls := []string{}
+	denials := []*Denial{}
+	authMiddleware := &JWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		Authenticator:   rejectLogin,
+		RequestIdHeader: "X-Request-ID",
+		AuthorizationChecks: []AuthorizationCheck{{
+			Name: "business_hours",
+			Check: func(userId string, request *rest.Request) error {
+				calls = append(calls, "business_hours")
+				return nil
+			},
+		}, {
+			Name: "not_archived",
+			Check: func(userId string, request *rest.Request) error {
+				calls = append(calls, "not_archived")
+				if request.URL.Query().Get("archived") != "" {
+					return errors.New("Archived resources are read-only")
+				}
+				return nil
+			},
+		}, {
+			Name: "never_reached",
+			Check: func(userId string, request *rest.Request) error {
+				calls = append(calls, "never_reached")
+				return errors.New("Denied")
+			},
+		}},
+		DenialCallback: func(denial *Denial, request *rest.Request) {
+			denials = append(denials, denial)
+		},
+	}
+
+	var logged *Denial
+	api := rest.NewApi()
+	api.Use(rest.MiddlewareSimple(func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(writer rest.ResponseWriter, request *rest.Request) {
+			handler(writer, request)
+			logged = ExtractDenial(request)
+		}
+	}), authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/documents", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireChecks(AuthorizationCheck{
+			Name: "owner",
+			Check: func(userId string, request *rest.Request) error {
+				if userId != "owner" {
+					return errors.New("Only the owner may list documents")
+				}
+				return nil
+			},
+		})}, func(w rest.ResponseWriter, r *rest.Request) {})),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/documents?archived=1", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	req.Header.Set("X-Request-ID", "req-42")
+	recorded := test.RunRequest(t, handler, req)
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Forbidden","check":"not_archived","code":"forbidden","reason":"Archived resources are read-only","request_id":"req-42"}`)
+	if len(calls) != 2 || calls[1] != "not_archived" {
+		t.Errorf("The checks should stop at the first denial, got %v", calls)
+	}
+	expected := Denial{Check: "not_archived", Reason: "Archived resources are read-only", UserId: "admin", Method: "GET", Path: "/documents", RequestId: "req-42"}
+	if len(denials) != 1 || *denials[0] != expected {
+		t.Errorf("Unexpected denials %+v", denials)
+	}
+	if logged != denials[0] {
+		t.Errorf("The denial should be available to the wrapping middlewares, got %+v", logged)
+	}
+
+	authMiddleware.AuthorizationChecks = authMiddleware.AuthorizationChecks[:1]
+	authMiddleware.SuppressErrorDetail = true
+	req = test.MakeSimpleRequest("GET", "http://localhost/documents", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(403)
+	if len(denials) != 2 || denials[1].Check != "owner" || denials[1].Reason != "Only the owner may list documents" {
+		t.Errorf("The guard should report its denial, got %+v", denials)
+	}
+	payload := map[string]interface{}{}
+	recorded.DecodeJsonPayload(&payload)
+	if payload["check"] != "owner" || payload["reason"] != nil {
+		t.Errorf("The reason should be suppressed, got %v", payload)
+	}
+}
@@ -0,0 +1,124 @@
+package jwt
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// AuthInfo is a snapshot of the identity of an authenticated request, detached from the request
+// so that it can be handed to goroutines and queues that outlive it. It can be serialized with
+// encoding/json.
+type AuthInfo struct {
+	// REMOTE_USER of the request.
+	UserId string `json:"user_id"`
+
+	// Deep copy of the claims of the token.
+	Claims map[string]interface{} `json:"claims"`
+
+	// Scopes granted to the user, as returned by ExtractScopes.
+	Scopes []string `json:"scopes"`
+
+	// Id of the token as returned by ExtractTokenId, to correlate the background work with the
+	// request.
+	TokenId string `json:"token_id,omitempty"`
+
+	// Id of the request as returned by ExtractRequestId.
+	RequestId string `json:"request_id,omitempty"`
+}
+
+// ErrNotAuthenticated is returned by MintInternalToken for a missing AuthInfo.
+var ErrNotAuthenticated = errors.New("Not authenticated")
+
+// SnapshotAuthInfo returns the AuthInfo of a request authenticated by the middleware, or nil if
+// the request isn't authenticated. request.Env must not be used after the request is done, the
+// snapshot can.
+func SnapshotAuthInfo(request *rest.Request) *AuthInfo {
+	userId, ok := request.Env["REMOTE_USER"].(string)
+	if !ok {
+		return nil
+	}
+	return &AuthInfo{
+		UserId:    userId,
+		Claims:    copyClaims(ExtractClaims(request)),
+		Scopes:    append([]string{}, ExtractScopes(request)...),
+		TokenId:   ExtractTokenId(request),
+		RequestId: ExtractRequestId(request),
+	}
+}
+
+// MintInternalToken returns a token for background work on behalf of the user of info, e.g. a job
+// calling internal services after the request is done. The token only carries the identity of
+// the user and the given scopes that were granted to them, expires after ttl, and has
+// TokenUseInternal as "token_use" claim, so that it isn't accepted as access token unless
+// AcceptedTokenUses says so. It is read back with ParseInternalToken.
+func (mw *JWTMiddleware) MintInternalToken(info *AuthInfo, scopes []string, ttl time.Duration) (string, error) {
+	mw.initDefaults()
+
+	if info == nil {
+		return "", ErrNotAuthenticated
+	}
+
+	granted := []string{}
+	for _, scope := range scopes {
+		if containsString(info.Scopes, scope) && !containsString(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	format := mw.defaultTokenFormat()
+	token := jwt.New(jwt.GetSigningMethod(format.SigningAlgorithm))
+	now := mw.Clock.Now()
+	token.Claims["id"] = info.UserId
+	token.Claims["scope"] = strings.Join(granted, " ")
+	token.Claims["token_use"] = TokenUseInternal
+	token.Claims["iat"] = now.Unix()
+	token.Claims["exp"] = now.Add(ttl).Unix()
+	if mw.Issuer != "" {
+		token.Claims["iss"] = mw.Issuer
+	}
+	if mw.Audience != "" {
+		token.Claims["aud"] = mw.Audience
+	}
+	if info.RequestId != "" {
+		token.Claims["request_id"] = info.RequestId
+	}
+
+	return mw.signToken(token, format, info.UserId)
+}
+
+// ParseInternalToken verifies a token minted by MintInternalToken and returns the AuthInfo it
+// carries.
+func (mw *JWTMiddleware) ParseInternalToken(tokenString string) (*AuthInfo, error) {
+	mw.initDefaults()
+
+	token, err := mw.parseSignedToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if token.Claims["token_use"] != TokenUseInternal {
+		return nil, ErrInvalidTokenUse
+	}
+	if mw.Issuer != "" && token.Claims["iss"] != mw.Issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if mw.Audience != "" && !hasAudience(token.Claims, mw.Audience) {
+		return nil, ErrInvalidAudience
+	}
+
+	userId, ok := claimString(token.Claims["id"])
+	if !ok {
+		return nil, ErrInvalidClaims
+	}
+	requestId, _ := token.Claims["request_id"].(string)
+	return &AuthInfo{
+		UserId:    userId,
+		Claims:    token.Claims,
+		Scopes:    defaultScopesFunc(token.Claims),
+		TokenId:   tokenId(token.Raw),
+		RequestId: requestId,
+	}, nil
+}
@@ -0,0 +1,84 @@
+package jwt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestAuthInfo(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	jobs := make(chan []byte, 1)
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(writer rest.ResponseWriter, request *rest.Request) {
+		info := SnapshotAuthInfo(request)
+		// the snapshot survives the request, e.g. enqueued as json
+		payload, err := json.Marshal(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs <- payload
+		writer.WriteJson(map[string]string{"status": "queued"})
+	}))
+	handler := api.MakeHandler()
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "admin"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	token.Claims["scope"] = "read write"
+	token.Claims["groups"] = []interface{}{"staff"}
+	tokenString, _ := token.SignedString(key)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	test.RunRequest(t, handler, req).CodeIs(200)
+
+	info := &AuthInfo{}
+	if err := json.Unmarshal(<-jobs, info); err != nil {
+		t.Fatal(err)
+	}
+	if info.UserId != "admin" || info.Claims["scope"] != "read write" || len(info.Scopes) != 2 || info.TokenId != tokenId(tokenString) {
+		t.Fatalf("The snapshot should carry the identity of the request, got %+v", info)
+	}
+
+	internalToken, err := authMiddleware.MintInternalToken(info, []string{"read", "admin"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := authMiddleware.ParseInternalToken(internalToken)
+	if err != nil {
+		t.Fatalf("The internal token should be valid, got %v", err)
+	}
+	if parsed.UserId != "admin" || len(parsed.Scopes) != 1 || parsed.Scopes[0] != "read" || parsed.Claims["groups"] != nil {
+		t.Errorf("The internal token should only carry the identity and the granted scopes, got %+v", parsed)
+	}
+
+	// internal tokens aren't access tokens, and access tokens aren't internal tokens
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+internalToken)
+	test.RunRequest(t, handler, req).CodeIs(401)
+	if _, err := authMiddleware.ParseInternalToken(tokenString); err != ErrInvalidTokenUse {
+		t.Errorf("Access tokens should be rejected as internal tokens, got %v", err)
+	}
+
+	if _, err := authMiddleware.MintInternalToken(nil, nil, time.Minute); err != ErrNotAuthenticated {
+		t.Errorf("Minting without AuthInfo should fail, got %v", err)
+	}
+	if info := SnapshotAuthInfo(&rest.Request{Env: map[string]interface{}{}}); info != nil {
+		t.Errorf("Unauthenticated requests have no AuthInfo, got %+v", info)
+	}
+}
@@ -0,0 +1,100 @@
+package jwt
+
+// AuthorizationError is returned by Check and CheckPolicy for authenticated users that aren't
+// allowed to go on, with the error code the middleware responds with to HTTP requests.
+type AuthorizationError struct {
+	// Error message, e.g. "Email not verified".
+	Message string
+
+	// Error code, e.g. "email_not_verified".
+	Code string
+}
+
+func (e *AuthorizationError) Error() string {
+	return e.Message
+}
+
+// The errors of the checks shared by the middleware and Check.
+var (
+	errAccountSuspended  = &AuthorizationError{Message: "Account suspended", Code: "account_suspended"}
+	errEmailNotVerified  = &AuthorizationError{Message: "Email not verified", Code: "email_not_verified"}
+	errMFARequired       = &AuthorizationError{Message: "Multi-factor authentication required", Code: "mfa_required"}
+	errInsufficientScope = &AuthorizationError{Message: "Insufficient scope", Code: "insufficient_scope"}
+	errForbidden         = &AuthorizationError{Message: "Forbidden", Code: "forbidden"}
+)
+
+// Authenticate verifies a token outside of HTTP, e.g. the token a WebSocket client sends when it
+// connects, like the middleware verifies the token of a request: its signature, claims,
+// revocation and activity. The checks that need the request, i.e. fingerprints, custom
+// VerificationStages and the Authorizator, aren't applied.
+func (mw *JWTMiddleware) Authenticate(tokenString string) (*AuthInfo, error) {
+	mw.initDefaults()
+
+	token, verifier, err := mw.parseCachedToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifier.validateClaims(token); err != nil {
+		return nil, err
+	}
+	if err := mw.checkTokenRevocation(token, verifier); err != nil {
+		return nil, err
+	}
+	if err := verifier.checkActivity(token); err != nil {
+		return nil, err
+	}
+	userId, err := verifier.IdentityHandler(token.Claims)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthInfo{
+		UserId:  userId,
+		Claims:  copyClaims(token.Claims),
+		Scopes:  verifier.scopes(token.Claims),
+		TokenId: tokenId(token.Raw),
+	}, nil
+}
+
+// Check authorizes the user of info to perform action on resource outside of HTTP, e.g. for each
+// message of a WebSocket or job of a background worker, with the checks the middleware applies
+// to requests that don't depend on HTTP: account suspension, RequireEmailVerified, the
+// TemporalPolicies, the RouteScopes of action and the ActionAuthorizator. The action may be a
+// route of RouteScopes, e.g. "DELETE /users/:id", to share its scopes. It returns nil if the
+// action is allowed, an *AuthorizationError otherwise. Tokens aren't revoked for suspended users.
+func (mw *JWTMiddleware) Check(info *AuthInfo, action string, resource string) error {
+	mw.initDefaults()
+
+	if info == nil {
+		return ErrNotAuthenticated
+	}
+	if mw.suspended(info.UserId, info.Claims) {
+		return errAccountSuspended
+	}
+	if mw.RequireEmailVerified && !mw.emailVerified(info.Claims) {
+		return errEmailNotVerified
+	}
+	if err := mw.checkSchedule(info.Claims); err != nil {
+		return err
+	}
+	if !mw.hasScopes(info.Scopes, mw.RouteScopes[action]) {
+		return errInsufficientScope
+	}
+	if mw.ActionAuthorizator != nil && !mw.ActionAuthorizator(info, action, resource) {
+		return errForbidden
+	}
+	return nil
+}
+
+// CheckPolicy checks info against policy outside of HTTP, like the middleware returned by
+// WithPolicy checks requests. It returns ErrInvalidAudience or ErrRevokedToken if the token
+// isn't accepted, and an *AuthorizationError if it lacks scopes or multi-factor authentication,
+// or doesn't satisfy the Condition.
+func (mw *JWTMiddleware) CheckPolicy(info *AuthInfo, policy Policy) error {
+	mw.initDefaults()
+
+	if info == nil {
+		return ErrNotAuthenticated
+	}
+	input := &expressionInput{userId: info.UserId, claims: info.Claims, scopes: info.Scopes}
+	return mw.checkPolicy(input, info.TokenId, policy)
+}
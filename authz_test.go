@@ -0,0 +1,88 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestAuthenticateAndCheck(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	authMiddleware := &JWTMiddleware{
+		Realm:                "test zone",
+		Key:                  key,
+		Timeout:              time.Hour,
+		Authenticator:        rejectLogin,
+		RevocationStore:      store,
+		RequireEmailVerified: true,
+		RouteScopes:          map[string][]string{"send": {"chat:write"}},
+		ActionAuthorizator: func(info *AuthInfo, action string, resource string) bool {
+			return resource != "#admins" || info.UserId == "admin"
+		},
+	}
+
+	makeToken := func(userId string, claims map[string]interface{}) string {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = userId
+		token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token.Claims["iat"] = time.Now().Unix()
+		token.Claims["email_verified"] = true
+		for name, value := range claims {
+			token.Claims[name] = value
+		}
+		tokenString, _ := token.SignedString(key)
+		return tokenString
+	}
+
+	if _, err := authMiddleware.Authenticate("invalid"); err == nil {
+		t.Error("Invalid tokens should be rejected")
+	}
+	expired := makeToken("admin", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})
+	if _, err := authMiddleware.Authenticate(expired); err == nil {
+		t.Error("Expired tokens should be rejected")
+	}
+
+	adminToken := makeToken("admin", map[string]interface{}{"scope": "chat:write"})
+	admin, err := authMiddleware.Authenticate(adminToken)
+	if err != nil {
+		t.Fatalf("The token should be accepted, got %v", err)
+	}
+	if admin.UserId != "admin" || !containsString(admin.Scopes, "chat:write") || admin.TokenId != tokenId(adminToken) {
+		t.Errorf("Unexpected AuthInfo %+v", admin)
+	}
+	if err := authMiddleware.Check(admin, "send", "#admins"); err != nil {
+		t.Errorf("The admin should be allowed, got %v", err)
+	}
+
+	user, _ := authMiddleware.Authenticate(makeToken("user", map[string]interface{}{"scope": "chat:write"}))
+	if err := authMiddleware.Check(user, "send", "#admins"); err != errForbidden {
+		t.Errorf("The ActionAuthorizator should reject the user, got %v", err)
+	}
+	if err := authMiddleware.Check(user, "send", "#general"); err != nil {
+		t.Errorf("The user should be allowed, got %v", err)
+	}
+
+	reader, _ := authMiddleware.Authenticate(makeToken("reader", nil))
+	err = authMiddleware.Check(reader, "send", "#general")
+	if authzErr, ok := err.(*AuthorizationError); !ok || authzErr.Code != "insufficient_scope" {
+		t.Errorf("Missing scopes should be reported, got %v", err)
+	}
+
+	unverified, _ := authMiddleware.Authenticate(makeToken("unverified", map[string]interface{}{"email_verified": false}))
+	if err := authMiddleware.Check(unverified, "read", "#general"); err != errEmailNotVerified {
+		t.Errorf("Unverified emails should be rejected, got %v", err)
+	}
+
+	if err := authMiddleware.CheckPolicy(admin, Policy{RequireMFA: true}); err != errMFARequired {
+		t.Errorf("The policy should require MFA, got %v", err)
+	}
+	store.Revoke(admin.TokenId, time.Hour)
+	if err := authMiddleware.CheckPolicy(admin, Policy{StatefulCheck: true}); err != ErrRevokedToken {
+		t.Errorf("The stateful check should see the revocation, got %v", err)
+	}
+
+	if err := authMiddleware.Check(nil, "send", "#general"); err != ErrNotAuthenticated {
+		t.Errorf("Missing AuthInfo should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package jwt
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// backchannelLogoutEvent is the member of the "events" claim of logout tokens.
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// ErrInvalidLogoutToken is returned for logout tokens that don't follow OpenID Connect
+// Back-Channel Logout, e.g. without logout event or with a nonce.
+var ErrInvalidLogoutToken = errors.New("Invalid logout token")
+
+// ErrReplayedLogoutToken is returned for logout tokens whose "jti" was seen already.
+var ErrReplayedLogoutToken = errors.New("Replayed logout token")
+
+type backchannelLogoutError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// BackchannelLogoutHandler receives the logout tokens of an upstream OpenID provider (OpenID
+// Connect Back-Channel Logout 1.0), posted as "logout_token" form field, so that logouts at the
+// provider propagate to the service. The logout token is verified like the tokens of the
+// middleware, i.e. with its Key, KeySet or AdditionalVerifiers, and its issuer and audience must
+// be the Issuer and Audience, if they are set. From then on, the tokens with the "sid" claim of
+// the logout token are rejected, as are the tokens with its "sub" claim issued before the logout.
+// BackchannelLogoutCallback is called to end the other sessions of the application.
+// Reply will be a 200, or a 400 with an OAuth error if the logout token is invalid.
+func (mw *JWTMiddleware) BackchannelLogoutHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	writer.Header().Set("Cache-Control", "no-store")
+
+	request.Body = ioutil.NopCloser(io.LimitReader(request.Body, mw.MaxLoginPayloadSize))
+	sub, sid, err := mw.acceptLogoutToken(request.PostFormValue("logout_token"))
+	if err != nil {
+		mw.Metrics.IncCounter("backchannel_logouts_rejected")
+		writer.WriteHeader(http.StatusBadRequest)
+		writer.WriteJson(backchannelLogoutError{Error: "invalid_request", ErrorDescription: err.Error()})
+		return
+	}
+	mw.Metrics.IncCounter("backchannel_logouts")
+
+	if mw.BackchannelLogoutCallback != nil {
+		mw.BackchannelLogoutCallback(sub, sid)
+	}
+	writer.WriteHeader(http.StatusOK)
+}
+
+// acceptLogoutToken validates a logout token and rejects the tokens it logs out. It returns the
+// "sub" and "sid" claims of the logout token, one of which may be empty.
+func (mw *JWTMiddleware) acceptLogoutToken(logoutToken string) (string, string, error) {
+	token, _, err := mw.parseWithVerifiers(logoutToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	if mw.Issuer != "" && token.Claims["iss"] != mw.Issuer {
+		return "", "", ErrInvalidIssuer
+	}
+	if mw.Audience != "" && !hasAudience(token.Claims, mw.Audience) {
+		return "", "", ErrInvalidAudience
+	}
+
+	events, _ := token.Claims["events"].(map[string]interface{})
+	if _, ok := events[backchannelLogoutEvent].(map[string]interface{}); !ok {
+		return "", "", ErrInvalidLogoutToken
+	}
+	if _, ok := token.Claims["nonce"]; ok {
+		return "", "", ErrInvalidLogoutToken
+	}
+	if _, ok := GetTime(token.Claims, "iat"); !ok {
+		return "", "", ErrInvalidLogoutToken
+	}
+	jti, ok := token.Claims["jti"].(string)
+	if !ok || jti == "" {
+		return "", "", ErrInvalidLogoutToken
+	}
+	sub, _ := token.Claims["sub"].(string)
+	sid, _ := token.Claims["sid"].(string)
+	if sub == "" && sid == "" {
+		return "", "", ErrInvalidLogoutToken
+	}
+
+	now := mw.Clock.Now()
+	replayKey := "logout_jti:" + jti
+	if _, ok := mw.loggedOut.Get(replayKey); ok {
+		return "", "", ErrReplayedLogoutToken
+	}
+	replayUntil := now.Add(mw.LogoutTicketTTL)
+	if exp, ok := GetTime(token.Claims, "exp"); ok {
+		replayUntil = exp
+	}
+	mw.denyLoggedOut([]string{replayKey}, replayUntil)
+
+	keys := []string{}
+	if sid != "" {
+		keys = append(keys, "family:"+sid)
+	}
+	if sub != "" {
+		keys = append(keys, "sub:"+sub)
+	}
+	mw.denyLoggedOut(keys, now.Add(mw.Timeout+mw.MaxRefresh))
+	return sub, sid, nil
+}
@@ -0,0 +1,171 @@
+package jwt
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestBackchannelLogout(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+	ended := []string{}
+	verifier := NewVerifier(key, WithIssuer("https://idp.example.com"), WithAudience("api"), WithConfig(func(mw *JWTMiddleware) {
+		mw.Clock = clock
+		mw.BackchannelLogoutCallback = func(sub string, sid string) {
+			ended = append(ended, sub+"/"+sid)
+		}
+	}))
+
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/backchannel_logout"
+		},
+		IfTrue: verifier,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/backchannel_logout", verifier.BackchannelLogoutHandler),
+		rest.Get("/", func(writer rest.ResponseWriter, request *rest.Request) {}),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	sign := func(claims map[string]interface{}) string {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["iss"] = "https://idp.example.com"
+		token.Claims["aud"] = "api"
+		token.Claims["iat"] = clock.now.Unix()
+		token.Claims["exp"] = clock.now.Add(time.Hour).Unix()
+		for name, value := range claims {
+			token.Claims[name] = value
+		}
+		tokenString, _ := token.SignedString(key)
+		return tokenString
+	}
+	accessToken := func(sub, sid string) string {
+		return sign(map[string]interface{}{"id": sub, "sub": sub, "sid": sid})
+	}
+	logoutToken := func(claims map[string]interface{}) string {
+		logoutClaims := map[string]interface{}{
+			"jti":    "logout-" + clock.now.String(),
+			"events": map[string]interface{}{backchannelLogoutEvent: map[string]interface{}{}},
+		}
+		for name, value := range claims {
+			logoutClaims[name] = value
+		}
+		return sign(logoutClaims)
+	}
+	get := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+	logout := func(tokenString string) *test.Recorded {
+		form := url.Values{"logout_token": {tokenString}}
+		req, _ := http.NewRequest("POST", "http://localhost/backchannel_logout", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return test.RunRequest(t, handler, req)
+	}
+
+	laptop := accessToken("alice", "laptop")
+	phone := accessToken("alice", "phone")
+	bob := accessToken("bob", "desktop")
+	clock.now = clock.now.Add(time.Second)
+
+	// logout of a session
+	logout(logoutToken(map[string]interface{}{"sid": "laptop"})).CodeIs(200)
+	get(laptop).CodeIs(401)
+	get(phone).CodeIs(200)
+
+	// logout of all sessions of a user issued before
+	clock.now = clock.now.Add(time.Second)
+	logout(logoutToken(map[string]interface{}{"sub": "alice"})).CodeIs(200)
+	get(phone).CodeIs(401)
+	get(bob).CodeIs(200)
+	clock.now = clock.now.Add(time.Second)
+	get(accessToken("alice", "tablet")).CodeIs(200)
+
+	if len(ended) != 2 || ended[0] != "/laptop" || ended[1] != "alice/" {
+		t.Errorf("The callback should be called for each logout, got %v", ended)
+	}
+
+	// invalid logout tokens
+	clock.now = clock.now.Add(time.Second)
+	replayed := logoutToken(map[string]interface{}{"sid": "desktop"})
+	logout(replayed).CodeIs(200)
+	logout(replayed).CodeIs(400)
+	logout(bob).CodeIs(400)
+	logout(logoutToken(map[string]interface{}{"jti": "nonce", "sub": "bob", "nonce": "n"})).CodeIs(400)
+	logout(logoutToken(map[string]interface{}{"jti": "nosub"})).CodeIs(400)
+	logout(logoutToken(map[string]interface{}{"jti": "aud", "sub": "bob", "aud": "other"})).CodeIs(400)
+	recorded := logout(logoutToken(map[string]interface{}{"jti": "iss", "sub": "bob", "iss": "https://evil.example.com"}))
+	recorded.CodeIs(400)
+	recorded.BodyIs(`{"error":"invalid_request","error_description":"Invalid token issuer"}`)
+	logout("").CodeIs(400)
+}
+
+func TestBackchannelLogoutOfAdditionalVerifier(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+	idpKey := []byte("idp key")
+	authMiddleware := &JWTMiddleware{
+		Realm:               "test zone",
+		Key:                 key,
+		Clock:               clock,
+		Authenticator:       rejectLogin,
+		AdditionalVerifiers: []*JWTMiddleware{{Realm: "idp", Key: idpKey, Clock: clock, Authenticator: rejectLogin}},
+	}
+
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/backchannel_logout"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/backchannel_logout", authMiddleware.BackchannelLogoutHandler),
+		rest.Get("/", func(writer rest.ResponseWriter, request *rest.Request) {}),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	sign := func(claims map[string]interface{}) string {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["iat"] = clock.now.Unix()
+		token.Claims["exp"] = clock.now.Add(time.Hour).Unix()
+		for name, value := range claims {
+			token.Claims[name] = value
+		}
+		tokenString, _ := token.SignedString(idpKey)
+		return tokenString
+	}
+	get := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	alice := sign(map[string]interface{}{"id": "alice", "sub": "alice"})
+	get(alice).CodeIs(200)
+
+	clock.now = clock.now.Add(time.Second)
+	form := url.Values{"logout_token": {sign(map[string]interface{}{
+		"sub":    "alice",
+		"jti":    "logout",
+		"events": map[string]interface{}{backchannelLogoutEvent: map[string]interface{}{}},
+	})}}
+	req, _ := http.NewRequest("POST", "http://localhost/backchannel_logout", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	test.RunRequest(t, handler, req).CodeIs(200)
+
+	// the logout recorded by the middleware applies to the tokens of its verifiers
+	get(alice).CodeIs(401)
+	clock.now = clock.now.Add(time.Second)
+	get(sign(map[string]interface{}{"id": "alice", "sub": "alice"})).CodeIs(200)
+}
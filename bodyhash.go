@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	// ErrBodyHashMismatch is returned for tokens bound to another request body than the one of
+	// the request.
+	ErrBodyHashMismatch = errors.New("Request body doesn't match the token")
+
+	// ErrBoundBodyTooLarge is returned for requests with a body bound token whose body is larger
+	// than MaxBoundBodySize.
+	ErrBoundBodyTooLarge = errors.New("Request body too large")
+
+	// ErrTokenAlreadyUsed is returned for body bound tokens that were used before.
+	ErrTokenAlreadyUsed = errors.New("Token already used")
+
+	// ErrTokenNotBodyBound is returned by RequireBodyBoundToken for tokens that weren't minted by
+	// MintBodyBoundToken.
+	ErrTokenNotBodyBound = errors.New("Token not bound to the request body")
+)
+
+// BodyHashStage checks that the tokens with a "body_sha256" claim, e.g. minted by
+// MintBodyBoundToken, are used once with the request body they are bound to, so that neither the
+// token nor the body of a signed callback can be substituted. The body is read and replaced so
+// that the handlers can still read it.
+var BodyHashStage VerificationStage = VerificationStageFunc(func(request *rest.Request, state *VerificationState) error {
+	return state.Middleware.checkBodyHash(state.Token, request)
+})
+
+// MintBodyBoundToken returns a one-time token of userId that is only accepted for a request with
+// the given body, e.g. for the callbacks of a webhook sent to a service verifying tokens with the
+// key of this middleware. It expires after ttl and carries the SHA-256 hash of the body as
+// "body_sha256" claim, which is checked by BodyHashStage. Its "token_use" claim is
+// TokenUseBodyBound, so that it is only accepted by RequireBodyBoundToken and not as access token.
+func (mw *JWTMiddleware) MintBodyBoundToken(userId string, body []byte, ttl time.Duration) (string, error) {
+	mw.initDefaults()
+
+	jti, err := newTokenId(mw.RandReader)
+	if err != nil {
+		return "", err
+	}
+	format := mw.defaultTokenFormat()
+	token := jwt.New(jwt.GetSigningMethod(format.SigningAlgorithm))
+	now := mw.Clock.Now()
+	token.Claims["id"] = userId
+	token.Claims["jti"] = jti
+	token.Claims["token_use"] = TokenUseBodyBound
+	token.Claims["body_sha256"] = bodyHash(body)
+	token.Claims["iat"] = now.Unix()
+	token.Claims["exp"] = now.Add(ttl).Unix()
+	if mw.Issuer != "" {
+		token.Claims["iss"] = mw.Issuer
+	}
+	if mw.Audience != "" {
+		token.Claims["aud"] = mw.Audience
+	}
+
+	return mw.signToken(token, format, userId)
+}
+
+// RequireBodyBoundToken returns a middleware that only calls the wrapped handler for the requests
+// with a token minted by MintBodyBoundToken for their body, e.g. for the endpoints receiving signed
+// callbacks. It verifies the requests like the middleware, which rejects body bound tokens, so
+// these routes must not be behind the middleware itself, e.g. by excluding them with
+// rest.IfMiddleware, and use it on a per route basis with rest.WrapMiddlewares instead. Other
+// tokens are rejected with a 401.
+func (mw *JWTMiddleware) RequireBodyBoundToken() rest.MiddlewareSimple {
+	return func(handler rest.HandlerFunc) rest.HandlerFunc {
+		authenticated := mw.MiddlewareFunc(handler)
+		return func(writer rest.ResponseWriter, request *rest.Request) {
+			request.Env["JWT_BODY_BOUND"] = true
+			authenticated(writer, request)
+		}
+	}
+}
+
+// bodyBoundRoute reports whether the request is verified by RequireBodyBoundToken.
+func bodyBoundRoute(request *rest.Request) bool {
+	bodyBound, _ := request.Env["JWT_BODY_BOUND"].(bool)
+	return bodyBound
+}
+
+// validateBodyBoundClaims checks the claims of a token used behind RequireBodyBoundToken, i.e. exp,
+// iat, token_use, which must be TokenUseBodyBound, iss and aud. The access token profile and the
+// ClaimsValidator don't apply to these tokens, which are minted by MintBodyBoundToken.
+func (mw *JWTMiddleware) validateBodyBoundClaims(token *jwt.Token) error {
+	if err := mw.checkRequiredTimes(token.Claims); err != nil {
+		return err
+	}
+	if token.Claims["token_use"] != TokenUseBodyBound {
+		return ErrTokenNotBodyBound
+	}
+	if mw.Issuer != "" && token.Claims["iss"] != mw.Issuer {
+		return ErrInvalidIssuer
+	}
+	if mw.Audience != "" && !hasAudience(token.Claims, mw.Audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// checkBodyHash rejects body bound tokens used with another body or for the second time.
+func (mw *JWTMiddleware) checkBodyHash(token *jwt.Token, request *rest.Request) error {
+	expected, ok := token.Claims["body_sha256"].(string)
+	if !ok {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, mw.MaxBoundBodySize+1))
+	request.Body.Close()
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > mw.MaxBoundBodySize {
+		return ErrBoundBodyTooLarge
+	}
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if subtle.ConstantTimeCompare([]byte(bodyHash(body)), []byte(expected)) != 1 {
+		return ErrBodyHashMismatch
+	}
+
+	jti, ok := token.Claims["jti"].(string)
+	if !ok {
+		return ErrInvalidClaims
+	}
+	// the token is rejected by ClaimsStage once it has expired
+	ttl := mw.Timeout
+	if exp, ok := GetTime(token.Claims, "exp"); ok {
+		ttl = exp.Sub(mw.Clock.Now()) + time.Second
+	}
+	if !mw.loggedOut.SetIfAbsent("body_jti:"+jti, mw.Clock.Now(), ttl) {
+		return ErrTokenAlreadyUsed
+	}
+	return nil
+}
+
+// bodyHash returns the hash of a request body of the "body_sha256" claim.
+func bodyHash(body []byte) string {
+	hash := sha256.Sum256(body)
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
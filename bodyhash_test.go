@@ -0,0 +1,82 @@
+package jwt
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestBodyBoundTokens(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Timeout:          time.Hour,
+		Authenticator:    rejectLogin,
+		MaxBoundBodySize: 64,
+	}
+
+	received := ""
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/callbacks"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/callbacks", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireBodyBoundToken()}, func(w rest.ResponseWriter, r *rest.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			received = string(body)
+		})),
+		rest.Post("/data", func(w rest.ResponseWriter, r *rest.Request) {}),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+	requestPath := func(path string, body string, tokenString string) *test.Recorded {
+		req, _ := http.NewRequest("POST", "http://localhost"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+	request := func(body string, tokenString string) *test.Recorded {
+		return requestPath("/callbacks", body, tokenString)
+	}
+
+	body := `{"event":"invoice.paid","id":42}`
+	tokenString, err := authMiddleware.MintBodyBoundToken("billing", []byte(body), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not an access token
+	recorded := requestPath("/data", body, tokenString)
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"not_authorized","detail":"Invalid token use"}`)
+
+	recorded = request(`{"event":"invoice.paid","id":43}`, tokenString)
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"not_authorized","detail":"Request body doesn't match the token"}`)
+
+	request(body, tokenString).CodeIs(200)
+	if received != body {
+		t.Errorf("The handler should read the body, got %q", received)
+	}
+
+	// one-time
+	recorded = request(body, tokenString)
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"not_authorized","detail":"Token already used"}`)
+
+	large := `{"event":"` + strings.Repeat("x", 64) + `"}`
+	tokenString, _ = authMiddleware.MintBodyBoundToken("billing", []byte(large), time.Minute)
+	request(large, tokenString).CodeIs(401)
+
+	recorded = request(body, makeTokenString("admin", key))
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"not_authorized","detail":"Token not bound to the request body"}`)
+}
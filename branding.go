@@ -0,0 +1,75 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// Branding customizes the error responses of the middleware for one brand of a white-labeled
+// deployment.
+type Branding struct {
+	// Realm of the WWW-Authenticate challenges, e.g. localized or the name of the brand.
+	// Optional, defaults to the Realm of the middleware.
+	Realm string
+
+	// Name of the product, returned as "product" in error responses. Optional.
+	ProductName string
+
+	// URL of the support of the brand, returned as "support_url" in error responses. Optional.
+	SupportURL string
+
+	// URL of the documentation of the brand, returned as "docs_url" in error responses. Optional.
+	DocsURL string
+}
+
+// brandResponses returns a writer adding the Branding of BrandingFunc for the request to the json
+// error responses written to it.
+func (mw *JWTMiddleware) brandResponses(writer rest.ResponseWriter, request *rest.Request) rest.ResponseWriter {
+	if mw.BrandingFunc == nil {
+		return writer
+	}
+	branding := mw.BrandingFunc(request)
+	if branding == nil {
+		return writer
+	}
+	return &brandingWriter{ResponseWriter: writer, branding: branding}
+}
+
+// challenge sets the WWW-Authenticate header with the realm of the response, followed by the
+// given auth-params, e.g. `, error="insufficient_scope"`.
+func (mw *JWTMiddleware) challenge(writer rest.ResponseWriter, params string) {
+	realm := mw.Realm
+	if w, ok := writer.(*brandingWriter); ok && w.branding.Realm != "" {
+		realm = w.branding.Realm
+	}
+	writer.Header().Set("WWW-Authenticate", "JWT realm="+realm+params)
+}
+
+// brandingWriter adds the fields of a Branding to the json error responses written to it.
+type brandingWriter struct {
+	rest.ResponseWriter
+	branding *Branding
+	status   int
+}
+
+func (w *brandingWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *brandingWriter) WriteJson(v interface{}) error {
+	if w.status >= http.StatusBadRequest {
+		if body, err := genericValue(v); err == nil {
+			if body, ok := body.(map[string]interface{}); ok {
+				for field, value := range map[string]string{"product": w.branding.ProductName, "support_url": w.branding.SupportURL, "docs_url": w.branding.DocsURL} {
+					if value != "" {
+						body[field] = value
+					}
+				}
+				v = body
+			}
+		}
+	}
+	return w.ResponseWriter.WriteJson(v)
+}
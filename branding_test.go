@@ -0,0 +1,58 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestBranding(t *testing.T) {
+	brands := map[string]*Branding{
+		"api.acme.com":  {Realm: "Acme", ProductName: "Acme Cloud", SupportURL: "https://acme.com/support", DocsURL: "https://docs.acme.com/auth"},
+		"api.globex.de": {Realm: "Globex Anmeldung", ProductName: "Globex"},
+	}
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: rejectLogin,
+		BrandingFunc: func(request *rest.Request) *Branding {
+			return brands[request.Host]
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/", func(w rest.ResponseWriter, r *rest.Request) {}),
+		rest.Get("/admin", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireScopes("admin")}, func(w rest.ResponseWriter, r *rest.Request) {})),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+	request := func(host, path, tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://"+host+path, nil)
+		if tokenString != "" {
+			req.Header.Set("Authorization", "Bearer "+tokenString)
+		}
+		return test.RunRequest(t, handler, req)
+	}
+
+	recorded := request("api.acme.com", "/", "")
+	recorded.CodeIs(401)
+	recorded.HeaderIs("WWW-Authenticate", "JWT realm=Acme")
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"token_missing","detail":"Auth header empty","docs_url":"https://docs.acme.com/auth","product":"Acme Cloud","support_url":"https://acme.com/support"}`)
+
+	recorded = request("api.globex.de", "/admin", makeTokenString("admin", key))
+	recorded.CodeIs(403)
+	recorded.HeaderIs("WWW-Authenticate", `JWT realm=Globex Anmeldung, error="insufficient_scope", scope="admin"`)
+	recorded.BodyIs(`{"Error":"Insufficient scope","product":"Globex"}`)
+
+	// unknown brands get the defaults
+	recorded = request("localhost", "/", "")
+	recorded.HeaderIs("WWW-Authenticate", "JWT realm=test zone")
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"token_missing","detail":"Auth header empty"}`)
+
+	request("api.acme.com", "/", makeTokenString("admin", key)).CodeIs(200)
+}
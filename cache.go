@@ -0,0 +1,206 @@
+package jwt
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ttlCache is a concurrency safe in-memory map whose entries expire after a per-entry TTL.
+// Expired entries are dropped lazily on access and by a periodic sweep on insertion. Once
+// instrumented by the middleware, the cache holds at most maxEntries, evicting the least recently
+// used ones, and reports its size as "<name>_cache_entries" gauge, evictions as
+// "<name>_cache_evictions" counter and, if lookups are counted, "<name>_cache_hits" and
+// "<name>_cache_misses" counters.
+type ttlCache struct {
+	mutex     sync.Mutex
+	entries   map[string]*list.Element
+	lru       *list.List
+	lastSweep time.Time
+
+	name         string
+	metrics      MetricsRecorder
+	maxEntries   int
+	countLookups bool
+}
+
+type ttlEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+func newTTLCache() *ttlCache {
+	return &ttlCache{
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+		lastSweep: time.Now(),
+		metrics:   noopMetrics{},
+	}
+}
+
+// instrument names the cache for its metrics and limits it to maxEntries, or leaves it unbounded
+// if maxEntries is 0.
+func (c *ttlCache) instrument(name string, metrics MetricsRecorder, maxEntries int, countLookups bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.name = name
+	c.metrics = metrics
+	c.maxEntries = maxEntries
+	c.countLookups = countLookups
+	c.evict()
+	c.reportSize()
+}
+
+func (c *ttlCache) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if ok && time.Now().After(element.Value.(*ttlEntry).expiresAt) {
+		c.remove(element)
+		c.reportSize()
+		ok = false
+	}
+	if !ok {
+		c.countLookup("_cache_misses")
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	c.countLookup("_cache_hits")
+	return element.Value.(*ttlEntry).value, true
+}
+
+func (c *ttlCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.set(key, value, ttl)
+}
+
+// SetIfAbsent sets key unless it is set already, and reports whether it did.
+func (c *ttlCache) SetIfAbsent(key string, value interface{}, ttl time.Duration) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok && !time.Now().After(element.Value.(*ttlEntry).expiresAt) {
+		return false
+	}
+	c.set(key, value, ttl)
+	return true
+}
+
+func (c *ttlCache) set(key string, value interface{}, ttl time.Duration) {
+	now := time.Now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		for _, element := range c.entries {
+			if now.After(element.Value.(*ttlEntry).expiresAt) {
+				c.remove(element)
+			}
+		}
+		c.lastSweep = now
+	}
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.lru.PushFront(&ttlEntry{key: key, value: value, expiresAt: now.Add(ttl)})
+	c.evict()
+	c.reportSize()
+}
+
+func (c *ttlCache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+		c.reportSize()
+	}
+}
+
+// Keys returns the keys of the entries that haven't expired.
+func (c *ttlCache) Keys() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(c.entries))
+	for key, element := range c.entries {
+		if !now.After(element.Value.(*ttlEntry).expiresAt) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (c *ttlCache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*ttlEntry).key)
+}
+
+// evict drops the least recently used entries beyond maxEntries.
+func (c *ttlCache) evict() {
+	for c.maxEntries != 0 && len(c.entries) > c.maxEntries {
+		c.remove(c.lru.Back())
+		if c.name != "" {
+			c.metrics.IncCounter(c.name + "_cache_evictions")
+		}
+	}
+}
+
+func (c *ttlCache) reportSize() {
+	if c.name != "" {
+		c.metrics.SetGauge(c.name+"_cache_entries", float64(len(c.entries)))
+	}
+}
+
+func (c *ttlCache) countLookup(suffix string) {
+	if c.name != "" && c.countLookups {
+		c.metrics.IncCounter(c.name + suffix)
+	}
+}
+
+// memoryCache is implemented by the in-memory stores, whose caches are instrumented by the
+// middleware using them.
+type memoryCache interface {
+	memoryCache() *ttlCache
+}
+
+// instrumentCaches names the caches of the in-memory stores and caches of the middleware and
+// bounds them by MaxCacheEntries. Security state is never evicted, only expired: evicting
+// revoked, quarantined and logged out keys would let the tokens through again, and evicting
+// login failures, last-seen times and quota counters would let anyone who fills the cache lift
+// lockouts, log out active users and reset quotas.
+func (mw *JWTMiddleware) instrumentCaches() {
+	stores := []struct {
+		name  string
+		store interface{}
+		evict bool
+	}{
+		{"activity", mw.ActivityStore, false},
+		{"idempotency", mw.IdempotencyStore, true},
+		{"quota", mw.QuotaStore, false},
+		{"sessions", mw.SessionStore, true},
+		{"revocation", mw.RevocationStore, false},
+		{"quarantine", mw.QuarantineStore, false},
+	}
+	for _, s := range stores {
+		if store, ok := s.store.(memoryCache); ok {
+			maxEntries := 0
+			if s.evict {
+				maxEntries = mw.MaxCacheEntries
+			}
+			store.memoryCache().instrument(s.name, mw.Metrics, maxEntries, true)
+		}
+	}
+	if mw.loginThrottle != nil {
+		mw.loginThrottle.cache.instrument("login_throttle", mw.Metrics, 0, false)
+	}
+	if mw.loggedOut != nil {
+		mw.loggedOut.instrument("logout", mw.Metrics, 0, false)
+	}
+	if mw.GroupMapper != nil {
+		mw.GroupMapper.cache.instrument("groups", mw.Metrics, mw.MaxCacheEntries, true)
+	}
+}
@@ -0,0 +1,107 @@
+package jwt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTTLCacheEviction(t *testing.T) {
+	metrics := newCountingMetrics()
+	cache := newTTLCache()
+	cache.instrument("test", metrics, 2, true)
+
+	cache.Set("a", 1, time.Hour)
+	cache.Set("b", 2, time.Hour)
+	// a becomes the most recently used entry, b is evicted next
+	cache.Get("a")
+	cache.Set("c", 3, time.Hour)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("The least recently used entry should be evicted")
+	}
+	if _, ok := cache.Get("a"); !ok {
+		t.Error("Recently used entries should be kept")
+	}
+	if entries, _ := metrics.gauge("test_cache_entries"); entries != 2 {
+		t.Errorf("test_cache_entries should be 2, got %v", entries)
+	}
+	if metrics.counter("test_cache_evictions") != 1 || metrics.counter("test_cache_hits") != 2 || metrics.counter("test_cache_misses") != 1 {
+		t.Errorf("Unexpected cache metrics %v", metrics.counters)
+	}
+
+	cache.Delete("a")
+	cache.Set("expired", 4, -time.Second)
+	if _, ok := cache.Get("expired"); ok {
+		t.Error("Expired entries shouldn't be returned")
+	}
+	if keys := cache.Keys(); len(keys) != 1 || keys[0] != "c" {
+		t.Errorf("Only c should be left, got %v", keys)
+	}
+}
+
+func TestInstrumentCaches(t *testing.T) {
+	metrics := newCountingMetrics()
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Metrics:          metrics,
+		MaxCacheEntries:  10,
+		IdempotencyStore: NewMemoryIdempotencyStore(),
+		RevocationStore:  NewMemoryRevocationStore(),
+		ActivityStore:    NewMemoryActivityStore(),
+		QuotaStore:       NewMemoryQuotaStore(),
+		MaxLoginAttempts: 3,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+	if err := authMiddleware.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		authMiddleware.IdempotencyStore.Set(key, "token", time.Hour)
+		authMiddleware.RevocationStore.Revoke(key, time.Hour)
+		authMiddleware.ActivityStore.SetLastSeen(key, time.Now(), time.Hour)
+		authMiddleware.QuotaStore.Increment(key, time.Hour)
+		authMiddleware.loginThrottle.fail(key, time.Now(), 3, time.Hour)
+	}
+	if entries, _ := metrics.gauge("idempotency_cache_entries"); entries != 10 {
+		t.Errorf("The idempotency store should be bounded, got %v entries", entries)
+	}
+	// evicting revoked tokens would let them through again
+	if !authMiddleware.RevocationStore.IsRevoked("key0") {
+		t.Error("Revoked keys should never be evicted")
+	}
+	if entries, _ := metrics.gauge("revocation_cache_entries"); entries != 20 {
+		t.Errorf("revocation_cache_entries should be 20, got %v", entries)
+	}
+	// nor can the lockouts, last-seen times and quotas of users be cleared by filling the caches
+	for _, name := range []string{"activity", "quota", "login_throttle"} {
+		if entries, _ := metrics.gauge(name + "_cache_entries"); entries != 20 {
+			t.Errorf("%s_cache_entries should be 20, got %v", name, entries)
+		}
+	}
+	if _, ok := authMiddleware.ActivityStore.LastSeen("key0"); !ok {
+		t.Error("Last-seen times should never be evicted")
+	}
+}
+
+func TestTTLCacheSetIfAbsent(t *testing.T) {
+	cache := newTTLCache()
+	if !cache.SetIfAbsent("key", 1, time.Hour) {
+		t.Error("A missing key should be set")
+	}
+	if cache.SetIfAbsent("key", 2, time.Hour) {
+		t.Error("A present key shouldn't be set")
+	}
+	if value, _ := cache.Get("key"); value != 1 {
+		t.Errorf("The first value should be kept, got %v", value)
+	}
+	cache.Set("expired", 1, -time.Second)
+	if !cache.SetIfAbsent("expired", 2, time.Hour) {
+		t.Error("An expired key should be set")
+	}
+}
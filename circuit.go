@@ -0,0 +1,88 @@
+package jwt
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by CircuitBreaker.Call while the circuit is open.
+var ErrCircuitOpen = errors.New("Circuit open")
+
+// CircuitBreaker stops calling a failing dependency, e.g. a JWKS endpoint or a Redis backed
+// store, after Threshold consecutive failures. While the circuit is open, calls fail immediately
+// with ErrCircuitOpen instead of waiting for the dependency to time out on every request. After
+// Cooldown, a single call is let through to probe whether the dependency recovered.
+// The zero value uses the defaults and is safe for concurrent use.
+type CircuitBreaker struct {
+	// Number of consecutive failures after which the circuit opens. Optional, defaults to 5.
+	Threshold int
+
+	// Duration for which the circuit stays open. Optional, defaults to 30 seconds.
+	Cooldown time.Duration
+
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// Call calls fn unless the circuit is open, and records its outcome.
+func (cb *CircuitBreaker) Call(fn func() error) error {
+	if !cb.allow() {
+		return ErrCircuitOpen
+	}
+	err := fn()
+	cb.record(err)
+	return err
+}
+
+// Open reports whether the circuit is currently open.
+func (cb *CircuitBreaker) Open() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return time.Now().Before(cb.openUntil)
+}
+
+func (cb *CircuitBreaker) allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if time.Now().Before(cb.openUntil) {
+		return false
+	}
+	if cb.failures >= cb.threshold() {
+		// half open, keep the circuit open for other calls while probing
+		cb.openUntil = time.Now().Add(cb.cooldown())
+	}
+	return true
+}
+
+func (cb *CircuitBreaker) record(err error) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if err == nil {
+		cb.failures = 0
+		cb.openUntil = time.Time{}
+		return
+	}
+	cb.failures++
+	if cb.failures >= cb.threshold() {
+		cb.openUntil = time.Now().Add(cb.cooldown())
+	}
+}
+
+func (cb *CircuitBreaker) threshold() int {
+	if cb.Threshold == 0 {
+		return 5
+	}
+	return cb.Threshold
+}
+
+func (cb *CircuitBreaker) cooldown() time.Duration {
+	if cb.Cooldown == 0 {
+		return 30 * time.Second
+	}
+	return cb.Cooldown
+}
@@ -0,0 +1,94 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := &CircuitBreaker{Threshold: 2, Cooldown: 50 * time.Millisecond}
+	failure := errors.New("Backend down")
+	calls := 0
+	fail := func() error {
+		calls++
+		return failure
+	}
+
+	breaker.Call(fail)
+	if breaker.Open() {
+		t.Errorf("Circuit should stay closed below the threshold")
+	}
+	breaker.Call(fail)
+	if !breaker.Open() {
+		t.Errorf("Circuit should open at the threshold")
+	}
+	if err := breaker.Call(fail); err != ErrCircuitOpen || calls != 2 {
+		t.Errorf("Open circuit should fail fast, got %v after %d calls", err, calls)
+	}
+
+	// after the cooldown a failing probe opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	if err := breaker.Call(fail); err != failure || calls != 3 {
+		t.Errorf("Probe should call the backend, got %v after %d calls", err, calls)
+	}
+	if !breaker.Open() {
+		t.Errorf("Failed probe should open the circuit")
+	}
+
+	// a successful probe closes it
+	time.Sleep(60 * time.Millisecond)
+	if err := breaker.Call(func() error { return nil }); err != nil {
+		t.Errorf("Probe should succeed, got %v", err)
+	}
+	if breaker.Open() {
+		t.Errorf("Successful probe should close the circuit")
+	}
+}
+
+func TestKeySetCircuitBreaker(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	down := false
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if down {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=0")
+		keySetHandler(privKey, "key-1")(w, r)
+	}))
+	defer server.Close()
+
+	keySet := NewKeySet(server.URL)
+	keySet.Breaker = &CircuitBreaker{Threshold: 2, Cooldown: time.Hour}
+
+	if _, err := keySet.Key("key-1"); err != nil {
+		t.Fatalf("Fetching key failed: %v", err)
+	}
+
+	// fail-closed rejects while the endpoint is down, and stops calling it once the circuit opens
+	down = true
+	for i := 0; i < 5; i++ {
+		if _, err := keySet.Key("key-1"); err == nil {
+			t.Errorf("Fail-closed key set should fail while the endpoint is down")
+		}
+	}
+	if fetches != 3 {
+		t.Errorf("Expected 3 fetches, got %d", fetches)
+	}
+
+	// fail-open keeps using the last keys
+	keySet.FailOpen = true
+	if _, err := keySet.Key("key-1"); err != nil {
+		t.Errorf("Fail-open key set should use the cached key, got %v", err)
+	}
+	if _, err := keySet.Key("key-2"); err == nil {
+		t.Errorf("Unknown key id should still fail")
+	}
+}
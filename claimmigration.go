@@ -0,0 +1,74 @@
+package jwt
+
+import (
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ClaimMigration upgrades the claims of tokens issued with an older claims schema, see
+// ClaimMigrations.
+type ClaimMigration struct {
+	// Name of the migration, e.g. "uid_to_id". Tokens changed by the migration are counted in the
+	// "claim_migration_NAME" metric, which drops to zero once the tokens with the old claims are
+	// gone and the migration can be removed.
+	Name string
+
+	// Callback function that migrates claims in place, and reports whether it changed them.
+	Migrate func(claims map[string]interface{}) bool
+}
+
+// RenameClaim returns a ClaimMigration named "rename_FROM" moving the claim from to the claim to,
+// unless the token already has the claim to, in which case from is dropped.
+func RenameClaim(from, to string) ClaimMigration {
+	return ClaimMigration{
+		Name: "rename_" + from,
+		Migrate: func(claims map[string]interface{}) bool {
+			value, ok := claims[from]
+			if !ok {
+				return false
+			}
+			if _, ok := claims[to]; !ok {
+				claims[to] = value
+			}
+			delete(claims, from)
+			return true
+		},
+	}
+}
+
+// SplitClaim returns a ClaimMigration named "split_NAME" turning the string claim name into a
+// list of strings split at separator, e.g. SplitClaim("roles", ",") for "admin,editor", or around
+// whitespace if separator is empty. Items are trimmed and empty items dropped.
+func SplitClaim(name, separator string) ClaimMigration {
+	return ClaimMigration{
+		Name: "split_" + name,
+		Migrate: func(claims map[string]interface{}) bool {
+			value, ok := claims[name].(string)
+			if !ok {
+				return false
+			}
+			parts := strings.Fields(value)
+			if separator != "" {
+				parts = strings.Split(value, separator)
+			}
+			items := []interface{}{}
+			for _, part := range parts {
+				if part = strings.TrimSpace(part); part != "" {
+					items = append(items, part)
+				}
+			}
+			claims[name] = items
+			return true
+		},
+	}
+}
+
+// migrateClaims applies the ClaimMigrations to the claims of a verified token.
+func (mw *JWTMiddleware) migrateClaims(token *jwt.Token) {
+	for _, migration := range mw.ClaimMigrations {
+		if migration.Migrate(token.Claims) {
+			mw.Metrics.IncCounter("claim_migration_" + migration.Name)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package jwt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestClaimMigrations(t *testing.T) {
+	metrics := newCountingMetrics()
+	authMiddleware := &JWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		MaxRefresh:      24 * time.Hour,
+		Authenticator:   rejectLogin,
+		Metrics:         metrics,
+		ClaimMigrations: []ClaimMigration{RenameClaim("uid", "id"), SplitClaim("roles", ",")},
+	}
+
+	var claims map[string]interface{}
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/", func(w rest.ResponseWriter, r *rest.Request) {
+			claims = ExtractClaims(r)
+			w.WriteJson(map[string]interface{}{"user": r.Env["REMOTE_USER"]})
+		}),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+	)
+	api.SetApp(router)
+	request := func(path, tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["uid"] = "alice"
+	token.Claims["roles"] = "editor, reviewer,"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["orig_iat"] = time.Now().Unix()
+	oldToken, _ := token.SignedString(key)
+
+	recorded := request("/", oldToken)
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"user":"alice"}`)
+	if _, ok := claims["uid"]; ok || !reflect.DeepEqual(claims["roles"], []interface{}{"editor", "reviewer"}) {
+		t.Errorf("The claims should be migrated, got %v", claims)
+	}
+	if metrics.counter("claim_migration_rename_uid") != 1 || metrics.counter("claim_migration_split_roles") != 1 {
+		t.Errorf("The migrations should be counted, got %v", metrics.counters)
+	}
+
+	// refreshed tokens have the current claims
+	recorded = request("/refresh", oldToken)
+	recorded.CodeIs(200)
+	refreshed := DecoderToken{}
+	recorded.DecodeJsonPayload(&refreshed)
+	request("/", refreshed.Token).CodeIs(200)
+	// verified by the middleware and the RefreshHandler
+	if metrics.counter("claim_migration_rename_uid") != 3 {
+		t.Errorf("Refreshed tokens shouldn't need migrations, got %v", metrics.counters)
+	}
+	parsed, _ := jwt.Parse(refreshed.Token, func(*jwt.Token) (interface{}, error) { return key, nil })
+	if parsed.Claims["id"] != "alice" || parsed.Claims["uid"] != nil {
+		t.Errorf("Refreshed tokens should be issued with the migrated claims, got %v", parsed.Claims)
+	}
+
+	// tokens with both claims keep the current one
+	request("/", makeTokenString("admin", key)).BodyIs(`{"user":"admin"}`)
+	claims = map[string]interface{}{"uid": "alice", "id": "admin"}
+	RenameClaim("uid", "id").Migrate(claims)
+	if !reflect.DeepEqual(claims, map[string]interface{}{"id": "admin"}) {
+		t.Errorf("The current claim should be kept, got %v", claims)
+	}
+	claims = map[string]interface{}{"roles": "editor  reviewer"}
+	SplitClaim("roles", "").Migrate(claims)
+	if !reflect.DeepEqual(claims["roles"], []interface{}{"editor", "reviewer"}) {
+		t.Errorf("Claims should be split around whitespace, got %v", claims)
+	}
+
+	authMiddleware.ClaimMigrations = append(authMiddleware.ClaimMigrations, ClaimMigration{Name: "incomplete"})
+	problems := authMiddleware.Validate()
+	if len(problems) == 0 || problems[len(problems)-1].Error() != "ClaimMigrations[2]: Name and Migrate are required" {
+		t.Errorf("Validate should report incomplete migrations, got %v", problems)
+	}
+}
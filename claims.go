@@ -0,0 +1,108 @@
+package jwt
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Accessors for the claims of tokens. jwt-go decodes numbers as float64, or as json.Number if
+// UseJSONNumber is set, and the claims of tokens being issued hold the values set by the
+// application, e.g. int64. The accessors accept all of them, so that code reading claims doesn't
+// depend on the decoding.
+
+// GetString returns the string claim name.
+func GetString(claims map[string]interface{}, name string) (string, bool) {
+	value, ok := claims[name].(string)
+	return value, ok
+}
+
+// GetInt64 returns the integer claim name. Numbers decoded as float64 from 2^53 on may have lost
+// their precision and are rejected, set UseJSONNumber to use such integers, e.g. large user ids.
+func GetInt64(claims map[string]interface{}, name string) (int64, bool) {
+	return int64Value(claims[name])
+}
+
+// GetTime returns the numeric date claim name (RFC 7519), e.g. "exp" or "iat".
+func GetTime(claims map[string]interface{}, name string) (time.Time, bool) {
+	return timeValue(claims[name])
+}
+
+// GetStringSlice returns the claim name as list of strings, accepting both a single string and an
+// array like the "aud" claim does. Items of the array that aren't strings are ignored.
+func GetStringSlice(claims map[string]interface{}, name string) ([]string, bool) {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}, true
+	case []string:
+		return value, true
+	case []interface{}:
+		return stringList(value), true
+	}
+	return nil, false
+}
+
+// integers from 2^53 on may have been rounded when decoded as float64
+const maxExactFloat = 1 << 53
+
+func int64Value(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) >= maxExactFloat {
+			return 0, false
+		}
+		return int64(v), true
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return 0, false
+		}
+		return int64Value(f)
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// numericValue returns a numeric claim as float64, e.g. to compare numeric dates.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func timeValue(value interface{}) (time.Time, bool) {
+	seconds, ok := numericValue(value)
+	// beyond the range of int64, converting is undefined
+	if !ok || math.IsNaN(seconds) || math.Abs(seconds) >= math.MaxInt64 {
+		return time.Time{}, false
+	}
+	whole := math.Floor(seconds)
+	return time.Unix(int64(whole), int64((seconds-whole)*1e9)), true
+}
+
+// claimString formats a string or integer claim, e.g. a numeric user id.
+func claimString(value interface{}) (string, bool) {
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	if i, ok := int64Value(value); ok {
+		return strconv.FormatInt(i, 10), true
+	}
+	return "", false
+}
@@ -0,0 +1,104 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestClaimAccessors(t *testing.T) {
+	claims := map[string]interface{}{
+		"name":     "admin",
+		"float":    float64(42),
+		"fraction": 1.5,
+		"large":    float64(1<<53 + 2),
+		"number":   json.Number("9007199254740993"),
+		"int64":    int64(7),
+		"exp":      json.Number("1700000000.25"),
+		"aud":      "api",
+		"scopes":   []interface{}{"read", 1, "write"},
+	}
+
+	if name, ok := GetString(claims, "name"); !ok || name != "admin" {
+		t.Errorf("Unexpected string claim %q", name)
+	}
+	if _, ok := GetString(claims, "float"); ok {
+		t.Error("Numbers aren't strings")
+	}
+
+	for name, expected := range map[string]int64{"float": 42, "number": 9007199254740993, "int64": 7} {
+		if value, ok := GetInt64(claims, name); !ok || value != expected {
+			t.Errorf("Claim %s should be %d, got %d", name, expected, value)
+		}
+	}
+	for _, name := range []string{"fraction", "large", "name", "missing"} {
+		if value, ok := GetInt64(claims, name); ok {
+			t.Errorf("Claim %s isn't an exact integer, got %d", name, value)
+		}
+	}
+
+	if exp, ok := GetTime(claims, "exp"); !ok || !exp.Equal(time.Unix(1700000000, 250000000)) {
+		t.Errorf("Unexpected numeric date %v", exp)
+	}
+	if _, ok := GetTime(map[string]interface{}{"exp": json.Number("1e400")}, "exp"); ok {
+		t.Error("Numeric dates beyond int64 should be rejected")
+	}
+
+	if aud, ok := GetStringSlice(claims, "aud"); !ok || len(aud) != 1 || aud[0] != "api" {
+		t.Errorf("Unexpected audience %v", aud)
+	}
+	if scopes, ok := GetStringSlice(claims, "scopes"); !ok || len(scopes) != 2 || scopes[1] != "write" {
+		t.Errorf("Unexpected scopes %v", scopes)
+	}
+}
+
+func TestUseJSONNumber(t *testing.T) {
+	now := time.Now().Unix()
+	largeId := signPayload([]byte(fmt.Sprintf(`{"id":9007199254740993,"exp":%d,"orig_iat":%d}`, now+3600, now)))
+	expired := signPayload([]byte(fmt.Sprintf(`{"id":"admin","exp":%d}`, now-3600)))
+
+	for _, useJSONNumber := range []bool{false, true} {
+		authMiddleware := &JWTMiddleware{
+			Realm:         "test zone",
+			Key:           key,
+			Timeout:       time.Hour,
+			MaxRefresh:    time.Hour * 24,
+			Authenticator: rejectLogin,
+			UseJSONNumber: useJSONNumber,
+		}
+
+		api := rest.NewApi()
+		api.Use(authMiddleware)
+		router, _ := rest.MakeRouter(
+			rest.Get("/", func(w rest.ResponseWriter, r *rest.Request) {
+				w.WriteJson(map[string]string{"id": r.Env["REMOTE_USER"].(string)})
+			}),
+			rest.Get("/refresh", authMiddleware.RefreshHandler),
+		)
+		api.SetApp(router)
+		handler := api.MakeHandler()
+		request := func(path, tokenString string) *test.Recorded {
+			req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+			req.Header.Set("Authorization", "Bearer "+tokenString)
+			return test.RunRequest(t, handler, req)
+		}
+
+		request("/", expired).CodeIs(401)
+		if !useJSONNumber {
+			// decoded as float64, the id has lost its precision
+			request("/", largeId).CodeIs(401)
+			continue
+		}
+
+		request("/", largeId).BodyIs(`{"id":"9007199254740993"}`)
+		recorded := request("/refresh", largeId)
+		recorded.CodeIs(200)
+		refreshed := DecoderToken{}
+		recorded.DecodeJsonPayload(&refreshed)
+		request("/", refreshed.Token).BodyIs(`{"id":"9007199254740993"}`)
+	}
+}
@@ -0,0 +1,217 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Grant types of a Client.
+const (
+	GrantPassword          = "password"
+	GrantClientCredentials = "client_credentials"
+)
+
+// ClientSubjectPrefix prefixes the client id in the "id" claim of the tokens issued by
+// ClientCredentialsHandler, so that clients never share the identity of a user, e.g. in the
+// Authorizator or the RevocationStore. LoginHandler rejects user ids with this prefix when Clients
+// is set.
+const ClientSubjectPrefix = "client:"
+
+// Client is a first-party application registered with the middleware, getting its own token
+// policy.
+type Client struct {
+	// Client id, sent as "client_id" by the application and set as "client_id" claim.
+	Id string
+
+	// Hash of the client secret as returned by HashClientSecret. Optional, clients without secret
+	// (e.g. single page applications) can only use GrantPassword.
+	SecretHash string
+
+	// Grant types the client may use, GrantPassword for LoginHandler and GrantClientCredentials for
+	// ClientCredentialsHandler.
+	GrantTypes []string
+
+	// Validity of the tokens issued to the client. Optional, defaults to the Timeout of the middleware.
+	Timeout time.Duration
+
+	// MaxRefresh of the tokens issued to the client. Optional, defaults to the MaxRefresh of the
+	// middleware.
+	MaxRefresh time.Duration
+
+	// Scopes the tokens of the client may carry. Tokens get all of them unless PayloadFunc sets a
+	// "scope" claim, which is then restricted to these.
+	// Optional, by default scopes aren't restricted.
+	Scopes []string
+}
+
+// ClientRegistry provides the registered clients. Implementations must be safe for concurrent use.
+type ClientRegistry interface {
+	// Client returns the client with the given id.
+	Client(id string) (*Client, bool)
+}
+
+type memoryClientRegistry map[string]*Client
+
+// NewClientRegistry returns a ClientRegistry of the given clients.
+func NewClientRegistry(clients ...*Client) ClientRegistry {
+	registry := memoryClientRegistry{}
+	for _, client := range clients {
+		registry[client.Id] = client
+	}
+	return registry
+}
+
+func (r memoryClientRegistry) Client(id string) (*Client, bool) {
+	client, ok := r[id]
+	return client, ok
+}
+
+// HashClientSecret returns the hash of a client secret to store in Client.SecretHash. Client
+// secrets are random high entropy strings, so a fast hash is sufficient.
+func HashClientSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// authenticateClient returns the registered client with the given credentials, if it may use
+// grantType.
+func (mw *JWTMiddleware) authenticateClient(id string, secret string, grantType string) (*Client, bool) {
+	client, ok := mw.Clients.Client(id)
+	if !ok || !containsString(client.GrantTypes, grantType) {
+		return nil, false
+	}
+	if client.SecretHash == "" {
+		return client, grantType == GrantPassword && secret == ""
+	}
+	hash := HashClientSecret(secret)
+	return client, subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash)) == 1
+}
+
+// setClientClaims applies the policy of client to a new token.
+func (mw *JWTMiddleware) setClientClaims(token *jwt.Token, client *Client) {
+	token.Claims["client_id"] = client.Id
+	if client.Timeout != 0 {
+		token.Claims["exp"] = mw.Clock.Now().Add(client.Timeout).Unix()
+	}
+	if len(client.Scopes) == 0 {
+		return
+	}
+	scopes := client.Scopes
+	if _, ok := token.Claims["scope"]; ok {
+		scopes = []string{}
+		for _, scope := range defaultScopesFunc(token.Claims) {
+			if containsString(client.Scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	token.Claims["scope"] = strings.Join(scopes, " ")
+}
+
+// tokenClient returns the registered client a token was issued to.
+func (mw *JWTMiddleware) tokenClient(claims map[string]interface{}) (*Client, bool) {
+	if mw.Clients == nil {
+		return nil, false
+	}
+	clientId, ok := claims["client_id"].(string)
+	if !ok {
+		return nil, false
+	}
+	return mw.Clients.Client(clientId)
+}
+
+type clientCredentials struct {
+	GrantType    string `json:"grant_type"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// ClientCredentialsHandler can be used by registered clients to get a token for themselves, as
+// in the OAuth 2.0 client credentials grant. Payload needs to be json in the form of
+// {"client_id": "ID", "client_secret": "SECRET"}, optionally with "grant_type":
+// "client_credentials", and is limited like the payload of LoginHandler. The token has the client
+// id prefixed with ClientSubjectPrefix as "id" claim, the client id as "client_id" claim, the
+// scopes of the client, and can't be refreshed.
+// Like LoginHandler, it responds with a 404 for verifiers and a 503 during maintenance.
+// Reply will be of the form {"token": "TOKEN"}.
+func (mw *JWTMiddleware) ClientCredentialsHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	// verifiers don't issue tokens
+	if mw.Authenticator == nil {
+		rest.NotFound(writer, request)
+		return
+	}
+
+	if mw.handleCORS(writer, request) {
+		return
+	}
+
+	if mw.loginUnavailable(writer) {
+		return
+	}
+
+	credentials := clientCredentials{}
+	status, err := mw.decodeLogin(request, &credentials)
+	if status == http.StatusRequestEntityTooLarge || status == http.StatusUnsupportedMediaType {
+		rest.Error(writer, err.Error(), status)
+		return
+	}
+	if mw.Clients == nil || err != nil {
+		mw.unauthorized(writer)
+		return
+	}
+	if credentials.GrantType != "" && credentials.GrantType != GrantClientCredentials {
+		errorWithCode(writer, "Unsupported grant type", "unsupported_grant_type", http.StatusBadRequest)
+		return
+	}
+	client, ok := mw.authenticateClient(credentials.ClientId, credentials.ClientSecret, GrantClientCredentials)
+	if !ok {
+		mw.unauthorized(writer)
+		return
+	}
+	subject := ClientSubjectPrefix + client.Id
+	if mw.quotaExceeded(writer, subject) {
+		return
+	}
+
+	format := mw.defaultTokenFormat()
+	token := jwt.New(jwt.GetSigningMethod(format.SigningAlgorithm))
+	now := mw.Clock.Now()
+	token.Claims["id"] = subject
+	token.Claims["iat"] = now.Unix()
+	token.Claims["exp"] = now.Add(mw.Timeout).Unix()
+	token.Claims["token_use"] = TokenUseAccess
+	if mw.Issuer != "" {
+		token.Claims["iss"] = mw.Issuer
+	}
+	mw.setClientClaims(token, client)
+	if mw.Audience != "" {
+		token.Claims["aud"] = mw.Audience
+	}
+
+	if !mw.validIssuedClaims(writer, request, token.Claims) {
+		return
+	}
+
+	tokenString, err := mw.signToken(token, format, subject)
+	if err != nil {
+		rest.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	mw.storeToken(subject, tokenString)
+	mw.recordActivity(tokenString)
+
+	mw.exposeIssuedUser(request, subject)
+	mw.LoginCallback(tokenString, request, writer)
+}
@@ -0,0 +1,136 @@
+package jwt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestClients(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+
+	authMiddleware := &JWTMiddleware{
+		Realm:      "test zone",
+		Key:        key,
+		Timeout:    time.Hour,
+		MaxRefresh: 24 * time.Hour,
+		Clock:      clock,
+		Authenticator: func(userId string, password string) bool {
+			return password == "admin"
+		},
+		PayloadFunc: func(userId string) map[string]interface{} {
+			return map[string]interface{}{"scope": "read write admin"}
+		},
+		Clients: NewClientRegistry(
+			&Client{
+				Id:         "spa",
+				GrantTypes: []string{GrantPassword},
+				Timeout:    5 * time.Minute,
+				MaxRefresh: time.Hour,
+				Scopes:     []string{"read", "write"},
+			},
+			&Client{
+				Id:         "worker",
+				SecretHash: HashClientSecret("s3cret"),
+				GrantTypes: []string{GrantClientCredentials},
+				Scopes:     []string{"jobs"},
+			},
+		),
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	login := func(payload map[string]string) *test.Recorded {
+		return test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", payload))
+	}
+	parse := func(recorded *test.Recorded) *jwt.Token {
+		nToken := DecoderToken{}
+		test.DecodeJsonPayload(recorded.Recorder, &nToken)
+		token, err := authMiddleware.parseTokenString(nToken.Token)
+		if err != nil {
+			t.Fatalf("Issued token is invalid: %s", err)
+		}
+		return token
+	}
+
+	// the client id is required
+	login(map[string]string{"username": "admin", "password": "admin"}).CodeIs(401)
+	login(map[string]string{"username": "admin", "password": "admin", "client_id": "unknown"}).CodeIs(401)
+	// the worker may only use client credentials
+	login(map[string]string{"username": "admin", "password": "admin", "client_id": "worker", "client_secret": "s3cret"}).CodeIs(401)
+	// users can't take the identity of a client
+	login(map[string]string{"username": "client:worker", "password": "admin", "client_id": "spa"}).CodeIs(401)
+	// public clients don't have a secret
+	login(map[string]string{"username": "admin", "password": "admin", "client_id": "spa", "client_secret": "guess"}).CodeIs(401)
+
+	recorded := login(map[string]string{"username": "admin", "password": "admin", "client_id": "spa"})
+	recorded.CodeIs(200)
+	token := parse(recorded)
+	if token.Claims["client_id"] != "spa" {
+		t.Errorf("client_id should be spa, got %v", token.Claims["client_id"])
+	}
+	if token.Claims["scope"] != "read write" {
+		t.Errorf("scope should be restricted to the client scopes, got %v", token.Claims["scope"])
+	}
+	if exp := int64(token.Claims["exp"].(float64)); exp != clock.now.Add(5*time.Minute).Unix() {
+		t.Errorf("exp should use the client timeout, got %d", exp)
+	}
+
+	// the refresh limit of the client applies
+	refreshApi := rest.NewApi()
+	refreshApi.Use(authMiddleware)
+	refreshApi.SetApp(rest.AppSimple(authMiddleware.RefreshHandler))
+	refresh := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, refreshApi.MakeHandler(), req)
+	}
+
+	tokenString, _ := token.SignedString(key)
+	clock.now = clock.now.Add(4 * time.Minute)
+	recorded = refresh(tokenString)
+	recorded.CodeIs(200)
+	refreshed := parse(recorded)
+	if exp := int64(refreshed.Claims["exp"].(float64)); exp != clock.now.Add(5*time.Minute).Unix() {
+		t.Errorf("refreshed exp should use the client timeout, got %d", exp)
+	}
+
+	refreshedString, _ := refreshed.SignedString(key)
+	clock.now = clock.now.Add(57 * time.Minute)
+	refresh(refreshedString).CodeIs(401)
+
+	// client credentials
+	credentialsApi := rest.NewApi()
+	credentialsApi.SetApp(rest.AppSimple(authMiddleware.ClientCredentialsHandler))
+	credentials := func(payload map[string]string) *test.Recorded {
+		return test.RunRequest(t, credentialsApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", payload))
+	}
+
+	credentials(map[string]string{"client_id": "worker", "client_secret": "wrong"}).CodeIs(401)
+	credentials(map[string]string{"client_id": "spa"}).CodeIs(401)
+	credentials(map[string]string{"grant_type": "password", "client_id": "worker", "client_secret": "s3cret"}).CodeIs(400)
+	credentials(map[string]string{"client_id": "worker", "client_secret": strings.Repeat("x", 5000)}).CodeIs(413)
+	req := test.MakeSimpleRequest("POST", "http://localhost/", map[string]string{"client_id": "worker", "client_secret": "s3cret"})
+	req.Header.Set("Content-Type", "text/plain")
+	test.RunRequest(t, credentialsApi.MakeHandler(), req).CodeIs(415)
+	authMiddleware.SetMaintenanceMode(MaintenanceNoLogins, 0)
+	credentials(map[string]string{"client_id": "worker", "client_secret": "s3cret"}).CodeIs(503)
+	authMiddleware.SetMaintenanceMode(MaintenanceOff, 0)
+
+	recorded = credentials(map[string]string{"grant_type": "client_credentials", "client_id": "worker", "client_secret": "s3cret"})
+	recorded.CodeIs(200)
+	token = parse(recorded)
+	if token.Claims["id"] != "client:worker" || token.Claims["client_id"] != "worker" {
+		t.Errorf("Client credentials token should identify the client, got %v", token.Claims)
+	}
+	if token.Claims["scope"] != "jobs" {
+		t.Errorf("scope should be the client scopes, got %v", token.Claims["scope"])
+	}
+	if _, ok := token.Claims["orig_iat"]; ok {
+		t.Error("Client credentials token shouldn't be refreshable")
+	}
+}
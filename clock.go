@@ -0,0 +1,15 @@
+package jwt
+
+import "time"
+
+// Clock provides the current time used to issue and verify tokens. Replacing it allows tests to
+// freeze time, and deployments to use e.g. a leap-second smeared time source.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
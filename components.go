@@ -0,0 +1,272 @@
+package jwt
+
+import (
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// Verifier is the verifying half of a JWTMiddleware, for resource servers that accept tokens but
+// never issue them. It only offers the middleware, guards and handlers verifying tokens, and
+// doesn't require an Authenticator.
+type Verifier struct {
+	mw *JWTMiddleware
+}
+
+// Issuer is the issuing half of a JWTMiddleware, for authentication servers that hand out tokens
+// to other services. It only offers the handlers issuing and revoking tokens.
+type Issuer struct {
+	mw *JWTMiddleware
+}
+
+// VerifierOption configures the middleware of NewVerifier.
+type VerifierOption func(mw *JWTMiddleware)
+
+// NewVerifier returns a Verifier of the tokens signed with key, e.g. for a microservice trusting
+// the tokens of a central login service. It never issues tokens, and doesn't require a Realm,
+// which defaults to "jwt", nor an Authenticator.
+func NewVerifier(key []byte, options ...VerifierOption) *Verifier {
+	mw := &JWTMiddleware{Key: key}
+	for _, option := range options {
+		option(mw)
+	}
+	return mw.AsVerifier()
+}
+
+// WithRealm sets the Realm of the middleware of NewVerifier.
+func WithRealm(realm string) VerifierOption {
+	return func(mw *JWTMiddleware) {
+		mw.Realm = realm
+	}
+}
+
+// WithSigningAlgorithm sets the SigningAlgorithm of the middleware of NewVerifier.
+func WithSigningAlgorithm(algorithm string) VerifierOption {
+	return func(mw *JWTMiddleware) {
+		mw.SigningAlgorithm = algorithm
+	}
+}
+
+// WithIssuer sets the expected Issuer of the tokens verified by NewVerifier.
+func WithIssuer(issuer string) VerifierOption {
+	return func(mw *JWTMiddleware) {
+		mw.Issuer = issuer
+	}
+}
+
+// WithAudience sets the expected Audience of the tokens verified by NewVerifier.
+func WithAudience(audience string) VerifierOption {
+	return func(mw *JWTMiddleware) {
+		mw.Audience = audience
+	}
+}
+
+// WithConfig calls configure with the middleware of NewVerifier, to set any of its other fields,
+// e.g. the IdentityHandler or RevocationStore.
+func WithConfig(configure func(mw *JWTMiddleware)) VerifierOption {
+	return configure
+}
+
+// AsVerifier returns the Verifier of the configuration of mw. It must be called before Init, so
+// that the Authenticator isn't required.
+func (mw *JWTMiddleware) AsVerifier() *Verifier {
+	mw.verifyOnly = true
+	return &Verifier{mw: mw}
+}
+
+// AsIssuer returns the Issuer of the configuration of mw.
+func (mw *JWTMiddleware) AsIssuer() *Issuer {
+	return &Issuer{mw: mw}
+}
+
+// Init validates the configuration and fills in the defaults, see JWTMiddleware.Init.
+func (v *Verifier) Init() error {
+	return v.mw.Init()
+}
+
+// MiddlewareFunc makes Verifier implement the Middleware interface.
+func (v *Verifier) MiddlewareFunc(handler rest.HandlerFunc) rest.HandlerFunc {
+	return v.mw.MiddlewareFunc(handler)
+}
+
+// VerifyHandler checks the validity of a token, see JWTMiddleware.VerifyHandler.
+func (v *Verifier) VerifyHandler(writer rest.ResponseWriter, request *rest.Request) {
+	v.mw.VerifyHandler(writer, request)
+}
+
+// AuthRequestHandler authenticates the subrequests of edge proxies, see
+// JWTMiddleware.AuthRequestHandler.
+func (v *Verifier) AuthRequestHandler(writer rest.ResponseWriter, request *rest.Request) {
+	v.mw.AuthRequestHandler(writer, request)
+}
+
+// RequireScopes returns a guard checking the scopes of the token, see JWTMiddleware.RequireScopes.
+func (v *Verifier) RequireScopes(scopes ...string) rest.MiddlewareSimple {
+	return v.mw.RequireScopes(scopes...)
+}
+
+// RequireMFA returns a guard checking the token attests multi-factor authentication, see
+// JWTMiddleware.RequireMFA.
+func (v *Verifier) RequireMFA(maxAge time.Duration) rest.MiddlewareSimple {
+	return v.mw.RequireMFA(maxAge)
+}
+
+// RequireVerifiedEmail returns a guard checking the token attests a verified email, see
+// JWTMiddleware.RequireVerifiedEmail.
+func (v *Verifier) RequireVerifiedEmail() rest.MiddlewareSimple {
+	return v.mw.RequireVerifiedEmail()
+}
+
+// RequireChecks returns a guard running a chain of authorization checks, see
+// JWTMiddleware.RequireChecks.
+func (v *Verifier) RequireChecks(checks ...AuthorizationCheck) rest.MiddlewareSimple {
+	return v.mw.RequireChecks(checks...)
+}
+
+// RequireBodyBoundToken returns a middleware verifying tokens bound to the request body, see
+// JWTMiddleware.RequireBodyBoundToken.
+func (v *Verifier) RequireBodyBoundToken() rest.MiddlewareSimple {
+	return v.mw.RequireBodyBoundToken()
+}
+
+// Stack returns the middlewares of stack with the verifying middleware inside of the access logs,
+// see JWTMiddleware.Stack.
+func (v *Verifier) Stack(stack ...rest.Middleware) []rest.Middleware {
+	return v.mw.Stack(stack...)
+}
+
+// WithPolicy returns a middleware verifying requests and enforcing policy on top, see
+// JWTMiddleware.WithPolicy.
+func (v *Verifier) WithPolicy(policy Policy) rest.Middleware {
+	return v.mw.WithPolicy(policy)
+}
+
+// Authenticate verifies a token outside of HTTP, see JWTMiddleware.Authenticate.
+func (v *Verifier) Authenticate(tokenString string) (*AuthInfo, error) {
+	return v.mw.Authenticate(tokenString)
+}
+
+// Check authorizes an action outside of HTTP, see JWTMiddleware.Check.
+func (v *Verifier) Check(info *AuthInfo, action string, resource string) error {
+	return v.mw.Check(info, action, resource)
+}
+
+// CheckPolicy checks a policy outside of HTTP, see JWTMiddleware.CheckPolicy.
+func (v *Verifier) CheckPolicy(info *AuthInfo, policy Policy) error {
+	return v.mw.CheckPolicy(info, policy)
+}
+
+// AuthorizeRoutes wraps routes with the RouteScopes and RouteAuthorizator checks, see
+// JWTMiddleware.AuthorizeRoutes.
+func (v *Verifier) AuthorizeRoutes(routes ...*rest.Route) []*rest.Route {
+	return v.mw.AuthorizeRoutes(routes...)
+}
+
+// ParseInternalToken verifies a token minted by Issuer.MintInternalToken.
+func (v *Verifier) ParseInternalToken(tokenString string) (*AuthInfo, error) {
+	return v.mw.ParseInternalToken(tokenString)
+}
+
+// AcceptLogoutTicket rejects the tokens logged out by a sibling service, see
+// JWTMiddleware.AcceptLogoutTicket.
+func (v *Verifier) AcceptLogoutTicket(ticket string) error {
+	return v.mw.AcceptLogoutTicket(ticket)
+}
+
+// BackchannelLogoutHandler receives the logout tokens of an upstream OpenID provider, see
+// JWTMiddleware.BackchannelLogoutHandler.
+func (v *Verifier) BackchannelLogoutHandler(writer rest.ResponseWriter, request *rest.Request) {
+	v.mw.BackchannelLogoutHandler(writer, request)
+}
+
+// SetKey replaces the key verifying tokens, see JWTMiddleware.SetKey.
+func (v *Verifier) SetKey(key []byte) {
+	v.mw.SetKey(key)
+}
+
+// Init validates the configuration and fills in the defaults, see JWTMiddleware.Init.
+func (i *Issuer) Init() error {
+	return i.mw.Init()
+}
+
+// LoginHandler issues tokens for credentials, see JWTMiddleware.LoginHandler.
+func (i *Issuer) LoginHandler(writer rest.ResponseWriter, request *rest.Request) {
+	i.mw.LoginHandler(writer, request)
+}
+
+// RefreshHandler refreshes tokens, see JWTMiddleware.RefreshHandler.
+func (i *Issuer) RefreshHandler(writer rest.ResponseWriter, request *rest.Request) {
+	i.mw.RefreshHandler(writer, request)
+}
+
+// ClientCredentialsHandler issues tokens to registered clients, see
+// JWTMiddleware.ClientCredentialsHandler.
+func (i *Issuer) ClientCredentialsHandler(writer rest.ResponseWriter, request *rest.Request) {
+	i.mw.ClientCredentialsHandler(writer, request)
+}
+
+// ExternalLoginHandler issues tokens for users authenticated by adapter, see
+// JWTMiddleware.ExternalLoginHandler.
+func (i *Issuer) ExternalLoginHandler(adapter ExternalLoginAdapter) rest.HandlerFunc {
+	return i.mw.ExternalLoginHandler(adapter)
+}
+
+// CompleteLogin issues a token for a user authenticated by the application, see
+// JWTMiddleware.CompleteLogin.
+func (i *Issuer) CompleteLogin(writer rest.ResponseWriter, request *rest.Request, userId string, extraClaims map[string]interface{}) {
+	i.mw.CompleteLogin(writer, request, userId, extraClaims)
+}
+
+// SwitchTenantHandler issues tokens scoped to another tenant, see
+// JWTMiddleware.SwitchTenantHandler.
+func (i *Issuer) SwitchTenantHandler(writer rest.ResponseWriter, request *rest.Request) {
+	i.mw.SwitchTenantHandler(writer, request)
+}
+
+// LogoutHandler logs out the token of the request, see JWTMiddleware.LogoutHandler.
+func (i *Issuer) LogoutHandler(writer rest.ResponseWriter, request *rest.Request) {
+	i.mw.LogoutHandler(writer, request)
+}
+
+// FrontchannelLogoutHandler logs out browsers and redirects them, see
+// JWTMiddleware.FrontchannelLogoutHandler.
+func (i *Issuer) FrontchannelLogoutHandler(writer rest.ResponseWriter, request *rest.Request) {
+	i.mw.FrontchannelLogoutHandler(writer, request)
+}
+
+// ForgotPasswordHandler sends password reset tokens, see JWTMiddleware.ForgotPasswordHandler.
+func (i *Issuer) ForgotPasswordHandler(writer rest.ResponseWriter, request *rest.Request) {
+	i.mw.ForgotPasswordHandler(writer, request)
+}
+
+// ResetPasswordHandler resets passwords with reset tokens, see
+// JWTMiddleware.ResetPasswordHandler.
+func (i *Issuer) ResetPasswordHandler(writer rest.ResponseWriter, request *rest.Request) {
+	i.mw.ResetPasswordHandler(writer, request)
+}
+
+// CookieDomain returns the Domain attribute of token cookies, see JWTMiddleware.CookieDomain.
+func (i *Issuer) CookieDomain(request *rest.Request) string {
+	return i.mw.CookieDomain(request)
+}
+
+// RevokeToken revokes a token until it expires, see JWTMiddleware.RevokeToken.
+func (i *Issuer) RevokeToken(tokenString string) error {
+	return i.mw.RevokeToken(tokenString)
+}
+
+// MintInternalToken mints a token for background work, see JWTMiddleware.MintInternalToken.
+func (i *Issuer) MintInternalToken(info *AuthInfo, scopes []string, ttl time.Duration) (string, error) {
+	return i.mw.MintInternalToken(info, scopes, ttl)
+}
+
+// MintBodyBoundToken mints a one-time token bound to a request body, see
+// JWTMiddleware.MintBodyBoundToken.
+func (i *Issuer) MintBodyBoundToken(userId string, body []byte, ttl time.Duration) (string, error) {
+	return i.mw.MintBodyBoundToken(userId, body, ttl)
+}
+
+// SetKey replaces the key signing tokens, see JWTMiddleware.SetKey.
+func (i *Issuer) SetKey(key []byte) {
+	i.mw.SetKey(key)
+}
@@ -0,0 +1,95 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestVerifierAndIssuer(t *testing.T) {
+	issuer := (&JWTMiddleware{
+		Realm:   "auth",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return password == "admin"
+		},
+	}).AsIssuer()
+	if err := issuer.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the resource server has no Authenticator
+	verifierMiddleware := &JWTMiddleware{Realm: "api", Key: key}
+	if problems := verifierMiddleware.Validate(); len(problems) == 0 || problems[0].Error() != "Authenticator is required" {
+		t.Errorf("A middleware issuing tokens requires an Authenticator, got %v", problems)
+	}
+	verifier := verifierMiddleware.AsVerifier()
+	if err := verifier.Init(); err != nil {
+		t.Fatalf("A verifier shouldn't require an Authenticator, got %v", err)
+	}
+
+	authApi := rest.NewApi()
+	authApi.SetApp(rest.AppSimple(issuer.LoginHandler))
+	recorded := test.RunRequest(t, authApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", map[string]string{"username": "admin", "password": "admin"}))
+	recorded.CodeIs(200)
+	token := DecoderToken{}
+	recorded.DecodeJsonPayload(&token)
+
+	api := rest.NewApi()
+	api.Use(verifier)
+	api.SetApp(rest.AppSimple(func(writer rest.ResponseWriter, request *rest.Request) {
+		writer.WriteJson(map[string]interface{}{"user": request.Env["REMOTE_USER"]})
+	}))
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"user":"admin"}`)
+
+	// the configuration of a verifier doesn't issue tokens through the JWTMiddleware either
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(verifierMiddleware.LoginHandler))
+	test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", map[string]string{"username": "admin", "password": "admin"})).CodeIs(404)
+}
+
+func TestNewVerifier(t *testing.T) {
+	verifier := NewVerifier(key, WithIssuer("https://login.example.com"), WithConfig(func(mw *JWTMiddleware) {
+		mw.IdentityHandler = func(claims map[string]interface{}) (string, error) {
+			return "user:" + claims["id"].(string), nil
+		}
+	}))
+	if err := verifier.Init(); err != nil {
+		t.Fatalf("A verifier needs neither Realm nor Authenticator, got %v", err)
+	}
+
+	api := rest.NewApi()
+	api.Use(verifier)
+	api.SetApp(rest.AppSimple(func(writer rest.ResponseWriter, request *rest.Request) {
+		writer.WriteJson(map[string]interface{}{"user": request.Env["REMOTE_USER"]})
+	}))
+	handler := api.MakeHandler()
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "admin"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	token.Claims["iss"] = "https://login.example.com"
+	tokenString, _ := token.SignedString(key)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	recorded := test.RunRequest(t, handler, req)
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"user":"user:admin"}`)
+
+	// tokens of other issuers are rejected
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(401)
+	recorded.HeaderIs("WWW-Authenticate", "JWT realm=jwt")
+}
@@ -0,0 +1,156 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+var updateGolden = flag.Bool("update", false, "update the issued tokens of testdata/conformance.json")
+
+const conformanceFile = "testdata/conformance.json"
+
+// conformanceVectors are the contents of testdata/conformance.json. Verification vectors are
+// verified at the given unix time with the base64url encoded HS256 key, and AllowMissingExpiration
+// for tokens issued elsewhere, like the examples of RFC 7519 without "iat". Issuance vectors are
+// logins of "admin" at the given unix time with the payload of PayloadFunc, the token being the
+// expected output.
+type conformanceVectors struct {
+	Verification []struct {
+		Name   string                 `json:"name"`
+		Key    string                 `json:"key"`
+		Now    int64                  `json:"now"`
+		Token  string                 `json:"token"`
+		Valid  bool                   `json:"valid"`
+		Claims map[string]interface{} `json:"claims,omitempty"`
+
+		AllowMissingExpiration bool `json:"allow_missing_expiration,omitempty"`
+	} `json:"verification"`
+	Issuance []struct {
+		Name    string                 `json:"name"`
+		Now     int64                  `json:"now"`
+		Payload map[string]interface{} `json:"payload"`
+		Token   string                 `json:"token"`
+	} `json:"issuance"`
+}
+
+// issuance vectors are signed with the key of the RFC 7519 example
+const conformanceKey = "AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow"
+
+func readConformanceVectors(t *testing.T) *conformanceVectors {
+	data, err := ioutil.ReadFile(conformanceFile)
+	if err != nil {
+		t.Fatalf("Reading %s failed: %v", conformanceFile, err)
+	}
+	vectors := &conformanceVectors{}
+	if err := json.Unmarshal(data, vectors); err != nil {
+		t.Fatalf("Decoding %s failed: %v", conformanceFile, err)
+	}
+	return vectors
+}
+
+func decodeConformanceKey(t *testing.T, encoded string) []byte {
+	key, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("Decoding key %q failed: %v", encoded, err)
+	}
+	return key
+}
+
+func TestConformanceVerification(t *testing.T) {
+	for _, vector := range readConformanceVectors(t).Verification {
+		authMiddleware := &JWTMiddleware{
+			Realm: "test zone",
+			Key:   decodeConformanceKey(t, vector.Key),
+			Authenticator: func(userId string, password string) bool {
+				return true
+			},
+			Clock:                  frozenClock{time.Unix(vector.Now, 0)},
+			AllowMissingExpiration: vector.AllowMissingExpiration,
+		}
+		authMiddleware.initDefaults()
+
+		token, err := authMiddleware.parseTokenString(vector.Token)
+		if vector.Valid != (err == nil) {
+			t.Errorf("%s: expected valid %v, got error %v", vector.Name, vector.Valid, err)
+			continue
+		}
+		if vector.Valid && !reflect.DeepEqual(token.Claims, vector.Claims) {
+			t.Errorf("%s: expected claims %v, got %v", vector.Name, vector.Claims, token.Claims)
+		}
+	}
+}
+
+func TestConformanceIssuance(t *testing.T) {
+	vectors := readConformanceVectors(t)
+
+	for i, vector := range vectors.Issuance {
+		authMiddleware := &JWTMiddleware{
+			Realm:      "test zone",
+			Key:        decodeConformanceKey(t, conformanceKey),
+			Timeout:    time.Hour,
+			MaxRefresh: time.Hour * 24,
+			Authenticator: func(userId string, password string) bool {
+				return true
+			},
+			PayloadFunc: func(userId string) map[string]interface{} {
+				return vector.Payload
+			},
+			Clock: frozenClock{time.Unix(vector.Now, 0)},
+		}
+
+		api := rest.NewApi()
+		api.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+		loginCreds := map[string]string{"username": "admin", "password": "admin"}
+		recorded := test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+		recorded.CodeIs(200)
+
+		nToken := DecoderToken{}
+		test.DecodeJsonPayload(recorded.Recorder, &nToken)
+
+		if *updateGolden {
+			vectors.Issuance[i].Token = nToken.Token
+			continue
+		}
+		if nToken.Token != vector.Token {
+			t.Errorf("%s: expected token %s, got %s", vector.Name, vector.Token, nToken.Token)
+		}
+
+		// issued tokens verify to the same claims
+		token, err := authMiddleware.parseTokenString(nToken.Token)
+		if err != nil {
+			t.Errorf("%s: issued token is invalid: %v", vector.Name, err)
+			continue
+		}
+		claims := map[string]interface{}{
+			"id":        "admin",
+			"exp":       float64(vector.Now + 3600),
+			"iat":       float64(vector.Now),
+			"orig_iat":  float64(vector.Now),
+			"token_use": TokenUseAccess,
+		}
+		for key, value := range vector.Payload {
+			claims[key] = value
+		}
+		if !reflect.DeepEqual(token.Claims, claims) {
+			t.Errorf("%s: expected claims %v, got %v", vector.Name, claims, token.Claims)
+		}
+	}
+
+	if *updateGolden {
+		data, err := json.MarshalIndent(vectors, "", "\t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(conformanceFile, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package jwt
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// consentRequired rejects the requests of users who haven't consented to RequiredConsentVersion
+// yet, unless they are made to one of the ConsentRoutes.
+func (mw *JWTMiddleware) consentRequired(writer rest.ResponseWriter, request *rest.Request) bool {
+	if mw.RequiredConsentVersion == 0 || containsString(mw.ConsentRoutes, request.URL.Path) {
+		return false
+	}
+	if version, ok := GetInt64(ExtractClaims(request), "consent_version"); ok && version >= int64(mw.RequiredConsentVersion) {
+		return false
+	}
+	errorWithCode(writer, "Consent required", "consent_required", http.StatusForbidden)
+	return true
+}
+
+// consentScopes returns the "scope" claim of a login requesting scope, restricted to the scopes
+// granted by ConsentFunc. It responds with a 403 and returns false if none were granted.
+func (mw *JWTMiddleware) consentScopes(writer rest.ResponseWriter, userId string, client *Client, scope string) (map[string]interface{}, bool) {
+	requested := strings.Fields(scope)
+	if mw.ConsentFunc == nil || len(requested) == 0 {
+		return nil, true
+	}
+	clientId := ""
+	if client != nil {
+		clientId = client.Id
+	}
+
+	consented := mw.ConsentFunc(userId, clientId, requested)
+	granted := []string{}
+	for _, scope := range requested {
+		if containsString(consented, scope) && !containsString(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	if len(granted) == 0 {
+		errorWithCode(writer, "None of the requested scopes were granted", "invalid_scope", http.StatusForbidden)
+		return nil, false
+	}
+	return map[string]interface{}{"scope": strings.Join(granted, " ")}, true
+}
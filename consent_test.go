@@ -0,0 +1,118 @@
+package jwt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestConsentVersion(t *testing.T) {
+	consented := map[string]int{"admin": 2, "user": 1}
+
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		RequiredConsentVersion: 2,
+		ConsentVersionFunc: func(userId string) int {
+			return consented[userId]
+		},
+		ConsentRoutes: []string{"/consent"},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	login := func(userId string) string {
+		loginCreds := map[string]string{"username": userId, "password": "secret"}
+		recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+		recorded.CodeIs(200)
+		nToken := DecoderToken{}
+		test.DecodeJsonPayload(recorded.Recorder, &nToken)
+		return nToken.Token
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	request := func(tokenString, path string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request(login("admin"), "/").CodeIs(200)
+
+	userToken := login("user")
+	recorded := request(userToken, "/")
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Consent required","code":"consent_required"}`)
+	request(userToken, "/consent").CodeIs(200)
+
+	// tokens without consent_version
+	request(makeTokenString("admin", key), "/").CodeIs(403)
+}
+
+func TestConsentScopes(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		Clients: NewClientRegistry(&Client{
+			Id:         "integration",
+			GrantTypes: []string{GrantPassword},
+			Scopes:     []string{"read", "write"},
+		}),
+		PayloadFunc: func(userId string) map[string]interface{} {
+			return map[string]interface{}{"scope": "read write admin"}
+		},
+		ConsentFunc: func(userId string, clientId string, requested []string) []string {
+			if clientId != "integration" {
+				return nil
+			}
+			return []string{"read", "admin"}
+		},
+	}
+
+	api := rest.NewApi()
+	api.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	login := func(scope string) *test.Recorded {
+		loginCreds := map[string]string{"username": "admin", "password": "secret", "client_id": "integration", "scope": scope}
+		return test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	}
+	scope := func(recorded *test.Recorded) interface{} {
+		recorded.CodeIs(200)
+		nToken := DecoderToken{}
+		recorded.DecodeJsonPayload(&nToken)
+		token, err := jwt.Parse(nToken.Token, func(*jwt.Token) (interface{}, error) { return key, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token.Claims["scope"]
+	}
+
+	// without requested scopes, the token gets the scopes of the user allowed for the client
+	if got := scope(login("")); got != "read write" {
+		t.Errorf("Expected the scopes of the user, got %v", got)
+	}
+	// admin is consented but not allowed for the client, write isn't consented
+	if got := scope(login("read write admin")); got != "read" {
+		t.Errorf("Expected only the granted scopes, got %v", got)
+	}
+	recorded := login("write")
+	recorded.CodeIs(403)
+	if !strings.Contains(recorded.Recorder.Body.String(), "invalid_scope") {
+		t.Errorf("Expected the invalid_scope error code, got %s", recorded.Recorder.Body.String())
+	}
+}
@@ -0,0 +1,86 @@
+package jwt
+
+import (
+	"net"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// Scopes of the cookies holding tokens, see CookieScope.
+const (
+	// The cookies are only sent to the host that set them, they have no Domain attribute.
+	CookieScopeHost = "host"
+
+	// The cookies are shared with the subdomains of the registrable domain of the host, e.g.
+	// "example.com" for "app.example.com", as determined by the PublicSuffixList.
+	CookieScopeParent = "parent"
+)
+
+// CookieDomain returns the Domain attribute of the cookies holding tokens set in response to a
+// request, according to the CookieDomainOverrides and the CookieScope, e.g. for a LoginCallback
+// returning tokens as cookies. It returns an empty string for host-only cookies, which is always
+// the case for IP addresses and hosts that are public suffixes.
+func (mw *JWTMiddleware) CookieDomain(request *rest.Request) string {
+	host := strings.TrimSuffix(strings.TrimPrefix(request.Host, "["), "]")
+	if h, _, err := net.SplitHostPort(request.Host); err == nil {
+		host = h
+	}
+	host = normalizeDomain(host)
+	if host == "" || net.ParseIP(host) != nil {
+		return ""
+	}
+
+	if domain, ok := mw.cookieDomainOverride(host); ok {
+		if domain == "" || !domainMatch(host, domain) || mw.publicSuffix(domain) {
+			return ""
+		}
+		return domain
+	}
+
+	if mw.CookieScope != CookieScopeParent || mw.PublicSuffixList == nil || mw.publicSuffix(host) {
+		return ""
+	}
+	suffix := mw.PublicSuffixList.PublicSuffix(host)
+	if !domainMatch(host, suffix) {
+		return ""
+	}
+	labels := strings.Split(strings.TrimSuffix(host, "."+suffix), ".")
+	return labels[len(labels)-1] + "." + suffix
+}
+
+// cookieDomainOverride returns the domain of the most specific of the CookieDomainOverrides
+// covering host.
+func (mw *JWTMiddleware) cookieDomainOverride(host string) (string, bool) {
+	for parent := host; parent != ""; {
+		for key, domain := range mw.CookieDomainOverrides {
+			if normalizeDomain(key) == parent {
+				return normalizeDomain(domain), true
+			}
+		}
+		dot := strings.Index(parent, ".")
+		if dot == -1 {
+			break
+		}
+		parent = parent[dot+1:]
+	}
+	return "", false
+}
+
+// publicSuffix reports whether domain is a public suffix. Without PublicSuffixList, single labels
+// such as "com" are.
+func (mw *JWTMiddleware) publicSuffix(domain string) bool {
+	if mw.PublicSuffixList == nil {
+		return !strings.Contains(domain, ".") && domain != "localhost"
+	}
+	return mw.PublicSuffixList.PublicSuffix(domain) == domain
+}
+
+// domainMatch reports whether cookies with the Domain attribute domain are sent to host.
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(domain), "."), ".")
+}
@@ -0,0 +1,120 @@
+package jwt
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+// suffixList is a public suffix list of a few suffixes, which otherwise takes the last label.
+type suffixList []string
+
+func (l suffixList) PublicSuffix(domain string) string {
+	for _, suffix := range l {
+		if domainMatch(domain, suffix) {
+			return suffix
+		}
+	}
+	return domain[strings.LastIndex(domain, ".")+1:]
+}
+
+func (l suffixList) String() string {
+	return "test"
+}
+
+func TestCookieDomain(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Authenticator:    rejectLogin,
+		CookieScope:      CookieScopeParent,
+		PublicSuffixList: suffixList{"co.uk", "herokuapp.com"},
+		CookieDomainOverrides: map[string]string{
+			"staging.example.com": "staging.example.com",
+			"dev.example.com":     "",
+			"qa.example.com":      "example.org",
+			".example.net":        "net",
+		},
+	}
+	domain := func(host string) string {
+		request := &rest.Request{Request: &http.Request{Host: host}}
+		return authMiddleware.CookieDomain(request)
+	}
+
+	cases := map[string]string{
+		"app.example.com":             "example.com",
+		"example.com:8080":            "example.com",
+		"API.Example.com.":            "example.com",
+		"shop.example.co.uk":          "example.co.uk",
+		"co.uk":                       "",
+		"myapp.herokuapp.com":         "myapp.herokuapp.com",
+		"herokuapp.com":               "",
+		"staging.example.com":         "staging.example.com",
+		"api.staging.example.com":     "staging.example.com",
+		"api.dev.example.com":         "",
+		"qa.example.com":              "",
+		"example.net":                 "",
+		"127.0.0.1:8080":              "",
+		"[::1]:8080":                  "",
+		"[::1]":                       "",
+		"localhost":                   "",
+		"a.b.shop.example.co.uk.":     "example.co.uk",
+		"www.app.staging.example.com": "staging.example.com",
+	}
+	for host, expected := range cases {
+		if actual := domain(host); actual != expected {
+			t.Errorf("Cookie domain of %q should be %q, got %q", host, expected, actual)
+		}
+	}
+
+	// without public suffix list only the overrides apply
+	authMiddleware.PublicSuffixList = nil
+	if actual := domain("app.example.com"); actual != "" {
+		t.Errorf("Cookies should be host-only without public suffix list, got %q", actual)
+	}
+	if actual := domain("api.staging.example.com"); actual != "staging.example.com" {
+		t.Errorf("Overrides should apply without public suffix list, got %q", actual)
+	}
+	authMiddleware.CookieScope = CookieScopeHost
+	authMiddleware.PublicSuffixList = suffixList{}
+	if actual := domain("app.example.com"); actual != "" {
+		t.Errorf("Cookies should be host-only with CookieScopeHost, got %q", actual)
+	}
+
+	problems := authMiddleware.Validate()
+	for _, expected := range []string{`"example.org" of "qa.example.com"`, `"net" of ".example.net"`} {
+		found := false
+		for _, problem := range problems {
+			found = found || strings.Contains(problem.Error(), expected)
+		}
+		if !found {
+			t.Errorf("Validate should report the cookie domain %s, got %v", expected, problems)
+		}
+	}
+}
+
+func TestLogoutCookieDomain(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Authenticator:    rejectLogin,
+		CookieScope:      CookieScopeParent,
+		PublicSuffixList: suffixList{},
+		LogoutCookies: []http.Cookie{
+			{Name: "token", Path: "/", Secure: true, HttpOnly: true},
+			{Name: "legacy", Path: "/", Domain: "app.example.com"},
+		},
+	}
+
+	api := rest.NewApi()
+	api.SetApp(rest.AppSimple(authMiddleware.FrontchannelLogoutHandler))
+	recorded := test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("GET", "https://app.example.com/logout", nil))
+	recorded.CodeIs(204)
+	cookies := recorded.Recorder.Result().Cookies()
+	if len(cookies) != 2 || cookies[0].Domain != "example.com" || cookies[1].Domain != "app.example.com" {
+		t.Errorf("Logout cookies should be cleared on their domain, got %v", recorded.Recorder.Header()["Set-Cookie"])
+	}
+}
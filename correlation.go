@@ -0,0 +1,84 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// maximum length of a request id taken from the request
+const maxRequestIdLength = 128
+
+// correlateRequest makes the request id of RequestIdHeader available in request.Env and the
+// response header, and returns a writer adding it to the error responses. The id of the request
+// is used if it is well-formed, otherwise one is generated.
+func (mw *JWTMiddleware) correlateRequest(writer rest.ResponseWriter, request *rest.Request) rest.ResponseWriter {
+	if mw.RequestIdHeader == "" {
+		return writer
+	}
+
+	requestId := ExtractRequestId(request)
+	if requestId == "" {
+		requestId = request.Header.Get(mw.RequestIdHeader)
+		if !validRequestId(requestId) {
+			var err error
+			if requestId, err = newTokenId(mw.RandReader); err != nil {
+				return writer
+			}
+		}
+		request.Env["JWT_REQUEST_ID"] = requestId
+	}
+	writer.Header().Set(mw.RequestIdHeader, requestId)
+	return &correlatingWriter{ResponseWriter: writer, requestId: requestId}
+}
+
+// validRequestId reports whether a request id of a client is safe to log and return.
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		return false
+	}
+	for _, c := range requestId {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// ExtractRequestId returns the correlation id of the request if RequestIdHeader is set.
+func ExtractRequestId(request *rest.Request) string {
+	requestId, _ := request.Env["JWT_REQUEST_ID"].(string)
+	return requestId
+}
+
+// logPrefix returns the request id to prefix the log lines of the middleware with, if any.
+func logPrefix(request *rest.Request) string {
+	if requestId := ExtractRequestId(request); requestId != "" {
+		return "[" + requestId + "] "
+	}
+	return ""
+}
+
+// correlatingWriter adds a "request_id" field to the json error responses written to it.
+type correlatingWriter struct {
+	rest.ResponseWriter
+	requestId string
+	status    int
+}
+
+func (w *correlatingWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *correlatingWriter) WriteJson(v interface{}) error {
+	if w.status >= http.StatusBadRequest {
+		if body, err := genericValue(v); err == nil {
+			if body, ok := body.(map[string]interface{}); ok {
+				body["request_id"] = w.requestId
+				v = body
+			}
+		}
+	}
+	return w.ResponseWriter.WriteJson(v)
+}
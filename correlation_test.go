@@ -0,0 +1,94 @@
+package jwt
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestRequestId(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		RequestIdHeader: "X-Request-ID",
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"RequestId": ExtractRequestId(r)})
+	}))
+	handler := api.MakeHandler()
+
+	request := func(tokenString, requestId string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		if tokenString != "" {
+			req.Header.Set("Authorization", "Bearer "+tokenString)
+		}
+		if requestId != "" {
+			req.Header.Set("X-Request-ID", requestId)
+		}
+		return test.RunRequest(t, handler, req)
+	}
+
+	recorded := request(makeTokenString("admin", []byte("wrong key")), "abc-123")
+	recorded.CodeIs(401)
+	recorded.HeaderIs("X-Request-ID", "abc-123")
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"signature_invalid","detail":"signature is invalid","request_id":"abc-123"}`)
+
+	recorded = request(makeTokenString("admin", key), "abc-123")
+	recorded.CodeIs(200)
+	recorded.HeaderIs("X-Request-ID", "abc-123")
+	recorded.BodyIs(`{"RequestId":"abc-123"}`)
+
+	// missing and malformed ids are replaced
+	generatedId := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	for _, requestId := range []string{"", "abc\n123", strings.Repeat("a", 129)} {
+		recorded = request("", requestId)
+		recorded.CodeIs(401)
+		requestId := recorded.Recorder.Header().Get("X-Request-ID")
+		if !generatedId.MatchString(requestId) {
+			t.Errorf("Request id should be generated, got %q", requestId)
+		}
+		recorded.BodyIs(`{"Error":"Not Authorized","code":"token_missing","detail":"Auth header empty","request_id":"` + requestId + `"}`)
+	}
+}
+
+func TestRequestIdLogs(t *testing.T) {
+	output := &bytes.Buffer{}
+	log.SetOutput(output)
+	defer log.SetOutput(os.Stderr)
+
+	authMiddleware := &JWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		RequestIdHeader: "X-Request-ID",
+		Authenticator: func(userId string, password string) bool {
+			panic("database down")
+		},
+	}
+
+	api := rest.NewApi()
+	api.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	req := test.MakeSimpleRequest("POST", "http://localhost/", map[string]string{"username": "admin", "password": "admin"})
+	req.Header.Set("X-Request-ID", "abc-123")
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(500)
+	recorded.BodyIs(`{"Error":"Internal Server Error","request_id":"abc-123"}`)
+
+	if !strings.Contains(output.String(), "[abc-123] Recovered panic") {
+		t.Errorf("Log should contain the request id, got %q", output.String())
+	}
+}
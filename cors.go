@@ -0,0 +1,90 @@
+package jwt
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// CORS configures cross-origin resource sharing for LoginHandler, RefreshHandler and
+// ClientCredentialsHandler, so that web applications on the AllowedOrigins can use them. The
+// allowed origin is always echoed rather than "*", which browsers refuse for credentialed requests.
+type CORS struct {
+	// Allows requests with credentials, i.e. cookies, which must be set for tokens returned as
+	// cookie by the LoginCallback. Optional, defaults to false.
+	AllowCredentials bool
+
+	// Request headers allowed in addition to the simple ones.
+	// Optional, defaults to the TokenHeaders and "Content-Type".
+	AllowedHeaders []string
+
+	// Response headers the web application may read, e.g. headers set by the LoginCallback.
+	// Optional.
+	ExposedHeaders []string
+
+	// Duration browsers may cache the preflight response. Optional, defaults to the browser default.
+	MaxAge time.Duration
+}
+
+// guardMethod returns the method whose rules apply to requests with method, i.e. GET for HEAD
+// if HeadAsGet is set.
+func (mw *JWTMiddleware) guardMethod(method string) string {
+	if mw.HeadAsGet && method == http.MethodHead {
+		return http.MethodGet
+	}
+	return method
+}
+
+// isPreflight reports whether the request is a CORS preflight request, which browsers send
+// without credentials.
+func isPreflight(request *rest.Request) bool {
+	return request.Method == http.MethodOptions && request.Header.Get("Origin") != "" && request.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// handleCORS adds the CORS headers to the response of a handler for requests from the
+// AllowedOrigins, and answers preflight requests. It returns true if the request was answered.
+func (mw *JWTMiddleware) handleCORS(writer rest.ResponseWriter, request *rest.Request) bool {
+	origin := request.Header.Get("Origin")
+	if mw.CORS == nil || origin == "" {
+		return false
+	}
+
+	header := writer.Header()
+	header.Add("Vary", "Origin")
+	if !mw.originAllowed(origin) {
+		if isPreflight(request) {
+			errorWithCode(writer, "Origin not allowed", "origin_not_allowed", http.StatusForbidden)
+			return true
+		}
+		return false
+	}
+
+	header.Set("Access-Control-Allow-Origin", origin)
+	if mw.CORS.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(mw.CORS.ExposedHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(mw.CORS.ExposedHeaders, ", "))
+	}
+	if !isPreflight(request) {
+		return false
+	}
+
+	allowedHeaders := mw.CORS.AllowedHeaders
+	if allowedHeaders == nil {
+		allowedHeaders = []string{"Content-Type"}
+		for _, tokenHeader := range mw.TokenHeaders {
+			allowedHeaders = append(allowedHeaders, tokenHeader.Name)
+		}
+	}
+	header.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	header.Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+	if mw.CORS.MaxAge != 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(mw.CORS.MaxAge.Seconds())))
+	}
+	writer.WriteHeader(http.StatusNoContent)
+	return true
+}
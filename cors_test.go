@@ -0,0 +1,124 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestCORS(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:      "test zone",
+		Key:        key,
+		Timeout:    time.Hour,
+		MaxRefresh: time.Hour * 24,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		AllowedOrigins: []string{"https://app.example.com"},
+		CORS: &CORS{
+			AllowCredentials: true,
+			ExposedHeaders:   []string{"X-Token-Expires"},
+			MaxAge:           10 * time.Minute,
+		},
+	}
+
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Options("/login", authMiddleware.LoginHandler),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+		rest.Options("/refresh", authMiddleware.RefreshHandler),
+	)
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/login"
+		},
+		IfTrue: authMiddleware,
+	})
+	api.SetApp(router)
+
+	preflight := func(path string, origin string) *test.Recorded {
+		req := test.MakeSimpleRequest("OPTIONS", "http://localhost"+path, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type")
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	for _, path := range []string{"/login", "/refresh"} {
+		recorded := preflight(path, "https://app.example.com")
+		recorded.CodeIs(204)
+		recorded.HeaderIs("Access-Control-Allow-Origin", "https://app.example.com")
+		recorded.HeaderIs("Access-Control-Allow-Credentials", "true")
+		recorded.HeaderIs("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		recorded.HeaderIs("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		recorded.HeaderIs("Access-Control-Max-Age", "600")
+		recorded.HeaderIs("Vary", "Origin")
+
+		recorded = preflight(path, "https://evil.example.com")
+		recorded.CodeIs(403)
+		recorded.HeaderIs("Access-Control-Allow-Origin", "")
+	}
+
+	req := test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"})
+	req.Header.Set("Origin", "https://app.example.com")
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.HeaderIs("Access-Control-Allow-Origin", "https://app.example.com")
+	recorded.HeaderIs("Access-Control-Expose-Headers", "X-Token-Expires")
+
+	req = test.MakeSimpleRequest("GET", "http://localhost/refresh", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.HeaderIs("Access-Control-Allow-Origin", "https://app.example.com")
+
+	// without CORS, preflights need a token like other requests
+	authMiddleware.CORS = nil
+	preflight("/refresh", "https://app.example.com").CodeIs(401)
+
+	if err := (&JWTMiddleware{Realm: "test zone", Key: key, Authenticator: authMiddleware.Authenticator, CORS: &CORS{}}).Init(); err == nil {
+		t.Error("CORS without AllowedOrigins should be rejected")
+	}
+}
+
+func TestPassPreflightRequests(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:                 "test zone",
+		Key:                   key,
+		Authenticator:         rejectLogin,
+		PassPreflightRequests: true,
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware, &rest.CorsMiddleware{
+		OriginValidator: func(origin string, request *rest.Request) bool {
+			return origin == "https://app.example.com"
+		},
+		AllowedMethods: []string{"GET"},
+		AllowedHeaders: []string{"Authorization"},
+	})
+	router, _ := rest.MakeRouter(rest.Get("/reports", func(w rest.ResponseWriter, r *rest.Request) {}))
+	api.SetApp(router)
+
+	req := test.MakeSimpleRequest("OPTIONS", "http://localhost/reports", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.HeaderIs("Access-Control-Allow-Origin", "https://app.example.com")
+
+	// other OPTIONS requests still need a token
+	req = test.MakeSimpleRequest("OPTIONS", "http://localhost/reports", nil)
+	test.RunRequest(t, api.MakeHandler(), req).CodeIs(401)
+
+	authMiddleware.PassPreflightRequests = false
+	req = test.MakeSimpleRequest("OPTIONS", "http://localhost/reports", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	test.RunRequest(t, api.MakeHandler(), req).CodeIs(401)
+}
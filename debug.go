@@ -0,0 +1,203 @@
+package jwt
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenReport is the reply of TokenDebugHandler.
+type TokenReport struct {
+	// Whether the middleware accepts the token.
+	Valid bool `json:"valid"`
+
+	// Header and claims of the token, also if its signature couldn't be verified.
+	Header map[string]interface{} `json:"header,omitempty"`
+	Claims map[string]interface{} `json:"claims,omitempty"`
+
+	// Checks performed on the token, in the order of the middleware.
+	Checks []TokenCheck `json:"checks"`
+
+	// Key that verified the signature: "default", "previous" for the secret replaced by the last
+	// rotation, "canary" or "verifier N" for the Nth of the AdditionalVerifiers, followed by the
+	// key id if the token has one. Empty if no key did.
+	Key string `json:"key,omitempty"`
+
+	// Seconds until the token expires, negative if it has expired.
+	ExpiresIn *int64 `json:"expires_in_seconds,omitempty"`
+}
+
+// TokenCheck is a validity check of a TokenReport.
+type TokenCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// TokenDebugHandler helps with "why is my token rejected" questions. It decodes a token and
+// reports its claims, the checks the middleware performs on it, the key that verified it and
+// its remaining validity. Payload needs to be json in the form of {"token": "TOKEN"}, without
+// payload the token of the request is inspected.
+// The handler is disabled unless DebugScope is set, and must be put under an endpoint that is
+// using the JWTMiddleware so that only callers granted DebugScope get reports.
+// Reply will be a 200 with a TokenReport, whether the token is valid or not.
+func (mw *JWTMiddleware) TokenDebugHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	if mw.DebugScope == "" {
+		rest.NotFound(writer, request)
+		return
+	}
+	if !mw.hasScopes(ExtractScopes(request), []string{mw.DebugScope}) {
+		mw.insufficientScope(writer, []string{mw.DebugScope})
+		return
+	}
+
+	var tokenString string
+	if request.ContentLength != 0 {
+		payload := struct {
+			Token string `json:"token"`
+		}{}
+		if err := request.DecodeJsonPayload(&payload); err != nil || payload.Token == "" {
+			rest.Error(writer, "Missing token", http.StatusBadRequest)
+			return
+		}
+		tokenString = payload.Token
+	} else {
+		var err error
+		if tokenString, err = mw.extractToken(request); err != nil {
+			if _, missing := err.(tokenMissingError); !missing {
+				rest.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			rest.Error(writer, "Missing token", http.StatusBadRequest)
+			return
+		}
+	}
+
+	writer.Header().Set("Cache-Control", "no-store")
+	report, _, _ := mw.inspectToken(tokenString)
+	writer.WriteJson(report)
+}
+
+// inspectToken runs the checks of parseTokenString and IdentityHandler, continuing after failed
+// checks so that all problems of the token are reported at once. It also returns the parsed token
+// and the middleware whose key verified it.
+func (mw *JWTMiddleware) inspectToken(tokenString string) (*TokenReport, *jwt.Token, *JWTMiddleware) {
+	report := &TokenReport{Checks: []TokenCheck{}}
+	check := func(name string, err error) {
+		tokenCheck := TokenCheck{Name: name, Passed: err == nil}
+		if err != nil {
+			tokenCheck.Error = err.Error()
+		}
+		report.Checks = append(report.Checks, tokenCheck)
+	}
+
+	// find the key verifying the signature, like parseTokenString and verifyToken do
+	type candidate struct {
+		name     string
+		verifier *JWTMiddleware
+		format   *TokenFormat
+	}
+	candidates := []candidate{{"default", mw, mw.defaultTokenFormat()}}
+	if format := mw.previousTokenFormat(); format != nil {
+		candidates = append(candidates, candidate{"previous", mw, format})
+	}
+	if mw.CanaryFormat != nil {
+		candidates = append(candidates, candidate{"canary", mw, mw.CanaryFormat})
+	}
+	for i, verifier := range mw.AdditionalVerifiers {
+		candidates = append(candidates, candidate{fmt.Sprintf("verifier %d", i), verifier, verifier.defaultTokenFormat()})
+		if format := verifier.previousTokenFormat(); format != nil {
+			candidates = append(candidates, candidate{fmt.Sprintf("verifier %d previous", i), verifier, format})
+		}
+		if verifier.CanaryFormat != nil {
+			candidates = append(candidates, candidate{fmt.Sprintf("verifier %d canary", i), verifier, verifier.CanaryFormat})
+		}
+	}
+
+	var token *jwt.Token
+	var err error
+	verifier := mw
+	for _, c := range candidates {
+		candidateToken, candidateErr := c.verifier.parseWithFormat(tokenString, c.format)
+		if token == nil {
+			token, err = candidateToken, candidateErr
+		}
+		if candidateErr == nil || isSignatureVerified(candidateErr) {
+			token, err, verifier = candidateToken, candidateErr, c.verifier
+			report.Key = c.name
+			if kid, ok := token.Header["kid"].(string); ok {
+				report.Key += " " + kid
+			}
+			break
+		}
+	}
+
+	if token == nil || token.Claims == nil {
+		check("format", err)
+		return report, token, verifier
+	}
+	if report.Key != "" {
+		// the checks see the claims of legacy tokens as the middleware does
+		verifier.migrateClaims(token)
+	}
+	report.Header = token.Header
+	report.Claims = token.Claims
+	if report.Key == "" {
+		check("signature", err)
+	} else {
+		check("signature", nil)
+	}
+	alg, _ := token.Header["alg"].(string)
+	report.Checks[len(report.Checks)-1].Detail = strings.TrimSpace(alg + " " + report.Key)
+
+	now := verifier.Clock.Now().Unix()
+	var timeErr error
+	if validationErr, ok := err.(*jwt.ValidationError); ok && report.Key != "" {
+		switch {
+		case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+			timeErr = fmt.Errorf("Token is expired")
+		case validationErr.Errors&jwt.ValidationErrorNotValidYet != 0:
+			timeErr = fmt.Errorf("Token is not valid yet")
+		}
+	}
+	if exp, ok := GetTime(token.Claims, "exp"); ok {
+		expiresIn := exp.Unix() - now
+		report.ExpiresIn = &expiresIn
+	}
+	if timeErr == nil {
+		timeErr = verifier.checkRequiredTimes(token.Claims)
+	}
+	check("time", timeErr)
+
+	claimsErr := func(ok bool, err error) error {
+		if ok {
+			return nil
+		}
+		return err
+	}
+	check("token_use", claimsErr(verifier.validTokenUse(token.Claims), ErrInvalidTokenUse))
+	check("issuer", claimsErr(verifier.Issuer == "" || token.Claims["iss"] == verifier.Issuer, ErrInvalidIssuer))
+	check("audience", claimsErr(verifier.Audience == "" || hasAudience(token.Claims, verifier.Audience), ErrInvalidAudience))
+	if verifier.AccessTokenProfile {
+		check("profile", claimsErr(isAccessTokenProfile(token), ErrInvalidClaims))
+	}
+	if verifier.ClaimsValidator != nil {
+		check("claims_validator", verifier.ClaimsValidator(token.Claims))
+	}
+	_, identityErr := verifier.IdentityHandler(token.Claims)
+	check("identity", identityErr)
+
+	report.Valid = true
+	for _, c := range report.Checks {
+		report.Valid = report.Valid && c.Passed
+	}
+	return report, token, verifier
+}
@@ -0,0 +1,118 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestTokenDebugHandler(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		Issuer:          "https://auth.example.com",
+		DebugScope:      "debug",
+		ClaimMigrations: []ClaimMigration{RenameClaim("uid", "id")},
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(authMiddleware.TokenDebugHandler))
+	inspect := func(callerToken string, payload interface{}) *test.Recorded {
+		req := test.MakeSimpleRequest("POST", "http://localhost/", payload)
+		req.Header.Set("Authorization", "Bearer "+callerToken)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+	report := func(recorded *test.Recorded) TokenReport {
+		recorded.CodeIs(200)
+		report := TokenReport{}
+		test.DecodeJsonPayload(recorded.Recorder, &report)
+		return report
+	}
+	failedChecks := func(report TokenReport) []string {
+		failed := []string{}
+		for _, check := range report.Checks {
+			if !check.Passed {
+				failed = append(failed, check.Name)
+			}
+		}
+		return failed
+	}
+
+	callerToken := jwt.New(jwt.GetSigningMethod("HS256"))
+	callerToken.Claims["id"] = "debugger"
+	callerToken.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	callerToken.Claims["iat"] = time.Now().Unix()
+	callerToken.Claims["iss"] = "https://auth.example.com"
+	callerToken.Claims["scope"] = "debug"
+	caller, _ := callerToken.SignedString(key)
+
+	// without the debug scope
+	userToken := jwt.New(jwt.GetSigningMethod("HS256"))
+	userToken.Claims["id"] = "user"
+	userToken.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	userToken.Claims["iat"] = time.Now().Unix()
+	userToken.Claims["iss"] = "https://auth.example.com"
+	user, _ := userToken.SignedString(key)
+	inspect(user, nil).CodeIs(403)
+
+	// the caller's own token
+	r := report(inspect(caller, nil))
+	if !r.Valid || r.Key != "default" || r.Claims["id"] != "debugger" {
+		t.Errorf("Caller token should be valid and verified by the default key, got %+v", r)
+	}
+	if r.ExpiresIn == nil || *r.ExpiresIn <= 0 || *r.ExpiresIn > 3600 {
+		t.Errorf("expires_in_seconds should be the remaining validity, got %v", r.ExpiresIn)
+	}
+
+	// an expired token of another issuer
+	rejected := jwt.New(jwt.GetSigningMethod("HS256"))
+	rejected.Claims["id"] = "user"
+	rejected.Claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	rejected.Claims["iat"] = time.Now().Unix()
+	rejected.Claims["iss"] = "https://other.example.com"
+	rejectedString, _ := rejected.SignedString(key)
+	r = report(inspect(caller, map[string]string{"token": rejectedString}))
+	if r.Valid || r.Key != "default" {
+		t.Errorf("Rejected token should be invalid but verified by the default key, got %+v", r)
+	}
+	if failed := failedChecks(r); len(failed) != 2 || failed[0] != "time" || failed[1] != "issuer" {
+		t.Errorf("time and issuer checks should fail, got %v", failed)
+	}
+	if r.ExpiresIn == nil || *r.ExpiresIn >= 0 {
+		t.Errorf("expires_in_seconds should be negative, got %v", r.ExpiresIn)
+	}
+
+	// the claims of legacy tokens are migrated
+	legacy := jwt.New(jwt.GetSigningMethod("HS256"))
+	legacy.Claims["uid"] = "user"
+	legacy.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	legacy.Claims["iat"] = time.Now().Unix()
+	legacy.Claims["iss"] = "https://auth.example.com"
+	legacyString, _ := legacy.SignedString(key)
+	r = report(inspect(caller, map[string]string{"token": legacyString}))
+	if !r.Valid || r.Claims["id"] != "user" {
+		t.Errorf("Legacy token should be valid with migrated claims, got %+v", r)
+	}
+
+	// a token signed with another key still shows its claims
+	forged, _ := userToken.SignedString([]byte("other key"))
+	r = report(inspect(caller, map[string]string{"token": forged}))
+	if r.Valid || r.Key != "" || r.Claims["id"] != "user" {
+		t.Errorf("Forged token should be invalid with claims, got %+v", r)
+	}
+	if failed := failedChecks(r); len(failed) != 1 || failed[0] != "signature" {
+		t.Errorf("signature check should fail, got %v", failed)
+	}
+
+	// disabled by default
+	authMiddleware.DebugScope = ""
+	inspect(caller, nil).CodeIs(404)
+}
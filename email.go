@@ -0,0 +1,55 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// RequireVerifiedEmail returns a guard that only calls the wrapped handler if the
+// EmailVerifiedClaim of the token of the request is true. Other requests are rejected like with
+// RequireEmailVerified. It must be used behind the middleware, usually on a per route basis with
+// rest.WrapMiddlewares.
+func (mw *JWTMiddleware) RequireVerifiedEmail() rest.MiddlewareSimple {
+	return func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(writer rest.ResponseWriter, request *rest.Request) {
+			if !mw.emailVerified(ExtractClaims(request)) {
+				mw.emailNotVerified(mw.encodeResponses(writer, request))
+				return
+			}
+			handler(writer, request)
+		}
+	}
+}
+
+// emailVerificationRequired rejects the requests of users whose email isn't verified if
+// RequireEmailVerified is set, unless they are made to one of the EmailVerificationRoutes.
+func (mw *JWTMiddleware) emailVerificationRequired(writer rest.ResponseWriter, request *rest.Request) bool {
+	if !mw.RequireEmailVerified || containsString(mw.EmailVerificationRoutes, request.URL.Path) || mw.emailVerified(ExtractClaims(request)) {
+		return false
+	}
+	mw.emailNotVerified(writer)
+	return true
+}
+
+// emailVerified reports whether the EmailVerifiedClaim of claims is true. Tokens without the claim
+// don't attest a verified email.
+func (mw *JWTMiddleware) emailVerified(claims map[string]interface{}) bool {
+	switch verified := claims[mw.EmailVerifiedClaim].(type) {
+	case bool:
+		return verified
+	case string:
+		return verified == "true"
+	}
+	return false
+}
+
+// emailNotVerified responds with a 403 pointing at the EmailVerificationURL.
+func (mw *JWTMiddleware) emailNotVerified(writer rest.ResponseWriter) {
+	writer.WriteHeader(http.StatusForbidden)
+	body := map[string]string{"Error": errEmailNotVerified.Message, "code": errEmailNotVerified.Code}
+	if mw.EmailVerificationURL != "" {
+		body["verification_url"] = mw.EmailVerificationURL
+	}
+	writer.WriteJson(body)
+}
@@ -0,0 +1,90 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestRequireEmailVerified(t *testing.T) {
+	verified := map[string]interface{}{"admin": true, "user": false, "cognito": "true"}
+
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		PayloadFunc: func(userId string) map[string]interface{} {
+			if value, ok := verified[userId]; ok {
+				return map[string]interface{}{"email_verified": value}
+			}
+			return nil
+		},
+		RequireEmailVerified:    true,
+		EmailVerificationURL:    "https://example.com/verify",
+		EmailVerificationRoutes: []string{"/verify/resend"},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	login := func(userId string) string {
+		loginCreds := map[string]string{"username": userId, "password": "secret"}
+		recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+		recorded.CodeIs(200)
+		nToken := DecoderToken{}
+		test.DecodeJsonPayload(recorded.Recorder, &nToken)
+		return nToken.Token
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {}))
+	request := func(tokenString, path string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request(login("admin"), "/").CodeIs(200)
+	request(login("cognito"), "/").CodeIs(200)
+
+	userToken := login("user")
+	recorded := request(userToken, "/")
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Email not verified","code":"email_not_verified","verification_url":"https://example.com/verify"}`)
+	request(userToken, "/verify/resend").CodeIs(200)
+
+	// tokens without the claim
+	request(login("anonymous"), "/").CodeIs(403)
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: rejectLogin,
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/profile", func(w rest.ResponseWriter, r *rest.Request) {}),
+		rest.Post("/payments", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireVerifiedEmail()}, func(w rest.ResponseWriter, r *rest.Request) {})),
+	)
+	api.SetApp(router)
+	request := func(method, path string) *test.Recorded {
+		req := test.MakeSimpleRequest(method, "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request("GET", "/profile").CodeIs(200)
+	recorded := request("POST", "/payments")
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Email not verified","code":"email_not_verified"}`)
+}
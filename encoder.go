@@ -0,0 +1,100 @@
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// ResponseEncoder encodes the json responses of the middleware and its handlers, i.e. the tokens
+// of LoginHandler and RefreshHandler and all error responses, so that they match the conventions
+// of the rest of an API.
+type ResponseEncoder interface {
+	// Encode returns the body of a response with the given status code. v is the body the
+	// middleware would have written, e.g. map[string]string{"token": "TOKEN"} or
+	// map[string]string{"Error": "Not Authorized", "code": "not_authorized"}.
+	Encode(status int, v interface{}) ([]byte, error)
+}
+
+// ContentTyper can be implemented by a ResponseEncoder to set the Content-Type of the responses it
+// encodes, which defaults to "application/json; charset=utf-8".
+type ContentTyper interface {
+	// ContentType returns the Content-Type of a response with the given status code.
+	ContentType(status int) string
+}
+
+// ResponseEncoderFunc adapts a function to a ResponseEncoder, e.g. jsoniter.Marshal wrapped in a
+// function ignoring the status code.
+type ResponseEncoderFunc func(status int, v interface{}) ([]byte, error)
+
+// Encode calls f(status, v).
+func (f ResponseEncoderFunc) Encode(status int, v interface{}) ([]byte, error) {
+	return f(status, v)
+}
+
+// EnvelopeEncoder is a ResponseEncoder wrapping successful responses in {"data": ...} and errors
+// in {"error": ...}.
+var EnvelopeEncoder ResponseEncoder = ResponseEncoderFunc(func(status int, v interface{}) ([]byte, error) {
+	if status >= 400 {
+		return json.Marshal(map[string]interface{}{"error": v})
+	}
+	return json.Marshal(map[string]interface{}{"data": v})
+})
+
+// encodeResponses returns a writer encoding the json responses written to it with the
+// ResponseEncoders entry negotiated for the request or ResponseEncoder, after adding the request
+// id of RequestIdHeader and the Branding of the request to error responses.
+func (mw *JWTMiddleware) encodeResponses(writer rest.ResponseWriter, request *rest.Request) rest.ResponseWriter {
+	encoder, mediaType := mw.ResponseEncoder, ""
+	if len(mw.ResponseEncoders) > 0 {
+		writer.Header().Add("Vary", "Accept")
+		encoder, mediaType = mw.negotiateEncoder(request)
+	}
+	if encoder != nil {
+		writer = &encodingWriter{ResponseWriter: writer, encoder: encoder, mediaType: mediaType}
+	}
+	return mw.brandResponses(mw.correlateRequest(writer, request), request)
+}
+
+type encodingWriter struct {
+	rest.ResponseWriter
+	encoder   ResponseEncoder
+	mediaType string
+	status    int
+}
+
+func (w *encodingWriter) WriteHeader(code int) {
+	w.status = code
+	if contentTyper, ok := w.encoder.(ContentTyper); ok {
+		w.Header().Set("Content-Type", contentTyper.ContentType(code))
+	} else if w.mediaType != "" {
+		w.Header().Set("Content-Type", w.mediaType)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *encodingWriter) EncodeJson(v interface{}) ([]byte, error) {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return w.encoder.Encode(status, v)
+}
+
+func (w *encodingWriter) WriteJson(v interface{}) error {
+	httpWriter, ok := w.ResponseWriter.(http.ResponseWriter)
+	if !ok {
+		// the writer has its own way of writing responses, e.g. the error handler of v2
+		return w.ResponseWriter.WriteJson(v)
+	}
+	data, err := w.EncodeJson(v)
+	if err != nil {
+		return err
+	}
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	_, err = httpWriter.Write(data)
+	return err
+}
@@ -0,0 +1,74 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestResponseEncoder(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		MaxRefresh:      time.Hour * 24,
+		ResponseEncoder: EnvelopeEncoder,
+		Authenticator: func(userId string, password string) bool {
+			return userId == "admin" && password == "admin"
+		},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+
+	recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", map[string]string{"username": "admin", "password": "admin"}))
+	recorded.CodeIs(200)
+	recorded.ContentTypeIsJson()
+	envelope := struct {
+		Data DecoderToken `json:"data"`
+	}{}
+	test.DecodeJsonPayload(recorded.Recorder, &envelope)
+	if envelope.Data.Token == "" {
+		t.Fatal("Token should be wrapped in data")
+	}
+
+	recorded = test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", map[string]string{"username": "admin", "password": "wrong"}))
+	recorded.CodeIs(401)
+	recorded.ContentTypeIsJson()
+	recorded.BodyIs(`{"error":{"Error":"Not Authorized","code":"not_authorized"}}`)
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(authMiddleware.RefreshHandler))
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+envelope.Data.Token)
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	refreshed := struct {
+		Data DecoderToken `json:"data"`
+	}{}
+	test.DecodeJsonPayload(recorded.Recorder, &refreshed)
+	if refreshed.Data.Token == "" {
+		t.Error("Refreshed token should be wrapped in data")
+	}
+
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"error":{"Error":"Not Authorized","code":"token_missing","detail":"Auth header empty"}}`)
+
+	// responses of the application aren't encoded
+	appApi := rest.NewApi()
+	appApi.Use(authMiddleware)
+	appApi.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded = test.RunRequest(t, appApi.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"Id":"admin"}`)
+}
@@ -0,0 +1,173 @@
+package jwt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrDecryptionFailed is returned for values that weren't encrypted with the key of the
+// ValueEncrypter or have been tampered with.
+var ErrDecryptionFailed = errors.New("Decryption failed")
+
+// ValueEncrypter encrypts the values of a store before they are persisted, see
+// NewEncryptedIdempotencyStore. additionalData binds a value to its key, so that values can't be
+// moved between keys. Implementations must be safe for concurrent use.
+type ValueEncrypter interface {
+	Encrypt(plaintext, additionalData []byte) ([]byte, error)
+	Decrypt(ciphertext, additionalData []byte) ([]byte, error)
+}
+
+type aesGCMEncrypter struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMEncrypter returns a ValueEncrypter using AES-GCM with key, which must be 16, 24 or 32
+// bytes long, as key encryption key. A random nonce is prepended to each value.
+func NewAESGCMEncrypter(key []byte) (ValueEncrypter, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aesGCMEncrypter{aead: aead}, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e *aesGCMEncrypter) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	return sealAESGCM(e.aead, plaintext, additionalData)
+}
+
+func (e *aesGCMEncrypter) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	return openAESGCM(e.aead, ciphertext, additionalData)
+}
+
+func sealAESGCM(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openAESGCM(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrDecryptionFailed
+	}
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// KeyWrapper wraps and unwraps data encryption keys with a key encryption key that never leaves
+// a key management service, e.g. by calling the Encrypt and Decrypt operations of AWS KMS or
+// Google Cloud KMS.
+type KeyWrapper interface {
+	WrapKey(key []byte) ([]byte, error)
+	UnwrapKey(wrappedKey []byte) ([]byte, error)
+}
+
+type envelopeEncrypter struct {
+	wrapper KeyWrapper
+}
+
+// NewEnvelopeEncrypter returns a ValueEncrypter using envelope encryption: each value is
+// encrypted with AES-256-GCM under a random data encryption key, which is wrapped by wrapper and
+// stored along with the value.
+func NewEnvelopeEncrypter(wrapper KeyWrapper) ValueEncrypter {
+	return &envelopeEncrypter{wrapper: wrapper}
+}
+
+func (e *envelopeEncrypter) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := e.wrapper.WrapKey(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealAESGCM(aead, plaintext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	// length of the wrapped key, wrapped key, nonce and ciphertext
+	ciphertext := make([]byte, 4, 4+len(wrappedKey)+len(sealed))
+	binary.BigEndian.PutUint32(ciphertext, uint32(len(wrappedKey)))
+	ciphertext = append(ciphertext, wrappedKey...)
+	return append(ciphertext, sealed...), nil
+}
+
+func (e *envelopeEncrypter) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < 4 {
+		return nil, ErrDecryptionFailed
+	}
+	keyLength := binary.BigEndian.Uint32(ciphertext)
+	if uint64(len(ciphertext)-4) < uint64(keyLength) {
+		return nil, ErrDecryptionFailed
+	}
+	key, err := e.wrapper.UnwrapKey(ciphertext[4 : 4+keyLength])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return openAESGCM(aead, ciphertext[4+keyLength:], additionalData)
+}
+
+type encryptedIdempotencyStore struct {
+	store     IdempotencyStore
+	encrypter ValueEncrypter
+}
+
+// NewEncryptedIdempotencyStore returns an IdempotencyStore encrypting the tokens with encrypter
+// before they are handed to store, e.g. one backed by Redis or SQL, so that no usable token is
+// kept at rest. Values that can't be decrypted are treated as missing.
+func NewEncryptedIdempotencyStore(store IdempotencyStore, encrypter ValueEncrypter) IdempotencyStore {
+	return &encryptedIdempotencyStore{store: store, encrypter: encrypter}
+}
+
+func (s *encryptedIdempotencyStore) Get(key string) (string, bool) {
+	value, ok := s.store.Get(key)
+	if !ok {
+		return "", false
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", false
+	}
+	token, err := s.encrypter.Decrypt(ciphertext, []byte(key))
+	if err != nil {
+		return "", false
+	}
+	return string(token), true
+}
+
+func (s *encryptedIdempotencyStore) Set(key string, token string, ttl time.Duration) {
+	ciphertext, err := s.encrypter.Encrypt([]byte(token), []byte(key))
+	if err != nil {
+		// not storing the token only costs the idempotency of the refresh
+		return
+	}
+	s.store.Set(key, base64.RawURLEncoding.EncodeToString(ciphertext), ttl)
+}
@@ -0,0 +1,77 @@
+package jwt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// xorKeyWrapper stands in for a key management service.
+type xorKeyWrapper struct {
+	calls int
+}
+
+func (w *xorKeyWrapper) WrapKey(key []byte) ([]byte, error) {
+	w.calls++
+	wrapped := make([]byte, len(key))
+	for i, b := range key {
+		wrapped[i] = b ^ 0x5a
+	}
+	return append([]byte("kms:"), wrapped...), nil
+}
+
+func (w *xorKeyWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	w.calls++
+	key := bytes.TrimPrefix(wrappedKey, []byte("kms:"))
+	unwrapped := make([]byte, len(key))
+	for i, b := range key {
+		unwrapped[i] = b ^ 0x5a
+	}
+	return unwrapped, nil
+}
+
+func TestEncryptedIdempotencyStore(t *testing.T) {
+	aesEncrypter, err := NewAESGCMEncrypter([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAESGCMEncrypter([]byte("short")); err == nil {
+		t.Error("Invalid key sizes should be rejected")
+	}
+	wrapper := &xorKeyWrapper{}
+
+	for name, encrypter := range map[string]ValueEncrypter{"aes-gcm": aesEncrypter, "envelope": NewEnvelopeEncrypter(wrapper)} {
+		backend := NewMemoryIdempotencyStore()
+		store := NewEncryptedIdempotencyStore(backend, encrypter)
+		tokenString := makeTokenString("admin", key)
+
+		store.Set("key", tokenString, time.Minute)
+		if token, ok := store.Get("key"); !ok || token != tokenString {
+			t.Errorf("%s: Token should be decrypted, got %q", name, token)
+		}
+
+		stored, _ := backend.Get("key")
+		if strings.Contains(stored, tokenString) || strings.Contains(stored, strings.Split(tokenString, ".")[1]) {
+			t.Errorf("%s: Token should be stored encrypted, got %q", name, stored)
+		}
+
+		// values are bound to their key
+		backend.Set("other key", stored, time.Minute)
+		if _, ok := store.Get("other key"); ok {
+			t.Errorf("%s: Value moved to another key should be rejected", name)
+		}
+
+		backend.Set("tampered", stored[:len(stored)-2]+"AA", time.Minute)
+		if _, ok := store.Get("tampered"); ok {
+			t.Errorf("%s: Tampered value should be rejected", name)
+		}
+		if _, ok := store.Get("missing"); ok {
+			t.Errorf("%s: Missing value should be reported", name)
+		}
+	}
+
+	if wrapper.calls == 0 {
+		t.Error("Envelope encryption should wrap the data keys")
+	}
+}
@@ -0,0 +1,95 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Machine readable codes of the 401 responses of the middleware, in the "code" field of the body.
+// Clients can refresh tokens on CodeTokenExpired, and need to log in again otherwise.
+const (
+	// The request has no token, or the TokenExtractor couldn't read it.
+	CodeTokenMissing = "token_missing"
+
+	// The token is valid, but has expired.
+	CodeTokenExpired = "token_expired"
+
+	// The signature of the token couldn't be verified.
+	CodeSignatureInvalid = "signature_invalid"
+
+	// The token lacks the "exp" or "iat" claim, see AllowMissingExpiration.
+	CodeClaimMissing = "claim_missing"
+
+	// Any other reason, e.g. invalid claims or credentials.
+	CodeNotAuthorized = "not_authorized"
+)
+
+// tokenMissingError marks the errors of the TokenExtractor.
+type tokenMissingError struct {
+	error
+}
+
+// unauthorizedBody is the body of 401 responses.
+type unauthorizedBody struct {
+	Error  string `json:"Error"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// errorCode returns the code of the 401 response for a verification error.
+func errorCode(err error) string {
+	if err == ErrMissingExpiration || err == ErrMissingIssuedAt {
+		return CodeClaimMissing
+	}
+	switch err := err.(type) {
+	case tokenMissingError:
+		return CodeTokenMissing
+	case *jwt.ValidationError:
+		if !isSignatureVerified(err) {
+			if err.Errors&jwt.ValidationErrorMalformed != 0 {
+				return CodeNotAuthorized
+			}
+			return CodeSignatureInvalid
+		}
+		if err.Errors&jwt.ValidationErrorExpired != 0 {
+			return CodeTokenExpired
+		}
+	}
+	return CodeNotAuthorized
+}
+
+// errorDetail describes a verification error. jwt-go can't describe the validation errors of
+// parseWithFormat.
+func errorDetail(err error) string {
+	if err, ok := err.(*jwt.ValidationError); ok && isSignatureVerified(err) {
+		switch {
+		case err.Errors&jwt.ValidationErrorExpired != 0:
+			return "Token is expired"
+		case err.Errors&jwt.ValidationErrorNotValidYet != 0:
+			return "Token is not valid yet"
+		}
+	}
+	return err.Error()
+}
+
+// unauthorizedError denies a request whose token failed verification with err, reporting the
+// error code and, unless SuppressErrorDetail is set, the error.
+func (mw *JWTMiddleware) unauthorizedError(writer rest.ResponseWriter, err error) {
+	body := unauthorizedBody{Error: "Not Authorized", Code: errorCode(err)}
+	if !mw.SuppressErrorDetail {
+		body.Detail = errorDetail(err)
+	}
+	mw.writeUnauthorized(writer, body)
+}
+
+func (mw *JWTMiddleware) unauthorized(writer rest.ResponseWriter) {
+	mw.writeUnauthorized(writer, unauthorizedBody{Error: "Not Authorized", Code: CodeNotAuthorized})
+}
+
+func (mw *JWTMiddleware) writeUnauthorized(writer rest.ResponseWriter, body unauthorizedBody) {
+	mw.challenge(writer, "")
+	writer.WriteHeader(http.StatusUnauthorized)
+	writer.WriteJson(body)
+}
@@ -0,0 +1,63 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestErrorCodes(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	request := func(authHeader string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		recorded := test.RunRequest(t, api.MakeHandler(), req)
+		recorded.CodeIs(401)
+		return recorded
+	}
+
+	expired := jwt.New(jwt.GetSigningMethod("HS256"))
+	expired.Claims["id"] = "admin"
+	expired.Claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	expired.Claims["iat"] = time.Now().Unix()
+	expiredString, _ := expired.SignedString(key)
+
+	noId := jwt.New(jwt.GetSigningMethod("HS256"))
+	noId.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	noId.Claims["iat"] = time.Now().Unix()
+	noIdString, _ := noId.SignedString(key)
+
+	noIat := jwt.New(jwt.GetSigningMethod("HS256"))
+	noIat.Claims["id"] = "admin"
+	noIat.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	noIatString, _ := noIat.SignedString(key)
+
+	request("").BodyIs(`{"Error":"Not Authorized","code":"token_missing","detail":"Auth header empty"}`)
+	request("Basic YWRtaW46YWRtaW4=").BodyIs(`{"Error":"Not Authorized","code":"token_missing","detail":"Invalid auth header"}`)
+	request("Bearer " + expiredString).BodyIs(`{"Error":"Not Authorized","code":"token_expired","detail":"Token is expired"}`)
+	request("Bearer " + makeTokenString("admin", []byte("other key"))).BodyIs(`{"Error":"Not Authorized","code":"signature_invalid","detail":"signature is invalid"}`)
+	request("Bearer " + noIdString).BodyIs(`{"Error":"Not Authorized","code":"not_authorized","detail":"Invalid id claim"}`)
+	request("Bearer " + noIatString).BodyIs(`{"Error":"Not Authorized","code":"claim_missing","detail":"Missing token issue time"}`)
+
+	authMiddleware.SuppressErrorDetail = true
+	request("Bearer " + expiredString).BodyIs(`{"Error":"Not Authorized","code":"token_expired"}`)
+	request("Bearer " + noIdString).BodyIs(`{"Error":"Not Authorized","code":"not_authorized"}`)
+}
@@ -0,0 +1,587 @@
+package jwt
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// Expression is an authorization rule written in a tiny expression language, for services that
+// don't want to write Go callbacks or run a policy engine, e.g.
+//
+//	claims.role == "admin" || claims.org == params.orgId
+//
+// Expressions are made of:
+//
+//   - values of the request: claims.NAME for the claims of the token, with nested claims as
+//     claims.address.country and claims with other characters as claims["cognito:groups"],
+//     params.NAME for the path parameters of the route, query.NAME for the first value of a
+//     query parameter, user for the REMOTE_USER, method for the HTTP method and scopes for the
+//     scopes granted by the token
+//   - literals: strings "admin", numbers 42, true, false, and lists ["admin", "owner"]
+//   - comparisons: ==, !=, <, <=, >, >= and in, e.g. "admin" in claims.roles
+//   - !, && and || combining them, and parentheses
+//
+// Comparisons with a missing value are missing too, and so is ! of a missing value, so that
+// neither claims.org == params.orgId nor !(claims.org == params.orgId) hold for tokens without
+// "org" claim or on routes without orgId parameter. && and || only ignore a missing operand when
+// the other one decides the result, and expressions evaluating to a missing value don't hold,
+// e.g. !claims.suspended doesn't hold for tokens without "suspended" claim. Numbers compare equal to
+// the strings spelling them, as path parameters are strings while claims are usually numbers.
+// Values used as conditions are true if they are true or "true".
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// expressionInput is the request an Expression is evaluated against.
+type expressionInput struct {
+	userId string
+	claims map[string]interface{}
+	scopes []string
+	method string
+	params map[string]string
+	query  url.Values
+}
+
+type exprNode interface {
+	eval(input *expressionInput) (interface{}, bool)
+}
+
+// CompileExpression parses an Expression, usually at startup so that errors are reported early.
+func CompileExpression(source string) (*Expression, error) {
+	tokens, err := lexExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expression %q: %v", source, err)
+	}
+	parser := &exprParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err == nil && parser.peek().kind != exprEOF {
+		err = parser.unexpected()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expression %q: %v", source, err)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// MustCompileExpression is like CompileExpression but panics if the expression is invalid. It
+// simplifies the initialization of global variables and configuration literals.
+func MustCompileExpression(source string) *Expression {
+	expression, err := CompileExpression(source)
+	if err != nil {
+		panic(err)
+	}
+	return expression
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Allows reports whether a request authenticated by the middleware satisfies the expression.
+func (e *Expression) Allows(request *rest.Request) bool {
+	return e.allows(requestExpressionInput(request))
+}
+
+// Check returns an AuthorizationCheck with the given name denying the requests that don't satisfy
+// the expression, e.g. for AuthorizationChecks or RequireChecks.
+func (e *Expression) Check(name string) AuthorizationCheck {
+	return AuthorizationCheck{
+		Name: name,
+		Check: func(userId string, request *rest.Request) error {
+			if !e.Allows(request) {
+				return fmt.Errorf("Expression %s not satisfied", e.source)
+			}
+			return nil
+		},
+	}
+}
+
+func (e *Expression) allows(input *expressionInput) bool {
+	return truthy(e.root.eval(input))
+}
+
+func requestExpressionInput(request *rest.Request) *expressionInput {
+	userId, _ := request.Env["REMOTE_USER"].(string)
+	return &expressionInput{
+		userId: userId,
+		claims: ExtractClaims(request),
+		scopes: ExtractScopes(request),
+		method: request.Method,
+		params: request.PathParams,
+		query:  request.URL.Query(),
+	}
+}
+
+// truthy reports whether a value used as condition is true.
+func truthy(value interface{}, ok bool) bool {
+	return ok && (value == true || value == "true")
+}
+
+// lexing
+
+const (
+	exprEOF = iota
+	exprIdent
+	exprString
+	exprNumber
+	exprOperator
+)
+
+type exprToken struct {
+	kind  int
+	text  string
+	value interface{}
+	pos   int
+}
+
+var exprOperators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ".", ","}
+
+var exprComparisons = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func lexExpression(source string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	for pos := 0; pos < len(source); {
+		c := source[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			pos++
+		case c == '"':
+			end := pos + 1
+			for end < len(source) && source[end] != '"' {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("unterminated string at %d", pos)
+			}
+			value, err := strconv.Unquote(source[pos : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d", pos)
+			}
+			tokens = append(tokens, exprToken{kind: exprString, text: source[pos : end+1], value: value, pos: pos})
+			pos = end + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := pos + 1
+			for end < len(source) && (source[end] == '.' || (source[end] >= '0' && source[end] <= '9')) {
+				end++
+			}
+			value, err := strconv.ParseFloat(source[pos:end], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number at %d", pos)
+			}
+			tokens = append(tokens, exprToken{kind: exprNumber, text: source[pos:end], value: value, pos: pos})
+			pos = end
+		case isIdentByte(c) && !(c >= '0' && c <= '9'):
+			end := pos + 1
+			for end < len(source) && isIdentByte(source[end]) {
+				end++
+			}
+			tokens = append(tokens, exprToken{kind: exprIdent, text: source[pos:end], pos: pos})
+			pos = end
+		default:
+			operator := ""
+			for _, op := range exprOperators {
+				if strings.HasPrefix(source[pos:], op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, pos)
+			}
+			tokens = append(tokens, exprToken{kind: exprOperator, text: operator, pos: pos})
+			pos += len(operator)
+		}
+	}
+	return append(tokens, exprToken{kind: exprEOF, pos: len(source)}), nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// parsing
+
+type exprParser struct {
+	tokens []exprToken
+	next   int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.next]
+}
+
+func (p *exprParser) accept(operator string) bool {
+	if token := p.peek(); token.kind == exprOperator && token.text == operator {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) unexpected() error {
+	token := p.peek()
+	if token.kind == exprEOF {
+		return fmt.Errorf("unexpected end at %d", token.pos)
+	}
+	return fmt.Errorf("unexpected %s at %d", token.text, token.pos)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var right exprNode
+		right, err = p.parseAnd()
+		left = &exprLogical{and: false, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.accept("&&") {
+		var right exprNode
+		right, err = p.parseUnary()
+		left = &exprLogical{and: true, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		return &exprNot{operand: operand}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	token := p.peek()
+	operator := ""
+	switch {
+	case token.kind == exprOperator && exprComparisons[token.text]:
+		operator = token.text
+	case token.kind == exprIdent && token.text == "in":
+		operator = "in"
+	default:
+		return left, nil
+	}
+	p.next++
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return &exprComparison{operator: operator, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	token := p.peek()
+	switch token.kind {
+	case exprString, exprNumber:
+		p.next++
+		return &exprLiteral{value: token.value}, nil
+	case exprIdent:
+		p.next++
+		switch token.text {
+		case "true", "false":
+			return &exprLiteral{value: token.text == "true"}, nil
+		}
+		return p.parsePath(token)
+	case exprOperator:
+		if p.accept("(") {
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(")") {
+				return nil, p.unexpected()
+			}
+			return node, nil
+		}
+		if p.accept("[") {
+			list := &exprList{}
+			for !p.accept("]") {
+				if len(list.items) > 0 && !p.accept(",") {
+					return nil, p.unexpected()
+				}
+				item, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+			}
+			return list, nil
+		}
+	}
+	return nil, p.unexpected()
+}
+
+func (p *exprParser) parsePath(root exprToken) (exprNode, error) {
+	path := &exprPath{root: root.text}
+	for {
+		if p.accept(".") {
+			token := p.peek()
+			if token.kind != exprIdent {
+				return nil, p.unexpected()
+			}
+			p.next++
+			path.keys = append(path.keys, token.text)
+		} else if p.accept("[") {
+			token := p.peek()
+			if token.kind != exprString {
+				return nil, p.unexpected()
+			}
+			p.next++
+			if !p.accept("]") {
+				return nil, p.unexpected()
+			}
+			path.keys = append(path.keys, token.value.(string))
+		} else {
+			break
+		}
+	}
+
+	switch path.root {
+	case "claims":
+	case "params", "query":
+		if len(path.keys) != 1 {
+			return nil, fmt.Errorf("%s at %d needs one parameter name", path.root, root.pos)
+		}
+	case "user", "method", "scopes":
+		if len(path.keys) != 0 {
+			return nil, fmt.Errorf("%s at %d has no fields", path.root, root.pos)
+		}
+	default:
+		return nil, fmt.Errorf("unknown value %s at %d", path.root, root.pos)
+	}
+	return path, nil
+}
+
+// evaluation
+
+type exprLiteral struct {
+	value interface{}
+}
+
+func (n *exprLiteral) eval(input *expressionInput) (interface{}, bool) {
+	return n.value, true
+}
+
+type exprList struct {
+	items []exprNode
+}
+
+func (n *exprList) eval(input *expressionInput) (interface{}, bool) {
+	values := []interface{}{}
+	for _, item := range n.items {
+		if value, ok := item.eval(input); ok {
+			values = append(values, value)
+		}
+	}
+	return values, true
+}
+
+type exprPath struct {
+	root string
+	keys []string
+}
+
+func (n *exprPath) eval(input *expressionInput) (interface{}, bool) {
+	switch n.root {
+	case "user":
+		return input.userId, input.userId != ""
+	case "method":
+		return input.method, input.method != ""
+	case "scopes":
+		scopes := make([]interface{}, len(input.scopes))
+		for i, scope := range input.scopes {
+			scopes[i] = scope
+		}
+		return scopes, true
+	case "params":
+		value, ok := input.params[n.keys[0]]
+		return value, ok
+	case "query":
+		values, ok := input.query[n.keys[0]]
+		if !ok || len(values) == 0 {
+			return nil, false
+		}
+		return values[0], true
+	}
+
+	var value interface{} = input.claims
+	for _, key := range n.keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, value != nil
+}
+
+type exprNot struct {
+	operand exprNode
+}
+
+func (n *exprNot) eval(input *expressionInput) (interface{}, bool) {
+	value, ok := n.operand.eval(input)
+	if !ok {
+		return nil, false
+	}
+	return !truthy(value, ok), true
+}
+
+type exprLogical struct {
+	and         bool
+	left, right exprNode
+}
+
+// eval ignores a missing operand only if the other one decides the result, e.g. a false operand
+// of &&, and is missing otherwise.
+func (n *exprLogical) eval(input *expressionInput) (interface{}, bool) {
+	left, leftOk := n.left.eval(input)
+	if leftOk && truthy(left, leftOk) != n.and {
+		return !n.and, true
+	}
+	right, rightOk := n.right.eval(input)
+	if rightOk && truthy(right, rightOk) != n.and {
+		return !n.and, true
+	}
+	if !leftOk || !rightOk {
+		return nil, false
+	}
+	return n.and, true
+}
+
+type exprComparison struct {
+	operator    string
+	left, right exprNode
+}
+
+func (n *exprComparison) eval(input *expressionInput) (interface{}, bool) {
+	left, ok := n.left.eval(input)
+	if !ok {
+		return nil, false
+	}
+	right, ok := n.right.eval(input)
+	if !ok {
+		return nil, false
+	}
+
+	switch n.operator {
+	case "==":
+		return exprEqual(left, right), true
+	case "!=":
+		_, leftList := exprListValue(left)
+		_, rightList := exprListValue(right)
+		return !leftList && !rightList && !exprEqual(left, right), true
+	case "in":
+		items, ok := exprListValue(right)
+		if !ok {
+			return false, true
+		}
+		for _, item := range items {
+			if exprEqual(left, item) {
+				return true, true
+			}
+		}
+		return false, true
+	}
+
+	order, ok := exprCompare(left, right)
+	if !ok {
+		return false, true
+	}
+	switch n.operator {
+	case "<":
+		return order < 0, true
+	case "<=":
+		return order <= 0, true
+	case ">":
+		return order > 0, true
+	}
+	return order >= 0, true
+}
+
+// exprListValue returns the items of a list value, e.g. a claim holding a JSON array.
+func exprListValue(value interface{}) ([]interface{}, bool) {
+	switch list := value.(type) {
+	case []interface{}:
+		return list, true
+	case []string:
+		items := make([]interface{}, len(list))
+		for i, item := range list {
+			items[i] = item
+		}
+		return items, true
+	}
+	return nil, false
+}
+
+// exprNumeric returns the number a value is, or spells.
+func exprNumeric(value interface{}) (float64, bool) {
+	if number, ok := numericValue(value); ok {
+		return number, true
+	}
+	if s, ok := value.(string); ok {
+		number, err := strconv.ParseFloat(s, 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+func exprEqual(left, right interface{}) bool {
+	leftString, leftIsString := left.(string)
+	rightString, rightIsString := right.(string)
+	if leftIsString && rightIsString {
+		return leftString == rightString
+	}
+	if leftBool, ok := left.(bool); ok {
+		return right == leftBool
+	}
+	if _, ok := right.(bool); ok {
+		return false
+	}
+	leftNumber, ok := exprNumeric(left)
+	if !ok {
+		return false
+	}
+	rightNumber, ok := exprNumeric(right)
+	return ok && leftNumber == rightNumber
+}
+
+// exprCompare orders two numbers, or two strings.
+func exprCompare(left, right interface{}) (int, bool) {
+	leftNumber, leftOk := exprNumeric(left)
+	rightNumber, rightOk := exprNumeric(right)
+	if leftOk && rightOk {
+		switch {
+		case leftNumber < rightNumber:
+			return -1, true
+		case leftNumber > rightNumber:
+			return 1, true
+		}
+		return 0, true
+	}
+	leftString, leftOk := left.(string)
+	rightString, rightOk := right.(string)
+	if leftOk && rightOk {
+		return strings.Compare(leftString, rightString), true
+	}
+	return 0, false
+}
@@ -0,0 +1,145 @@
+package jwt
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestExpression(t *testing.T) {
+	input := &expressionInput{
+		userId: "alice",
+		claims: map[string]interface{}{
+			"role":           "editor",
+			"org":            float64(42),
+			"roles":          []interface{}{"editor", "reviewer"},
+			"cognito:groups": []interface{}{"staff"},
+			"address":        map[string]interface{}{"country": "NL"},
+			"admin":          false,
+			"verified":       "true",
+			"level":          float64(3),
+		},
+		scopes: []string{"documents:read"},
+		method: "PUT",
+		params: map[string]string{"orgId": "42", "name": "report"},
+		query:  url.Values{"draft": {"true"}},
+	}
+
+	cases := map[string]bool{
+		`claims.role == "admin" || claims.org == params.orgId`:        true,
+		`claims.role == "admin"`:                                      false,
+		`claims.org == 42 && claims.org != 43`:                        true,
+		`"reviewer" in claims.roles`:                                  true,
+		`"admin" in claims.roles`:                                     false,
+		`claims.role in ["editor", "owner"]`:                          true,
+		`"staff" in claims["cognito:groups"]`:                         true,
+		`claims.address.country == "NL"`:                              true,
+		`claims.address.city == "Amsterdam"`:                          false,
+		`claims.admin`:                                                false,
+		`!claims.admin && claims.verified`:                            true,
+		`claims.level >= 3 && claims.level < 4`:                       true,
+		`claims.level > 3 || claims.level <= 2`:                       false,
+		`user == "alice" && method == "PUT"`:                          true,
+		`"documents:read" in scopes`:                                  true,
+		`query.draft`:                                                 true,
+		`params.name == "report"`:                                     true,
+		`!(claims.role == "editor" || claims.role == "owner")`:        false,
+		`claims.role == "editor" && (method == "GET" || query.draft)`: true,
+		// comparisons with missing values are missing, also through !
+		`claims.missing == params.missing`:                          false,
+		`claims.missing != "admin"`:                                 false,
+		`claims.missing`:                                            false,
+		`!claims.missing`:                                           false,
+		`params.missing in claims.roles`:                            false,
+		`!(claims.missing == params.orgId)`:                         false,
+		`!(claims.missing == params.orgId || claims.admin)`:         false,
+		`!(claims.missing == params.orgId && claims.admin)`:         true,
+		`claims.missing == params.orgId || claims.role == "editor"`: true,
+	}
+	for source, expected := range cases {
+		expression, err := CompileExpression(source)
+		if err != nil {
+			t.Errorf("%s should compile, got %v", source, err)
+			continue
+		}
+		if actual := expression.allows(input); actual != expected {
+			t.Errorf("%s should be %v, got %v", source, expected, actual)
+		}
+	}
+
+	invalid := map[string]string{
+		`claims.role ==`:         "unexpected end at 14",
+		`claims.role = "admin"`:  `unexpected '='`,
+		`(claims.admin`:          "unexpected end",
+		`header.host == "x"`:     "unknown value header",
+		`params == "x"`:          "needs one parameter name",
+		`user.name == "x"`:       "has no fields",
+		`claims.role == "admin`:  "unterminated string",
+		`claims.role == "a" "b"`: `unexpected "b"`,
+		`claims[role] == "x"`:    "unexpected role",
+		`["a", "b" == "a"`:       "unexpected ==",
+		``:                       "unexpected end at 0",
+	}
+	for source, expected := range invalid {
+		if _, err := CompileExpression(source); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s should be invalid with %q, got %v", source, expected, err)
+		}
+	}
+}
+
+func TestPolicyCondition(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: rejectLogin,
+	}
+	orgAdmin := MustCompileExpression(`claims.role == "admin" || claims.org == params.orgId`)
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/orgs/:orgId", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.WithPolicy(Policy{Condition: orgAdmin})}, func(w rest.ResponseWriter, r *rest.Request) {})),
+		rest.Delete("/orgs/:orgId", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireChecks(orgAdmin.Check("org_admin"))}, func(w rest.ResponseWriter, r *rest.Request) {})),
+	)
+	api.SetApp(router)
+	request := func(method, path string, claims map[string]interface{}) *test.Recorded {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "alice"
+		token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token.Claims["iat"] = time.Now().Unix()
+		for name, value := range claims {
+			token.Claims[name] = value
+		}
+		tokenString, _ := token.SignedString(key)
+		req := test.MakeSimpleRequest(method, "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	member := map[string]interface{}{"org": 42}
+	request("GET", "/orgs/42", member).CodeIs(200)
+	recorded := request("GET", "/orgs/7", member)
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Forbidden","code":"forbidden"}`)
+	request("GET", "/orgs/7", map[string]interface{}{"role": "admin"}).CodeIs(200)
+
+	recorded = request("DELETE", "/orgs/7", member)
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Forbidden","code":"forbidden","check":"org_admin","reason":"Expression claims.role == \"admin\" || claims.org == params.orgId not satisfied"}`)
+	request("DELETE", "/orgs/42", member).CodeIs(200)
+
+	info := &AuthInfo{UserId: "alice", Claims: map[string]interface{}{"role": "admin"}}
+	if err := authMiddleware.CheckPolicy(info, Policy{Condition: orgAdmin}); err != nil {
+		t.Errorf("CheckPolicy should evaluate the condition, got %v", err)
+	}
+	info.Claims = map[string]interface{}{"org": 42}
+	if err := authMiddleware.CheckPolicy(info, Policy{Condition: orgAdmin}); err != errForbidden {
+		t.Errorf("Conditions on request values should fail outside of requests, got %v", err)
+	}
+}
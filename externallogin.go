@@ -0,0 +1,53 @@
+package jwt
+
+import (
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// ExternalLoginAdapter performs a login ceremony the middleware doesn't implement itself, e.g. an
+// OAuth callback, a magic link or a WebAuthn assertion. It returns the id of the authenticated
+// user and the claims to add to its token, or false after writing an error response.
+type ExternalLoginAdapter func(writer rest.ResponseWriter, request *rest.Request) (userId string, extraClaims map[string]interface{}, ok bool)
+
+// ExternalLoginHandler returns a handler authenticating users with adapter and issuing their
+// tokens like LoginHandler. The CORS, maintenance mode and AllowedOrigins checks of LoginHandler
+// apply before the adapter is called.
+func (mw *JWTMiddleware) ExternalLoginHandler(adapter ExternalLoginAdapter) rest.HandlerFunc {
+	return func(writer rest.ResponseWriter, request *rest.Request) {
+		mw.initDefaults()
+		writer = mw.encodeResponses(writer, request)
+		defer mw.recoverHandlerPanic(writer, request)
+
+		mw.sanitizeProxyHeaders(request)
+
+		if mw.handleCORS(writer, request) {
+			return
+		}
+
+		if mw.loginUnavailable(writer) {
+			return
+		}
+
+		if mw.crossSiteRequest(writer, request) {
+			return
+		}
+
+		userId, extraClaims, ok := adapter(writer, request)
+		if !ok {
+			return
+		}
+		mw.issueToken(writer, request, userId, nil, extraClaims)
+	}
+}
+
+// CompleteLogin issues a token to userId, who has been authenticated by the application, with
+// the pipeline of LoginHandler: issuance quota, PayloadFunc, the standard claims, StoreToken and
+// LoginCallback. extraClaims are added to the token, but can't override the standard claims such
+// as id and exp.
+func (mw *JWTMiddleware) CompleteLogin(writer rest.ResponseWriter, request *rest.Request, userId string, extraClaims map[string]interface{}) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	mw.issueToken(writer, request, userId, nil, extraClaims)
+}
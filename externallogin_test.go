@@ -0,0 +1,71 @@
+package jwt
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestExternalLogin(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return false
+		},
+		PayloadFunc: func(userId string) map[string]interface{} {
+			return map[string]interface{}{"tenant": "acme"}
+		},
+	}
+
+	router, err := rest.MakeRouter(
+		rest.Get("/magic", authMiddleware.ExternalLoginHandler(func(w rest.ResponseWriter, r *rest.Request) (string, map[string]interface{}, bool) {
+			if r.URL.Query().Get("code") != "1234" {
+				rest.Error(w, "Invalid code", http.StatusUnauthorized)
+				return "", nil, false
+			}
+			return "admin", map[string]interface{}{"amr": "magic_link"}, true
+		})),
+		rest.Post("/webauthn", func(w rest.ResponseWriter, r *rest.Request) {
+			authMiddleware.CompleteLogin(w, r, "user", map[string]interface{}{"amr": "webauthn", "id": "admin"})
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := rest.NewApi()
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	claims := func(recorded *test.Recorded) map[string]interface{} {
+		tokenString := DecoderToken{}
+		recorded.DecodeJsonPayload(&tokenString)
+		token, err := jwt.Parse(tokenString.Token, func(*jwt.Token) (interface{}, error) { return key, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token.Claims
+	}
+
+	recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/magic?code=0000", nil))
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Invalid code"}`)
+
+	recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/magic?code=1234", nil))
+	recorded.CodeIs(200)
+	if c := claims(recorded); c["id"] != "admin" || c["amr"] != "magic_link" || c["tenant"] != "acme" || c["exp"] == nil {
+		t.Errorf("Token should be issued with the standard and extra claims, got %v", c)
+	}
+
+	// extra claims don't override the standard claims
+	recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/webauthn", nil))
+	recorded.CodeIs(200)
+	if c := claims(recorded); c["id"] != "user" || c["amr"] != "webauthn" {
+		t.Errorf("Token should be issued to user, got %v", c)
+	}
+}
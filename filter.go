@@ -0,0 +1,162 @@
+package jwt
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// FilterForRequest returns the JSON representation of obj without the struct fields that require
+// scopes the authenticated user wasn't granted, matched with the ScopeMatcher of the middleware.
+// The scopes a field requires are listed, space separated, in its "scope" tag, e.g.
+//
+//	type Employee struct {
+//		Name   string `json:"name"`
+//		Salary int    `json:"salary" scope:"hr:read"`
+//	}
+//
+//	writer.WriteJson(jwt.FilterForRequest(request, employee))
+//
+// Nested structs, pointers, slices and maps are filtered as well, values implementing
+// json.Marshaler are kept as they are. Unlike with encoding/json, the fields of unexported embedded
+// structs are left out. Requests that weren't authenticated keep only the fields
+// requiring no scope.
+func FilterForRequest(request *rest.Request, obj interface{}) interface{} {
+	matcher, ok := request.Env["JWT_SCOPE_MATCHER"].(ScopeMatcher)
+	if !ok {
+		matcher = NewScopeMatcher(nil)
+	}
+	return FilterForScopes(obj, ExtractScopes(request), matcher)
+}
+
+// FilterForScopes is FilterForRequest for the given granted scopes, e.g. the Scopes of an
+// AuthInfo outside of HTTP. matcher may be nil for exact matches and wildcards.
+func FilterForScopes(obj interface{}, granted []string, matcher ScopeMatcher) interface{} {
+	if matcher == nil {
+		matcher = NewScopeMatcher(nil)
+	}
+	allowed := func(tag string) bool {
+		for _, scope := range strings.Fields(tag) {
+			if !matcher(granted, scope) {
+				return false
+			}
+		}
+		return true
+	}
+	return filterValue(reflect.ValueOf(obj), allowed)
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// filterValue returns the value as map, slice or the value itself, without the struct fields
+// whose scope tag isn't allowed.
+func filterValue(value reflect.Value, allowed func(tag string) bool) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+	if value.Type().Implements(jsonMarshalerType) || value.Type().Implements(textMarshalerType) {
+		return value.Interface()
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return filterValue(value.Elem(), allowed)
+	case reflect.Struct:
+		filtered := map[string]interface{}{}
+		filterFields(value, allowed, filtered)
+		return filtered
+	case reflect.Map:
+		if value.IsNil() || value.Type().Key().Kind() != reflect.String {
+			return value.Interface()
+		}
+		filtered := make(map[string]interface{}, value.Len())
+		for _, key := range value.MapKeys() {
+			filtered[key.String()] = filterValue(value.MapIndex(key), allowed)
+		}
+		return filtered
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && (value.IsNil() || value.Type().Elem().Kind() == reflect.Uint8) {
+			// nil stays null and []byte base64, like encoding/json
+			return value.Interface()
+		}
+		filtered := make([]interface{}, value.Len())
+		for i := range filtered {
+			filtered[i] = filterValue(value.Index(i), allowed)
+		}
+		return filtered
+	}
+	return value.Interface()
+}
+
+// filterFields adds the allowed exported fields of a struct to filtered, under their JSON names.
+// The fields of exported embedded structs are promoted like encoding/json does, without handling
+// conflicts, those of unexported ones are left out.
+func filterFields(value reflect.Value, allowed func(tag string) bool, filtered map[string]interface{}) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !allowed(field.Tag.Get("scope")) {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, options = tag[:i], tag[i+1:]
+		}
+
+		if field.PkgPath != "" {
+			// the values of unexported fields, including embedded structs, can't be read
+			continue
+		}
+		fieldValue := value.Field(i)
+		if field.Anonymous && name == "" {
+			if fieldValue.Kind() == reflect.Ptr {
+				if fieldValue.IsNil() {
+					continue
+				}
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct {
+				filterFields(fieldValue, allowed, filtered)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if containsString(strings.Split(options, ","), "omitempty") && isEmptyValue(fieldValue) {
+			continue
+		}
+		filtered[name] = filterValue(fieldValue, allowed)
+	}
+}
+
+// isEmptyValue reports whether a field is omitted by the omitempty option of encoding/json.
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return value.IsNil()
+	}
+	return false
+}
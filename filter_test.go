@@ -0,0 +1,117 @@
+package jwt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestFilterForRequest(t *testing.T) {
+	type secret struct {
+		Key string `json:"key"`
+	}
+
+	type Contact struct {
+		Email string `json:"email"`
+		Phone string `json:"phone,omitempty" scope:"contacts:read"`
+	}
+
+	type Audit struct {
+		CreatedBy string `json:"created_by" scope:"audit:read"`
+	}
+
+	type Employee struct {
+		Audit
+		*Contact `json:"contact"`
+		Name     string            `json:"name"`
+		Salary   int               `json:"salary" scope:"hr:read"`
+		Bonus    int               `json:"bonus" scope:"hr:read hr:write"`
+		Hired    time.Time         `json:"hired"`
+		Reports  []Employee        `json:"reports,omitempty"`
+		Contacts map[string]string `json:"contacts" scope:"contacts:read"`
+		Password string            `json:"-"`
+		internal string
+		secret   // unexported embedded structs are left out
+	}
+
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: rejectLogin,
+		ScopeMatcher:  NewScopeMatcher(map[string][]string{"admin": {"read", "write"}}),
+	}
+
+	hired := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	employee := &Employee{
+		Audit:    Audit{CreatedBy: "root"},
+		Contact:  &Contact{Email: "bob@example.com", Phone: "555-0100"},
+		Name:     "Bob",
+		Salary:   1000,
+		Bonus:    100,
+		Hired:    hired,
+		Reports:  []Employee{{Name: "Alice", Salary: 900}},
+		Contacts: map[string]string{"home": "555-0101"},
+		Password: "secret",
+		internal: "internal",
+		secret:   secret{Key: "key"},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(FilterForRequest(r, employee))
+	}))
+	handler := api.MakeHandler()
+	request := func(scope string) *test.Recorded {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "admin"
+		token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token.Claims["iat"] = time.Now().Unix()
+		token.Claims["scope"] = scope
+		tokenString, _ := token.SignedString(key)
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	recorded := request("")
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"contact":{"email":"bob@example.com"},"hired":"2020-01-02T00:00:00Z","name":"Bob","reports":[{"contact":null,"hired":"0001-01-01T00:00:00Z","name":"Alice"}]}`)
+
+	recorded = request("hr:read contacts:read")
+	recorded.BodyIs(`{"contact":{"email":"bob@example.com","phone":"555-0100"},"contacts":{"home":"555-0101"},"hired":"2020-01-02T00:00:00Z","name":"Bob","reports":[{"contact":null,"contacts":null,"hired":"0001-01-01T00:00:00Z","name":"Alice","salary":900}],"salary":1000}`)
+
+	// the ScopeMatcher of the middleware is used
+	recorded = request("hr:admin audit:read")
+	recorded.BodyIs(`{"bonus":100,"contact":{"email":"bob@example.com"},"created_by":"root","hired":"2020-01-02T00:00:00Z","name":"Bob","reports":[{"bonus":0,"contact":null,"created_by":"","hired":"0001-01-01T00:00:00Z","name":"Alice","salary":900}],"salary":1000}`)
+}
+
+func TestFilterForScopes(t *testing.T) {
+	type Audit struct {
+		CreatedBy string `json:"created_by" scope:"audit:read"`
+	}
+	filtered := FilterForScopes(map[string]interface{}{
+		"audit": Audit{CreatedBy: "root"},
+		"list":  []interface{}{&Audit{CreatedBy: "admin"}, nil},
+		"data":  []byte("raw"),
+	}, []string{"audit:*"}, nil)
+	payload, err := json.Marshal(filtered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != `{"audit":{"created_by":"root"},"data":"cmF3","list":[{"created_by":"admin"},null]}` {
+		t.Errorf("Unexpected filtered payload %s", payload)
+	}
+
+	if filtered := FilterForScopes(Audit{CreatedBy: "root"}, nil, nil); len(filtered.(map[string]interface{})) != 0 {
+		t.Errorf("Fields requiring scopes shouldn't be kept without scopes, got %v", filtered)
+	}
+	if FilterForScopes(nil, nil, nil) != nil {
+		t.Error("nil should stay nil")
+	}
+}
@@ -0,0 +1,39 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrFingerprintMismatch is returned for tokens used by a request whose fingerprint differs from
+// the one of the request they were issued to.
+var ErrFingerprintMismatch = errors.New("Token fingerprint mismatch")
+
+// fingerprint returns the hashed fingerprint of request, which is stored as "fpt" claim so that
+// the attributes used for it aren't disclosed by the token.
+func (mw *JWTMiddleware) fingerprint(request *rest.Request) string {
+	hash := sha256.Sum256([]byte(mw.FingerprintFunc(request)))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// setFingerprint binds a new token to the fingerprint of request.
+func (mw *JWTMiddleware) setFingerprint(token *jwt.Token, request *rest.Request) {
+	if mw.FingerprintFunc != nil {
+		token.Claims["fpt"] = mw.fingerprint(request)
+	}
+}
+
+// checkFingerprint rejects tokens that are used by a request with another fingerprint.
+func (mw *JWTMiddleware) checkFingerprint(token *jwt.Token, request *rest.Request) error {
+	if mw.FingerprintFunc == nil {
+		return nil
+	}
+	if fpt, ok := token.Claims["fpt"].(string); !ok || fpt != mw.fingerprint(request) {
+		return ErrFingerprintMismatch
+	}
+	return nil
+}
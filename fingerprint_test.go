@@ -0,0 +1,67 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestFingerprint(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:      "test zone",
+		Key:        key,
+		Timeout:    time.Hour,
+		MaxRefresh: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		FingerprintFunc: func(request *rest.Request) string {
+			return request.UserAgent() + "\x00" + request.Header.Get("X-Device-Id")
+		},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	loginCreds := map[string]string{"username": "admin", "password": "admin"}
+	req := test.MakeSimpleRequest("POST", "http://localhost/", loginCreds)
+	req.Header.Set("User-Agent", "app/1.0")
+	req.Header.Set("X-Device-Id", "device-1")
+	recorded := test.RunRequest(t, loginApi.MakeHandler(), req)
+	recorded.CodeIs(200)
+	nToken := DecoderToken{}
+	test.DecodeJsonPayload(recorded.Recorder, &nToken)
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/", func(w rest.ResponseWriter, r *rest.Request) {
+			w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+		}),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+	)
+	api.SetApp(router)
+	request := func(tokenString, path, userAgent, deviceId string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("X-Device-Id", deviceId)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request(nToken.Token, "/", "app/1.0", "device-1").CodeIs(200)
+	request(nToken.Token, "/", "app/1.0", "device-2").CodeIs(401)
+	request(nToken.Token, "/", "curl/8.0", "device-1").CodeIs(401)
+
+	// refreshed tokens stay bound
+	recorded = request(nToken.Token, "/refresh", "app/1.0", "device-1")
+	recorded.CodeIs(200)
+	rToken := DecoderToken{}
+	test.DecodeJsonPayload(recorded.Recorder, &rToken)
+	request(rToken.Token, "/", "app/1.0", "device-1").CodeIs(200)
+	request(rToken.Token, "/", "app/1.0", "device-2").CodeIs(401)
+
+	// tokens without fingerprint
+	request(makeTokenString("admin", key), "/", "app/1.0", "device-1").CodeIs(401)
+}
@@ -0,0 +1,83 @@
+package jwt
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// FrontchannelLogoutHandler logs out browsers, which are sent to it by links or redirects. The
+// token of the request, e.g. read from a cookie by the TokenExtractor, is logged out like by
+// LogoutHandler, the LogoutCookies are cleared, and the browser is redirected to the
+// "post_logout_redirect_uri" query parameter, which must be one of the PostLogoutRedirectURIs,
+// passing on the "state" query parameter. Requests without a valid token are cleared and
+// redirected all the same, so that logging out twice, e.g. from two tabs, is harmless.
+// Requests of browsers on origins outside of AllowedOrigins are rejected, if they are set.
+// Reply will be a 303 to the post logout redirect URI, a 204 if there are no
+// PostLogoutRedirectURIs, or a 400 if the requested URI isn't allowed.
+func (mw *JWTMiddleware) FrontchannelLogoutHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	writer.Header().Set("Cache-Control", "no-store")
+
+	redirectURI, ok := mw.postLogoutRedirectURI(request.URL.Query().Get("post_logout_redirect_uri"))
+	if !ok {
+		errorWithCode(writer, "Post logout redirect URI not allowed", "invalid_redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if mw.crossSiteRequest(writer, request) {
+		return
+	}
+
+	if token, err := mw.parseToken(request); err == nil {
+		if userId, err := mw.IdentityHandler(token.Claims); err == nil {
+			if !mw.logout(writer, userId, token) {
+				return
+			}
+		}
+	}
+
+	for _, cookie := range mw.LogoutCookies {
+		cookie.Value = ""
+		cookie.Expires = time.Unix(0, 0)
+		cookie.MaxAge = -1
+		if cookie.Domain == "" {
+			cookie.Domain = mw.CookieDomain(request)
+		}
+		writer.Header().Add("Set-Cookie", cookie.String())
+	}
+
+	if redirectURI == "" {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if state := request.URL.Query().Get("state"); state != "" {
+		parsed, _ := url.Parse(redirectURI)
+		query := parsed.Query()
+		query.Set("state", state)
+		parsed.RawQuery = query.Encode()
+		redirectURI = parsed.String()
+	}
+	writer.Header().Set("Location", redirectURI)
+	writer.WriteHeader(http.StatusSeeOther)
+}
+
+// postLogoutRedirectURI returns the URI to redirect to after the logout, which is empty if there
+// are no PostLogoutRedirectURIs. It returns false if the requested URI isn't allowed.
+func (mw *JWTMiddleware) postLogoutRedirectURI(requested string) (string, bool) {
+	if requested == "" {
+		if len(mw.PostLogoutRedirectURIs) == 0 {
+			return "", true
+		}
+		return mw.PostLogoutRedirectURIs[0], true
+	}
+	if !containsString(mw.PostLogoutRedirectURIs, requested) {
+		return "", false
+	}
+	return requested, true
+}
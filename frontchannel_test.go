@@ -0,0 +1,104 @@
+package jwt
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestFrontchannelLogout(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+	sessions := NewMemorySessionStore()
+	authMiddleware := &JWTMiddleware{
+		Realm:        "test zone",
+		Key:          key,
+		Timeout:      time.Hour,
+		MaxRefresh:   time.Hour * 24,
+		Clock:        clock,
+		SessionStore: sessions,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		TokenExtractor: func(request *rest.Request) (string, error) {
+			cookie, err := request.Cookie("token")
+			if err != nil {
+				return "", err
+			}
+			return cookie.Value, nil
+		},
+		LogoutCookies:          []http.Cookie{{Name: "token", Path: "/", Secure: true, HttpOnly: true}},
+		PostLogoutRedirectURIs: []string{"https://app.example.com/", "https://app.example.com/bye?lang=en"},
+	}
+
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path == "/"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Get("/logout", authMiddleware.FrontchannelLogoutHandler),
+		rest.Get("/", func(writer rest.ResponseWriter, request *rest.Request) {}),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	login := func() string {
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"}))
+		recorded.CodeIs(200)
+		token := DecoderToken{}
+		recorded.DecodeJsonPayload(&token)
+		clock.now = clock.now.Add(time.Second)
+		return token.Token
+	}
+	request := func(path, tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		if tokenString != "" {
+			req.AddCookie(&http.Cookie{Name: "token", Value: tokenString})
+		}
+		return test.RunRequest(t, handler, req)
+	}
+
+	loggedOut := login()
+	other := login()
+	if len(sessions.Sessions("admin")) != 2 {
+		t.Fatalf("Both logins should have a session, got %v", sessions.Sessions("admin"))
+	}
+
+	recorded := request("/logout?post_logout_redirect_uri="+"https%3A%2F%2Fapp.example.com%2Fbye%3Flang%3Den&state=xyz", loggedOut)
+	recorded.CodeIs(303)
+	recorded.HeaderIs("Location", "https://app.example.com/bye?lang=en&state=xyz")
+	recorded.HeaderIs("Cache-Control", "no-store")
+	setCookie := recorded.Recorder.Header().Get("Set-Cookie")
+	if !strings.HasPrefix(setCookie, "token=;") || !strings.Contains(setCookie, "Max-Age=0") || !strings.Contains(setCookie, "Secure") {
+		t.Errorf("The token cookie should be cleared, got %q", setCookie)
+	}
+
+	request("/", loggedOut).CodeIs(401)
+	request("/", other).CodeIs(200)
+	if len(sessions.Sessions("admin")) != 1 {
+		t.Errorf("The session should be ended, got %v", sessions.Sessions("admin"))
+	}
+
+	// logging out again, or without token, still redirects, by default to the first URI
+	recorded = request("/logout", loggedOut)
+	recorded.CodeIs(303)
+	recorded.HeaderIs("Location", "https://app.example.com/")
+	request("/logout", "").CodeIs(303)
+
+	// URIs outside of the allow-list are rejected without logging out
+	request("/logout?post_logout_redirect_uri=https%3A%2F%2Fevil.example.com%2F", other).CodeIs(400)
+	request("/logout?post_logout_redirect_uri=https%3A%2F%2Fapp.example.com%2Fbye", other).CodeIs(400)
+	request("/", other).CodeIs(200)
+
+	authMiddleware.PostLogoutRedirectURIs = []string{"https://app.example.com/#fragment", "/relative"}
+	if problems := authMiddleware.Validate(); len(problems) < 2 {
+		t.Errorf("Redirect URIs with fragment or relative ones should be reported, got %v", problems)
+	}
+}
@@ -0,0 +1,125 @@
+//go:build go1.18
+// +build go1.18
+
+package jwt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// newFuzzMiddleware returns a middleware failing the test on any recovered panic.
+func newFuzzMiddleware(t *testing.T) *JWTMiddleware {
+	return &JWTMiddleware{
+		Realm:      "test zone",
+		Key:        key,
+		Timeout:    time.Hour,
+		MaxRefresh: time.Hour * 24,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		Authorizator: func(userId string, request *rest.Request) bool {
+			ExtractClaims(request)
+			return true
+		},
+		PanicHandler: func(request *rest.Request, recovered interface{}) {
+			t.Fatalf("Handling %s %s panicked: %v", request.Method, request.URL, recovered)
+		},
+	}
+}
+
+// signPayload returns a token with the given raw claims segment and a valid HS256 signature.
+func signPayload(payload []byte) string {
+	signingString := jwt.EncodeSegment([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + jwt.EncodeSegment(payload)
+	signature, _ := jwt.SigningMethodHS256.Sign(signingString, key)
+	return signingString + "." + signature
+}
+
+func FuzzTokenExtractor(f *testing.F) {
+	f.Add("Bearer abc.def.ghi")
+	f.Add("Bearer ")
+	f.Add("bearer abc")
+	f.Add("Bearer  abc def")
+	f.Add("\x00")
+
+	extractor := defaultTokenExtractor(&JWTMiddleware{TokenHeaders: []TokenHeader{{Name: "Authorization", Scheme: "Bearer"}}})
+
+	f.Fuzz(func(t *testing.T, authHeader string) {
+		request := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		request.Header["Authorization"] = []string{authHeader}
+
+		token, err := extractor(&rest.Request{Request: request, Env: map[string]interface{}{}})
+		if err == nil && authHeader != "Bearer "+token {
+			t.Errorf("Extracted %q from auth header %q", token, authHeader)
+		}
+	})
+}
+
+func FuzzParseTokenString(f *testing.F) {
+	f.Add(makeTokenString("admin", key))
+	f.Add(makeTokenString("admin", []byte("wrong key")))
+	f.Add("a.b.c")
+	f.Add("..")
+	f.Add(signPayload([]byte(`{"exp":"never"}`)))
+
+	f.Fuzz(func(t *testing.T, tokenString string) {
+		mw := newFuzzMiddleware(t)
+		mw.initDefaults()
+
+		token, err := mw.parseTokenString(tokenString)
+		if err == nil && !token.Valid {
+			t.Errorf("Accepted invalid token %q", tokenString)
+		}
+	})
+}
+
+func FuzzClaims(f *testing.F) {
+	now := time.Now().Unix()
+	f.Add([]byte(fmt.Sprintf(`{"id":"admin","exp":%d,"orig_iat":%d}`, now+3600, now)))
+	f.Add([]byte(fmt.Sprintf(`{"id":"admin","exp":%d}`, now+3600)))
+	f.Add([]byte(fmt.Sprintf(`{"id":1,"exp":%d,"orig_iat":"now"}`, now+3600)))
+	f.Add([]byte(fmt.Sprintf(`{"id":"admin","exp":%d,"scope":["a",1],"scopes":"a b"}`, now+3600)))
+	f.Add([]byte(fmt.Sprintf(`{"id":"admin","exp":%d,"aud":[1,null],"nested":{"a":[{}]}}`, now+3600)))
+	f.Add([]byte(`{"id":"admin","exp":1e400}`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`null`))
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		mw := newFuzzMiddleware(t)
+		tokenString := signPayload(payload)
+
+		api := rest.NewApi()
+		api.Use(&rest.IfMiddleware{
+			Condition: func(request *rest.Request) bool {
+				return request.URL.Path == "/"
+			},
+			IfTrue: mw,
+		})
+		router, _ := rest.MakeRouter(
+			rest.Get("/", func(w rest.ResponseWriter, r *rest.Request) {
+				w.WriteJson(map[string]interface{}{"claims": ExtractClaims(r), "scopes": ExtractScopes(r)})
+			}),
+			rest.Get("/refresh", mw.RefreshHandler),
+			rest.Get("/verify", mw.VerifyHandler),
+			rest.Get("/auth", mw.AuthRequestHandler),
+		)
+		api.SetApp(router)
+		handler := api.MakeHandler()
+
+		for _, path := range []string{"/", "/refresh", "/verify", "/auth"} {
+			request := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+			request.Header.Set("Authorization", "Bearer "+tokenString)
+			recorded := test.RunRequest(t, handler, request)
+			if code := recorded.Recorder.Code; code >= 500 {
+				t.Errorf("GET %s with claims %q failed with %d: %s", path, payload, code,
+					strings.TrimSpace(recorded.Recorder.Body.String()))
+			}
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+)
+
+// GroupMapper translates the groups of a token, e.g. Azure AD groups or Keycloak roles, into
+// application scopes at verification time, so that applications only reason about scopes.
+// The mapped scopes are added to the ones returned by ScopesFunc.
+type GroupMapper struct {
+	// Claim holding the groups, either a string or an array of strings.
+	// Optional, defaults to "groups".
+	Claim string
+
+	// Scopes granted by each group. Optional.
+	Mapping map[string][]string
+
+	// Callback function that returns the scopes granted by a group that isn't in Mapping, e.g.
+	// loaded from a database. Its results are cached for CacheTTL. Must be safe for concurrent use.
+	// Optional.
+	MappingFunc func(group string) []string
+
+	// Duration for which the results of MappingFunc are cached. Optional, defaults to 5 minutes.
+	CacheTTL time.Duration
+
+	cache    *ttlCache
+	initOnce sync.Once
+}
+
+// Scopes returns the scopes granted by the groups in claims.
+func (gm *GroupMapper) Scopes(claims map[string]interface{}) []string {
+	claim := gm.Claim
+	if claim == "" {
+		claim = "groups"
+	}
+	groups, ok := claims[claim].([]interface{})
+	if group, isString := claims[claim].(string); isString {
+		groups, ok = []interface{}{group}, true
+	}
+	if !ok {
+		return nil
+	}
+
+	scopes := []string{}
+	for _, group := range stringList(groups) {
+		for _, scope := range gm.groupScopes(group) {
+			if !containsString(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+func (gm *GroupMapper) groupScopes(group string) []string {
+	if scopes, ok := gm.Mapping[group]; ok {
+		return scopes
+	}
+	if gm.MappingFunc == nil {
+		return nil
+	}
+	// the mapper may be used on its own, without the initDefaults of a middleware
+	gm.initDefaults()
+	if scopes, ok := gm.cache.Get(group); ok {
+		return scopes.([]string)
+	}
+	scopes := gm.MappingFunc(group)
+	gm.cache.Set(group, scopes, gm.CacheTTL)
+	return scopes
+}
+
+func (gm *GroupMapper) initDefaults() {
+	gm.initOnce.Do(func() {
+		if gm.CacheTTL == 0 {
+			gm.CacheTTL = 5 * time.Minute
+		}
+		gm.cache = newTTLCache()
+	})
+}
@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// hmacVerifier is the fast path for verifying HS256, HS384 and HS512 tokens signed with the key of
+// the middleware. The signing method is resolved once, the signature is checked before the
+// segments are decoded, and the HMAC states and buffers are pooled. Tokens it can't handle, e.g.
+// invalid ones, are left to jwt.Parse so that errors stay the same.
+type hmacVerifier struct {
+	method *jwt.SigningMethodHMAC
+	key    []byte
+	states sync.Pool
+
+	// decode numbers as json.Number, see UseJSONNumber
+	useNumber bool
+
+	// last decoded header, shared read-only by the tokens with the same header segment
+	header atomic.Value
+}
+
+type hmacState struct {
+	hash hash.Hash
+	// raw token, decoded segment and signature
+	raw, decoded, sum []byte
+}
+
+type cachedHeader struct {
+	segment string
+	header  map[string]interface{}
+}
+
+// newHMACVerifier returns the fast path for tokens signed with key by the given algorithm, or nil
+// if the algorithm isn't HMAC based.
+func newHMACVerifier(algorithm string, key []byte) *hmacVerifier {
+	method, ok := jwt.GetSigningMethod(algorithm).(*jwt.SigningMethodHMAC)
+	if !ok || key == nil || !method.Hash.Available() {
+		return nil
+	}
+	// copied, so that changes to the bytes of Key don't go unnoticed by handles
+	key = append([]byte(nil), key...)
+	v := &hmacVerifier{method: method, key: key}
+	v.states.New = func() interface{} {
+		return &hmacState{hash: hmac.New(method.Hash.New, key)}
+	}
+	return v
+}
+
+// handles reports whether tokens of format are verified by v.
+func (v *hmacVerifier) handles(format *TokenFormat) bool {
+	return v != nil && format.SigningAlgorithm == v.method.Name && bytes.Equal(format.Key, v.key)
+}
+
+// parse verifies the signature of tokenString and decodes its segments. It returns false if the
+// token must be parsed by jwt.Parse instead.
+func (v *hmacVerifier) parse(tokenString string) (*jwt.Token, bool) {
+	headerEnd := strings.IndexByte(tokenString, '.')
+	signatureStart := strings.LastIndexByte(tokenString, '.')
+	if headerEnd < 0 || headerEnd == signatureStart || strings.IndexByte(tokenString[headerEnd+1:signatureStart], '.') >= 0 {
+		return nil, false
+	}
+
+	state := v.states.Get().(*hmacState)
+	defer v.states.Put(state)
+	state.raw = append(state.raw[:0], tokenString...)
+
+	// check the signature first, forged tokens aren't worth decoding
+	if base64.RawURLEncoding.DecodedLen(len(tokenString)-signatureStart-1) != state.hash.Size() {
+		return nil, false
+	}
+	state.sum = growBuffer(state.sum, 2*state.hash.Size())
+	n, err := base64.RawURLEncoding.Decode(state.sum, state.raw[signatureStart+1:])
+	if err != nil {
+		return nil, false
+	}
+	state.hash.Reset()
+	state.hash.Write(state.raw[:signatureStart])
+	if !hmac.Equal(state.sum[:n], state.hash.Sum(state.sum[n:n])) {
+		return nil, false
+	}
+
+	header, ok := v.decodeHeader(state, tokenString[:headerEnd])
+	if !ok {
+		return nil, false
+	}
+
+	var claims map[string]interface{}
+	if !state.decode(state.raw[headerEnd+1:signatureStart], &claims, v.useNumber) {
+		return nil, false
+	}
+
+	return &jwt.Token{
+		Raw:       tokenString,
+		Method:    v.method,
+		Header:    header,
+		Claims:    claims,
+		Signature: tokenString[signatureStart+1:],
+	}, true
+}
+
+// decodeHeader returns the decoded header segment, which must name the algorithm of v.
+func (v *hmacVerifier) decodeHeader(state *hmacState, segment string) (map[string]interface{}, bool) {
+	if cached, ok := v.header.Load().(*cachedHeader); ok && cached.segment == segment {
+		return cached.header, true
+	}
+
+	var header map[string]interface{}
+	if !state.decode(state.raw[:len(segment)], &header, false) || header["alg"] != v.method.Name {
+		return nil, false
+	}
+	v.header.Store(&cachedHeader{segment: segment, header: header})
+	return header, true
+}
+
+// decode unmarshals the base64url encoded json of segment into v, with numbers as json.Number if
+// useNumber is set.
+func (state *hmacState) decode(segment []byte, v interface{}, useNumber bool) bool {
+	state.decoded = growBuffer(state.decoded, base64.RawURLEncoding.DecodedLen(len(segment)))
+	n, err := base64.RawURLEncoding.Decode(state.decoded, segment)
+	if err != nil {
+		return false
+	}
+	if !useNumber {
+		return json.Unmarshal(state.decoded[:n], v) == nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(state.decoded[:n]))
+	decoder.UseNumber()
+	if decoder.Decode(v) != nil {
+		return false
+	}
+	// like json.Unmarshal, reject trailing data
+	_, err = decoder.Token()
+	return err == io.EOF
+}
+
+// growBuffer returns buf resized to n bytes, reusing its capacity.
+func growBuffer(buf []byte, n int) []byte {
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
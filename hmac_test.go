@@ -0,0 +1,76 @@
+package jwt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestHMACVerifier(t *testing.T) {
+	verifier := newHMACVerifier("HS256", key)
+	tokenString := makeTokenString("admin", key)
+
+	token, ok := verifier.parse(tokenString)
+	if !ok {
+		t.Fatal("Valid token should be verified")
+	}
+	parsedToken, err := jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) { return key, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(token.Claims, parsedToken.Claims) || !reflect.DeepEqual(token.Header, parsedToken.Header) || token.Method != parsedToken.Method {
+		t.Errorf("Token should be decoded like jwt.Parse, got %v %v", token.Header, token.Claims)
+	}
+
+	hs384Token := jwt.New(jwt.SigningMethodHS384)
+	hs384Token.Claims["id"] = "admin"
+	hs384TokenString, _ := hs384Token.SignedString(key)
+
+	malformedClaims := jwt.EncodeSegment([]byte(`{"alg":"HS256"}`)) + "." + jwt.EncodeSegment([]byte(`{"id":`))
+	signature, _ := jwt.SigningMethodHS256.Sign(malformedClaims, key)
+
+	for _, tokenString := range []string{
+		makeTokenString("admin", []byte("wrong key")),
+		tokenString[:len(tokenString)-1],
+		tokenString + ".",
+		tokenString + "=",
+		hs384TokenString,
+		malformedClaims + "." + signature,
+		"a.b",
+		"..",
+	} {
+		if _, ok := verifier.parse(tokenString); ok {
+			t.Errorf("Token %q should be left to jwt.Parse", tokenString)
+		}
+	}
+
+	if newHMACVerifier("RS256", key) != nil || newHMACVerifier("HS256", nil) != nil {
+		t.Error("Only HMAC tokens with a key should have a fast path")
+	}
+	if verifier.handles(&TokenFormat{SigningAlgorithm: "HS256", Key: []byte("other key")}) {
+		t.Error("Tokens signed with another key should be left to jwt.Parse")
+	}
+}
+
+func BenchmarkParseTokenStringHS256(b *testing.B) {
+	mw := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+	mw.initDefaults()
+	tokenString := makeTokenString("admin", key)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := mw.parseTokenString(tokenString); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
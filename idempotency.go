@@ -0,0 +1,50 @@
+package jwt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// IdempotencyStore remembers the tokens issued for idempotent refresh requests for a limited time.
+// Deployments running several instances should use a shared implementation, e.g. backed by Redis.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Get returns the token stored under key, if it hasn't expired yet.
+	Get(key string) (string, bool)
+
+	// Set stores token under key for ttl.
+	Set(key string, token string, ttl time.Duration)
+}
+
+type memoryIdempotencyStore struct {
+	cache *ttlCache
+}
+
+// NewMemoryIdempotencyStore returns an IdempotencyStore keeping the tokens in memory.
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{cache: newTTLCache()}
+}
+
+func (s *memoryIdempotencyStore) memoryCache() *ttlCache {
+	return s.cache
+}
+
+func (s *memoryIdempotencyStore) Get(key string) (string, bool) {
+	token, ok := s.cache.Get(key)
+	if !ok {
+		return "", false
+	}
+	return token.(string), true
+}
+
+func (s *memoryIdempotencyStore) Set(key string, token string, ttl time.Duration) {
+	s.cache.Set(key, token, ttl)
+}
+
+// idempotencyStoreKey binds an Idempotency-Key to the token being refreshed, so that a key can't
+// be used to obtain the tokens of somebody else.
+func idempotencyStoreKey(idempotencyKey string, rawToken string) string {
+	hash := sha256.Sum256([]byte(idempotencyKey + "\x00" + rawToken))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestRefreshIdempotency(t *testing.T) {
+	removed := 0
+	authMiddleware := &JWTMiddleware{
+		Realm:                 "test zone",
+		Key:                   key,
+		MaxRefresh:            time.Hour,
+		RefreshIdempotencyTTL: time.Minute,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		RemoveToken: func(userId, token string) {
+			removed++
+		},
+	}
+
+	refreshApi := rest.NewApi()
+	refreshApi.Use(authMiddleware)
+	refreshApi.SetApp(rest.AppSimple(authMiddleware.RefreshHandler))
+
+	refresh := func(tokenString, idempotencyKey string) string {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		if idempotencyKey != "" {
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+		recorded := test.RunRequest(t, refreshApi.MakeHandler(), req)
+		recorded.CodeIs(200)
+
+		rToken := DecoderToken{}
+		test.DecodeJsonPayload(recorded.Recorder, &rToken)
+		return rToken.Token
+	}
+
+	makeRefreshableToken := func(jti string) string {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "admin"
+		token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token.Claims["orig_iat"] = time.Now().Unix()
+		token.Claims["jti"] = jti
+		tokenString, _ := token.SignedString(key)
+		return tokenString
+	}
+
+	tokenString := makeRefreshableToken("1")
+
+	// retries with the same key get the same token and rotate only once
+	first := refresh(tokenString, "retry-1")
+	time.Sleep(time.Second)
+	if retried := refresh(tokenString, "retry-1"); retried != first {
+		t.Errorf("Retried refresh should return the same token")
+	}
+	if removed != 1 {
+		t.Errorf("Token should be rotated once, was rotated %d times", removed)
+	}
+
+	// a new key rotates again
+	if refresh(tokenString, "retry-2") == first {
+		t.Errorf("Refresh with a new key should return a new token")
+	}
+
+	// the key is bound to the refreshed token
+	if refresh(makeRefreshableToken("2"), "retry-1") == first {
+		t.Errorf("Idempotency-Key must not return the token of another refresh")
+	}
+
+	// without key every request rotates
+	if refresh(tokenString, "") == first {
+		t.Errorf("Refresh without key should return a new token")
+	}
+}
@@ -0,0 +1,327 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeySet provides the public keys of a JSON Web Key Set (RFC 7517) published by an identity
+// provider. The keys are fetched lazily from URL and cached for RefreshInterval. RSA and EC
+// signature keys are supported, the latter on the P-256, P-384 and P-521 curves.
+// When the key set response carries a Cache-Control max-age directive, it determines how long the
+// keys are cached instead of RefreshInterval.
+// Tokens with a key id missing from the cached keys make the key set be fetched again, at most once
+// per UnknownKeyRefreshInterval, so that keys rotated by the identity provider are picked up before
+// the cached keys expire.
+// Only one fetch is in flight at a time, which concurrent requests needing it wait for, while the
+// requests verified with the cached keys go on.
+// Fetches go through Breaker, so that an unreachable JWKS endpoint isn't called on every request.
+type KeySet struct {
+	// URL of the JSON Web Key Set. Required.
+	URL string
+
+	// Duration after which the key set is fetched again. Optional, defaults to one hour.
+	RefreshInterval time.Duration
+
+	// Minimum duration between two attempts to fetch the key set, after which a token with an
+	// unknown key id makes it be fetched again, so that tokens with made up key ids can't trigger a
+	// fetch each. Optional, defaults to one minute.
+	UnknownKeyRefreshInterval time.Duration
+
+	// HTTP client used to fetch the key set. Optional, defaults to a client with a timeout of
+	// 10 seconds.
+	Client *http.Client
+
+	// Circuit breaker for fetching the key set. Optional, defaults to a CircuitBreaker with the
+	// default settings.
+	Breaker *CircuitBreaker
+
+	// Policy while the key set can't be fetched. If set, tokens are verified with the keys of the
+	// last successful fetch (fail-open), otherwise they are rejected (fail-closed).
+	// Optional, defaults to false.
+	FailOpen bool
+
+	// Duration after the expiry of the cached keys during which they are still used while the key
+	// set is fetched again in the background, so that requests don't wait for the fetch and
+	// short outages of the JWKS endpoint go unnoticed.
+	// Optional, defaults to 0 meaning expired keys are fetched again before they are used.
+	StaleWindow time.Duration
+
+	// Public keys by key id that are always trusted in addition to the fetched ones, e.g. as an
+	// escape hatch when the JWKS endpoint is unreachable during disaster recovery. Pinned keys are
+	// used without fetching the key set and take precedence over fetched keys with the same id.
+	// Optional.
+	PinnedKeys map[string]interface{}
+
+	// Recorder for the age of the cached keys, reported as "jwks_cache_age_seconds" gauge.
+	// Optional, the middleware sets it to its own Metrics.
+	Metrics MetricsRecorder
+
+	mutex       sync.Mutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	expiresAt   time.Time
+	attemptedAt time.Time
+	inFlight    *pendingFetch
+}
+
+// pendingFetch is a fetch in flight, e.g. of a key set, which is done once its result is stored.
+type pendingFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// defaultFetchClient fetches key sets and revocation manifests unless another client is configured,
+// so that an unresponsive endpoint can't hold requests indefinitely.
+var defaultFetchClient = &http.Client{Timeout: 10 * time.Second}
+
+// NewKeySet returns a KeySet fetching its keys from url.
+func NewKeySet(url string) *KeySet {
+	return &KeySet{URL: url}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// Key returns the public key with the given key id, which is either pinned or fetched with the
+// key set if the cached copy is missing or expired.
+func (ks *KeySet) Key(kid string) (interface{}, error) {
+	if key, ok := ks.PinnedKeys[kid]; ok {
+		return key, nil
+	}
+
+	ks.mutex.Lock()
+	if ks.Breaker == nil {
+		ks.Breaker = &CircuitBreaker{}
+	}
+	now := time.Now()
+	fresh := ks.keys != nil && !now.After(ks.expiresAt)
+	stale := ks.keys != nil && !fresh && now.Before(ks.expiresAt.Add(ks.StaleWindow))
+	_, known := ks.keys[kid]
+	refreshUnknown := !known && (fresh || stale) && now.Sub(ks.attemptedAt) >= ks.unknownKeyRefreshInterval()
+	if stale && ks.inFlight == nil {
+		// serve the stale keys while refreshing in the background
+		go ks.fetchShared()
+	}
+	ks.mutex.Unlock()
+
+	if !fresh && !stale {
+		if err := ks.fetchShared(); err != nil {
+			ks.mutex.Lock()
+			defer ks.mutex.Unlock()
+			if ks.FailOpen && ks.keys != nil {
+				return ks.cachedKey(kid)
+			}
+			return nil, err
+		}
+	} else if refreshUnknown {
+		// the identity provider may have rotated its keys, the cached ones are kept if this fails
+		ks.fetchShared()
+		if ks.Metrics != nil {
+			ks.Metrics.IncCounter("jwks_unknown_key_refreshes")
+		}
+	}
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	if ks.Metrics != nil {
+		ks.Metrics.SetGauge("jwks_cache_age_seconds", time.Since(ks.fetchedAt).Seconds())
+	}
+	return ks.cachedKey(kid)
+}
+
+func (ks *KeySet) unknownKeyRefreshInterval() time.Duration {
+	if ks.UnknownKeyRefreshInterval == 0 {
+		return time.Minute
+	}
+	return ks.UnknownKeyRefreshInterval
+}
+
+// fetchShared fetches the key set and caches its keys, or waits for the fetch in flight. It must
+// be called without holding the mutex.
+func (ks *KeySet) fetchShared() error {
+	ks.mutex.Lock()
+	fetch := ks.inFlight
+	if fetch != nil {
+		ks.mutex.Unlock()
+		<-fetch.done
+		return fetch.err
+	}
+	fetch = &pendingFetch{done: make(chan struct{})}
+	ks.inFlight = fetch
+	ks.attemptedAt = time.Now()
+	ks.mutex.Unlock()
+
+	keys, maxAge, err := ks.fetchWithBreaker()
+
+	ks.mutex.Lock()
+	if err == nil {
+		ks.update(keys, maxAge)
+	}
+	fetch.err = err
+	ks.inFlight = nil
+	ks.mutex.Unlock()
+	close(fetch.done)
+	return err
+}
+
+func (ks *KeySet) fetchWithBreaker() (keys map[string]interface{}, maxAge time.Duration, err error) {
+	err = ks.Breaker.Call(func() error {
+		keys, maxAge, err = ks.fetch()
+		return err
+	})
+	return keys, maxAge, err
+}
+
+// update caches keys for maxAge, which is negative if the response didn't specify it.
+func (ks *KeySet) update(keys map[string]interface{}, maxAge time.Duration) {
+	if maxAge < 0 {
+		maxAge = ks.RefreshInterval
+		if maxAge == 0 {
+			maxAge = time.Hour
+		}
+	}
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+	ks.expiresAt = ks.fetchedAt.Add(maxAge)
+}
+
+func (ks *KeySet) cachedKey(kid string) (interface{}, error) {
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("Unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// fetch downloads the key set and returns its keys along with the max-age of the response, which
+// is negative if the response doesn't specify one.
+func (ks *KeySet) fetch() (map[string]interface{}, time.Duration, error) {
+	client := ks.Client
+	if client == nil {
+		client = defaultFetchClient
+	}
+
+	response, err := client.Get(ks.URL)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("Fetching key set failed with status %d", response.StatusCode)
+	}
+
+	set := jsonWebKeySet{}
+	if err := json.NewDecoder(response.Body).Decode(&set); err != nil {
+		return nil, 0, err
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		var key interface{}
+		var err error
+		switch jwk.Kty {
+		case "RSA":
+			key, err = parseRSAJSONWebKey(jwk)
+		case "EC":
+			if ellipticCurves[jwk.Crv] == nil {
+				continue
+			}
+			key, err = parseECJSONWebKey(jwk)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, maxAge(response.Header.Get("Cache-Control")), nil
+}
+
+// maxAge returns the max-age directive of a Cache-Control header, or -1 if there is none.
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.HasPrefix(directive, "max-age=") {
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err != nil || seconds < 0 {
+				return -1
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return -1
+}
+
+func parseRSAJSONWebKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("Invalid RSA key")
+	}
+
+	exponent := 0
+	for _, b := range e {
+		exponent = exponent<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+}
+
+// ellipticCurves are the curves of the EC keys of key sets, by their "crv" names.
+var ellipticCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func parseECJSONWebKey(jwk jsonWebKey) (*ecdsa.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	curve := ellipticCurves[jwk.Crv]
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if len(x) == 0 || len(y) == 0 || !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("Invalid EC key")
+	}
+	return key, nil
+}
@@ -0,0 +1,395 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// keySetServer serves a JSON Web Key Set containing the public key of privKey as kid.
+func keySetServer(privKey *rsa.PrivateKey, kid string) *httptest.Server {
+	return httptest.NewServer(keySetHandler(privKey, kid))
+}
+
+func keySetHandler(privKey *rsa.PrivateKey, kid string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"keys":[{"kty":"RSA","use":"sig","alg":"RS256","kid":"` + kid + `",` +
+			`"n":"` + base64.RawURLEncoding.EncodeToString(privKey.PublicKey.N.Bytes()) + `",` +
+			`"e":"` + base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privKey.PublicKey.E)).Bytes()) + `"}]}`))
+	}
+}
+
+func makeRSATokenString(privKey *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	token := jwt.New(jwt.GetSigningMethod("RS256"))
+	token.Header["kid"] = kid
+	for key, value := range claims {
+		token.Claims[key] = value
+	}
+	tokenString, _ := token.SignedString(privKey)
+	return tokenString
+}
+
+func TestKeySet(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := keySetServer(privKey, "key-1")
+	defer server.Close()
+
+	keySet := NewKeySet(server.URL)
+
+	pubKey, err := keySet.Key("key-1")
+	if err != nil {
+		t.Fatalf("Fetching key failed: %v", err)
+	}
+	if pubKey.(*rsa.PublicKey).N.Cmp(privKey.PublicKey.N) != 0 || pubKey.(*rsa.PublicKey).E != privKey.PublicKey.E {
+		t.Errorf("Received wrong key")
+	}
+
+	if _, err := keySet.Key("key-2"); err == nil {
+		t.Errorf("Unknown key id should fail")
+	}
+
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		SigningAlgorithm: "RS256",
+		KeySet:           keySet,
+		Issuer:           "https://issuer.example.com",
+		Audience:         "api",
+		Authenticator:    rejectLogin,
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"user": r.Env["REMOTE_USER"].(string)})
+	}))
+	handler := api.MakeHandler()
+
+	claims := map[string]interface{}{
+		"id":  "admin",
+		"iss": "https://issuer.example.com",
+		"aud": []string{"other", "api"},
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	// token signed by the identity provider
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSATokenString(privKey, "key-1", claims))
+	recorded := test.RunRequest(t, handler, req)
+	recorded.CodeIs(200)
+
+	// token signed by an unknown key
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSATokenString(otherKey, "key-1", claims))
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(401)
+
+	// wrong issuer
+	claims["iss"] = "https://evil.example.com"
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSATokenString(privKey, "key-1", claims))
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(401)
+
+	// wrong audience
+	claims["iss"] = "https://issuer.example.com"
+	claims["aud"] = "other"
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSATokenString(privKey, "key-1", claims))
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(401)
+
+	// HMAC token can't be used with a key set
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(401)
+}
+
+func TestKeySetCacheControl(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Cache-Control", "public, max-age=3600, must-revalidate")
+		keySetHandler(privKey, "key-1")(w, r)
+	}))
+	defer server.Close()
+
+	// max-age takes precedence over RefreshInterval
+	keySet := &KeySet{URL: server.URL, RefreshInterval: time.Nanosecond}
+	keySet.Key("key-1")
+	time.Sleep(time.Millisecond)
+	keySet.Key("key-1")
+	if fetches != 1 {
+		t.Errorf("Key set should be fetched once, was fetched %d times", fetches)
+	}
+
+	if maxAge("no-cache") != -1 || maxAge("max-age=60") != time.Minute {
+		t.Errorf("Cache-Control max-age parsed incorrectly")
+	}
+}
+
+func TestKeySetStaleWhileRevalidate(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	fetched := make(chan bool, 10)
+	var down int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { fetched <- true }()
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=0")
+		keySetHandler(privKey, "key-1")(w, r)
+	}))
+	defer server.Close()
+
+	metrics := newCountingMetrics()
+	keySet := NewKeySet(server.URL)
+	keySet.StaleWindow = time.Hour
+	keySet.Metrics = metrics
+
+	if _, err := keySet.Key("key-1"); err != nil {
+		t.Fatalf("Fetching key failed: %v", err)
+	}
+	<-fetched
+	if _, ok := metrics.gauge("jwks_cache_age_seconds"); !ok {
+		t.Errorf("Cache age should be reported")
+	}
+
+	// the expired keys are used while the endpoint is down, and fetched again in the background
+	atomic.StoreInt32(&down, 1)
+	time.Sleep(time.Second)
+	if _, err := keySet.Key("key-1"); err != nil {
+		t.Errorf("Stale key should be used, got %v", err)
+	}
+	select {
+	case <-fetched:
+	case <-time.After(time.Second):
+		t.Errorf("Key set should be fetched in the background")
+	}
+	if age, _ := metrics.gauge("jwks_cache_age_seconds"); age < 1 {
+		t.Errorf("Expected cache age of at least 1s, got %v", age)
+	}
+
+	// beyond the stale window the keys are rejected
+	keySet.mutex.Lock()
+	keySet.expiresAt = time.Now().Add(-2 * time.Hour)
+	keySet.mutex.Unlock()
+	if _, err := keySet.Key("key-1"); err == nil {
+		t.Errorf("Keys beyond the stale window should not be used")
+	}
+}
+
+func TestKeySetPinnedKeys(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pinnedKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	keySet := NewKeySet(server.URL)
+	keySet.PinnedKeys = map[string]interface{}{"pinned": &pinnedKey.PublicKey}
+
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		SigningAlgorithm: "RS256",
+		KeySet:           keySet,
+		Authenticator:    rejectLogin,
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"user": r.Env["REMOTE_USER"].(string)})
+	}))
+	handler := api.MakeHandler()
+
+	claims := map[string]interface{}{
+		"id":  "admin",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	// tokens signed by the pinned key are accepted although the JWKS endpoint is down
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSATokenString(pinnedKey, "pinned", claims))
+	recorded := test.RunRequest(t, handler, req)
+	recorded.CodeIs(200)
+
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSATokenString(privKey, "key-1", claims))
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(401)
+
+	// the pinned key is bound to its key id
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSATokenString(privKey, "pinned", claims))
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(401)
+}
+
+func TestKeySetUnknownKeyId(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var kid atomic.Value
+	kid.Store("key-1")
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		keySetHandler(privKey, kid.Load().(string))(w, r)
+	}))
+	defer server.Close()
+
+	metrics := newCountingMetrics()
+	keySet := NewKeySet(server.URL)
+	keySet.Metrics = metrics
+
+	if _, err := keySet.Key("key-1"); err != nil {
+		t.Fatalf("Fetching key failed: %v", err)
+	}
+
+	// the identity provider rotates its key, which isn't picked up right after a fetch
+	kid.Store("key-2")
+	if _, err := keySet.Key("key-2"); err == nil {
+		t.Errorf("Unknown key id shouldn't be fetched again right after a fetch")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("Expected 1 fetch, got %d", n)
+	}
+
+	// once UnknownKeyRefreshInterval has passed the cached keys are replaced
+	keySet.mutex.Lock()
+	keySet.attemptedAt = time.Now().Add(-2 * time.Minute)
+	keySet.mutex.Unlock()
+	if _, err := keySet.Key("key-2"); err != nil {
+		t.Errorf("Rotated key should be fetched, got %v", err)
+	}
+	if _, err := keySet.Key("key-3"); err == nil {
+		t.Errorf("Unknown key id should fail")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("Expected 2 fetches, got %d", n)
+	}
+	if n := metrics.counter("jwks_unknown_key_refreshes"); n != 1 {
+		t.Errorf("Expected 1 unknown key refresh, got %d", n)
+	}
+}
+
+func TestKeySetUnknownKeyIdFetchInFlight(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var down int32
+	var fetches int32
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) == 2 {
+			<-release
+		}
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		keySetHandler(privKey, "key-1")(w, r)
+	}))
+	defer server.Close()
+
+	keySet := NewKeySet(server.URL)
+	if _, err := keySet.Key("key-1"); err != nil {
+		t.Fatalf("Fetching key failed: %v", err)
+	}
+
+	// the cached keys are used while an unknown key id is fetched
+	atomic.StoreInt32(&down, 1)
+	keySet.mutex.Lock()
+	keySet.attemptedAt = time.Now().Add(-2 * time.Minute)
+	keySet.mutex.Unlock()
+	done := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := keySet.Key("key-2")
+			done <- err
+		}()
+	}
+	for atomic.LoadInt32(&fetches) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := keySet.Key("key-1"); err != nil {
+		t.Errorf("Cached key should be used during a fetch, got %v", err)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err == nil {
+			t.Errorf("Unknown key id should fail")
+		}
+	}
+
+	// the failed attempt counts for UnknownKeyRefreshInterval, and the cached keys are kept
+	if _, err := keySet.Key("key-3"); err == nil {
+		t.Errorf("Unknown key id should fail")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("Expected 2 fetches, got %d", n)
+	}
+	if _, err := keySet.Key("key-1"); err != nil {
+		t.Errorf("Cached key should be kept after a failed fetch, got %v", err)
+	}
+}
+
+func TestKeySetECKeys(t *testing.T) {
+	privKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"keys":[` +
+			`{"kty":"EC","use":"sig","crv":"P-256","kid":"ec-1",` +
+			`"x":"` + base64.RawURLEncoding.EncodeToString(privKey.PublicKey.X.Bytes()) + `",` +
+			`"y":"` + base64.RawURLEncoding.EncodeToString(privKey.PublicKey.Y.Bytes()) + `"},` +
+			`{"kty":"EC","crv":"secp256k1","kid":"other","x":"AQ","y":"AQ"},` +
+			`{"kty":"OKP","crv":"Ed25519","kid":"ed","x":"AQ"}]}`))
+	}))
+	defer server.Close()
+
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		SigningAlgorithm: "ES256",
+		KeySet:           NewKeySet(server.URL),
+		Authenticator:    rejectLogin,
+	}
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {}))
+
+	token := jwt.New(jwt.GetSigningMethod("ES256"))
+	token.Header["kid"] = "ec-1"
+	token.Claims["id"] = "admin"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	tokenString, _ := token.SignedString(privKey)
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	test.RunRequest(t, api.MakeHandler(), req).CodeIs(200)
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tokenString, _ = token.SignedString(otherKey)
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	test.RunRequest(t, api.MakeHandler(), req).CodeIs(401)
+
+	if _, err := parseECJSONWebKey(jsonWebKey{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}); err == nil {
+		t.Errorf("Points off the curve should be rejected")
+	}
+}
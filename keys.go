@@ -0,0 +1,61 @@
+package jwt
+
+import (
+	"crypto"
+	"time"
+)
+
+// signingKeys is the key state of a middleware, replaced as a whole by SetKey so that requests
+// never see a key along with the fast path or the verified tokens of another one.
+type signingKeys struct {
+	key            []byte
+	privateKey     crypto.Signer
+	publicKey      crypto.PublicKey
+	hmacVerifier   *hmacVerifier
+	verifiedTokens *ttlCache
+
+	// keys replaced by a rotation of the secret of the SecretProvider, still accepted for
+	// verification until previousUntil
+	previous      *signingKeys
+	previousUntil time.Time
+}
+
+func (mw *JWTMiddleware) newSigningKeys(key []byte) *signingKeys {
+	keys := &signingKeys{
+		key:          key,
+		privateKey:   parsePrivateKey(mw.SigningAlgorithm, key),
+		publicKey:    parsePublicKey(mw.SigningAlgorithm, key, mw.PublicKey),
+		hmacVerifier: newHMACVerifier(mw.SigningAlgorithm, key),
+	}
+	if keys.hmacVerifier != nil {
+		keys.hmacVerifier.useNumber = mw.UseJSONNumber
+	}
+	if mw.VerificationCacheTTL != 0 {
+		keys.verifiedTokens = newTTLCache()
+		// hits and misses are counted by parseCachedToken
+		keys.verifiedTokens.instrument("verification", mw.Metrics, mw.MaxCacheEntries, false)
+	}
+	return keys
+}
+
+// SetKey replaces the secret key used for signing and verifying tokens. Unlike assigning Key, it
+// is safe while requests are served. Tokens signed with the previous key are rejected from then
+// on, use AdditionalVerifiers to keep accepting them during a rotation.
+func (mw *JWTMiddleware) SetKey(key []byte) {
+	mw.initDefaults()
+	mw.keys.Store(mw.newSigningKeys(key))
+}
+
+// signingKeys returns the current key state, or the one of Key if Init hasn't run yet. It also
+// starts fetching the secret of the SecretProvider again when it is due.
+func (mw *JWTMiddleware) signingKeys() *signingKeys {
+	mw.refreshSecretKey()
+	if keys, ok := mw.keys.Load().(*signingKeys); ok {
+		return keys
+	}
+	return &signingKeys{
+		key:        mw.Key,
+		privateKey: parsePrivateKey(mw.SigningAlgorithm, mw.Key),
+		publicKey:  parsePublicKey(mw.SigningAlgorithm, mw.Key, mw.PublicKey),
+	}
+}
@@ -0,0 +1,132 @@
+package jwt
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestSetKey(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	handler := api.MakeHandler()
+
+	request := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	request(makeTokenString("admin", key)).CodeIs(200)
+
+	newKey := []byte("rotated secret key")
+	authMiddleware.SetKey(newKey)
+
+	request(makeTokenString("admin", key)).CodeIs(401)
+	request(makeTokenString("admin", newKey)).CodeIs(200)
+
+	// tokens are issued with the new key
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", map[string]string{"username": "admin", "password": "admin"}))
+	recorded.CodeIs(200)
+	tokenString := struct{ Token string }{}
+	recorded.DecodeJsonPayload(&tokenString)
+	request(tokenString.Token).CodeIs(200)
+}
+
+// TestConcurrentApis is meant to be run with the race detector.
+func TestConcurrentApis(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:      "test zone",
+		Key:        key,
+		Timeout:    time.Hour,
+		MaxRefresh: time.Hour * 24,
+		Authenticator: func(userId string, password string) bool {
+			return password == "secret"
+		},
+	}
+
+	handlers := []http.Handler{}
+	for i := 0; i < 2; i++ {
+		api := rest.NewApi()
+		api.Use(&rest.IfMiddleware{
+			Condition: func(request *rest.Request) bool {
+				return request.URL.Path != "/login"
+			},
+			IfTrue: authMiddleware,
+		})
+		router, err := rest.MakeRouter(
+			rest.Post("/login", authMiddleware.LoginHandler),
+			rest.Get("/refresh", authMiddleware.RefreshHandler),
+			rest.Get("/", func(w rest.ResponseWriter, r *rest.Request) {
+				w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		api.SetApp(router)
+		handlers = append(handlers, api.MakeHandler())
+	}
+
+	run := func(handler http.Handler, method, path, body, tokenString string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if tokenString != "" {
+			req.Header.Set("Authorization", "Bearer "+tokenString)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			handler := handlers[i%len(handlers)]
+			for j := 0; j < 20; j++ {
+				user := fmt.Sprintf("user%d", i)
+				recorded := run(handler, "POST", "/login", `{"username":"`+user+`","password":"secret"}`, "")
+				if recorded.Code != 200 {
+					t.Errorf("Login failed with %d", recorded.Code)
+					return
+				}
+				tokenString := strings.Split(recorded.Body.String(), `"`)[3]
+
+				if recorded := run(handler, "GET", "/", "", tokenString); recorded.Body.String() != `{"Id":"`+user+`"}` {
+					t.Errorf("Request failed with %s", recorded.Body)
+				}
+				if recorded := run(handler, "GET", "/refresh", "", tokenString); recorded.Code != 200 {
+					t.Errorf("Refresh failed with %d", recorded.Code)
+				}
+			}
+		}(i)
+	}
+	// rotating to the same key doesn't invalidate tokens
+	for i := 0; i < 20; i++ {
+		authMiddleware.SetKey(key)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,115 @@
+package jwt
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// BatchFunc loads the values of keys for a request in one backend call, e.g. the roles or feature
+// flags of the authenticated user. Keys without value may be left out of the result.
+type BatchFunc func(request *rest.Request, keys []string) (map[string]interface{}, error)
+
+// Loader shares and batches the backend lookups of the guards and authorizers of one request
+// (dataloader pattern). Values are loaded at most once per request, and keys announced with
+// Queue are loaded together with the first Load, so that a chain of guards needs a single backend
+// call instead of one per guard. Loaders are obtained with RequestLoader.
+type Loader struct {
+	request *rest.Request
+	batch   BatchFunc
+
+	mutex  sync.Mutex
+	values map[string]interface{}
+	loaded map[string]bool
+	queued []string
+}
+
+// ErrUnknownLoader is returned by the Loader of a name missing in Loaders.
+var ErrUnknownLoader = errors.New("Unknown loader")
+
+// RequestLoader returns the Loader of the request for the BatchFunc registered in Loaders under
+// name. It is created on first use and kept in request.Env["JWT_LOADERS"].
+func (mw *JWTMiddleware) RequestLoader(request *rest.Request, name string) *Loader {
+	loaders, ok := request.Env["JWT_LOADERS"].(map[string]*Loader)
+	if !ok {
+		loaders = map[string]*Loader{}
+		request.Env["JWT_LOADERS"] = loaders
+	}
+	loader, ok := loaders[name]
+	if !ok {
+		loader = &Loader{request: request, batch: mw.Loaders[name], values: map[string]interface{}{}, loaded: map[string]bool{}}
+		loaders[name] = loader
+	}
+	return loader
+}
+
+// QueueLoads returns a middleware announcing keys to the Loader name of each request, so that they
+// are fetched with the first Load. It is usually put in front of the guards that load them.
+func (mw *JWTMiddleware) QueueLoads(name string, keys ...string) rest.MiddlewareSimple {
+	return func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(writer rest.ResponseWriter, request *rest.Request) {
+			mw.RequestLoader(request, name).Queue(keys...)
+			handler(writer, request)
+		}
+	}
+}
+
+// Queue announces keys to be loaded with the next Load.
+func (l *Loader) Queue(keys ...string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.queued = append(l.queued, keys...)
+}
+
+// Load returns the value of key, and whether it has one.
+func (l *Loader) Load(key string) (interface{}, bool, error) {
+	values, err := l.LoadMany(key)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := values[key]
+	return value, ok, nil
+}
+
+// LoadMany returns the values of keys, loading those that haven't been loaded yet together with
+// the queued keys in one call of the BatchFunc. Failed loads aren't cached.
+func (l *Loader) LoadMany(keys ...string) (map[string]interface{}, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, key := range append(keys, l.queued...) {
+		if !l.loaded[key] && !seen[key] {
+			missing = append(missing, key)
+			seen[key] = true
+		}
+	}
+
+	if len(missing) > 0 {
+		if l.batch == nil {
+			return nil, ErrUnknownLoader
+		}
+		values, err := l.batch(l.request, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range missing {
+			if value, ok := values[key]; ok {
+				l.values[key] = value
+			}
+			l.loaded[key] = true
+		}
+		l.queued = nil
+	}
+
+	result := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if value, ok := l.values[key]; ok {
+			result[key] = value
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,112 @@
+package jwt
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestLoader(t *testing.T) {
+	batches := [][]string{}
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		Loaders: map[string]BatchFunc{
+			"flags": func(request *rest.Request, keys []string) (map[string]interface{}, error) {
+				batches = append(batches, keys)
+				if request.Env["REMOTE_USER"] != "admin" {
+					return nil, errors.New("Backend unavailable")
+				}
+				return map[string]interface{}{"beta": true, "billing": false}, nil
+			},
+		},
+	}
+
+	requireFlag := func(flag string) rest.MiddlewareSimple {
+		return func(handler rest.HandlerFunc) rest.HandlerFunc {
+			return func(writer rest.ResponseWriter, request *rest.Request) {
+				value, _, err := authMiddleware.RequestLoader(request, "flags").Load(flag)
+				if err != nil {
+					rest.Error(writer, err.Error(), http.StatusServiceUnavailable)
+					return
+				}
+				if value != true {
+					rest.Error(writer, "Forbidden", http.StatusForbidden)
+					return
+				}
+				handler(writer, request)
+			}
+		}
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(rest.WrapMiddlewares(
+		[]rest.Middleware{authMiddleware.QueueLoads("flags", "beta", "billing", "audit"), requireFlag("beta"), requireFlag("beta")},
+		func(w rest.ResponseWriter, r *rest.Request) {
+			w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+		},
+	)))
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+
+	if !reflect.DeepEqual(batches, [][]string{{"beta", "billing", "audit"}}) {
+		t.Errorf("Flags should be loaded in one batch, got %v", batches)
+	}
+
+	// loads are per request
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	if len(batches) != 2 {
+		t.Errorf("Each request should load its flags, got %v", batches)
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	calls := 0
+	mw := &JWTMiddleware{
+		Loaders: map[string]BatchFunc{
+			"roles": func(request *rest.Request, keys []string) (map[string]interface{}, error) {
+				calls++
+				if calls == 1 {
+					return nil, errors.New("Backend unavailable")
+				}
+				return map[string]interface{}{"admin": true}, nil
+			},
+		},
+	}
+	request := &rest.Request{Env: map[string]interface{}{}}
+
+	loader := mw.RequestLoader(request, "roles")
+	if _, _, err := loader.Load("admin"); err == nil {
+		t.Error("Load should return the error of the batch function")
+	}
+	// failed loads aren't cached
+	if value, ok, err := loader.Load("admin"); value != true || !ok || err != nil {
+		t.Errorf("Load should retry, got %v %v %v", value, ok, err)
+	}
+	// keys without value are cached too
+	if _, ok, _ := loader.Load("owner"); ok {
+		t.Error("owner should have no value")
+	}
+	loader.Load("owner")
+	if calls != 3 {
+		t.Errorf("Batch function should be called 3 times, got %d", calls)
+	}
+
+	if _, _, err := mw.RequestLoader(request, "unknown").Load("admin"); err != ErrUnknownLoader {
+		t.Errorf("Unknown loaders should fail, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package jwt
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// LogoutHandler logs out the token of the request: it is revoked with RevokeToken, rejected by
+// this middleware along with the other tokens of its session, and, if LogoutPublisher is set, a
+// logout ticket is minted so that sibling services verifying tokens statelessly can do the same
+// with AcceptLogoutTicket. The session of the token is ended if the SessionStore is a
+// SessionEnder. It needs to be put under an endpoint that is using the JWTMiddleware.
+// The ticket is a short-lived token signed like the issued ones, with TokenUseLogout as
+// "token_use" claim, the logged out keys in the "logout" claim and the time until which they are
+// rejected in the "deny_until" claim.
+// Reply will be a 204.
+func (mw *JWTMiddleware) LogoutHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	if mw.handleCORS(writer, request) {
+		return
+	}
+
+	if mw.crossSiteRequest(writer, request) {
+		return
+	}
+
+	token, err := mw.parseToken(request)
+	if err != nil {
+		mw.unauthorizedError(writer, err)
+		return
+	}
+	userId, err := mw.IdentityHandler(token.Claims)
+	if err != nil {
+		mw.unauthorized(writer)
+		return
+	}
+
+	if !mw.logout(writer, userId, token) {
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// logout revokes the token, rejects the other tokens of its session, ends the session and
+// publishes a logout ticket. If it fails, the error response has been written and false is
+// returned.
+func (mw *JWTMiddleware) logout(writer rest.ResponseWriter, userId string, token *jwt.Token) bool {
+	if err := mw.RevokeToken(token.Raw); err != nil {
+		mw.unauthorizedError(writer, err)
+		return false
+	}
+
+	// the other tokens of the session may be refreshed until MaxRefresh has passed
+	now := mw.Clock.Now()
+	denyUntil := now.Add(mw.Timeout + mw.MaxRefresh)
+	keys := logoutKeys(userId, token)
+	mw.denyLoggedOut(keys, denyUntil)
+	mw.endSession(userId, token)
+
+	if mw.LogoutPublisher != nil {
+		ticket, err := mw.mintLogoutTicket(userId, keys, now, denyUntil)
+		if err != nil {
+			rest.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+			return false
+		}
+		mw.LogoutPublisher(ticket)
+	}
+	return true
+}
+
+// AcceptLogoutTicket verifies a logout ticket minted by the LogoutHandler of a sibling service,
+// signed with the key of this middleware or of one of its AdditionalVerifiers, and rejects the
+// logged out tokens from then on. Tickets older than their LogoutTicketTTL are rejected.
+func (mw *JWTMiddleware) AcceptLogoutTicket(ticket string) error {
+	mw.initDefaults()
+
+	token, _, err := mw.parseWithVerifiers(ticket)
+	if err != nil {
+		return err
+	}
+	if token.Claims["token_use"] != TokenUseLogout {
+		return ErrInvalidTokenUse
+	}
+	if _, ok := token.Claims["exp"]; !ok {
+		return ErrMissingExpiration
+	}
+	if mw.Issuer != "" && token.Claims["iss"] != mw.Issuer {
+		return ErrInvalidIssuer
+	}
+	denyUntil, ok := GetTime(token.Claims, "deny_until")
+	if !ok {
+		return ErrInvalidClaims
+	}
+
+	mw.denyLoggedOut(stringList(token.Claims["logout"]), denyUntil)
+	mw.Metrics.IncCounter("logout_tickets_accepted")
+	return nil
+}
+
+// logoutKeys returns the keys identifying a logged out token and its token family.
+func logoutKeys(userId string, token *jwt.Token) []string {
+	return []string{"token:" + tokenId(token.Raw), "family:" + tokenFamily(userId, token.Claims)}
+}
+
+// denyLoggedOut rejects the tokens identified by keys until denyUntil.
+func (mw *JWTMiddleware) denyLoggedOut(keys []string, denyUntil time.Time) {
+	now := mw.Clock.Now()
+	ttl := denyUntil.Sub(now)
+	if ttl <= 0 {
+		return
+	}
+	for _, key := range keys {
+		mw.loggedOut.Set(key, now, ttl)
+	}
+}
+
+// loggedOutToken reports whether the token or its token family was logged out, or its subject
+// was logged out by a back-channel logout or its user reset the password after the token was
+// issued.
+func (mw *JWTMiddleware) loggedOutToken(token *jwt.Token) bool {
+	if sub, ok := token.Claims["sub"].(string); ok {
+		if loggedOutAt, ok := mw.loggedOut.Get("sub:" + sub); ok && !issuedAfter(token.Claims, loggedOutAt.(time.Time)) {
+			return true
+		}
+	}
+	userId, err := mw.IdentityHandler(token.Claims)
+	if err != nil {
+		return false
+	}
+	if resetAt, ok := mw.loggedOut.Get("password_reset:" + userId); ok && !issuedAfter(token.Claims, resetAt.(time.Time)) {
+		return true
+	}
+	for _, key := range logoutKeys(userId, token) {
+		if _, ok := mw.loggedOut.Get(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// issuedAfter reports whether the token with claims was issued after t, according to its "iat"
+// claim or else its "orig_iat" claim. Tokens with neither aren't.
+func issuedAfter(claims map[string]interface{}, t time.Time) bool {
+	issuedAt, ok := GetTime(claims, "iat")
+	if !ok {
+		issuedAt, ok = GetTime(claims, "orig_iat")
+	}
+	return ok && issuedAt.Unix() > t.Unix()
+}
+
+func (mw *JWTMiddleware) mintLogoutTicket(userId string, keys []string, now, denyUntil time.Time) (string, error) {
+	jti, err := newTokenId(mw.RandReader)
+	if err != nil {
+		return "", err
+	}
+
+	format := mw.defaultTokenFormat()
+	ticket := jwt.New(jwt.GetSigningMethod(format.SigningAlgorithm))
+	ticket.Claims["id"] = userId
+	ticket.Claims["jti"] = jti
+	ticket.Claims["token_use"] = TokenUseLogout
+	ticket.Claims["logout"] = keys
+	ticket.Claims["deny_until"] = denyUntil.Unix()
+	ticket.Claims["iat"] = now.Unix()
+	ticket.Claims["exp"] = now.Add(mw.LogoutTicketTTL).Unix()
+	if mw.Issuer != "" {
+		ticket.Claims["iss"] = mw.Issuer
+	}
+	return mw.signToken(ticket, format, userId)
+}
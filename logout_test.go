@@ -0,0 +1,102 @@
+package jwt
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestLogoutTickets(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+	tickets := []string{}
+	authMiddleware := &JWTMiddleware{
+		Realm:      "test zone",
+		Key:        key,
+		Timeout:    time.Hour,
+		MaxRefresh: time.Hour * 24,
+		Clock:      clock,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		LogoutPublisher: func(ticket string) {
+			tickets = append(tickets, ticket)
+		},
+	}
+
+	authApi := rest.NewApi()
+	authApi.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/login"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+		rest.Post("/logout", authMiddleware.LogoutHandler),
+		rest.Get("/", func(writer rest.ResponseWriter, request *rest.Request) {}),
+	)
+	authApi.SetApp(router)
+	authHandler := authApi.MakeHandler()
+
+	sibling := NewVerifier(key, WithConfig(func(mw *JWTMiddleware) {
+		mw.Clock = clock
+	}))
+	siblingApi := rest.NewApi()
+	siblingApi.Use(sibling)
+	siblingApi.SetApp(rest.AppSimple(func(writer rest.ResponseWriter, request *rest.Request) {}))
+	siblingHandler := siblingApi.MakeHandler()
+
+	request := func(handler http.Handler, method, path, tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest(method, "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+	tokenOf := func(recorded *test.Recorded) string {
+		recorded.CodeIs(200)
+		token := DecoderToken{}
+		recorded.DecodeJsonPayload(&token)
+		return token.Token
+	}
+	login := func() string {
+		token := tokenOf(test.RunRequest(t, authHandler, test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"})))
+		clock.now = clock.now.Add(time.Second)
+		return token
+	}
+
+	loggedOut := login()
+	refreshed := tokenOf(request(authHandler, "GET", "/refresh", loggedOut))
+	other := login()
+
+	request(authHandler, "POST", "/logout", loggedOut).CodeIs(204)
+	if len(tickets) != 1 {
+		t.Fatalf("A logout ticket should be published, got %v", tickets)
+	}
+
+	// the token is logged out along with its token family
+	request(authHandler, "GET", "/", loggedOut).CodeIs(401)
+	request(authHandler, "GET", "/", refreshed).CodeIs(401)
+	request(authHandler, "GET", "/", other).CodeIs(200)
+
+	// siblings verifying statelessly log it out once they got the ticket
+	request(siblingHandler, "GET", "/", refreshed).CodeIs(200)
+	if err := sibling.AcceptLogoutTicket(tickets[0]); err != nil {
+		t.Fatalf("The ticket should be accepted, got %v", err)
+	}
+	request(siblingHandler, "GET", "/", loggedOut).CodeIs(401)
+	request(siblingHandler, "GET", "/", refreshed).CodeIs(401)
+	request(siblingHandler, "GET", "/", other).CodeIs(200)
+
+	// tickets aren't access tokens, and expire
+	request(siblingHandler, "GET", "/", tickets[0]).CodeIs(401)
+	if err := sibling.AcceptLogoutTicket(other); err != ErrInvalidTokenUse {
+		t.Errorf("Access tokens aren't logout tickets, got %v", err)
+	}
+	clock.now = clock.now.Add(10 * time.Minute)
+	if err := sibling.AcceptLogoutTicket(tickets[0]); err == nil {
+		t.Error("Expired tickets should be rejected")
+	}
+}
@@ -0,0 +1,69 @@
+package jwt
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// MaintenanceMode restricts authentication at runtime, e.g. during incident response when
+// credentials may be compromised. See SetMaintenanceMode.
+type MaintenanceMode int
+
+const (
+	// MaintenanceOff is the regular operation.
+	MaintenanceOff MaintenanceMode = iota
+
+	// MaintenanceNoLogins rejects all logins, while existing tokens remain valid.
+	MaintenanceNoLogins
+
+	// MaintenanceOpsOnly rejects all logins and all tokens without the MaintenanceScope.
+	MaintenanceOpsOnly
+)
+
+// SetMaintenanceMode switches the maintenance mode of the middleware. Rejected requests get a 503
+// with the "maintenance" error code and a Retry-After header of retryAfter, if it isn't 0.
+// It is safe to call while the middleware is serving requests.
+func (mw *JWTMiddleware) SetMaintenanceMode(mode MaintenanceMode, retryAfter time.Duration) {
+	mw.maintenance.Store(maintenanceState{mode: mode, retryAfter: retryAfter})
+}
+
+type maintenanceState struct {
+	mode       MaintenanceMode
+	retryAfter time.Duration
+}
+
+func (mw *JWTMiddleware) currentMaintenance() (MaintenanceMode, time.Duration) {
+	state, _ := mw.maintenance.Load().(maintenanceState)
+	return state.mode, state.retryAfter
+}
+
+// loginUnavailable rejects logins in maintenance mode.
+func (mw *JWTMiddleware) loginUnavailable(writer rest.ResponseWriter) bool {
+	mode, retryAfter := mw.currentMaintenance()
+	if mode == MaintenanceOff {
+		return false
+	}
+	mw.serviceUnavailable(writer, retryAfter)
+	return true
+}
+
+// requestUnavailable rejects authenticated requests without the MaintenanceScope in
+// MaintenanceOpsOnly mode.
+func (mw *JWTMiddleware) requestUnavailable(writer rest.ResponseWriter, request *rest.Request) bool {
+	mode, retryAfter := mw.currentMaintenance()
+	if mode != MaintenanceOpsOnly || containsString(ExtractScopes(request), mw.MaintenanceScope) {
+		return false
+	}
+	mw.serviceUnavailable(writer, retryAfter)
+	return true
+}
+
+func (mw *JWTMiddleware) serviceUnavailable(writer rest.ResponseWriter, retryAfter time.Duration) {
+	if retryAfter != 0 {
+		writer.Header().Set("Retry-After", strconv.FormatInt(int64(retryAfter/time.Second), 10))
+	}
+	errorWithCode(writer, "Service Unavailable", "maintenance", http.StatusServiceUnavailable)
+}
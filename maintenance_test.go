@@ -0,0 +1,74 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	login := func() *test.Recorded {
+		loginCreds := map[string]string{"username": "admin", "password": "admin"}
+		return test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	request := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	authApi := rest.NewApi()
+	authApi.SetApp(rest.AppSimple(authMiddleware.AuthRequestHandler))
+	authRequest := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/auth", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		req.Header.Set("X-Original-URI", "/reports")
+		return test.RunRequest(t, authApi.MakeHandler(), req)
+	}
+
+	userToken := makeTokenString("admin", key)
+	opsToken := makeScopedTokenString("ops")
+
+	login().CodeIs(200)
+
+	authMiddleware.SetMaintenanceMode(MaintenanceNoLogins, 5*time.Minute)
+	recorded := login()
+	recorded.CodeIs(503)
+	recorded.HeaderIs("Retry-After", "300")
+	recorded.BodyIs(`{"Error":"Service Unavailable","code":"maintenance"}`)
+	request(userToken).CodeIs(200)
+
+	authMiddleware.SetMaintenanceMode(MaintenanceOpsOnly, 0)
+	login().CodeIs(503)
+	recorded = request(userToken)
+	recorded.CodeIs(503)
+	recorded.HeaderIs("Retry-After", "")
+	request(opsToken).CodeIs(200)
+	// edge proxies are switched off as well
+	authRequest(userToken).CodeIs(503)
+	authRequest(opsToken).CodeIs(200)
+
+	authMiddleware.SetMaintenanceMode(MaintenanceOff, 0)
+	login().CodeIs(200)
+	request(userToken).CodeIs(200)
+	authRequest(userToken).CodeIs(200)
+}
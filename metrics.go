@@ -0,0 +1,17 @@
+package jwt
+
+// MetricsRecorder receives the metric events of the middleware, e.g. to forward them to
+// Prometheus, expvar or StatsD. Implementations must be safe for concurrent use.
+type MetricsRecorder interface {
+	// IncCounter increments the counter with the given name by one.
+	IncCounter(name string)
+
+	// SetGauge sets the gauge with the given name to value.
+	SetGauge(name string, value float64)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) IncCounter(name string) {}
+
+func (noopMetrics) SetGauge(name string, value float64) {}
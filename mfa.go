@@ -0,0 +1,90 @@
+package jwt
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// RequireMFA returns a guard that only calls the wrapped handler if the token of the request
+// attests multi-factor authentication, by an "amr" claim (RFC 8176) containing "mfa" or by an
+// "mfa" claim set to true. With a maxAge, the "auth_time" claim, stamped along with "amr" by
+// LoginHandler, must also be at most maxAge old, so that refreshed tokens, which keep both claims
+// of the login, don't attest it for longer. 0 means no limit. Other requests are rejected with a
+// 403, the "mfa_required" error code and an insufficient_user_authentication challenge (RFC 9470),
+// telling clients to step up. It must be used behind the middleware, usually on a per route basis
+// with rest.WrapMiddlewares.
+func (mw *JWTMiddleware) RequireMFA(maxAge time.Duration) rest.MiddlewareSimple {
+	return func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(writer rest.ResponseWriter, request *rest.Request) {
+			if !mw.hasMFA(ExtractClaims(request), maxAge) {
+				mw.mfaRequired(mw.encodeResponses(writer, request), maxAge)
+				return
+			}
+			handler(writer, request)
+		}
+	}
+}
+
+// hasMFA reports whether claims attest multi-factor authentication, at most maxAge ago unless it
+// is 0.
+func (mw *JWTMiddleware) hasMFA(claims map[string]interface{}, maxAge time.Duration) bool {
+	mfa, _ := claims["mfa"].(bool)
+	if !mfa && !containsString(stringList(claims["amr"]), "mfa") {
+		return false
+	}
+	if maxAge == 0 {
+		return true
+	}
+	authTime, ok := GetTime(claims, "auth_time")
+	return ok && !mw.Clock.Now().After(authTime.Add(maxAge))
+}
+
+// mfaRequired responds with a 403 and a step-up challenge, with the max_age of RFC 9470 if any.
+func (mw *JWTMiddleware) mfaRequired(writer rest.ResponseWriter, maxAge time.Duration) {
+	params := `, error="insufficient_user_authentication"`
+	if maxAge != 0 {
+		params += ", max_age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+	}
+	mw.challenge(writer, params)
+	errorWithCode(writer, errMFARequired.Message, errMFARequired.Code, http.StatusForbidden)
+}
+
+// authenticateSecondFactor calls the SecondFactorAuthenticator with the otp of a login and returns
+// the "amr" claim of the token, ok is false if it timed out. Logins without otp are only
+// authenticated by password.
+func (mw *JWTMiddleware) authenticateSecondFactor(userId string, otp string) ([]string, bool, bool) {
+	amr := []string{"pwd"}
+	if otp == "" {
+		return amr, true, true
+	}
+
+	var methods []string
+	verified := false
+	if !mw.callWithTimeout(func() { methods, verified = mw.SecondFactorAuthenticator(userId, otp) }) {
+		return nil, false, false
+	}
+	if !verified {
+		return nil, false, true
+	}
+	for _, method := range methods {
+		if !containsString(amr, method) && method != "mfa" {
+			amr = append(amr, method)
+		}
+	}
+	return append(amr, "mfa"), true, true
+}
+
+// authenticationClaims returns claims with the "amr" claim and the login time as "auth_time"
+// claim.
+func (mw *JWTMiddleware) authenticationClaims(claims map[string]interface{}, amr []string) map[string]interface{} {
+	withAuthentication := map[string]interface{}{}
+	for key, value := range claims {
+		withAuthentication[key] = value
+	}
+	withAuthentication["amr"] = amr
+	withAuthentication["auth_time"] = mw.Clock.Now().Unix()
+	return withAuthentication
+}
@@ -0,0 +1,140 @@
+package jwt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestRequireMFA(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	handler := func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/", handler),
+		rest.Get("/sensitive", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireMFA(0)}, handler)),
+		rest.Get("/recent", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireMFA(5 * time.Minute)}, handler)),
+	)
+	api.SetApp(router)
+
+	request := func(path string, claims map[string]interface{}) *test.Recorded {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "admin"
+		token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token.Claims["iat"] = time.Now().Unix()
+		for name, value := range claims {
+			token.Claims[name] = value
+		}
+		tokenString, _ := token.SignedString(key)
+
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request("/", nil).CodeIs(200)
+
+	recorded := request("/sensitive", map[string]interface{}{"amr": []string{"pwd"}})
+	recorded.CodeIs(403)
+	recorded.HeaderIs("WWW-Authenticate", `JWT realm=test zone, error="insufficient_user_authentication"`)
+	recorded.BodyIs(`{"Error":"Multi-factor authentication required","code":"mfa_required"}`)
+
+	request("/sensitive", map[string]interface{}{"amr": []string{"pwd", "otp", "mfa"}}).CodeIs(200)
+	request("/sensitive", map[string]interface{}{"mfa": true}).CodeIs(200)
+	request("/sensitive", map[string]interface{}{"mfa": "true"}).CodeIs(403)
+
+	request("/recent", map[string]interface{}{"amr": []string{"pwd", "otp", "mfa"}, "auth_time": time.Now().Unix()}).CodeIs(200)
+	recorded = request("/recent", map[string]interface{}{"amr": []string{"pwd", "otp", "mfa"}, "auth_time": time.Now().Add(-10 * time.Minute).Unix()})
+	recorded.CodeIs(403)
+	recorded.HeaderIs("WWW-Authenticate", `JWT realm=test zone, error="insufficient_user_authentication", max_age=300`)
+	request("/recent", map[string]interface{}{"mfa": true}).CodeIs(403)
+}
+
+func TestSecondFactorLogin(t *testing.T) {
+	clock := &frozenClock{time.Unix(1300819000, 0)}
+	authMiddleware := &JWTMiddleware{
+		Realm:      "test zone",
+		Key:        key,
+		Timeout:    time.Hour,
+		MaxRefresh: 24 * time.Hour,
+		Clock:      clock,
+		Authenticator: func(userId string, password string) bool {
+			return password == "admin"
+		},
+		SecondFactorAuthenticator: func(userId string, otp string) ([]string, bool) {
+			return []string{"otp"}, otp == "123456"
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/login"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+		rest.Get("/sensitive", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireMFA(15 * time.Minute)}, func(w rest.ResponseWriter, r *rest.Request) {})),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+	login := func(credentials map[string]string) *test.Recorded {
+		return test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/login", credentials))
+	}
+	get := func(path string, tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+	claims := func(tokenString string) map[string]interface{} {
+		token, err := authMiddleware.parseTokenString(tokenString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token.Claims
+	}
+
+	login(map[string]string{"username": "admin", "password": "admin", "otp": "000000"}).CodeIs(401)
+
+	recorded := login(map[string]string{"username": "admin", "password": "admin"})
+	recorded.CodeIs(200)
+	passwordOnly := DecoderToken{}
+	recorded.DecodeJsonPayload(&passwordOnly)
+	if amr := stringList(claims(passwordOnly.Token)["amr"]); len(amr) != 1 || amr[0] != "pwd" {
+		t.Errorf("Logins without otp should only be authenticated by password, got %v", amr)
+	}
+	get("/sensitive", passwordOnly.Token).CodeIs(403)
+
+	recorded = login(map[string]string{"username": "admin", "password": "admin", "otp": "123456"})
+	recorded.CodeIs(200)
+	mfa := DecoderToken{}
+	recorded.DecodeJsonPayload(&mfa)
+	if c := claims(mfa.Token); !reflect.DeepEqual(stringList(c["amr"]), []string{"pwd", "otp", "mfa"}) || c["auth_time"] != float64(clock.now.Unix()) {
+		t.Errorf("The login should stamp amr and auth_time, got %v", c)
+	}
+	get("/sensitive", mfa.Token).CodeIs(200)
+
+	// refreshing keeps the auth_time of the login
+	clock.now = clock.now.Add(30 * time.Minute)
+	recorded = get("/refresh", mfa.Token)
+	recorded.CodeIs(200)
+	refreshed := DecoderToken{}
+	recorded.DecodeJsonPayload(&refreshed)
+	get("/sensitive", refreshed.Token).CodeIs(403)
+}
@@ -0,0 +1,241 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// XMLEncoder is a ResponseEncoder writing responses as XML with Content-Type "application/xml",
+// e.g. <response><token>TOKEN</token></response>. Errors have the root element "error", arrays
+// are written as repeated "item" elements.
+var XMLEncoder ResponseEncoder = xmlEncoder{}
+
+type xmlEncoder struct{}
+
+func (xmlEncoder) Encode(status int, v interface{}) ([]byte, error) {
+	value, err := genericValue(v)
+	if err != nil {
+		return nil, err
+	}
+	root := "response"
+	if status >= 400 {
+		root = "error"
+	}
+	buffer := &bytes.Buffer{}
+	buffer.WriteString(xml.Header)
+	encoder := xml.NewEncoder(buffer)
+	if err := encodeXMLElement(encoder, root, value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (xmlEncoder) ContentType(status int) string {
+	return "application/xml; charset=utf-8"
+}
+
+func encodeXMLElement(encoder *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(value) {
+			if err := encodeXMLElement(encoder, key, value[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := encodeXMLElement(encoder, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := encoder.EncodeToken(xml.CharData(scalarString(value))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+func scalarString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case json.Number:
+		return value.String()
+	}
+	return ""
+}
+
+// MsgpackEncoder is a ResponseEncoder writing responses as MessagePack with Content-Type
+// "application/msgpack". Map keys are sorted, so the encoding is deterministic.
+var MsgpackEncoder ResponseEncoder = msgpackEncoder{}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) Encode(status int, v interface{}) ([]byte, error) {
+	value, err := genericValue(v)
+	if err != nil {
+		return nil, err
+	}
+	buffer := &bytes.Buffer{}
+	encodeMsgpack(buffer, value)
+	return buffer.Bytes(), nil
+}
+
+func (msgpackEncoder) ContentType(status int) string {
+	return "application/msgpack"
+}
+
+func encodeMsgpack(buffer *bytes.Buffer, value interface{}) {
+	switch value := value.(type) {
+	case nil:
+		buffer.WriteByte(0xc0)
+	case bool:
+		if value {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			encodeMsgpackInt(buffer, i)
+		} else {
+			f, _ := value.Float64()
+			buffer.WriteByte(0xcb)
+			binary.Write(buffer, binary.BigEndian, math.Float64bits(f))
+		}
+	case string:
+		switch n := len(value); {
+		case n < 32:
+			buffer.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buffer.Write([]byte{0xd9, byte(n)})
+		case n <= math.MaxUint16:
+			buffer.WriteByte(0xda)
+			binary.Write(buffer, binary.BigEndian, uint16(n))
+		default:
+			buffer.WriteByte(0xdb)
+			binary.Write(buffer, binary.BigEndian, uint32(n))
+		}
+		buffer.WriteString(value)
+	case []interface{}:
+		encodeMsgpackLength(buffer, len(value), 0x90, 0xdc)
+		for _, item := range value {
+			encodeMsgpack(buffer, item)
+		}
+	case map[string]interface{}:
+		encodeMsgpackLength(buffer, len(value), 0x80, 0xde)
+		for _, key := range sortedKeys(value) {
+			encodeMsgpack(buffer, key)
+			encodeMsgpack(buffer, value[key])
+		}
+	}
+}
+
+func encodeMsgpackInt(buffer *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 127:
+		buffer.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buffer.WriteByte(byte(int8(i)))
+	case i >= 0 && i <= math.MaxUint32:
+		buffer.WriteByte(0xce)
+		binary.Write(buffer, binary.BigEndian, uint32(i))
+	default:
+		buffer.WriteByte(0xd3)
+		binary.Write(buffer, binary.BigEndian, i)
+	}
+}
+
+// encodeMsgpackLength writes the header of an array or map, fix is the format of up to 15
+// elements, format16 the one of up to 65535 elements and format16+1 the one beyond.
+func encodeMsgpackLength(buffer *bytes.Buffer, n int, fix byte, format16 byte) {
+	switch {
+	case n < 16:
+		buffer.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buffer.WriteByte(format16)
+		binary.Write(buffer, binary.BigEndian, uint16(n))
+	default:
+		buffer.WriteByte(format16 + 1)
+		binary.Write(buffer, binary.BigEndian, uint32(n))
+	}
+}
+
+// genericValue converts v to the values of its json encoding, i.e. maps, arrays, strings, bools,
+// json.Number and nil.
+func genericValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	return value, decoder.Decode(&value)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// negotiateEncoder returns the ResponseEncoders entry for the media type preferred by the Accept
+// header of the request, or ResponseEncoder if json is preferred or nothing else is acceptable.
+func (mw *JWTMiddleware) negotiateEncoder(request *rest.Request) (ResponseEncoder, string) {
+	type mediaRange struct {
+		mediaType string
+		quality   float64
+	}
+	ranges := []mediaRange{}
+	for _, part := range strings.Split(request.Header.Get("Accept"), ",") {
+		params := strings.Split(part, ";")
+		mediaRange := mediaRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), quality: 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					mediaRange.quality = q
+				}
+			}
+		}
+		if mediaRange.mediaType != "" && mediaRange.quality > 0 {
+			ranges = append(ranges, mediaRange)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	for _, mediaRange := range ranges {
+		if mediaRange.mediaType == "application/json" || mediaRange.mediaType == "*/*" || mediaRange.mediaType == "application/*" {
+			break
+		}
+		if encoder, ok := mw.ResponseEncoders[mediaRange.mediaType]; ok {
+			return encoder, mediaRange.mediaType
+		}
+	}
+	return mw.ResponseEncoder, ""
+}
@@ -0,0 +1,95 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestContentNegotiation(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return userId == "admin" && password == "admin"
+		},
+		ResponseEncoders: map[string]ResponseEncoder{
+			"application/xml":     XMLEncoder,
+			"application/msgpack": MsgpackEncoder,
+		},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	login := func(password string, accept string) *test.Recorded {
+		loginCreds := map[string]string{"username": "admin", "password": password}
+		req := test.MakeSimpleRequest("POST", "http://localhost/", loginCreds)
+		req.Header.Set("Accept", accept)
+		return test.RunRequest(t, loginApi.MakeHandler(), req)
+	}
+
+	recorded := login("admin", "application/xml")
+	recorded.CodeIs(200)
+	recorded.HeaderIs("Content-Type", "application/xml; charset=utf-8")
+	recorded.HeaderIs("Vary", "Accept")
+	response := struct {
+		XMLName xml.Name `xml:"response"`
+		Token   string   `xml:"token"`
+	}{}
+	if err := xml.Unmarshal(recorded.Recorder.Body.Bytes(), &response); err != nil || response.Token == "" {
+		t.Errorf("Login should reply with the token as xml, got %s", recorded.Recorder.Body.String())
+	}
+
+	recorded = login("wrong", "application/xml")
+	recorded.CodeIs(401)
+	recorded.BodyIs(xml.Header + `<error><Error>Not Authorized</Error><code>not_authorized</code></error>`)
+
+	recorded = login("wrong", "application/msgpack")
+	recorded.CodeIs(401)
+	recorded.HeaderIs("Content-Type", "application/msgpack")
+	expected := []byte{0x82, 0xa5, 'E', 'r', 'r', 'o', 'r', 0xae}
+	expected = append(expected, "Not Authorized"...)
+	expected = append(expected, 0xa4, 'c', 'o', 'd', 'e', 0xae)
+	expected = append(expected, "not_authorized"...)
+	if body := recorded.Recorder.Body.Bytes(); !bytes.Equal(body, expected) {
+		t.Errorf("Error should be encoded as msgpack, got %x", body)
+	}
+
+	recorded = login("admin", "application/msgpack")
+	recorded.CodeIs(200)
+	if body := recorded.Recorder.Body.Bytes(); !bytes.HasPrefix(body, []byte{0x81, 0xa5, 't', 'o', 'k', 'e', 'n', 0xd9}) {
+		t.Errorf("Token should be encoded as msgpack, got %x", body)
+	}
+
+	// json is preferred
+	recorded = login("admin", "application/json, application/xml;q=0.9")
+	recorded.CodeIs(200)
+	recorded.ContentTypeIsJson()
+
+	recorded = login("admin", "application/json;q=0.5, application/msgpack")
+	recorded.CodeIs(200)
+	recorded.HeaderIs("Content-Type", "application/msgpack")
+
+	// nothing matches
+	recorded = login("admin", "text/html")
+	recorded.CodeIs(200)
+	recorded.ContentTypeIsJson()
+}
+
+func TestMsgpackEncoder(t *testing.T) {
+	body, err := MsgpackEncoder.Encode(200, map[string]interface{}{
+		"a": []interface{}{true, nil, -1, 300, 1.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x81, 0xa1, 'a', 0x95, 0xc3, 0xc0, 0xff, 0xce, 0, 0, 0x01, 0x2c, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(body, expected) {
+		t.Errorf("Expected %x, got %x", expected, body)
+	}
+}
@@ -0,0 +1,49 @@
+package jwt
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// requestOrigin returns the origin of a request according to its Origin header or, if absent, its
+// Referer header. It returns an empty string if the request has neither.
+func requestOrigin(request *rest.Request) string {
+	if origin := request.Header.Get("Origin"); origin != "" {
+		return origin
+	}
+	referer, err := url.Parse(request.Header.Get("Referer"))
+	if err != nil {
+		return "null"
+	}
+	if referer.Scheme == "" && referer.Host == "" {
+		return ""
+	}
+	return referer.Scheme + "://" + referer.Host
+}
+
+func (mw *JWTMiddleware) originAllowed(origin string) bool {
+	for _, allowed := range mw.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// crossSiteRequest rejects requests of browsers on origins outside of AllowedOrigins with a 403,
+// protecting the login against cross-site request forgery. Requests without Origin and Referer
+// aren't sent by browsers and are accepted.
+func (mw *JWTMiddleware) crossSiteRequest(writer rest.ResponseWriter, request *rest.Request) bool {
+	if len(mw.AllowedOrigins) == 0 {
+		return false
+	}
+	origin := requestOrigin(request)
+	if origin == "" || mw.originAllowed(origin) {
+		return false
+	}
+	errorWithCode(writer, "Origin not allowed", "origin_not_allowed", http.StatusForbidden)
+	return true
+}
@@ -0,0 +1,58 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestAllowedOrigins(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:      "test zone",
+		Key:        key,
+		Timeout:    time.Hour,
+		MaxRefresh: time.Hour * 24,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		AllowedOrigins: []string{"https://app.example.com"},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	login := func(headers map[string]string) *test.Recorded {
+		loginCreds := map[string]string{"username": "admin", "password": "admin"}
+		req := test.MakeSimpleRequest("POST", "http://localhost/", loginCreds)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		return test.RunRequest(t, loginApi.MakeHandler(), req)
+	}
+
+	login(map[string]string{"Origin": "https://app.example.com"}).CodeIs(200)
+	login(map[string]string{"Referer": "https://app.example.com/login?next=/"}).CodeIs(200)
+	login(map[string]string{}).CodeIs(200)
+
+	recorded := login(map[string]string{"Origin": "https://evil.example.com"})
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Origin not allowed","code":"origin_not_allowed"}`)
+	login(map[string]string{"Origin": "null"}).CodeIs(403)
+	login(map[string]string{"Referer": "https://evil.example.com/"}).CodeIs(403)
+	// Origin takes precedence
+	login(map[string]string{"Origin": "https://evil.example.com", "Referer": "https://app.example.com/"}).CodeIs(403)
+
+	refreshApi := rest.NewApi()
+	refreshApi.Use(authMiddleware)
+	refreshApi.SetApp(rest.AppSimple(authMiddleware.RefreshHandler))
+	refresh := func(origin string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+		req.Header.Set("Origin", origin)
+		return test.RunRequest(t, refreshApi.MakeHandler(), req)
+	}
+
+	refresh("https://app.example.com").CodeIs(200)
+	refresh("https://evil.example.com").CodeIs(403)
+}
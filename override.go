@@ -0,0 +1,115 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrOverrideDisabled is returned by MintOverrideToken if the OverridePolicy isn't Enabled.
+var ErrOverrideDisabled = errors.New("Authorization override disabled")
+
+// OverridePolicy lets trusted internal tooling skip the authorization of requests in staging
+// environments, e.g. end-to-end tests or previews of feature flags exercising routes the test
+// user isn't authorized for. Requests carrying a valid override token in the Header skip the
+// Authorizator, the AuthorizationChecks and the RouteAuthorizator, but are still authenticated
+// and subject to the other checks, scopes included. Override tokens are signed with the Key of
+// the policy, which must not be one of the keys of the middleware, and are bound to one user.
+//
+// The policy does nothing unless Enabled returns true, so that production configurations
+// sharing the code can leave it disabled, e.g.
+//
+//	OverridePolicy: &jwt.OverridePolicy{
+//		Key:     []byte(os.Getenv("AUTHZ_OVERRIDE_KEY")),
+//		Enabled: func() bool { return os.Getenv("ENVIRONMENT") == "staging" },
+//	}
+type OverridePolicy struct {
+	// HS256 key the override tokens are signed with, at least 32 bytes. Required.
+	Key []byte
+
+	// Callback function reporting whether overrides are allowed in the current environment. It is
+	// called for every request carrying the Header, so that overrides can be switched off at
+	// runtime. Required, overrides are never allowed without it.
+	Enabled func() bool
+
+	// Header carrying the override token. Optional, defaults to "X-Authorization-Override".
+	Header string
+
+	// Maximum lifetime of the override tokens, longer lived ones are rejected.
+	// Optional, defaults to 5 minutes.
+	MaxTTL time.Duration
+}
+
+// MintOverrideToken returns an override token for userId, e.g. for a test harness, which expires
+// after ttl. It fails with ErrOverrideDisabled if the policy isn't Enabled.
+func (policy *OverridePolicy) MintOverrideToken(userId string, ttl time.Duration) (string, error) {
+	if !policy.enabled() {
+		return "", ErrOverrideDisabled
+	}
+	token := jwt.New(jwt.SigningMethodHS256)
+	now := time.Now()
+	token.Claims["sub"] = userId
+	token.Claims["override"] = "authorization"
+	token.Claims["iat"] = now.Unix()
+	token.Claims["exp"] = now.Add(ttl).Unix()
+	return token.SignedString(policy.Key)
+}
+
+// ExtractAuthorizationOverride reports whether the authorization of a request was skipped by the
+// OverridePolicy, e.g. to log it.
+func ExtractAuthorizationOverride(request *rest.Request) bool {
+	overridden, _ := request.Env["JWT_AUTHORIZATION_OVERRIDE"].(bool)
+	return overridden
+}
+
+func (policy *OverridePolicy) enabled() bool {
+	return policy != nil && policy.Enabled != nil && len(policy.Key) >= minHMACKeySizes["HS256"] && policy.Enabled()
+}
+
+func (policy *OverridePolicy) header() string {
+	if policy.Header == "" {
+		return "X-Authorization-Override"
+	}
+	return policy.Header
+}
+
+func (policy *OverridePolicy) maxTTL() time.Duration {
+	if policy.MaxTTL == 0 {
+		return 5 * time.Minute
+	}
+	return policy.MaxTTL
+}
+
+// authorizationOverridden reports whether the request carries a valid override token for its user,
+// and marks it with request.Env["JWT_AUTHORIZATION_OVERRIDE"].
+func (mw *JWTMiddleware) authorizationOverridden(userId string, request *rest.Request) bool {
+	policy := mw.OverridePolicy
+	if policy == nil {
+		return false
+	}
+	tokenString := request.Header.Get(policy.header())
+	if tokenString == "" || !policy.enabled() {
+		return false
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("Invalid signing algorithm")
+		}
+		return policy.Key, nil
+	})
+	if err != nil || token.Claims["override"] != "authorization" || token.Claims["sub"] != userId {
+		return false
+	}
+	issuedAt, hasIat := GetTime(token.Claims, "iat")
+	expiresAt, hasExp := GetTime(token.Claims, "exp")
+	if !hasIat || !hasExp || expiresAt.Sub(issuedAt) > policy.maxTTL() {
+		return false
+	}
+
+	request.Env["JWT_AUTHORIZATION_OVERRIDE"] = true
+	mw.Metrics.IncCounter("authorization_overrides")
+	return true
+}
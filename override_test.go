@@ -0,0 +1,125 @@
+package jwt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestOverridePolicy(t *testing.T) {
+	staging := true
+	policy := &OverridePolicy{
+		Key:     []byte(strings.Repeat("o", 32)),
+		Enabled: func() bool { return staging },
+	}
+	metrics := newCountingMetrics()
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: rejectLogin,
+		Metrics:       metrics,
+		Authorizator: func(userId string, request *rest.Request) bool {
+			return request.URL.Path != "/admin"
+		},
+		AuthorizationChecks: []AuthorizationCheck{{
+			Name: "not_beta",
+			Check: func(userId string, request *rest.Request) error {
+				if request.URL.Path == "/beta" {
+					return errors.New("Beta not enabled")
+				}
+				return nil
+			},
+		}},
+		RouteAuthorizator: func(userId string, route string, request *rest.Request) bool {
+			return route != "GET /reports"
+		},
+		OverridePolicy: policy,
+	}
+
+	overridden := false
+	handler := func(w rest.ResponseWriter, r *rest.Request) {
+		overridden = ExtractAuthorizationOverride(r)
+	}
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(authMiddleware.AuthorizeRoutes(
+		rest.Get("/admin", handler),
+		rest.Get("/beta", handler),
+		rest.Get("/reports", handler),
+		rest.Get("/scoped", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireScopes("reports")}, handler)),
+	)...)
+	api.SetApp(router)
+	request := func(path, override string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+		if override != "" {
+			req.Header.Set("X-Authorization-Override", override)
+		}
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	for _, path := range []string{"/admin", "/beta", "/reports"} {
+		if request(path, "").Recorder.Code == 200 {
+			t.Errorf("%s should be denied without override", path)
+		}
+	}
+
+	override, err := policy.MintOverrideToken("admin", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/admin", "/beta", "/reports"} {
+		request(path, override).CodeIs(200)
+		if !overridden {
+			t.Errorf("%s should be marked as overridden", path)
+		}
+	}
+	if metrics.counter("authorization_overrides") != 3 {
+		t.Errorf("Overrides should be counted, got %v", metrics.counters)
+	}
+	// scopes are still required
+	request("/scoped", override).CodeIs(403)
+
+	// overrides are bound to the user, and to the key of the policy
+	otherUser, _ := policy.MintOverrideToken("bob", time.Minute)
+	request("/admin", otherUser).CodeIs(401)
+	request("/admin", makeTokenString("admin", key)).CodeIs(401)
+	longLived, _ := policy.MintOverrideToken("admin", time.Hour)
+	request("/admin", longLived).CodeIs(401)
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["sub"] = "admin"
+	token.Claims["override"] = "authorization"
+	token.Claims["exp"] = time.Now().Add(time.Minute).Unix()
+	withoutIat, _ := token.SignedString(policy.Key)
+	request("/admin", withoutIat).CodeIs(401)
+
+	// disabled in production
+	staging = false
+	request("/admin", override).CodeIs(401)
+	if _, err := policy.MintOverrideToken("admin", time.Minute); err != ErrOverrideDisabled {
+		t.Errorf("Minting should fail when disabled, got %v", err)
+	}
+
+	authMiddleware.OverridePolicy = &OverridePolicy{Key: key}
+	problems := authMiddleware.Validate()
+	expected := []string{
+		"OverridePolicy Key of 10 bytes is too weak, overrides are disabled",
+		"OverridePolicy without Enabled, overrides are disabled",
+		"OverridePolicy Key must not be the Key of the middleware",
+	}
+	for _, message := range expected {
+		found := false
+		for _, problem := range problems {
+			found = found || problem.Error() == message
+		}
+		if !found {
+			t.Errorf("Validate should report %q, got %v", message, problems)
+		}
+	}
+}
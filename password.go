@@ -0,0 +1,23 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// passwordExpired reports whether the "pwd_exp" claim of the authenticated request has passed.
+func (mw *JWTMiddleware) passwordExpired(request *rest.Request) bool {
+	pwdExp, ok := GetTime(ExtractClaims(request), "pwd_exp")
+	return ok && !mw.Clock.Now().Before(pwdExp)
+}
+
+// passwordRotationRequired rejects the requests of users whose password has expired, unless
+// they are made to one of the PasswordChangeRoutes.
+func (mw *JWTMiddleware) passwordRotationRequired(writer rest.ResponseWriter, request *rest.Request) bool {
+	if !mw.passwordExpired(request) || containsString(mw.PasswordChangeRoutes, request.URL.Path) {
+		return false
+	}
+	errorWithCode(writer, "Password expired", "password_expired", http.StatusForbidden)
+	return true
+}
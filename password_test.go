@@ -0,0 +1,66 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestPasswordExpiry(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Clock:   clock,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		PasswordExpiryFunc: func(userId string) time.Time {
+			if userId == "admin" {
+				return clock.now.Add(time.Minute)
+			}
+			return time.Time{}
+		},
+		PasswordChangeRoutes: []string{"/password"},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	login := func(userId string) string {
+		loginCreds := map[string]string{"username": userId, "password": "secret"}
+		recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+		recorded.CodeIs(200)
+		nToken := DecoderToken{}
+		test.DecodeJsonPayload(recorded.Recorder, &nToken)
+		return nToken.Token
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	request := func(tokenString, path string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	adminToken := login("admin")
+	userToken := login("user")
+
+	request(adminToken, "/").CodeIs(200)
+
+	clock.now = clock.now.Add(time.Minute)
+	recorded := request(adminToken, "/")
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Password expired","code":"password_expired"}`)
+	request(adminToken, "/password").CodeIs(200)
+
+	// users without expiring password are not affected
+	request(userToken, "/").CodeIs(200)
+}
@@ -0,0 +1,197 @@
+package jwt
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// actionResetPassword is the "action" claim of the password reset tokens.
+const actionResetPassword = "reset_password"
+
+// errInvalidResetToken is returned for reset tokens that are expired, used or otherwise invalid,
+// which aren't told apart in the responses.
+var errInvalidResetToken = errors.New("Invalid or expired reset token")
+
+type forgotPassword struct {
+	Username string `json:"username"`
+}
+
+type passwordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ForgotPasswordHandler can be used by users who forgot their password to get a reset token,
+// which is delivered by the PasswordResetSender and expires after PasswordResetTTL.
+// Payload needs to be json in the form of {"username": "USERNAME"}.
+// Reply will be a 202 whether the account exists or not, so that it can't be used to find out
+// which users are registered.
+func (mw *JWTMiddleware) ForgotPasswordHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	if mw.PasswordResetSender == nil {
+		rest.NotFound(writer, request)
+		return
+	}
+
+	if mw.handleCORS(writer, request) {
+		return
+	}
+
+	if mw.crossSiteRequest(writer, request) {
+		return
+	}
+
+	payload := forgotPassword{}
+	if request.DecodeJsonPayload(&payload) != nil || payload.Username == "" {
+		errorWithCode(writer, "Username required", "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	token, err := mw.mintPasswordResetToken(payload.Username)
+	if err != nil {
+		rest.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	mw.Metrics.IncCounter("password_reset_requests")
+	mw.PasswordResetSender(payload.Username, token)
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPasswordHandler sets a new password with a reset token delivered by the
+// PasswordResetSender. Each token can be used once, and the tokens of the user issued before the
+// reset, reset tokens and access tokens alike, are rejected afterwards, so that a stolen session
+// doesn't survive the reset. The login lockout of the user is lifted with MaxLoginAttempts.
+// Used reset tokens and the rejected tokens are tracked in memory, so with several instances the
+// RevocationStore should be shared, which records the used reset tokens, and the LogoutPublisher
+// should deliver the logout ticket minted for the reset to the other instances.
+// Payload needs to be json in the form of {"token": "TOKEN", "password": "PASSWORD"}.
+// Reply will be a 204, or a 400 with the "invalid_reset_token" error code for invalid, expired or
+// used tokens, and with the "password_rejected" error code if the PasswordResetter rejected the
+// password, in which case the token can be used again.
+func (mw *JWTMiddleware) ResetPasswordHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	if mw.PasswordResetter == nil {
+		rest.NotFound(writer, request)
+		return
+	}
+
+	if mw.handleCORS(writer, request) {
+		return
+	}
+
+	if mw.crossSiteRequest(writer, request) {
+		return
+	}
+
+	payload := passwordReset{}
+	if request.DecodeJsonPayload(&payload) != nil || payload.Token == "" || payload.Password == "" {
+		errorWithCode(writer, "Token and password required", "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	userId, jti, err := mw.parsePasswordResetToken(payload.Token)
+	now := mw.Clock.Now()
+	if err == nil && mw.RevocationStore != nil && mw.RevocationStore.IsRevoked("reset_jti:"+jti) {
+		err = errInvalidResetToken
+	}
+	if err == nil && !mw.loggedOut.SetIfAbsent("reset_jti:"+jti, now, mw.PasswordResetTTL) {
+		err = errInvalidResetToken
+	}
+	if err != nil {
+		errorWithCode(writer, errInvalidResetToken.Error(), "invalid_reset_token", http.StatusBadRequest)
+		return
+	}
+
+	if err := mw.PasswordResetter(userId, payload.Password); err != nil {
+		mw.loggedOut.Delete("reset_jti:" + jti)
+		errorWithCode(writer, err.Error(), "password_rejected", http.StatusBadRequest)
+		return
+	}
+
+	if mw.RevocationStore != nil {
+		mw.RevocationStore.Revoke("reset_jti:"+jti, mw.PasswordResetTTL)
+	}
+
+	// the access tokens issued before may be refreshed until MaxRefresh has passed, and the
+	// reset tokens expire within PasswordResetTTL
+	denyUntil := now.Add(mw.Timeout + mw.MaxRefresh)
+	if resetExpiry := now.Add(mw.PasswordResetTTL); resetExpiry.After(denyUntil) {
+		denyUntil = resetExpiry
+	}
+	keys := []string{"password_reset:" + userId}
+	mw.denyLoggedOut(keys, denyUntil)
+	if mw.LogoutPublisher != nil {
+		ticket, err := mw.mintLogoutTicket(userId, keys, now, denyUntil)
+		if err != nil {
+			rest.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		mw.LogoutPublisher(ticket)
+	}
+	if mw.MaxLoginAttempts != 0 {
+		mw.loginThrottle.reset(userId)
+	}
+	mw.Metrics.IncCounter("password_resets")
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (mw *JWTMiddleware) mintPasswordResetToken(userId string) (string, error) {
+	jti, err := newTokenId(mw.RandReader)
+	if err != nil {
+		return "", err
+	}
+
+	format := mw.defaultTokenFormat()
+	token := jwt.New(jwt.GetSigningMethod(format.SigningAlgorithm))
+	now := mw.Clock.Now()
+	token.Claims["id"] = userId
+	token.Claims["jti"] = jti
+	token.Claims["token_use"] = TokenUseAction
+	token.Claims["action"] = actionResetPassword
+	token.Claims["iat"] = now.Unix()
+	token.Claims["exp"] = now.Add(mw.PasswordResetTTL).Unix()
+	if mw.Issuer != "" {
+		token.Claims["iss"] = mw.Issuer
+	}
+	return mw.signToken(token, format, userId)
+}
+
+// parsePasswordResetToken verifies a reset token minted by this middleware, not by one of the
+// AdditionalVerifiers, and returns its user and token id.
+func (mw *JWTMiddleware) parsePasswordResetToken(tokenString string) (string, string, error) {
+	token, err := mw.parseSignedToken(tokenString)
+	if err != nil {
+		return "", "", err
+	}
+	if token.Claims["token_use"] != TokenUseAction || token.Claims["action"] != actionResetPassword {
+		return "", "", ErrInvalidTokenUse
+	}
+	if _, ok := token.Claims["exp"]; !ok {
+		return "", "", ErrMissingExpiration
+	}
+	if mw.Issuer != "" && token.Claims["iss"] != mw.Issuer {
+		return "", "", ErrInvalidIssuer
+	}
+	jti, ok := token.Claims["jti"].(string)
+	if !ok {
+		return "", "", ErrInvalidClaims
+	}
+	userId, err := mw.IdentityHandler(token.Claims)
+	if err != nil {
+		return "", "", err
+	}
+	if resetAt, ok := mw.loggedOut.Get("password_reset:" + userId); ok && !issuedAfter(token.Claims, resetAt.(time.Time)) {
+		return "", "", errInvalidResetToken
+	}
+	return userId, jti, nil
+}
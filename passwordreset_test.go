@@ -0,0 +1,179 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestPasswordReset(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+	passwords := map[string]string{"admin": "old"}
+	sent := map[string]string{}
+	authMiddleware := &JWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		MaxRefresh:      24 * time.Hour,
+		Clock:           clock,
+		RevocationStore: NewMemoryRevocationStore(),
+		Authenticator: func(userId string, password string) bool {
+			return password != "" && passwords[userId] == password
+		},
+		PasswordResetSender: func(userId string, token string) {
+			if _, ok := passwords[userId]; ok {
+				sent[userId] = token
+			}
+		},
+		PasswordResetter: func(userId string, password string) error {
+			if len(password) < 8 {
+				return errors.New("Password too short")
+			}
+			passwords[userId] = password
+			return nil
+		},
+	}
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Post("/forgot", authMiddleware.ForgotPasswordHandler),
+		rest.Post("/reset", authMiddleware.ResetPasswordHandler),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+	post := func(path string, payload interface{}) *test.Recorded {
+		return test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost"+path, payload))
+	}
+
+	// the responses don't tell registered users apart
+	for _, userId := range []string{"admin", "nobody"} {
+		recorded := post("/forgot", map[string]string{"username": userId})
+		recorded.CodeIs(202)
+		recorded.BodyIs("")
+	}
+	if len(sent) != 1 || sent["admin"] == "" {
+		t.Fatalf("A reset token should be sent to admin only, got %v", sent)
+	}
+	post("/forgot", map[string]string{}).CodeIs(400)
+
+	// reset tokens aren't access tokens
+	authenticated := rest.NewApi()
+	authenticated.Use(authMiddleware)
+	authenticated.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {}))
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+sent["admin"])
+	test.RunRequest(t, authenticated.MakeHandler(), req).CodeIs(401)
+
+	post("/reset", map[string]string{"token": makeTokenString("admin", key), "password": "new password"}).CodeIs(400)
+
+	// a session of the user, e.g. a stolen one
+	session := DecoderToken{}
+	post("/login", map[string]string{"username": "admin", "password": "old"}).DecodeJsonPayload(&session)
+	authenticatedRequest := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, authenticated.MakeHandler(), req)
+	}
+	authenticatedRequest(session.Token).CodeIs(200)
+
+	recorded := post("/reset", map[string]string{"token": sent["admin"], "password": "short"})
+	recorded.CodeIs(400)
+	recorded.BodyIs(`{"Error":"Password too short","code":"password_rejected"}`)
+
+	token := sent["admin"]
+	clock.now = clock.now.Add(time.Second)
+	post("/forgot", map[string]string{"username": "admin"}).CodeIs(202)
+	other := sent["admin"]
+
+	clock.now = clock.now.Add(time.Second)
+	post("/reset", map[string]string{"token": token, "password": "new password"}).CodeIs(204)
+	authenticatedRequest(session.Token).CodeIs(401)
+	clock.now = clock.now.Add(time.Second)
+	recorded = post("/login", map[string]string{"username": "admin", "password": "new password"})
+	recorded.CodeIs(200)
+	recorded.DecodeJsonPayload(&session)
+	authenticatedRequest(session.Token).CodeIs(200)
+
+	// the token is used, and the one issued before the reset is rejected
+	recorded = post("/reset", map[string]string{"token": token, "password": "other password"})
+	recorded.CodeIs(400)
+	recorded.BodyIs(`{"Error":"Invalid or expired reset token","code":"invalid_reset_token"}`)
+	post("/reset", map[string]string{"token": other, "password": "other password"}).CodeIs(400)
+
+	// tokens expire
+	clock.now = clock.now.Add(time.Second)
+	post("/forgot", map[string]string{"username": "admin"}).CodeIs(202)
+	clock.now = clock.now.Add(authMiddleware.PasswordResetTTL + time.Second)
+	post("/reset", map[string]string{"token": sent["admin"], "password": "other password"}).CodeIs(400)
+	if passwords["admin"] != "new password" {
+		t.Errorf("The password should only be reset once, got %q", passwords["admin"])
+	}
+}
+
+func TestPasswordResetDisabled(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: rejectLogin,
+	}
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/forgot", authMiddleware.ForgotPasswordHandler),
+		rest.Post("/reset", authMiddleware.ResetPasswordHandler),
+	)
+	api.SetApp(router)
+	test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/forgot", map[string]string{"username": "admin"})).CodeIs(404)
+	test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/reset", map[string]string{"token": "x", "password": "y"})).CodeIs(404)
+}
+
+func TestPasswordResetOnOtherInstance(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	tickets := []string{}
+	instance := func() *JWTMiddleware {
+		return &JWTMiddleware{
+			Realm:           "test zone",
+			Key:             key,
+			Authenticator:   rejectLogin,
+			RevocationStore: store,
+			LogoutPublisher: func(ticket string) {
+				tickets = append(tickets, ticket)
+			},
+			PasswordResetter: func(userId string, password string) error {
+				return nil
+			},
+		}
+	}
+	first, second := instance(), instance()
+	first.initDefaults()
+	resetToken, err := first.mintPasswordResetToken("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionToken := makeTokenString("admin", key)
+
+	reset := func(mw *JWTMiddleware) *test.Recorded {
+		api := rest.NewApi()
+		api.SetApp(rest.AppSimple(mw.ResetPasswordHandler))
+		return test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", map[string]string{"token": resetToken, "password": "new password"}))
+	}
+	reset(first).CodeIs(204)
+
+	// the reset token can't be replayed on the other instance
+	reset(second).CodeIs(400)
+
+	// which rejects the sessions of the user once it got the logout ticket
+	if len(tickets) != 1 {
+		t.Fatalf("A logout ticket should be published, got %d", len(tickets))
+	}
+	if err := second.AcceptLogoutTicket(tickets[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Authenticate(sessionToken); err == nil {
+		t.Errorf("Tokens issued before the reset should be rejected")
+	}
+}
@@ -0,0 +1,130 @@
+package jwt
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+var errStatefulCheckWithoutStore = errors.New("RevocationStore is required for a Policy with StatefulCheck")
+
+// Policy is a set of verification requirements of a group of routes, see WithPolicy. The zero
+// value requires nothing beyond the middleware itself.
+type Policy struct {
+	// Scopes the token must grant according to the ScopeMatcher. Requests lacking them get a 403
+	// with an insufficient_scope challenge. Optional.
+	RequiredScopes []string
+
+	// Require the token to attest multi-factor authentication, like RequireMFA. Optional.
+	RequireMFA bool
+
+	// Maximum age of the multi-factor authentication required by RequireMFA, checked against the
+	// "auth_time" claim like the maxAge of JWTMiddleware.RequireMFA. Optional, defaults to 0
+	// meaning no limit.
+	MFAMaxAge time.Duration
+
+	// Audience the token must be meant for, in addition to the Audience of the middleware, e.g.
+	// "admin-api". Requests with other tokens get a 401. Optional.
+	Audience string
+
+	// Look up the RevocationStore on every request instead of trusting the revocation filter,
+	// which only learns about revocations of other instances every RevocationFilterInterval, so
+	// that revocations take effect immediately, e.g. for an admin API. Requires a
+	// RevocationStore. Optional, defaults to false.
+	StatefulCheck bool
+
+	// Expression the request must satisfy, e.g.
+	// jwt.MustCompileExpression(`claims.role == "admin" || "support" in claims.groups`).
+	// Requests that don't get a 403 with the "forbidden" error code. The params of the route are
+	// only set once the router has matched the request, so they are missing when the policy is
+	// used with api.Use, and only available when it wraps a route, e.g. with
+	// rest.WrapMiddlewares. With CheckPolicy, it is evaluated without the params, query and method
+	// of a request. Optional.
+	Condition *Expression
+}
+
+// WithPolicy returns a middleware verifying requests like the middleware itself, and enforcing
+// policy on top, so that route groups such as a public, an admin and an internal API can share
+// the keys and issuance configuration of one middleware while requiring different scopes,
+// audiences or checks, e.g.
+//
+//	adminApi.Use(authMiddleware.WithPolicy(jwt.Policy{RequiredScopes: []string{"admin"}, RequireMFA: true}))
+//
+// It log.Fatals on an invalid configuration, like MiddlewareFunc.
+func (mw *JWTMiddleware) WithPolicy(policy Policy) rest.Middleware {
+	mw.initDefaults()
+	if policy.StatefulCheck && mw.RevocationStore == nil {
+		log.Fatal(errStatefulCheckWithoutStore)
+	}
+
+	return rest.MiddlewareSimple(func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(writer rest.ResponseWriter, request *rest.Request) {
+			mw.middlewareImpl(writer, request, func(writer rest.ResponseWriter, request *rest.Request) {
+				if mw.enforcePolicy(mw.encodeResponses(writer, request), request, policy) {
+					handler(writer, request)
+				}
+			})
+		}
+	})
+}
+
+// enforcePolicy checks the authenticated request against policy. If it fails, the error response
+// has been written and false is returned.
+func (mw *JWTMiddleware) enforcePolicy(writer rest.ResponseWriter, request *rest.Request, policy Policy) bool {
+	if mw.CORS != nil && isPreflight(request) {
+		return true
+	}
+	switch err := mw.checkPolicy(requestExpressionInput(request), ExtractTokenId(request), policy); err {
+	case nil:
+		return true
+	case errInsufficientScope:
+		mw.insufficientScope(writer, policy.RequiredScopes)
+	case errMFARequired:
+		mw.mfaRequired(writer, policy.MFAMaxAge)
+	case errForbidden:
+		errorWithCode(writer, errForbidden.Message, errForbidden.Code, http.StatusForbidden)
+	default:
+		mw.unauthorizedError(writer, err)
+	}
+	return false
+}
+
+// checkPolicy checks the token with the given id against policy, for the request described by
+// input.
+func (mw *JWTMiddleware) checkPolicy(input *expressionInput, id string, policy Policy) error {
+	claims := input.claims
+	if policy.Audience != "" && !hasAudience(claims, policy.Audience) {
+		return ErrInvalidAudience
+	}
+	if policy.StatefulCheck {
+		if mw.RevocationStore == nil {
+			return errStatefulCheckWithoutStore
+		}
+		if mw.revokedInStoreNow(id, claims) {
+			return ErrRevokedToken
+		}
+	}
+	if !mw.hasScopes(input.scopes, policy.RequiredScopes) {
+		return errInsufficientScope
+	}
+	if policy.RequireMFA && !mw.hasMFA(claims, policy.MFAMaxAge) {
+		return errMFARequired
+	}
+	if policy.Condition != nil && !policy.Condition.allows(input) {
+		return errForbidden
+	}
+	return nil
+}
+
+// revokedInStoreNow looks up the RevocationStore for the token with the given id and claims,
+// bypassing the revocation filter.
+func (mw *JWTMiddleware) revokedInStoreNow(id string, claims map[string]interface{}) bool {
+	if mw.RevocationStore.IsRevoked(id) {
+		return true
+	}
+	jti, ok := claims["jti"].(string)
+	return ok && mw.RevocationStore.IsRevoked(jti)
+}
@@ -0,0 +1,70 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestWithPolicy(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	authMiddleware := &JWTMiddleware{
+		Realm:                    "test zone",
+		Key:                      key,
+		Timeout:                  time.Hour,
+		Authenticator:            rejectLogin,
+		RevocationStore:          store,
+		RevocationFilterInterval: time.Hour,
+	}
+
+	newHandler := func(middleware rest.Middleware) func(tokenString string) *test.Recorded {
+		api := rest.NewApi()
+		api.Use(middleware)
+		api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {}))
+		handler := api.MakeHandler()
+		return func(tokenString string) *test.Recorded {
+			req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenString)
+			return test.RunRequest(t, handler, req)
+		}
+	}
+	public := newHandler(authMiddleware)
+	admin := newHandler(authMiddleware.WithPolicy(Policy{RequiredScopes: []string{"admin"}, RequireMFA: true, StatefulCheck: true}))
+	internal := newHandler(authMiddleware.WithPolicy(Policy{Audience: "internal"}))
+
+	makeToken := func(claims map[string]interface{}) string {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "admin"
+		token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token.Claims["iat"] = time.Now().Unix()
+		for name, value := range claims {
+			token.Claims[name] = value
+		}
+		tokenString, _ := token.SignedString(key)
+		return tokenString
+	}
+
+	user := makeToken(nil)
+	public(user).CodeIs(200)
+	admin(user).CodeIs(403)
+	internal(user).CodeIs(401)
+
+	adminToken := makeToken(map[string]interface{}{"scope": "admin", "amr": []string{"pwd", "mfa"}})
+	admin(adminToken).CodeIs(200)
+	recorded := admin(makeToken(map[string]interface{}{"scope": "admin"}))
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Multi-factor authentication required","code":"mfa_required"}`)
+
+	internal(makeToken(map[string]interface{}{"aud": []string{"api", "internal"}})).CodeIs(200)
+
+	// revoked by another instance, which the revocation filter doesn't know about yet
+	store.Revoke(tokenId(adminToken), time.Hour)
+	public(adminToken).CodeIs(200)
+	admin(adminToken).CodeIs(401)
+
+	// policies don't bypass the middleware
+	admin("").CodeIs(401)
+}
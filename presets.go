@@ -0,0 +1,228 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NewCognitoMiddleware returns a JWTMiddleware verifying the ID and access tokens issued by an AWS
+// Cognito user pool. The signing keys are fetched from the JWKS of the user pool, the issuer and
+// client id are validated, and the "cognito:username" claim is used as REMOTE_USER.
+// Tokens are issued by Cognito, so the returned middleware rejects all logins.
+func NewCognitoMiddleware(region, userPoolId, clientId string) *JWTMiddleware {
+	issuer := fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, userPoolId)
+
+	return &JWTMiddleware{
+		Realm:            userPoolId,
+		SigningAlgorithm: "RS256",
+		KeySet:           NewKeySet(issuer + "/.well-known/jwks.json"),
+		Issuer:           issuer,
+		Authenticator:    rejectLogin,
+		// the claims validator checks the audience depending on the token use
+		AcceptedTokenUses: []string{"id", TokenUseAccess},
+		ClaimsValidator: func(claims map[string]interface{}) error {
+			switch claims["token_use"] {
+			case "id":
+				// ID tokens carry the client id as audience
+				if !hasAudience(claims, clientId) {
+					return ErrInvalidAudience
+				}
+			case "access":
+				if claims["client_id"] != clientId {
+					return ErrInvalidAudience
+				}
+			default:
+				return errors.New("Invalid token_use claim")
+			}
+			return nil
+		},
+		IdentityHandler: func(claims map[string]interface{}) (string, error) {
+			// ID tokens use cognito:username, access tokens username
+			if username, ok := claims["cognito:username"].(string); ok {
+				return username, nil
+			}
+			if username, ok := claims["username"].(string); ok {
+				return username, nil
+			}
+			return "", errors.New("Invalid cognito:username claim")
+		},
+	}
+}
+
+// NewFirebaseMiddleware returns a JWTMiddleware verifying the ID tokens issued by Firebase
+// Authentication for the given project. The signing keys are fetched from Google and cached as
+// long as the Cache-Control header of the response allows, the audience, issuer, subject and
+// authentication time are validated as required by Firebase, and the "user_id" claim is used as
+// REMOTE_USER.
+// Tokens are issued by Firebase, so the returned middleware rejects all logins.
+func NewFirebaseMiddleware(projectId string) *JWTMiddleware {
+	return &JWTMiddleware{
+		Realm:            projectId,
+		SigningAlgorithm: "RS256",
+		KeySet:           NewKeySet("https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"),
+		Issuer:           "https://securetoken.google.com/" + projectId,
+		Audience:         projectId,
+		Authenticator:    rejectLogin,
+		ClaimsValidator: func(claims map[string]interface{}) error {
+			if sub, ok := claims["sub"].(string); !ok || sub == "" {
+				return errors.New("Invalid sub claim")
+			}
+			now := time.Now()
+			if authTime, ok := GetTime(claims, "auth_time"); !ok || authTime.After(now) {
+				return errors.New("Invalid auth_time claim")
+			}
+			if iat, ok := GetTime(claims, "iat"); !ok || iat.After(now) {
+				return errors.New("Invalid iat claim")
+			}
+			return nil
+		},
+		IdentityHandler: func(claims map[string]interface{}) (string, error) {
+			userId, ok := claims["user_id"].(string)
+			if !ok || userId == "" {
+				return "", errors.New("Invalid user_id claim")
+			}
+			return userId, nil
+		},
+	}
+}
+
+// NewKeycloakMiddleware returns a JWTMiddleware verifying the access tokens issued by a Keycloak
+// realm for the given client, e.g. NewKeycloakMiddleware("https://sso.example.com/realms/acme", "api").
+// The issuer and JWKS endpoint are derived from the realm URL, the token must be meant for the
+// client (as audience or authorized party), the "preferred_username" claim is used as REMOTE_USER
+// and roles are mapped to scopes by KeycloakScopes.
+// Tokens are issued by Keycloak, so the returned middleware rejects all logins.
+func NewKeycloakMiddleware(realmURL, clientId string) *JWTMiddleware {
+	realmURL = strings.TrimSuffix(realmURL, "/")
+
+	return &JWTMiddleware{
+		Realm:            realmURL[strings.LastIndex(realmURL, "/")+1:],
+		SigningAlgorithm: "RS256",
+		KeySet:           NewKeySet(realmURL + "/protocol/openid-connect/certs"),
+		Issuer:           realmURL,
+		Authenticator:    rejectLogin,
+		ClaimsValidator: func(claims map[string]interface{}) error {
+			if !hasAudience(claims, clientId) && claims["azp"] != clientId {
+				return ErrInvalidAudience
+			}
+			return nil
+		},
+		IdentityHandler: func(claims map[string]interface{}) (string, error) {
+			if username, ok := claims["preferred_username"].(string); ok {
+				return username, nil
+			}
+			if sub, ok := claims["sub"].(string); ok {
+				return sub, nil
+			}
+			return "", errors.New("Invalid preferred_username claim")
+		},
+		ScopesFunc: KeycloakScopes,
+	}
+}
+
+// KeycloakScopes is a ScopesFunc for Keycloak tokens. Next to the regular "scope" claim, it returns
+// the realm roles of the "realm_access" claim as is, and the client roles of the "resource_access"
+// claim as "client:role".
+func KeycloakScopes(claims map[string]interface{}) []string {
+	scopes := defaultScopesFunc(claims)
+
+	if realmAccess, ok := claims["realm_access"].(map[string]interface{}); ok {
+		scopes = append(scopes, stringList(realmAccess["roles"])...)
+	}
+	if resourceAccess, ok := claims["resource_access"].(map[string]interface{}); ok {
+		for client, access := range resourceAccess {
+			if access, ok := access.(map[string]interface{}); ok {
+				for _, role := range stringList(access["roles"]) {
+					scopes = append(scopes, client+":"+role)
+				}
+			}
+		}
+	}
+	return scopes
+}
+
+// stringList returns the strings of a decoded json array, ignoring other values.
+func stringList(value interface{}) []string {
+	list, _ := value.([]interface{})
+	strs := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// NewAzureADMiddleware returns a JWTMiddleware verifying the v2.0 access tokens issued by Azure AD
+// (Microsoft Entra ID) for the given application (client) id. tenant is either a tenant id, or
+// one of the multi-tenant values "common", "organizations" and "consumers", in which case the
+// issuer is validated against the "tid" claim of the token. The "oid" claim is used as REMOTE_USER
+// ("preferred_username" remains available through ExtractClaims), and scopes are mapped by
+// AzureADScopes.
+// Tokens are issued by Azure AD, so the returned middleware rejects all logins.
+func NewAzureADMiddleware(tenant, clientId string) *JWTMiddleware {
+	return &JWTMiddleware{
+		Realm:            tenant,
+		SigningAlgorithm: "RS256",
+		KeySet:           NewKeySet("https://login.microsoftonline.com/" + tenant + "/discovery/v2.0/keys"),
+		Authenticator:    rejectLogin,
+		ClaimsValidator: func(claims map[string]interface{}) error {
+			tid, ok := claims["tid"].(string)
+			if !ok || tid == "" {
+				return errors.New("Invalid tid claim")
+			}
+			switch tenant {
+			case "common":
+			case "organizations":
+				// work and school accounts only
+				if tid == azureADConsumersTenant {
+					return ErrInvalidIssuer
+				}
+			case "consumers":
+				if tid != azureADConsumersTenant {
+					return ErrInvalidIssuer
+				}
+			default:
+				if tid != tenant {
+					return ErrInvalidIssuer
+				}
+			}
+			if claims["iss"] != "https://login.microsoftonline.com/"+tid+"/v2.0" {
+				return ErrInvalidIssuer
+			}
+			if !hasAudience(claims, clientId) && !hasAudience(claims, "api://"+clientId) {
+				return ErrInvalidAudience
+			}
+			return nil
+		},
+		IdentityHandler: func(claims map[string]interface{}) (string, error) {
+			oid, ok := claims["oid"].(string)
+			if !ok || oid == "" {
+				return "", errors.New("Invalid oid claim")
+			}
+			return oid, nil
+		},
+		ScopesFunc: AzureADScopes,
+	}
+}
+
+// tenant id of personal Microsoft accounts
+const azureADConsumersTenant = "9188040d-6c67-4c5b-b112-36a304b66dad"
+
+// AzureADScopes is a ScopesFunc for Azure AD tokens, returning the delegated permissions of the
+// space separated "scp" claim and the application roles of the "roles" claim.
+func AzureADScopes(claims map[string]interface{}) []string {
+	scopes := []string{}
+	if scp, ok := claims["scp"].(string); ok {
+		scopes = append(scopes, strings.Fields(scp)...)
+	}
+	return append(scopes, stringList(claims["roles"])...)
+}
+
+// rejectLogin is the Authenticator of the presets for external identity providers, which issue
+// the tokens themselves.
+func rejectLogin(userId string, password string) bool {
+	return false
+}
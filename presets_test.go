@@ -0,0 +1,260 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+// presetHandler returns a handler protected by authMiddleware that echoes REMOTE_USER.
+func presetHandler(authMiddleware *JWTMiddleware) rest.HandlerFunc {
+	return authMiddleware.MiddlewareFunc(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"user": r.Env["REMOTE_USER"].(string)})
+	})
+}
+
+// presetRequest runs a request carrying tokenString through authMiddleware and returns the
+// REMOTE_USER it was accepted for.
+func presetRequest(t *testing.T, authMiddleware *JWTMiddleware, tokenString string, code int) string {
+	api := rest.NewApi()
+	api.SetApp(rest.AppSimple(presetHandler(authMiddleware)))
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(code)
+
+	payload := map[string]string{}
+	if code == 200 {
+		test.DecodeJsonPayload(recorded.Recorder, &payload)
+	}
+	return payload["user"]
+}
+
+func TestCognitoMiddleware(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := keySetServer(privKey, "cognito-key")
+	defer server.Close()
+
+	authMiddleware := NewCognitoMiddleware("eu-west-1", "eu-west-1_pool", "client")
+	if authMiddleware.KeySet.URL != "https://cognito-idp.eu-west-1.amazonaws.com/eu-west-1_pool/.well-known/jwks.json" {
+		t.Errorf("Unexpected JWKS URL %s", authMiddleware.KeySet.URL)
+	}
+	authMiddleware.KeySet.URL = server.URL
+
+	idToken := map[string]interface{}{
+		"iss":              "https://cognito-idp.eu-west-1.amazonaws.com/eu-west-1_pool",
+		"aud":              "client",
+		"token_use":        "id",
+		"cognito:username": "alice",
+		"iat":              time.Now().Unix(),
+		"exp":              time.Now().Add(time.Hour).Unix(),
+	}
+	if user := presetRequest(t, authMiddleware, makeRSATokenString(privKey, "cognito-key", idToken), 200); user != "alice" {
+		t.Errorf("REMOTE_USER is expected to be 'alice', got %q", user)
+	}
+
+	accessToken := map[string]interface{}{
+		"iss":       "https://cognito-idp.eu-west-1.amazonaws.com/eu-west-1_pool",
+		"client_id": "client",
+		"token_use": "access",
+		"username":  "bob",
+		"iat":       time.Now().Unix(),
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+	if user := presetRequest(t, authMiddleware, makeRSATokenString(privKey, "cognito-key", accessToken), 200); user != "bob" {
+		t.Errorf("REMOTE_USER is expected to be 'bob', got %q", user)
+	}
+
+	// token for another app client
+	accessToken["client_id"] = "other"
+	presetRequest(t, authMiddleware, makeRSATokenString(privKey, "cognito-key", accessToken), 401)
+
+	// token of another user pool
+	idToken["iss"] = "https://cognito-idp.eu-west-1.amazonaws.com/other_pool"
+	presetRequest(t, authMiddleware, makeRSATokenString(privKey, "cognito-key", idToken), 401)
+}
+
+func TestFirebaseMiddleware(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := keySetServer(privKey, "firebase-key")
+	defer server.Close()
+
+	authMiddleware := NewFirebaseMiddleware("my-project")
+	authMiddleware.KeySet.URL = server.URL
+
+	now := time.Now().Unix()
+	claims := map[string]interface{}{
+		"iss":       "https://securetoken.google.com/my-project",
+		"aud":       "my-project",
+		"sub":       "uid-1",
+		"user_id":   "uid-1",
+		"auth_time": now - 60,
+		"iat":       now,
+		"exp":       now + 3600,
+	}
+	if user := presetRequest(t, authMiddleware, makeRSATokenString(privKey, "firebase-key", claims), 200); user != "uid-1" {
+		t.Errorf("REMOTE_USER is expected to be 'uid-1', got %q", user)
+	}
+
+	// authenticated in the future
+	claims["auth_time"] = now + 3600
+	presetRequest(t, authMiddleware, makeRSATokenString(privKey, "firebase-key", claims), 401)
+
+	// token of another project
+	claims["auth_time"] = now - 60
+	claims["aud"] = "other-project"
+	presetRequest(t, authMiddleware, makeRSATokenString(privKey, "firebase-key", claims), 401)
+}
+
+func TestKeycloakMiddleware(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := keySetServer(privKey, "keycloak-key")
+	defer server.Close()
+
+	authMiddleware := NewKeycloakMiddleware("https://sso.example.com/realms/acme/", "api")
+	if authMiddleware.KeySet.URL != "https://sso.example.com/realms/acme/protocol/openid-connect/certs" {
+		t.Errorf("Unexpected JWKS URL %s", authMiddleware.KeySet.URL)
+	}
+	if authMiddleware.Realm != "acme" {
+		t.Errorf("Unexpected realm %s", authMiddleware.Realm)
+	}
+	authMiddleware.KeySet.URL = server.URL
+
+	claims := map[string]interface{}{
+		"iss":                "https://sso.example.com/realms/acme",
+		"aud":                "account",
+		"azp":                "api",
+		"sub":                "f:1234",
+		"preferred_username": "alice",
+		"scope":              "openid profile",
+		"realm_access":       map[string]interface{}{"roles": []string{"admin"}},
+		"resource_access": map[string]interface{}{
+			"billing": map[string]interface{}{"roles": []string{"read", "write"}},
+		},
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	api := rest.NewApi()
+	api.SetApp(rest.AppSimple(authMiddleware.MiddlewareFunc(
+		rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireScopes("admin", "billing:write", "openid")},
+			func(w rest.ResponseWriter, r *rest.Request) {
+				w.WriteJson(map[string]string{"user": r.Env["REMOTE_USER"].(string)})
+			}))))
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSATokenString(privKey, "keycloak-key", claims))
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+
+	// token for another client
+	claims["azp"] = "frontend"
+	presetRequest(t, authMiddleware, makeRSATokenString(privKey, "keycloak-key", claims), 401)
+}
+
+func TestAzureADMiddleware(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := keySetServer(privKey, "azure-key")
+	defer server.Close()
+
+	tenantId := "72f988bf-86f1-41af-91ab-2d7cd011db47"
+	claims := func(tid string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":                "https://login.microsoftonline.com/" + tid + "/v2.0",
+			"aud":                "app-id",
+			"tid":                tid,
+			"oid":                "object-id",
+			"preferred_username": "alice@example.com",
+			"scp":                "User.Read Files.Read",
+			"roles":              []string{"Admin"},
+			"iat":                time.Now().Unix(),
+			"exp":                time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	// single tenant
+	authMiddleware := NewAzureADMiddleware(tenantId, "app-id")
+	if authMiddleware.KeySet.URL != "https://login.microsoftonline.com/"+tenantId+"/discovery/v2.0/keys" {
+		t.Errorf("Unexpected JWKS URL %s", authMiddleware.KeySet.URL)
+	}
+	authMiddleware.KeySet.URL = server.URL
+
+	if user := presetRequest(t, authMiddleware, makeRSATokenString(privKey, "azure-key", claims(tenantId)), 200); user != "object-id" {
+		t.Errorf("REMOTE_USER is expected to be 'object-id', got %q", user)
+	}
+	presetRequest(t, authMiddleware, makeRSATokenString(privKey, "azure-key", claims("other-tenant")), 401)
+
+	// multi tenant accepts any tenant with a matching issuer
+	commonMiddleware := NewAzureADMiddleware("common", "app-id")
+	commonMiddleware.KeySet.URL = server.URL
+
+	presetRequest(t, commonMiddleware, makeRSATokenString(privKey, "azure-key", claims("other-tenant")), 200)
+
+	spoofedIssuer := claims("other-tenant")
+	spoofedIssuer["iss"] = "https://login.microsoftonline.com/" + tenantId + "/v2.0"
+	presetRequest(t, commonMiddleware, makeRSATokenString(privKey, "azure-key", spoofedIssuer), 401)
+
+	// personal accounts only
+	consumersMiddleware := NewAzureADMiddleware("consumers", "app-id")
+	consumersMiddleware.KeySet.URL = server.URL
+	presetRequest(t, consumersMiddleware, makeRSATokenString(privKey, "azure-key", claims(azureADConsumersTenant)), 200)
+	presetRequest(t, consumersMiddleware, makeRSATokenString(privKey, "azure-key", claims(tenantId)), 401)
+
+	// work and school accounts only
+	organizationsMiddleware := NewAzureADMiddleware("organizations", "app-id")
+	organizationsMiddleware.KeySet.URL = server.URL
+	presetRequest(t, organizationsMiddleware, makeRSATokenString(privKey, "azure-key", claims("other-tenant")), 200)
+	presetRequest(t, organizationsMiddleware, makeRSATokenString(privKey, "azure-key", claims(azureADConsumersTenant)), 401)
+	presetRequest(t, commonMiddleware, makeRSATokenString(privKey, "azure-key", claims(azureADConsumersTenant)), 200)
+
+	scopes := AzureADScopes(map[string]interface{}{"scp": "User.Read Files.Read", "roles": []interface{}{"Admin"}})
+	if len(scopes) != 3 || scopes[0] != "User.Read" || scopes[2] != "Admin" {
+		t.Errorf("Unexpected scopes %v", scopes)
+	}
+}
+
+func TestAdditionalVerifiers(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := keySetServer(privKey, "cognito-key")
+	defer server.Close()
+
+	cognitoMiddleware := NewCognitoMiddleware("eu-west-1", "eu-west-1_pool", "client")
+	cognitoMiddleware.KeySet.URL = server.URL
+
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		AdditionalVerifiers: []*JWTMiddleware{cognitoMiddleware},
+	}
+
+	// locally issued token
+	if user := presetRequest(t, authMiddleware, makeTokenString("admin", key), 200); user != "admin" {
+		t.Errorf("REMOTE_USER is expected to be 'admin', got %q", user)
+	}
+
+	// token of the identity provider, normalized by its IdentityHandler
+	idToken := map[string]interface{}{
+		"iss":              "https://cognito-idp.eu-west-1.amazonaws.com/eu-west-1_pool",
+		"aud":              "client",
+		"token_use":        "id",
+		"cognito:username": "alice",
+		"iat":              time.Now().Unix(),
+		"exp":              time.Now().Add(time.Hour).Unix(),
+	}
+	if user := presetRequest(t, authMiddleware, makeRSATokenString(privKey, "cognito-key", idToken), 200); user != "alice" {
+		t.Errorf("REMOTE_USER is expected to be 'alice', got %q", user)
+	}
+
+	// tokens neither of them accepts
+	presetRequest(t, authMiddleware, makeTokenString("admin", []byte("sekret key")), 401)
+	idToken["aud"] = "other"
+	presetRequest(t, authMiddleware, makeRSATokenString(privKey, "cognito-key", idToken), 401)
+}
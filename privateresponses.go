@@ -0,0 +1,18 @@
+package jwt
+
+import "github.com/ant0ine/go-json-rest/rest"
+
+// markPrivate keeps the response to an authenticated request out of shared caches if
+// PrivateResponses is set. The handler may still set its own Cache-Control.
+func (mw *JWTMiddleware) markPrivate(writer rest.ResponseWriter) {
+	if !mw.PrivateResponses {
+		return
+	}
+	header := writer.Header()
+	if header.Get("Cache-Control") == "" {
+		header.Set("Cache-Control", "private")
+	}
+	for _, name := range mw.VaryHeaders {
+		header.Add("Vary", name)
+	}
+}
@@ -0,0 +1,71 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestPrivateResponses(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Timeout:          time.Hour,
+		Authenticator:    rejectLogin,
+		PrivateResponses: true,
+		TokenHeaders:     []TokenHeader{{Name: "Authorization", Scheme: "Bearer"}, {Name: "X-Access-Token"}},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/profile", func(w rest.ResponseWriter, r *rest.Request) {}),
+		rest.Get("/catalog", func(w rest.ResponseWriter, r *rest.Request) {
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		}),
+	)
+	api.SetApp(router)
+	request := func(path string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	recorded := request("/profile")
+	recorded.CodeIs(200)
+	recorded.HeaderIs("Cache-Control", "private")
+	if vary := recorded.Recorder.Header()["Vary"]; len(vary) != 2 || vary[0] != "Authorization" || vary[1] != "X-Access-Token" {
+		t.Errorf("Responses should vary on the token headers, got %v", vary)
+	}
+	request("/catalog").HeaderIs("Cache-Control", "public, max-age=60")
+
+	// error responses aren't marked
+	recorded = test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("GET", "http://localhost/profile", nil))
+	recorded.CodeIs(401)
+	recorded.HeaderIs("Cache-Control", "")
+
+	cookieMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: rejectLogin,
+		TokenExtractor: func(request *rest.Request) (string, error) {
+			cookie, err := request.Cookie("token")
+			if err != nil {
+				return "", err
+			}
+			return cookie.Value, nil
+		},
+		PrivateResponses: true,
+		VaryHeaders:      []string{"Cookie"},
+	}
+	cookieApi := rest.NewApi()
+	cookieApi.Use(cookieMiddleware)
+	cookieApi.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {}))
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Cookie", "token="+makeTokenString("admin", key))
+	recorded = test.RunRequest(t, cookieApi.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.HeaderIs("Vary", "Cookie")
+}
@@ -0,0 +1,93 @@
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// ProblemDetailsEncoder is a ResponseEncoder writing errors as RFC 7807 Problem Details with
+// Content-Type "application/problem+json", e.g.
+// {"type":"about:blank","title":"Not Authorized","status":401,"code":"token_expired"}. The error
+// message becomes the title, other fields of the error like "code" and "detail" are kept as
+// members of the problem. Successful responses are encoded as json.
+var ProblemDetailsEncoder ResponseEncoder = problemDetailsEncoder{}
+
+type problemDetailsEncoder struct{}
+
+func (problemDetailsEncoder) Encode(status int, v interface{}) ([]byte, error) {
+	if status < 400 {
+		return json.Marshal(v)
+	}
+	problem, err := errorFields(status, v)
+	if err != nil {
+		return nil, err
+	}
+	problem["type"] = "about:blank"
+	problem["title"] = problem["Error"]
+	problem["status"] = status
+	delete(problem, "Error")
+	return json.Marshal(problem)
+}
+
+func (problemDetailsEncoder) ContentType(status int) string {
+	if status < 400 {
+		return "application/json; charset=utf-8"
+	}
+	return "application/problem+json"
+}
+
+// JSONAPIEncoder is a ResponseEncoder writing responses as JSON:API documents with Content-Type
+// "application/vnd.api+json". Errors become error objects, e.g.
+// {"errors":[{"status":"401","code":"token_expired","title":"Not Authorized"}]}, with the fields
+// of the error that have no JSON:API counterpart in "meta". Successful responses aren't resources,
+// so they are returned as "meta" of the document, e.g. {"meta":{"token":"TOKEN"}}.
+var JSONAPIEncoder ResponseEncoder = jsonAPIEncoder{}
+
+type jsonAPIEncoder struct{}
+
+func (jsonAPIEncoder) Encode(status int, v interface{}) ([]byte, error) {
+	if status < 400 {
+		return json.Marshal(map[string]interface{}{"meta": v})
+	}
+	fields, err := errorFields(status, v)
+	if err != nil {
+		return nil, err
+	}
+	errorObject := map[string]interface{}{
+		"status": strconv.Itoa(status),
+		"title":  fields["Error"],
+	}
+	delete(fields, "Error")
+	for _, member := range []string{"code", "detail"} {
+		if value, ok := fields[member]; ok {
+			errorObject[member] = value
+			delete(fields, member)
+		}
+	}
+	if len(fields) > 0 {
+		errorObject["meta"] = fields
+	}
+	return json.Marshal(map[string]interface{}{"errors": []interface{}{errorObject}})
+}
+
+func (jsonAPIEncoder) ContentType(status int) string {
+	return "application/vnd.api+json"
+}
+
+// errorFields returns the fields of an error response body, adding the status text as "Error"
+// message if it has none.
+func errorFields(status int, v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if _, ok := fields["Error"]; !ok {
+		fields["Error"] = http.StatusText(status)
+	}
+	return fields, nil
+}
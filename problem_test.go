@@ -0,0 +1,75 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestErrorFormats(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Timeout:          time.Hour,
+		MaxLoginAttempts: 3,
+		Authenticator: func(userId string, password string) bool {
+			return userId == "admin" && password == "admin"
+		},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	login := func(password string) *test.Recorded {
+		loginCreds := map[string]string{"username": "admin", "password": password}
+		return test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	request := func() *test.Recorded {
+		return test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("GET", "http://localhost/", nil))
+	}
+
+	authMiddleware.ResponseEncoder = ProblemDetailsEncoder
+
+	recorded := request()
+	recorded.CodeIs(401)
+	recorded.HeaderIs("Content-Type", "application/problem+json")
+	recorded.BodyIs(`{"code":"token_missing","detail":"Auth header empty","status":401,"title":"Not Authorized","type":"about:blank"}`)
+
+	recorded = login("wrong")
+	recorded.CodeIs(401)
+	recorded.HeaderIs("Content-Type", "application/problem+json")
+	recorded.BodyIs(`{"attempts_remaining":2,"code":"not_authorized","status":401,"title":"Not Authorized","type":"about:blank"}`)
+
+	recorded = login("admin")
+	recorded.CodeIs(200)
+	recorded.ContentTypeIsJson()
+
+	authMiddleware.ResponseEncoder = JSONAPIEncoder
+
+	recorded = request()
+	recorded.CodeIs(401)
+	recorded.HeaderIs("Content-Type", "application/vnd.api+json")
+	recorded.BodyIs(`{"errors":[{"code":"token_missing","detail":"Auth header empty","status":"401","title":"Not Authorized"}]}`)
+
+	recorded = login("wrong")
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"errors":[{"code":"not_authorized","meta":{"attempts_remaining":2},"status":"401","title":"Not Authorized"}]}`)
+
+	recorded = login("admin")
+	recorded.CodeIs(200)
+	recorded.HeaderIs("Content-Type", "application/vnd.api+json")
+	document := struct {
+		Meta DecoderToken `json:"meta"`
+	}{}
+	test.DecodeJsonPayload(recorded.Recorder, &document)
+	if document.Meta.Token == "" {
+		t.Error("Token should be returned as meta")
+	}
+}
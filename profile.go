@@ -0,0 +1,73 @@
+package jwt
+
+import (
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// "typ" header of RFC 9068 access tokens
+const accessTokenType = "at+jwt"
+
+// setAccessTokenProfileClaims sets the claims required by RFC 9068 on a token issued to userId.
+func (mw *JWTMiddleware) setAccessTokenProfileClaims(token *jwt.Token, userId string) error {
+	jti, err := newTokenId(mw.RandReader)
+	if err != nil {
+		return err
+	}
+
+	token.Claims["iss"] = mw.Issuer
+	token.Claims["aud"] = mw.Audience
+	token.Claims["sub"] = userId
+	if _, ok := token.Claims["client_id"]; !ok {
+		token.Claims["client_id"] = mw.ClientId
+	}
+	token.Claims["iat"] = mw.Clock.Now().Unix()
+	token.Claims["jti"] = jti
+
+	// the scope claim is a space separated string, not an array
+	switch scope := token.Claims["scope"].(type) {
+	case []string:
+		token.Claims["scope"] = strings.Join(scope, " ")
+	case []interface{}:
+		token.Claims["scope"] = strings.Join(stringList(scope), " ")
+	}
+	return nil
+}
+
+// isAccessTokenProfile reports whether a verified token follows RFC 9068.
+func isAccessTokenProfile(token *jwt.Token) bool {
+	if typ, _ := token.Header["typ"].(string); !strings.EqualFold(typ, accessTokenType) && !strings.EqualFold(typ, "application/"+accessTokenType) {
+		return false
+	}
+	for _, claim := range []string{"iss", "sub", "client_id", "jti"} {
+		if value, ok := token.Claims[claim].(string); !ok || value == "" {
+			return false
+		}
+	}
+	for _, claim := range []string{"exp", "iat"} {
+		if _, ok := GetTime(token.Claims, claim); !ok {
+			return false
+		}
+	}
+	if _, ok := token.Claims["aud"]; !ok {
+		return false
+	}
+	if scope, ok := token.Claims["scope"]; ok {
+		if _, ok := scope.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// newTokenId returns a random token id suitable for the "jti" claim.
+func newTokenId(randReader io.Reader) (string, error) {
+	id := make([]byte, 16)
+	if _, err := io.ReadFull(randReader, id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,170 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestAccessTokenProfile(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:              "test zone",
+		Key:                key,
+		MaxRefresh:         time.Hour,
+		Issuer:             "https://auth.example.com",
+		Audience:           "https://api.example.com",
+		ClientId:           "web",
+		AccessTokenProfile: true,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		PayloadFunc: func(userId string) map[string]interface{} {
+			return map[string]interface{}{"scope": []string{"read", "write"}}
+		},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+
+	loginCreds := map[string]string{"username": "admin", "password": "admin"}
+	recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	recorded.CodeIs(200)
+
+	nToken := DecoderToken{}
+	test.DecodeJsonPayload(recorded.Recorder, &nToken)
+	token, err := jwt.Parse(nToken.Token, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	if err != nil {
+		t.Fatalf("Received token with wrong signature: %v", err)
+	}
+
+	if token.Header["typ"] != "at+jwt" ||
+		token.Claims["iss"] != "https://auth.example.com" ||
+		token.Claims["aud"] != "https://api.example.com" ||
+		token.Claims["sub"] != "admin" ||
+		token.Claims["client_id"] != "web" ||
+		token.Claims["scope"] != "read write" ||
+		token.Claims["jti"] == nil || token.Claims["iat"] == nil {
+		t.Errorf("Received token not following RFC 9068: %v %v", token.Header, token.Claims)
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/", func(w rest.ResponseWriter, r *rest.Request) {
+			w.WriteJson(map[string]string{"Id": "123"})
+		}),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+	)
+	api.SetApp(router)
+
+	// profile token is accepted
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+nToken.Token)
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+
+	// refreshed token gets a new jti
+	req = test.MakeSimpleRequest("GET", "http://localhost/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+nToken.Token)
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+
+	rToken := DecoderToken{}
+	test.DecodeJsonPayload(recorded.Recorder, &rToken)
+	refreshedToken, _ := jwt.Parse(rToken.Token, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	if refreshedToken.Claims["jti"] == token.Claims["jti"] || refreshedToken.Header["typ"] != "at+jwt" {
+		t.Errorf("Refreshed token should be a new RFC 9068 token")
+	}
+
+	// plain token is rejected
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(401)
+}
+
+type frozenClock struct {
+	now time.Time
+}
+
+func (c frozenClock) Now() time.Time {
+	return c.now
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestClockAndRandReader(t *testing.T) {
+	frozen := time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)
+
+	authMiddleware := &JWTMiddleware{
+		Realm:              "test zone",
+		Key:                key,
+		Timeout:            time.Hour,
+		Issuer:             "https://auth.example.com",
+		Audience:           "https://api.example.com",
+		ClientId:           "web",
+		AccessTokenProfile: true,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		Clock:      frozenClock{frozen},
+		RandReader: zeroReader{},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+
+	login := func() string {
+		loginCreds := map[string]string{"username": "admin", "password": "admin"}
+		recorded := test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+		recorded.CodeIs(200)
+
+		nToken := DecoderToken{}
+		test.DecodeJsonPayload(recorded.Recorder, &nToken)
+		return nToken.Token
+	}
+
+	// tokens are deterministic
+	tokenString := login()
+	if login() != tokenString {
+		t.Errorf("Tokens issued with frozen clock and rand should be identical")
+	}
+
+	token, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	if int64(token.Claims["exp"].(float64)) != frozen.Add(time.Hour).Unix() ||
+		int64(token.Claims["iat"].(float64)) != frozen.Unix() ||
+		token.Claims["jti"] != "00000000000000000000000000000000" {
+		t.Errorf("Received token with unexpected claims %v", token.Claims)
+	}
+
+	// the token expired long ago according to the system clock but not according to the middleware
+	api := rest.NewApi()
+	api.SetApp(rest.AppSimple(authMiddleware.VerifyHandler))
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(204)
+	recorded.HeaderIs("X-Token-Expires-In", "3600")
+
+	// and a valid token according to the system clock isn't valid yet for the middleware
+	authMiddleware.Clock = frozenClock{frozen.Add(2 * time.Hour)}
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(401)
+}
@@ -0,0 +1,52 @@
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// propagateClaims copies the claims selected by ClaimsToEnv and ClaimsToHeaders into the Env and
+// the headers of the request.
+func (mw *JWTMiddleware) propagateClaims(claims map[string]interface{}, env map[string]interface{}, header http.Header) {
+	for claim, name := range mw.ClaimsToEnv {
+		if value, ok := claims[claim]; ok {
+			env[name] = copyClaimValue(value)
+		}
+	}
+	for claim, name := range mw.ClaimsToHeaders {
+		if value, ok := claims[claim]; ok {
+			header.Set(name, claimHeaderValue(value))
+		}
+	}
+}
+
+// stripClaimHeaders removes the headers set by ClaimsToHeaders from a request, so that clients
+// can't pass them on to downstream services themselves.
+func (mw *JWTMiddleware) stripClaimHeaders(header http.Header) {
+	for _, name := range mw.ClaimsToHeaders {
+		header.Del(name)
+	}
+}
+
+// claimHeaderValue formats a claim as header value. Lists are joined by commas, objects are
+// encoded as json.
+func claimHeaderValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case []interface{}:
+		values := make([]string, len(value))
+		for i, item := range value {
+			values[i] = claimHeaderValue(item)
+		}
+		return strings.Join(values, ",")
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
@@ -0,0 +1,67 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestClaimsPropagation(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		ClaimsToEnv:     map[string]string{"tenant": "TENANT_ID"},
+		ClaimsToHeaders: map[string]string{"tenant": "X-Tenant-Id", "groups": "X-Groups", "level": "X-Level"},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]interface{}{
+			"env":    r.Env["TENANT_ID"],
+			"tenant": r.Header.Get("X-Tenant-Id"),
+			"groups": r.Header.Get("X-Groups"),
+			"level":  r.Header.Get("X-Level"),
+		})
+	}))
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "admin"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	token.Claims["tenant"] = "acme"
+	token.Claims["groups"] = []string{"admins", "users"}
+	token.Claims["level"] = 3
+	tokenString, _ := token.SignedString(key)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	req.Header.Set("X-Tenant-Id", "evil")
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"env":"acme","groups":"admins,users","level":"3","tenant":"acme"}`)
+
+	// headers sent by clients are dropped for tokens without the claims
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	req.Header.Set("X-Tenant-Id", "evil")
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"env":null,"groups":"","level":"","tenant":""}`)
+
+	// auth request responses carry the headers for the proxy
+	authApi := rest.NewApi()
+	authApi.SetApp(rest.AppSimple(authMiddleware.AuthRequestHandler))
+	req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	recorded = test.RunRequest(t, authApi.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.HeaderIs("X-Tenant-Id", "acme")
+	recorded.HeaderIs("X-Groups", "admins,users")
+}
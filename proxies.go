@@ -0,0 +1,116 @@
+package jwt
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// headers of reverse proxies describing the original request, which clients can spoof
+var forwardedHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Port",
+	"X-Forwarded-Prefix",
+	"X-Forwarded-Proto",
+	"X-Real-Ip",
+}
+
+// parseTrustedProxies parses IPs and CIDR ranges.
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted proxy %q", proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (mw *JWTMiddleware) trustedProxy(ip net.IP) bool {
+	for _, network := range mw.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeProxyHeaders removes the identity-bearing and forwarding headers of the request that
+// weren't set by TrustedProxies, and records the client IP in request.Env["JWT_CLIENT_IP"].
+//
+// The client IP is found by walking X-Forwarded-For from the connecting peer towards the client,
+// as long as the hops are trusted proxies. Entries before the first untrusted hop may have been
+// sent by the client, so they are removed. If the peer isn't a trusted proxy, all forwarding
+// headers are removed.
+func (mw *JWTMiddleware) sanitizeProxyHeaders(request *rest.Request) {
+	if !mw.SanitizeProxyHeaders {
+		return
+	}
+	request.Header.Del(mw.IdentityHeader)
+
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	clientIP := host
+	if peer := net.ParseIP(host); peer == nil || !mw.trustedProxy(peer) {
+		for _, name := range forwardedHeaders {
+			request.Header.Del(name)
+		}
+	} else {
+		hops := forwardedFor(request.Header)
+		trusted := len(hops)
+		for trusted > 0 {
+			hop := net.ParseIP(hops[trusted-1])
+			if hop == nil {
+				break
+			}
+			clientIP = hops[trusted-1]
+			trusted--
+			if !mw.trustedProxy(hop) {
+				break
+			}
+		}
+		switch {
+		case trusted == len(hops):
+			request.Header.Del("X-Forwarded-For")
+		case trusted > 0:
+			request.Header.Set("X-Forwarded-For", strings.Join(hops[trusted:], ", "))
+		}
+	}
+	request.Env["JWT_CLIENT_IP"] = clientIP
+}
+
+// forwardedFor returns the hops of the X-Forwarded-For headers, the closest one last.
+func forwardedFor(header http.Header) []string {
+	hops := []string{}
+	for _, value := range header["X-Forwarded-For"] {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// ExtractClientIP returns the IP of the client as determined by the middleware with
+// SanitizeProxyHeaders, or an empty string if it wasn't.
+func ExtractClientIP(request *rest.Request) string {
+	clientIP, _ := request.Env["JWT_CLIENT_IP"].(string)
+	return clientIP
+}
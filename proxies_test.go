@@ -0,0 +1,67 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestSanitizeProxyHeaders(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		SanitizeProxyHeaders: true,
+		TrustedProxies:       []string{"10.0.0.0/8", "192.168.1.1"},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{
+			"ClientIP": ExtractClientIP(r),
+			"For":      r.Header.Get("X-Forwarded-For"),
+			"Proto":    r.Header.Get("X-Forwarded-Proto"),
+			"User":     r.Header.Get("X-Auth-User"),
+		})
+	}))
+	request := func(remoteAddr string, headers map[string]string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		recorded := test.RunRequest(t, api.MakeHandler(), req)
+		recorded.CodeIs(200)
+		return recorded
+	}
+
+	// a client connecting directly can't spoof anything
+	request("203.0.113.7:1234", map[string]string{
+		"X-Forwarded-For":   "10.1.1.1",
+		"X-Forwarded-Proto": "https",
+		"X-Auth-User":       "root",
+	}).BodyIs(`{"ClientIP":"203.0.113.7","For":"","Proto":"","User":""}`)
+
+	// through trusted proxies, entries the client prepended are dropped
+	request("192.168.1.1:1234", map[string]string{
+		"X-Forwarded-For":   "10.9.9.9, 203.0.113.7, 10.0.0.2",
+		"X-Forwarded-Proto": "https",
+		"X-Auth-User":       "root",
+	}).BodyIs(`{"ClientIP":"203.0.113.7","For":"203.0.113.7, 10.0.0.2","Proto":"https","User":""}`)
+
+	// only trusted hops
+	request("10.0.0.1:1234", map[string]string{
+		"X-Forwarded-For": "10.0.0.2",
+	}).BodyIs(`{"ClientIP":"10.0.0.2","For":"10.0.0.2","Proto":"","User":""}`)
+
+	if err := (&JWTMiddleware{Realm: "test zone", Key: key, Authenticator: authMiddleware.Authenticator, TrustedProxies: []string{"10.0.0.0/33"}}).Init(); err == nil {
+		t.Error("Invalid trusted proxies should be rejected")
+	}
+}
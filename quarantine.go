@@ -0,0 +1,99 @@
+package jwt
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// QuarantineStore keeps the quarantined users and tokens. Deployments running several instances
+// should use a shared implementation. Implementations must be safe for concurrent use.
+type QuarantineStore interface {
+	// Quarantined reports whether key is quarantined.
+	Quarantined(key string) bool
+
+	// Quarantine quarantines key for the given duration, or until it is released if it is 0.
+	Quarantine(key string, duration time.Duration)
+
+	// Release lifts the quarantine of key.
+	Release(key string)
+}
+
+type memoryQuarantineStore struct {
+	cache *ttlCache
+}
+
+// NewMemoryQuarantineStore returns a QuarantineStore keeping the quarantined keys in memory.
+func NewMemoryQuarantineStore() QuarantineStore {
+	return &memoryQuarantineStore{cache: newTTLCache()}
+}
+
+func (s *memoryQuarantineStore) memoryCache() *ttlCache {
+	return s.cache
+}
+
+func (s *memoryQuarantineStore) Quarantined(key string) bool {
+	_, ok := s.cache.Get(key)
+	return ok
+}
+
+func (s *memoryQuarantineStore) Quarantine(key string, duration time.Duration) {
+	if duration == 0 {
+		duration = 100 * 365 * 24 * time.Hour
+	}
+	s.cache.Set(key, true, duration)
+}
+
+func (s *memoryQuarantineStore) Release(key string) {
+	s.cache.Delete(key)
+}
+
+// QuarantineUser quarantines all tokens of userId for the given duration, or until
+// ReleaseUser if it is 0. Requests with quarantined tokens still verify, but are subject to the
+// QuarantinePolicy.
+func (mw *JWTMiddleware) QuarantineUser(userId string, duration time.Duration) {
+	mw.initDefaults()
+	mw.QuarantineStore.Quarantine("user:"+userId, duration)
+}
+
+// ReleaseUser lifts the quarantine of userId.
+func (mw *JWTMiddleware) ReleaseUser(userId string) {
+	mw.initDefaults()
+	mw.QuarantineStore.Release("user:" + userId)
+}
+
+// QuarantineToken quarantines a single token for the given duration, or until ReleaseToken if
+// it is 0.
+func (mw *JWTMiddleware) QuarantineToken(tokenString string, duration time.Duration) {
+	mw.initDefaults()
+	mw.QuarantineStore.Quarantine("token:"+tokenId(tokenString), duration)
+}
+
+// ReleaseToken lifts the quarantine of a token.
+func (mw *JWTMiddleware) ReleaseToken(tokenString string) {
+	mw.initDefaults()
+	mw.QuarantineStore.Release("token:" + tokenId(tokenString))
+}
+
+// QuarantineReadOnly is the default QuarantinePolicy, allowing quarantined users only safe
+// requests (GET, HEAD and OPTIONS) and rejecting others with a 403 and the "quarantined" error
+// code.
+func QuarantineReadOnly(writer rest.ResponseWriter, request *rest.Request) bool {
+	if safeMethod(request.Method) {
+		return true
+	}
+	errorWithCode(writer, "Account under review, only read access is allowed", "quarantined", http.StatusForbidden)
+	return false
+}
+
+// quarantineRestricted applies the QuarantinePolicy to requests of quarantined users and tokens,
+// which are marked with request.Env["JWT_QUARANTINED"].
+func (mw *JWTMiddleware) quarantineRestricted(writer rest.ResponseWriter, request *rest.Request) bool {
+	userId, _ := request.Env["REMOTE_USER"].(string)
+	if !mw.QuarantineStore.Quarantined("user:"+userId) && !mw.QuarantineStore.Quarantined("token:"+ExtractTokenId(request)) {
+		return false
+	}
+	request.Env["JWT_QUARANTINED"] = true
+	return !mw.QuarantinePolicy(writer, request)
+}
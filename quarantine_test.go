@@ -0,0 +1,71 @@
+package jwt
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestQuarantine(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		_, quarantined := r.Env["JWT_QUARANTINED"]
+		w.WriteJson(map[string]interface{}{"Id": r.Env["REMOTE_USER"], "Quarantined": quarantined})
+	}))
+	request := func(method string, tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest(method, "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	adminToken := makeTokenString("admin", key)
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "user"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	userToken, _ := token.SignedString(key)
+
+	request("POST", adminToken).BodyIs(`{"Id":"admin","Quarantined":false}`)
+
+	authMiddleware.QuarantineUser("admin", 0)
+	request("GET", adminToken).BodyIs(`{"Id":"admin","Quarantined":true}`)
+	recorded := request("POST", adminToken)
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Account under review, only read access is allowed","code":"quarantined"}`)
+	request("POST", userToken).CodeIs(200)
+
+	authMiddleware.ReleaseUser("admin")
+	request("POST", adminToken).CodeIs(200)
+
+	// single tokens
+	authMiddleware.QuarantineToken(userToken, time.Hour)
+	request("DELETE", userToken).CodeIs(403)
+	request("DELETE", adminToken).CodeIs(200)
+	authMiddleware.ReleaseToken(userToken)
+	request("DELETE", userToken).CodeIs(200)
+
+	// custom policy
+	authMiddleware.QuarantinePolicy = func(writer rest.ResponseWriter, request *rest.Request) bool {
+		writer.Header().Set("Location", "/verify")
+		writer.WriteHeader(http.StatusSeeOther)
+		return false
+	}
+	authMiddleware.QuarantineUser("admin", time.Hour)
+	recorded = request("GET", adminToken)
+	recorded.CodeIs(303)
+	recorded.HeaderIs("Location", "/verify")
+}
@@ -0,0 +1,141 @@
+package jwt
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// QuotaStore counts the tokens issued per user and client for IssuanceQuota, and the refreshes for
+// RefreshRateLimit and RefreshUserRateLimit. Deployments running
+// several instances should use a shared implementation, e.g. backed by Redis INCR and EXPIRE.
+// Implementations must be safe for concurrent use.
+type QuotaStore interface {
+	// Increment increments the counter stored under key and returns its new value. A new counter
+	// expires after ttl.
+	Increment(key string, ttl time.Duration) int
+}
+
+type memoryQuotaStore struct {
+	mutex sync.Mutex
+	cache *ttlCache
+}
+
+// NewMemoryQuotaStore returns a QuotaStore keeping the counters in memory.
+func NewMemoryQuotaStore() QuotaStore {
+	return &memoryQuotaStore{cache: newTTLCache()}
+}
+
+func (s *memoryQuotaStore) memoryCache() *ttlCache {
+	return s.cache
+}
+
+func (s *memoryQuotaStore) Increment(key string, ttl time.Duration) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 1
+	if value, ok := s.cache.Get(key); ok {
+		count = value.(int) + 1
+	}
+	s.cache.Set(key, count, ttl)
+	return count
+}
+
+// quotaExceeded counts a token about to be issued against the IssuanceQuota of each of the given
+// quota keys, e.g. "user:admin", and rejects it with a 429 if one of the quotas is exceeded.
+// Windows are fixed, starting at multiples of IssuanceQuotaWindow.
+func (mw *JWTMiddleware) quotaExceeded(writer rest.ResponseWriter, keys ...string) bool {
+	if mw.IssuanceQuota == 0 {
+		return false
+	}
+
+	limits := make([]int, len(keys))
+	for i := range limits {
+		limits[i] = mw.IssuanceQuota
+	}
+	retryAfter, exceeded := mw.countInWindow(keys, limits, mw.IssuanceQuotaWindow)
+	if !exceeded {
+		return false
+	}
+
+	mw.Metrics.IncCounter("issuance_quota_exceeded")
+	writer.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	errorWithCode(writer, "Token issuance quota exceeded", "quota_exceeded", http.StatusTooManyRequests)
+	return true
+}
+
+// refreshRateLimited counts a refresh of token against RefreshRateLimit and RefreshUserRateLimit,
+// and rejects it with a 429 if one of them is exceeded. The Retry-After is jittered by up to one
+// window, so that the clients rejected together don't all come back at the start of the next one.
+func (mw *JWTMiddleware) refreshRateLimited(writer rest.ResponseWriter, token *jwt.Token) bool {
+	keys := []string{}
+	limits := []int{}
+	userId, err := mw.IdentityHandler(token.Claims)
+	if err != nil {
+		// rejected by the RefreshHandler anyway
+		return false
+	}
+	if mw.RefreshRateLimit != 0 {
+		keys = append(keys, "refresh_family:"+tokenFamily(userId, token.Claims))
+		limits = append(limits, mw.RefreshRateLimit)
+	}
+	if mw.RefreshUserRateLimit != 0 {
+		keys = append(keys, "refresh_user:"+userId)
+		limits = append(limits, mw.RefreshUserRateLimit)
+	}
+	if len(keys) == 0 {
+		return false
+	}
+
+	retryAfter, exceeded := mw.countInWindow(keys, limits, mw.RefreshRateWindow)
+	if !exceeded {
+		return false
+	}
+
+	mw.Metrics.IncCounter("refreshes_rate_limited")
+	retryAfter += rand.Int63n(int64(mw.RefreshRateWindow/time.Second) + 1)
+	writer.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	errorWithCode(writer, "Too many refreshes", "refresh_rate_limited", http.StatusTooManyRequests)
+	return true
+}
+
+// tokenFamily identifies the tokens refreshed from the same login, by their "sid" claim or else
+// by the user and the "orig_iat" claim.
+func tokenFamily(userId string, claims map[string]interface{}) string {
+	if sid, ok := claims["sid"].(string); ok {
+		return sid
+	}
+	origIat, _ := numericValue(claims["orig_iat"])
+	return userId + ":" + strconv.FormatFloat(origIat, 'f', -1, 64)
+}
+
+// countInWindow counts an event against the limit of each of the given keys in the current fixed
+// window, starting at a multiple of window. If a limit is exceeded, it returns true along with the
+// seconds until the end of the window.
+func (mw *JWTMiddleware) countInWindow(keys []string, limits []int, window time.Duration) (int64, bool) {
+	now := mw.Clock.Now()
+	index := now.UnixNano() / int64(window)
+	windowEnd := time.Unix(0, (index+1)*int64(window))
+	exceeded := false
+	for i, key := range keys {
+		// count all keys, so that one exceeded limit doesn't spare the others
+		if mw.QuotaStore.Increment(key+":"+strconv.FormatInt(index, 10), window) > limits[i] {
+			exceeded = true
+		}
+	}
+	if !exceeded {
+		return 0, false
+	}
+
+	retryAfter := int64(windowEnd.Sub(now).Seconds() + 0.5)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	return retryAfter, true
+}
@@ -0,0 +1,155 @@
+package jwt
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestIssuanceQuota(t *testing.T) {
+	clock := &frozenClock{now: time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)}
+	metrics := newCountingMetrics()
+
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		IssuanceQuota: 2,
+		Clock:         clock,
+		Metrics:       metrics,
+		Authenticator: func(userId string, password string) bool {
+			return password == "admin"
+		},
+	}
+
+	api := rest.NewApi()
+	api.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+
+	login := func(userId, password string) *test.Recorded {
+		loginCreds := map[string]string{"username": userId, "password": password}
+		return test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	}
+
+	// failed logins don't count
+	login("admin", "wrong").CodeIs(401)
+	login("admin", "admin").CodeIs(200)
+	login("admin", "admin").CodeIs(200)
+
+	recorded := login("admin", "admin")
+	recorded.CodeIs(429)
+	recorded.HeaderIs("Retry-After", "1860")
+	recorded.BodyIs(`{"Error":"Token issuance quota exceeded","code":"quota_exceeded"}`)
+	if count := metrics.counter("issuance_quota_exceeded"); count != 1 {
+		t.Errorf("issuance_quota_exceeded should be 1, got %d", count)
+	}
+
+	// quotas are per user
+	login("user", "admin").CodeIs(200)
+
+	// the next window starts at the full hour
+	clock.now = clock.now.Add(31 * time.Minute)
+	login("admin", "admin").CodeIs(200)
+}
+
+func TestClientIssuanceQuota(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		IssuanceQuota: 1,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		Clients: NewClientRegistry(&Client{Id: "spa", GrantTypes: []string{GrantPassword}}),
+	}
+
+	api := rest.NewApi()
+	api.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+
+	login := func(userId string) *test.Recorded {
+		loginCreds := map[string]string{"username": userId, "password": "admin", "client_id": "spa"}
+		return test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	}
+
+	login("admin").CodeIs(200)
+	// the quota of the client is exhausted for all users
+	login("user").CodeIs(429)
+}
+
+func TestRefreshRateLimit(t *testing.T) {
+	clock := &frozenClock{now: time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)}
+	metrics := newCountingMetrics()
+
+	authMiddleware := &JWTMiddleware{
+		Realm:                "test zone",
+		Key:                  key,
+		Timeout:              time.Hour,
+		MaxRefresh:           time.Hour * 24,
+		RefreshRateLimit:     2,
+		RefreshUserRateLimit: 3,
+		Clock:                clock,
+		Metrics:              metrics,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/login"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	login := func(userId string) string {
+		loginCreds := map[string]string{"username": userId, "password": "secret"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/login", loginCreds))
+		recorded.CodeIs(200)
+		token := DecoderToken{}
+		recorded.DecodeJsonPayload(&token)
+		// tokens of later logins belong to another family
+		clock.now = clock.now.Add(time.Second)
+		return token.Token
+	}
+	refresh := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/refresh", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	laptop := login("admin")
+	phone := login("admin")
+
+	refresh(laptop).CodeIs(200)
+	refresh(laptop).CodeIs(200)
+	recorded := refresh(laptop)
+	recorded.CodeIs(429)
+	recorded.BodyIs(`{"Error":"Too many refreshes","code":"refresh_rate_limited"}`)
+	// the window ends in 58 seconds, jittered by up to one window
+	retryAfter, _ := strconv.Atoi(recorded.Recorder.Header().Get("Retry-After"))
+	if retryAfter < 58 || retryAfter > 118 {
+		t.Errorf("Retry-After should be between 58 and 118, got %d", retryAfter)
+	}
+	if count := metrics.counter("refreshes_rate_limited"); count != 1 {
+		t.Errorf("refreshes_rate_limited should be 1, got %d", count)
+	}
+
+	// the other family is only limited by the refreshes of the user, rejected ones included
+	refresh(phone).CodeIs(429)
+
+	// other users aren't limited
+	refresh(login("user")).CodeIs(200)
+
+	clock.now = clock.now.Add(time.Minute)
+	refresh(phone).CodeIs(200)
+}
@@ -0,0 +1,296 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrRevokedToken is returned for tokens on the RevocationList.
+var ErrRevokedToken = errors.New("Token revoked")
+
+// ErrRevocationListUnavailable is returned while the RevocationList has never been fetched
+// successfully and isn't FailOpen.
+var ErrRevocationListUnavailable = errors.New("Revocation list unavailable")
+
+// RevocationList is a list of revoked tokens that every instance of a deployment pulls from URL,
+// for deployments without shared fast storage. The list is held in memory, behind a bloom filter
+// so that the vast majority of tokens, which aren't revoked, are checked without a map lookup.
+//
+// The list is published as a manifest, a JWT signed with Key whose "revoked" claim is an array of
+// the revoked tokens, each given by its "jti" claim or the hex encoded SHA-256 hash of the token.
+// Manifests need an "exp" claim, so that an old manifest can't be replayed to instances that
+// haven't fetched the list yet, and manifests with an "iat" claim older than the current one are
+// ignored, so that it can't be replayed to unrevoke tokens either.
+//
+// The list is fetched again in the background once RefreshInterval has passed, requests don't
+// wait for it. Until it has been fetched, requests wait for a single fetch in flight, which goes
+// through Breaker so that an unreachable URL fails fast.
+type RevocationList struct {
+	// URL of the manifest. Required.
+	URL string
+
+	// Key verifying the signature of the manifest. Required.
+	Key interface{}
+
+	// Signing algorithm of the manifest. Optional, defaults to "RS256".
+	SigningAlgorithm string
+
+	// Duration after which the manifest is fetched again. Optional, defaults to one minute.
+	RefreshInterval time.Duration
+
+	// HTTP client used to fetch the manifest. Optional, defaults to a client with a timeout of
+	// 10 seconds.
+	Client *http.Client
+
+	// Circuit breaker for fetching the manifest. Optional, defaults to a CircuitBreaker with the
+	// default settings.
+	Breaker *CircuitBreaker
+
+	// Policy while the manifest has never been fetched. If set, no tokens are considered revoked
+	// (fail-open), otherwise all tokens are rejected (fail-closed).
+	// Optional, defaults to false.
+	FailOpen bool
+
+	mutex       sync.Mutex
+	filter      *bloomFilter
+	revoked     map[string]bool
+	issuedAt    float64
+	attemptedAt time.Time
+	inFlight    *pendingFetch
+}
+
+// maxManifestSize is the size above which manifests are rejected.
+const maxManifestSize = 32 << 20
+
+// NewRevocationList returns a RevocationList fetching its manifest from url, verified with key.
+func NewRevocationList(url string, key interface{}) *RevocationList {
+	return &RevocationList{URL: url, Key: key}
+}
+
+// Revoked reports whether the token is on the list.
+func (rl *RevocationList) Revoked(token *jwt.Token) (bool, error) {
+	rl.mutex.Lock()
+	if rl.Breaker == nil {
+		rl.Breaker = &CircuitBreaker{}
+	}
+	known := rl.revoked != nil
+	if known && time.Since(rl.attemptedAt) > rl.refreshInterval() && rl.inFlight == nil {
+		go rl.fetchShared()
+	}
+	filter, revoked := rl.filter, rl.revoked
+	rl.mutex.Unlock()
+
+	if !known {
+		// block the first requests until the list is known
+		if err := rl.fetchShared(); err != nil {
+			if rl.FailOpen {
+				return false, nil
+			}
+			return false, ErrRevocationListUnavailable
+		}
+		rl.mutex.Lock()
+		filter, revoked = rl.filter, rl.revoked
+		rl.mutex.Unlock()
+	}
+
+	keys := []string{activityStoreKey(token.Raw)}
+	if jti, ok := token.Claims["jti"].(string); ok {
+		keys = append(keys, jti)
+	}
+	for _, key := range keys {
+		if filter.mayContain(key) && revoked[key] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (rl *RevocationList) refreshInterval() time.Duration {
+	if rl.RefreshInterval == 0 {
+		return time.Minute
+	}
+	return rl.RefreshInterval
+}
+
+// fetchShared fetches the manifest and updates the list, or waits for the fetch in flight. It must
+// be called without holding the mutex.
+func (rl *RevocationList) fetchShared() error {
+	rl.mutex.Lock()
+	fetch := rl.inFlight
+	if fetch != nil {
+		rl.mutex.Unlock()
+		<-fetch.done
+		return fetch.err
+	}
+	fetch = &pendingFetch{done: make(chan struct{})}
+	rl.inFlight = fetch
+	rl.attemptedAt = time.Now()
+	rl.mutex.Unlock()
+
+	var revoked []string
+	var issuedAt float64
+	err := rl.Breaker.Call(func() error {
+		var err error
+		revoked, issuedAt, err = rl.fetch()
+		return err
+	})
+
+	rl.mutex.Lock()
+	if err == nil {
+		rl.update(revoked, issuedAt)
+	}
+	fetch.err = err
+	rl.inFlight = nil
+	rl.mutex.Unlock()
+	close(fetch.done)
+	return err
+}
+
+// update replaces the list, unless the manifest was issued before the current one.
+func (rl *RevocationList) update(revokedList []string, issuedAt float64) {
+	if rl.revoked != nil && issuedAt < rl.issuedAt {
+		return
+	}
+
+	filter := newBloomFilter(len(revokedList))
+	revoked := make(map[string]bool, len(revokedList))
+	for _, key := range revokedList {
+		filter.add(key)
+		revoked[key] = true
+	}
+	rl.filter, rl.revoked, rl.issuedAt = filter, revoked, issuedAt
+}
+
+// fetch downloads and verifies the manifest, and returns its revoked tokens and issue time.
+func (rl *RevocationList) fetch() ([]string, float64, error) {
+	client := rl.Client
+	if client == nil {
+		client = defaultFetchClient
+	}
+
+	response, err := client.Get(rl.URL)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("Fetching revocation list failed with status %d", response.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(body) > maxManifestSize {
+		return nil, 0, errors.New("Revocation list too large")
+	}
+
+	algorithm := rl.SigningAlgorithm
+	if algorithm == "" {
+		algorithm = "RS256"
+	}
+	manifest, err := jwt.Parse(strings.TrimSpace(string(body)), func(token *jwt.Token) (interface{}, error) {
+		if jwt.GetSigningMethod(algorithm) != token.Method {
+			return nil, errors.New("Invalid signing algorithm")
+		}
+		return rl.Key, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, ok := manifest.Claims["exp"]; !ok {
+		return nil, 0, ErrMissingExpiration
+	}
+	revoked, ok := manifest.Claims["revoked"].([]interface{})
+	if !ok {
+		return nil, 0, errors.New("Invalid revoked claim")
+	}
+	issuedAt, _ := numericValue(manifest.Claims["iat"])
+	return stringList(revoked), issuedAt, nil
+}
+
+// checkTokenRevocation rejects a token accepted by verifier, i.e. this middleware or one of its
+// AdditionalVerifiers, if either of them revoked it, so that RevokeToken, the RevocationList and
+// the logouts of this middleware, e.g. back-channel logouts of an upstream provider, also apply to
+// the tokens of its verifiers.
+func (mw *JWTMiddleware) checkTokenRevocation(token *jwt.Token, verifier *JWTMiddleware) error {
+	if err := mw.checkRevocation(token); err != nil || verifier == nil || verifier == mw {
+		return err
+	}
+	return verifier.checkRevocation(token)
+}
+
+// checkRevocation rejects tokens on the RevocationList, revoked with RevokeToken or logged out by
+// LogoutHandler or a logout ticket.
+func (mw *JWTMiddleware) checkRevocation(token *jwt.Token) error {
+	if mw.RevocationList != nil {
+		revoked, err := mw.RevocationList.Revoked(token)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrRevokedToken
+		}
+	}
+	if mw.RevocationStore != nil && mw.revokedInStore(token) {
+		return ErrRevokedToken
+	}
+	if mw.loggedOutToken(token) {
+		return ErrRevokedToken
+	}
+	return nil
+}
+
+// bloomFilter is a bloom filter of strings with about 1% false positives.
+type bloomFilter struct {
+	bits []uint64
+}
+
+const bloomFilterHashes = 7
+
+func newBloomFilter(n int) *bloomFilter {
+	// 10 bits per element
+	words := (n*10 + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	return &bloomFilter{bits: make([]uint64, words)}
+}
+
+// positions returns the bits of key, derived from two halves of a 64 bit hash.
+func (f *bloomFilter) positions(key string) [bloomFilterHashes]uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	sum := hash.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32
+	size := uint64(len(f.bits) * 64)
+	positions := [bloomFilterHashes]uint64{}
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % size
+	}
+	return positions
+}
+
+func (f *bloomFilter) add(key string) {
+	for _, position := range f.positions(key) {
+		f.bits[position/64] |= 1 << (position % 64)
+	}
+}
+
+func (f *bloomFilter) mayContain(key string) bool {
+	for _, position := range f.positions(key) {
+		if f.bits[position/64]&(1<<(position%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,223 @@
+package jwt
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// revocationServer serves a manifest signed with key.
+type revocationServer struct {
+	mutex    sync.Mutex
+	revoked  []string
+	issuedAt int64
+	fetches  int
+	status   int
+	delay    time.Duration
+	noExp    bool
+}
+
+func (s *revocationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.fetches++
+	time.Sleep(s.delay)
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	manifest := jwt.New(jwt.GetSigningMethod("HS256"))
+	manifest.Claims["revoked"] = s.revoked
+	manifest.Claims["iat"] = s.issuedAt
+	if !s.noExp {
+		manifest.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	}
+	manifestString, _ := manifest.SignedString(key)
+	fmt.Fprint(w, manifestString)
+}
+
+func (s *revocationServer) publish(issuedAt int64, revoked ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.revoked, s.issuedAt = append([]string{}, revoked...), issuedAt
+}
+
+func TestRevocationList(t *testing.T) {
+	manifests := &revocationServer{revoked: []string{}}
+	server := httptest.NewServer(manifests)
+	defer server.Close()
+
+	revocationList := NewRevocationList(server.URL, key)
+	revocationList.SigningAlgorithm = "HS256"
+	revocationList.RefreshInterval = time.Millisecond
+
+	authMiddleware := &JWTMiddleware{
+		Realm:          "test zone",
+		Key:            key,
+		Timeout:        time.Hour,
+		RevocationList: revocationList,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	request := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+	// waitFor retries request until the background refresh picked up the manifest
+	waitFor := func(tokenString string, code int) {
+		for i := 0; i < 100; i++ {
+			if request(tokenString).Recorder.Code == code {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Errorf("Request should get %d", code)
+	}
+
+	hashed := makeTokenString("admin", key)
+	withId := jwt.New(jwt.GetSigningMethod("HS256"))
+	withId.Claims["id"] = "user"
+	withId.Claims["jti"] = "token-1"
+	withId.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	withId.Claims["iat"] = time.Now().Unix()
+	withIdString, _ := withId.SignedString(key)
+
+	request(hashed).CodeIs(200)
+	request(withIdString).CodeIs(200)
+
+	manifests.publish(2, "token-1", activityStoreKey(hashed))
+	waitFor(hashed, 401)
+	request(hashed).BodyIs(`{"Error":"Not Authorized","code":"not_authorized","detail":"Token revoked"}`)
+	request(withIdString).CodeIs(401)
+
+	// older manifests are ignored
+	manifests.publish(1)
+	time.Sleep(20 * time.Millisecond)
+	request(hashed).CodeIs(401)
+
+	manifests.publish(3)
+	waitFor(hashed, 200)
+	request(withIdString).CodeIs(200)
+
+	// the list is kept while the manifest can't be fetched
+	manifests.publish(4, "token-1")
+	waitFor(withIdString, 401)
+	manifests.mutex.Lock()
+	manifests.status = http.StatusInternalServerError
+	manifests.mutex.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	request(withIdString).CodeIs(401)
+}
+
+func TestRevocationListUnavailable(t *testing.T) {
+	manifests := &revocationServer{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(manifests)
+	defer server.Close()
+
+	tokenString := makeTokenString("admin", key)
+	token, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+
+	revocationList := NewRevocationList(server.URL, key)
+	if _, err := revocationList.Revoked(token); err != ErrRevocationListUnavailable {
+		t.Errorf("Unavailable revocation list should fail closed, got %v", err)
+	}
+
+	revocationList.FailOpen = true
+	if revoked, err := revocationList.Revoked(token); revoked || err != nil {
+		t.Errorf("Unavailable revocation list should fail open, got %v %v", revoked, err)
+	}
+
+	// manifests need a valid signature
+	manifests.status = 0
+	manifests.revoked = []string{}
+	revocationList = NewRevocationList(server.URL, []byte("other key"))
+	revocationList.SigningAlgorithm = "HS256"
+	if _, err := revocationList.Revoked(token); err != ErrRevocationListUnavailable {
+		t.Errorf("Manifest with invalid signature should be rejected, got %v", err)
+	}
+
+	// and an expiration
+	manifests.noExp = true
+	revocationList = NewRevocationList(server.URL, key)
+	revocationList.SigningAlgorithm = "HS256"
+	if _, err := revocationList.Revoked(token); err != ErrRevocationListUnavailable {
+		t.Errorf("Manifest without expiration should be rejected, got %v", err)
+	}
+}
+
+func TestRevocationListFetchInFlight(t *testing.T) {
+	manifests := &revocationServer{status: http.StatusServiceUnavailable, delay: 50 * time.Millisecond}
+	server := httptest.NewServer(manifests)
+	defer server.Close()
+
+	tokenString := makeTokenString("admin", key)
+	token, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	revocationList := NewRevocationList(server.URL, key)
+	revocationList.SigningAlgorithm = "HS256"
+	revocationList.Breaker = &CircuitBreaker{Threshold: 1, Cooldown: time.Hour}
+
+	// the requests waiting for the list share one fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := revocationList.Revoked(token); err != ErrRevocationListUnavailable {
+				t.Errorf("Unavailable revocation list should fail closed, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// and the open circuit fails fast
+	start := time.Now()
+	revocationList.Revoked(token)
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("Open circuit should fail fast, took %v", elapsed)
+	}
+	manifests.mutex.Lock()
+	defer manifests.mutex.Unlock()
+	if manifests.fetches != 1 {
+		t.Errorf("Expected 1 fetch, got %d", manifests.fetches)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter := newBloomFilter(1000)
+	for i := 0; i < 1000; i++ {
+		filter.add("revoked-" + strconv.Itoa(i))
+	}
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if !filter.mayContain("revoked-" + strconv.Itoa(i)) {
+			t.Fatalf("Bloom filter lost revoked-%d", i)
+		}
+		if filter.mayContain("valid-" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Errorf("Bloom filter has %d false positives out of 1000", falsePositives)
+	}
+}
@@ -0,0 +1,161 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// RevocationStore keeps the tokens revoked with RevokeToken. Deployments running several instances
+// should use a shared implementation, e.g. backed by Redis. Implementations must be safe for
+// concurrent use.
+type RevocationStore interface {
+	// Revoke stores key as revoked for ttl.
+	Revoke(key string, ttl time.Duration)
+
+	// IsRevoked reports whether key is revoked.
+	IsRevoked(key string) bool
+
+	// RevokedKeys returns all revoked keys, which are loaded into the bloom filter in front of the
+	// store.
+	RevokedKeys() []string
+}
+
+type memoryRevocationStore struct {
+	cache *ttlCache
+}
+
+// NewMemoryRevocationStore returns a RevocationStore keeping the revoked keys in memory.
+func NewMemoryRevocationStore() RevocationStore {
+	return &memoryRevocationStore{cache: newTTLCache()}
+}
+
+func (s *memoryRevocationStore) memoryCache() *ttlCache {
+	return s.cache
+}
+
+func (s *memoryRevocationStore) Revoke(key string, ttl time.Duration) {
+	s.cache.Set(key, true, ttl)
+}
+
+func (s *memoryRevocationStore) IsRevoked(key string) bool {
+	_, ok := s.cache.Get(key)
+	return ok
+}
+
+func (s *memoryRevocationStore) RevokedKeys() []string {
+	return s.cache.Keys()
+}
+
+// revocationFilter is the bloom filter in front of the RevocationStore, so that tokens that
+// aren't revoked are accepted without asking the store.
+type revocationFilter struct {
+	mutex      sync.RWMutex
+	filter     *bloomFilter
+	builtAt    time.Time
+	rebuilding bool
+
+	// keys revoked during a rebuild, which may be missing from the rebuilt filter
+	pending []string
+}
+
+// RevokeToken revokes a token until it expires. The token is identified by its "jti" claim, or
+// by its hash if it has none. Tokens accepted by the AdditionalVerifiers, e.g. of an upstream
+// identity provider, are revoked as well. Expired and invalid tokens don't need to be revoked,
+// ErrInvalidClaims or the verification error are returned for them.
+func (mw *JWTMiddleware) RevokeToken(tokenString string) error {
+	mw.initDefaults()
+	if mw.RevocationStore == nil {
+		return nil
+	}
+
+	token, verifier, err := mw.parseWithVerifiers(tokenString)
+	if err != nil {
+		return err
+	}
+	if err := verifier.validateClaims(token); err != nil {
+		return err
+	}
+	key := activityStoreKey(tokenString)
+	if jti, ok := token.Claims["jti"].(string); ok {
+		key = jti
+	}
+	ttl := mw.Timeout
+	if exp, ok := GetTime(token.Claims, "exp"); ok {
+		ttl = exp.Sub(mw.Clock.Now()) + time.Second
+	}
+
+	mw.RevocationStore.Revoke(key, ttl)
+	mw.forgetVerifiedToken(tokenString)
+	mw.revocationFilter.mutex.Lock()
+	if mw.revocationFilter.filter != nil {
+		mw.revocationFilter.filter.add(key)
+	}
+	if mw.revocationFilter.rebuilding {
+		mw.revocationFilter.pending = append(mw.revocationFilter.pending, key)
+	}
+	mw.revocationFilter.mutex.Unlock()
+	return nil
+}
+
+// revokedInStore reports whether the token was revoked with RevokeToken. The store is only asked
+// if the bloom filter may contain the token, the answers of the store are reported as
+// "revocation_filter_positives" and "revocation_filter_false_positives" counters.
+func (mw *JWTMiddleware) revokedInStore(token *jwt.Token) bool {
+	filter := mw.currentRevocationFilter()
+
+	keys := []string{activityStoreKey(token.Raw)}
+	if jti, ok := token.Claims["jti"].(string); ok {
+		keys = append(keys, jti)
+	}
+	for _, key := range keys {
+		mw.revocationFilter.mutex.RLock()
+		mayContain := filter.mayContain(key)
+		mw.revocationFilter.mutex.RUnlock()
+		if !mayContain {
+			continue
+		}
+		mw.Metrics.IncCounter("revocation_filter_positives")
+		if mw.RevocationStore.IsRevoked(key) {
+			return true
+		}
+		mw.Metrics.IncCounter("revocation_filter_false_positives")
+	}
+	return false
+}
+
+// currentRevocationFilter returns the bloom filter, building it on first use and rebuilding it in
+// the background every RevocationFilterInterval, which picks up revocations by other instances and
+// drops expired ones.
+func (mw *JWTMiddleware) currentRevocationFilter() *bloomFilter {
+	rf := mw.revocationFilter
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.filter == nil {
+		rf.filter, rf.builtAt = mw.buildRevocationFilter(), time.Now()
+	} else if time.Since(rf.builtAt) > mw.RevocationFilterInterval && !rf.rebuilding {
+		rf.rebuilding = true
+		go func() {
+			filter := mw.buildRevocationFilter()
+			rf.mutex.Lock()
+			defer rf.mutex.Unlock()
+			for _, key := range rf.pending {
+				filter.add(key)
+			}
+			rf.filter, rf.builtAt, rf.rebuilding, rf.pending = filter, time.Now(), false, nil
+		}()
+	}
+	return rf.filter
+}
+
+func (mw *JWTMiddleware) buildRevocationFilter() *bloomFilter {
+	keys := mw.RevocationStore.RevokedKeys()
+	// leave room for the tokens revoked until the next rebuild
+	filter := newBloomFilter(2*len(keys) + 1000)
+	for _, key := range keys {
+		filter.add(key)
+	}
+	return filter
+}
@@ -0,0 +1,194 @@
+package jwt
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// countingRevocationStore counts the lookups of a RevocationStore.
+type countingRevocationStore struct {
+	RevocationStore
+	mutex   sync.Mutex
+	lookups int
+}
+
+func (s *countingRevocationStore) IsRevoked(key string) bool {
+	s.mutex.Lock()
+	s.lookups++
+	s.mutex.Unlock()
+	return s.RevocationStore.IsRevoked(key)
+}
+
+func (s *countingRevocationStore) lookupCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lookups
+}
+
+func TestRevocationStore(t *testing.T) {
+	store := &countingRevocationStore{RevocationStore: NewMemoryRevocationStore()}
+	metrics := newCountingMetrics()
+
+	authMiddleware := &JWTMiddleware{
+		Realm:                    "test zone",
+		Key:                      key,
+		Timeout:                  time.Hour,
+		Metrics:                  metrics,
+		RevocationStore:          store,
+		RevocationFilterInterval: time.Millisecond,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	request := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	adminToken := makeTokenString("admin", key)
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "user"
+	token.Claims["jti"] = "token-1"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	userToken, _ := token.SignedString(key)
+
+	// tokens that aren't revoked don't hit the store
+	request(adminToken).CodeIs(200)
+	request(userToken).CodeIs(200)
+	if lookups := store.lookupCount(); lookups != 0 {
+		t.Errorf("Store should not be asked for valid tokens, got %d lookups", lookups)
+	}
+
+	if err := authMiddleware.RevokeToken(adminToken); err != nil {
+		t.Fatal(err)
+	}
+	recorded := request(adminToken)
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"not_authorized","detail":"Token revoked"}`)
+	if positives := metrics.counter("revocation_filter_positives"); positives != 1 {
+		t.Errorf("revocation_filter_positives should be 1, got %d", positives)
+	}
+	request(userToken).CodeIs(200)
+
+	// revocations by other instances are picked up by the rebuild
+	store.Revoke("token-1", time.Hour)
+	for i := 0; i < 100 && request(userToken).Recorder.Code == 200; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	request(userToken).CodeIs(401)
+
+	if err := authMiddleware.RevokeToken(makeTokenString("admin", []byte("other key"))); err == nil {
+		t.Error("Invalid tokens should not be revoked")
+	}
+}
+
+// pausingRevocationStore pauses the rebuilds of the revocation filter after taking the snapshot
+// of the revoked keys, once paused is set.
+type pausingRevocationStore struct {
+	RevocationStore
+	paused      bool
+	snapshotted chan bool
+	resume      chan bool
+}
+
+func (s *pausingRevocationStore) RevokedKeys() []string {
+	keys := s.RevocationStore.RevokedKeys()
+	if s.paused {
+		s.snapshotted <- true
+		<-s.resume
+	}
+	return keys
+}
+
+func TestRevocationDuringFilterRebuild(t *testing.T) {
+	store := &pausingRevocationStore{
+		RevocationStore: NewMemoryRevocationStore(),
+		snapshotted:     make(chan bool),
+		resume:          make(chan bool),
+	}
+	authMiddleware := &JWTMiddleware{
+		Realm:                    "test zone",
+		Key:                      key,
+		RevocationStore:          store,
+		RevocationFilterInterval: time.Millisecond,
+		Authenticator:            rejectLogin,
+	}
+	authMiddleware.initDefaults()
+	authMiddleware.currentRevocationFilter()
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "admin"
+	token.Claims["jti"] = "token-1"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	tokenString, _ := token.SignedString(key)
+
+	time.Sleep(2 * time.Millisecond)
+	store.paused = true
+	authMiddleware.currentRevocationFilter()
+	<-store.snapshotted
+	if err := authMiddleware.RevokeToken(tokenString); err != nil {
+		t.Fatal(err)
+	}
+	store.resume <- true
+
+	rf := authMiddleware.revocationFilter
+	for i := 0; i < 100; i++ {
+		rf.mutex.RLock()
+		rebuilding, revoked := rf.rebuilding, rf.filter.mayContain("token-1")
+		rf.mutex.RUnlock()
+		if !rebuilding {
+			if !revoked {
+				t.Errorf("Tokens revoked during a rebuild should be in the rebuilt filter")
+			}
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("The filter should be rebuilt")
+}
+
+func TestRevokeTokenOfAdditionalVerifier(t *testing.T) {
+	idpKey := []byte("idp key")
+	authMiddleware := &JWTMiddleware{
+		Realm:               "test zone",
+		Key:                 key,
+		RevocationStore:     NewMemoryRevocationStore(),
+		Authenticator:       rejectLogin,
+		AdditionalVerifiers: []*JWTMiddleware{{Realm: "idp", Key: idpKey, Authenticator: rejectLogin}},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {}))
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "alice"
+	token.Claims["jti"] = "idp-token"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	tokenString, _ := token.SignedString(idpKey)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	test.RunRequest(t, api.MakeHandler(), req).CodeIs(200)
+
+	// tokens of the verifiers are revoked in the store of the middleware
+	if err := authMiddleware.RevokeToken(tokenString); err != nil {
+		t.Fatalf("The token of the verifier should be revoked, got %v", err)
+	}
+	test.RunRequest(t, api.MakeHandler(), req).CodeIs(401)
+}
@@ -0,0 +1,56 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// AuthorizeRoutes wraps the handlers of routes to apply RouteAuthorizator and RouteScopes, which
+// get the matched route instead of just the request, and to make the route available through
+// ExtractRoute. The middleware runs before the router, so route based policies can only be
+// applied by the routes themselves, e.g.
+//
+//	router, _ := rest.MakeRouter(authMiddleware.AuthorizeRoutes(
+//		rest.Get("/users/:id", getUser),
+//		rest.Delete("/users/:id", deleteUser),
+//	)...)
+//
+// The routes must be used behind the middleware. Requests rejected by RouteAuthorizator get a
+// 403, those lacking the RouteScopes of their route a 403 with an insufficient_scope challenge.
+func (mw *JWTMiddleware) AuthorizeRoutes(routes ...*rest.Route) []*rest.Route {
+	wrapped := make([]*rest.Route, len(routes))
+	for i, route := range routes {
+		route := *route
+		handler := route.Func
+		pattern := route.HttpMethod + " " + route.PathExp
+		guarded := mw.guardMethod(route.HttpMethod) + " " + route.PathExp
+		route.Func = func(writer rest.ResponseWriter, request *rest.Request) {
+			request.Env["JWT_ROUTE"] = pattern
+
+			userId, ok := request.Env["REMOTE_USER"].(string)
+			if !ok {
+				mw.unauthorized(mw.encodeResponses(writer, request))
+				return
+			}
+			if mw.RouteAuthorizator != nil && !ExtractAuthorizationOverride(request) && !mw.RouteAuthorizator(userId, guarded, request) {
+				rest.Error(mw.encodeResponses(writer, request), "Forbidden", http.StatusForbidden)
+				return
+			}
+			if scopes := mw.RouteScopes[guarded]; !mw.hasScopes(ExtractScopes(request), scopes) {
+				mw.insufficientScope(mw.encodeResponses(writer, request), scopes)
+				return
+			}
+			handler(writer, request)
+		}
+		wrapped[i] = &route
+	}
+	return wrapped
+}
+
+// ExtractRoute returns the route matched by a request to one of the AuthorizeRoutes, as method
+// and path pattern, e.g. "GET /users/:id".
+func ExtractRoute(request *rest.Request) string {
+	route, _ := request.Env["JWT_ROUTE"].(string)
+	return route
+}
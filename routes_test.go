@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestAuthorizeRoutes(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		RouteAuthorizator: func(userId string, route string, request *rest.Request) bool {
+			return route != "GET /users/:id" || request.PathParams["id"] == userId
+		},
+		RouteScopes: map[string][]string{"DELETE /users/:id": {"users:admin"}},
+	}
+
+	handler := func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"route": ExtractRoute(r)})
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(authMiddleware.AuthorizeRoutes(
+		rest.Get("/users/:id", handler),
+		rest.Delete("/users/:id", handler),
+	)...)
+	api.SetApp(router)
+
+	request := func(method, path, tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest(method, "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	recorded := request("GET", "/users/admin", makeTokenString("admin", key))
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"route":"GET /users/:id"}`)
+	request("GET", "/users/other", makeTokenString("admin", key)).CodeIs(403)
+
+	request("DELETE", "/users/other", makeTokenString("admin", key)).CodeIs(403)
+	request("DELETE", "/users/other", makeScopedTokenString("users:admin")).CodeIs(200)
+}
+
+func TestHeadAsGet(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: rejectLogin,
+		RouteScopes:   map[string][]string{"GET /reports/:id": {"reports:read"}},
+		ScopeTable:    []ScopeRule{{Method: "GET", Path: "/exports/:id", Scopes: []string{"exports:read"}}},
+		HeadAsGet:     true,
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(append(authMiddleware.AuthorizeRoutes(
+		rest.Get("/reports/:id", func(w rest.ResponseWriter, r *rest.Request) {}),
+		rest.Head("/reports/:id", func(w rest.ResponseWriter, r *rest.Request) {}),
+	), rest.Head("/exports/:id", func(w rest.ResponseWriter, r *rest.Request) {}))...)
+	api.SetApp(router)
+
+	request := func(method, path, tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest(method, "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request("HEAD", "/reports/1", makeTokenString("admin", key)).CodeIs(403)
+	request("HEAD", "/reports/1", makeScopedTokenString("reports:read")).CodeIs(200)
+	request("HEAD", "/exports/1", makeTokenString("admin", key)).CodeIs(403)
+	request("HEAD", "/exports/1", makeScopedTokenString("exports:read")).CodeIs(200)
+
+	authMiddleware.HeadAsGet = false
+	request("HEAD", "/exports/1", makeTokenString("admin", key)).CodeIs(200)
+}
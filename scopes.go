@@ -0,0 +1,108 @@
+package jwt
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// defaultScopesFunc returns the scopes of the space separated "scope" claim (RFC 8693) and of the
+// "scopes" array claim.
+func defaultScopesFunc(claims map[string]interface{}) []string {
+	scopes := []string{}
+	if scope, ok := claims["scope"].(string); ok {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+	return append(scopes, stringList(claims["scopes"])...)
+}
+
+// ExtractScopes returns the scopes granted to the authenticated user, as made available by the
+// middleware in request.Env["JWT_SCOPES"].
+func ExtractScopes(request *rest.Request) []string {
+	scopes, _ := request.Env["JWT_SCOPES"].([]string)
+	return scopes
+}
+
+// RequireScopes returns a guard that only calls the wrapped handler if the authenticated user was
+// granted all of the given scopes according to the ScopeMatcher, and responds with 403 otherwise. It must be used behind the
+// middleware, usually on a per route basis with rest.WrapMiddlewares.
+func (mw *JWTMiddleware) RequireScopes(scopes ...string) rest.MiddlewareSimple {
+	return func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(writer rest.ResponseWriter, request *rest.Request) {
+			if !mw.hasScopes(ExtractScopes(request), scopes) {
+				mw.insufficientScope(mw.encodeResponses(writer, request), scopes)
+				return
+			}
+			handler(writer, request)
+		}
+	}
+}
+
+// ScopeMatcher reports whether the granted scopes satisfy a required scope.
+type ScopeMatcher func(granted []string, required string) bool
+
+// NewScopeMatcher returns a ScopeMatcher for colon separated scopes like "repo:read", supporting
+//
+//   - wildcards: "billing:*" grants all scopes starting with "billing:", "*" grants all scopes
+//   - hierarchy: implied maps the last part of a scope to the parts it implies, e.g.
+//     {"admin": {"write"}, "write": {"read"}} makes "repo:admin" grant "repo:write" and "repo:read"
+//
+// implied may be nil.
+func NewScopeMatcher(implied map[string][]string) ScopeMatcher {
+	return func(granted []string, required string) bool {
+		for _, scope := range granted {
+			if matchScope(scope, required, implied, len(implied)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchScope reports whether scope grants required, following at most depth implications.
+func matchScope(scope string, required string, implied map[string][]string, depth int) bool {
+	if scope == required || scope == "*" {
+		return true
+	}
+	if strings.HasSuffix(scope, ":*") && strings.HasPrefix(required, strings.TrimSuffix(scope, "*")) {
+		return true
+	}
+	if depth == 0 {
+		return false
+	}
+	prefix, action := "", scope
+	if i := strings.LastIndex(scope, ":"); i >= 0 {
+		prefix, action = scope[:i+1], scope[i+1:]
+	}
+	for _, impliedAction := range implied[action] {
+		if matchScope(prefix+impliedAction, required, implied, depth-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasScopes reports whether the granted scopes satisfy all required scopes.
+func (mw *JWTMiddleware) hasScopes(granted []string, required []string) bool {
+	for _, scope := range required {
+		if !mw.ScopeMatcher(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func (mw *JWTMiddleware) insufficientScope(writer rest.ResponseWriter, scopes []string) {
+	mw.challenge(writer, `, error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+	rest.Error(writer, "Insufficient scope", http.StatusForbidden)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
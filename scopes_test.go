@@ -0,0 +1,187 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func makeScopedTokenString(scope interface{}) string {
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "admin"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	token.Claims["scope"] = scope
+	tokenString, _ := token.SignedString(key)
+	return tokenString
+}
+
+func TestRequireScopes(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	endpoint := func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": "123"})
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/read", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireScopes("read")}, endpoint)),
+		rest.Get("/admin", rest.WrapMiddlewares([]rest.Middleware{authMiddleware.RequireScopes("read", "admin")}, endpoint)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// granted scope
+	req := test.MakeSimpleRequest("GET", "http://localhost/read", nil)
+	req.Header.Set("Authorization", "Bearer "+makeScopedTokenString("read write"))
+	recorded := test.RunRequest(t, handler, req)
+	recorded.CodeIs(200)
+
+	// one of the required scopes is missing
+	req = test.MakeSimpleRequest("GET", "http://localhost/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+makeScopedTokenString("read write"))
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(403)
+	recorded.ContentTypeIsJson()
+	recorded.HeaderIs("WWW-Authenticate", `JWT realm=test zone, error="insufficient_scope", scope="read admin"`)
+
+	// token without scopes
+	req = test.MakeSimpleRequest("GET", "http://localhost/read", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(403)
+
+	// scopes given as array claim
+	arrayToken := jwt.New(jwt.GetSigningMethod("HS256"))
+	arrayToken.Claims["id"] = "admin"
+	arrayToken.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	arrayToken.Claims["iat"] = time.Now().Unix()
+	arrayToken.Claims["scopes"] = []string{"read", "admin"}
+	tokenString, _ := arrayToken.SignedString(key)
+
+	req = test.MakeSimpleRequest("GET", "http://localhost/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	recorded = test.RunRequest(t, handler, req)
+	recorded.CodeIs(200)
+}
+
+func TestScopeMatcher(t *testing.T) {
+	matcher := NewScopeMatcher(map[string][]string{"admin": {"write"}, "write": {"read"}})
+
+	cases := []struct {
+		granted  []string
+		required string
+		matches  bool
+	}{
+		{[]string{"repo:read"}, "repo:read", true},
+		{[]string{"repo:read"}, "repo:write", false},
+		{[]string{"repo:admin"}, "repo:read", true},
+		{[]string{"repo:write"}, "repo:admin", false},
+		{[]string{"repo:admin"}, "billing:read", false},
+		{[]string{"billing:*"}, "billing:invoices:read", true},
+		{[]string{"billing:*"}, "billingx:read", false},
+		{[]string{"*"}, "anything", true},
+		{[]string{"admin"}, "read", true},
+		{[]string{}, "read", false},
+	}
+	for _, c := range cases {
+		if matcher(c.granted, c.required) != c.matches {
+			t.Errorf("Expected %v granting %q to be %v", c.granted, c.required, c.matches)
+		}
+	}
+
+	// cyclic hierarchies terminate
+	cyclic := NewScopeMatcher(map[string][]string{"a": {"b"}, "b": {"a"}})
+	if cyclic([]string{"x:a"}, "x:c") {
+		t.Errorf("Cyclic hierarchy should not grant unrelated scopes")
+	}
+
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		ScopeMatcher: matcher,
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(authMiddleware.RequireScopes("repo:read")(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	})))
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeScopedTokenString("repo:admin"))
+	test.RunRequest(t, api.MakeHandler(), req).CodeIs(200)
+
+	req.Header.Set("Authorization", "Bearer "+makeScopedTokenString("billing:*"))
+	test.RunRequest(t, api.MakeHandler(), req).CodeIs(403)
+}
+
+func TestGroupMapper(t *testing.T) {
+	lookups := 0
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		GroupMapper: &GroupMapper{
+			Mapping: map[string][]string{
+				"Billing Admins": {"billing:read", "billing:write"},
+				"Employees":      {"billing:read", "wiki:read"},
+			},
+			MappingFunc: func(group string) []string {
+				lookups++
+				if group == "Support" {
+					return []string{"tickets:write"}
+				}
+				return nil
+			},
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(ExtractScopes(r))
+	}))
+
+	request := func(groups interface{}) *test.Recorded {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "admin"
+		token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token.Claims["iat"] = time.Now().Unix()
+		token.Claims["scope"] = "profile"
+		token.Claims["groups"] = groups
+		tokenString, _ := token.SignedString(key)
+
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request([]string{"Billing Admins", "Employees"}).BodyIs(`["profile","billing:read","billing:write","wiki:read"]`)
+	request("Support").BodyIs(`["profile","tickets:write"]`)
+	request([]string{"Support", "Unknown"}).BodyIs(`["profile","tickets:write"]`)
+	if lookups != 2 {
+		t.Errorf("Expected lookups to be cached, got %d lookups", lookups)
+	}
+
+	// a mapper used on its own creates its cache itself
+	mapper := &GroupMapper{MappingFunc: func(group string) []string { return []string{group + ":read"} }}
+	if scopes := mapper.Scopes(map[string]interface{}{"groups": "wiki"}); len(scopes) != 1 || scopes[0] != "wiki:read" {
+		t.Errorf("Expected the scopes of the standalone mapper, got %v", scopes)
+	}
+}
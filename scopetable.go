@@ -0,0 +1,135 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/trie"
+)
+
+// ScopeRule requires scopes for the requests matching a method and a path pattern. Rules are
+// usually loaded from a configuration file with ParseScopeTable.
+type ScopeRule struct {
+	// HTTP method of the requests, or "*" for all methods.
+	Method string `json:"method"`
+
+	// Path pattern of the requests in the syntax of the go-json-rest router, e.g. "/users/:id" or
+	// "/admin/*path".
+	Path string `json:"path"`
+
+	// Scopes the token must all be granted, matched with the ScopeMatcher. Empty for the routes
+	// only requiring a valid token.
+	Scopes []string `json:"scopes"`
+}
+
+// scopeTable finds the first ScopeRule matching a request, with the same matching as the router.
+type scopeTable struct {
+	rules []ScopeRule
+	trie  *trie.Trie
+}
+
+// scopeRoute is the route of a rule in the trie, the index breaks ties between matching rules.
+type scopeRoute struct {
+	index int
+}
+
+// ParseScopeTable parses a JSON array of ScopeRules, e.g.
+//
+//	[
+//		{"method": "GET", "path": "/users/:id", "scopes": ["users:read"]},
+//		{"method": "*", "path": "/admin/*path", "scopes": ["admin"]}
+//	]
+//
+// Unknown fields and invalid rules are rejected, so that typos don't silently drop a requirement.
+func ParseScopeTable(data []byte) ([]ScopeRule, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var rules []ScopeRule
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("Invalid scope table: %v", err)
+	}
+	if _, err := newScopeTable(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func newScopeTable(rules []ScopeRule) (*scopeTable, error) {
+	table := &scopeTable{rules: rules, trie: trie.New()}
+	for i, rule := range rules {
+		method := strings.ToUpper(rule.Method)
+		if method == "" {
+			return nil, fmt.Errorf("ScopeTable[%d]: method is required", i)
+		}
+		path, err := escapedPathPattern(rule.Path)
+		if err != nil {
+			return nil, fmt.Errorf("ScopeTable[%d]: %v", i, err)
+		}
+		if err := table.trie.AddRoute(method, path, &scopeRoute{index: i}); err != nil {
+			return nil, fmt.Errorf("ScopeTable[%d]: %v", i, err)
+		}
+	}
+	table.trie.Compress()
+	return table, nil
+}
+
+// escapedPathPattern escapes a path pattern like the router does, so that it matches the escaped
+// paths of the requests.
+func escapedPathPattern(pattern string) (string, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return "", fmt.Errorf("path %q must start with /", pattern)
+	}
+	if strings.Contains(pattern, "?") {
+		return "", fmt.Errorf("path %q must not contain a query string", pattern)
+	}
+	placeholders := strings.NewReplacer("*", "__SPLAT__", "#", "__RELAXED__")
+	parsed, err := url.Parse(placeholders.Replace(pattern))
+	if err != nil {
+		return "", err
+	}
+	return strings.NewReplacer("__SPLAT__", "*", "__RELAXED__", "#").Replace(parsed.RequestURI()), nil
+}
+
+// match returns the first rule matching the method and the URL of a request.
+func (t *scopeTable) match(method string, requestURL *url.URL) (*ScopeRule, bool) {
+	path := strings.SplitN(requestURL.RequestURI(), "?", 2)[0]
+	method = strings.ToUpper(method)
+	first := -1
+	for _, m := range []string{method, "*"} {
+		for _, match := range t.trie.FindRoutes(m, path) {
+			if index := match.Route.(*scopeRoute).index; first == -1 || index < first {
+				first = index
+			}
+		}
+	}
+	if first == -1 {
+		return nil, false
+	}
+	return &t.rules[first], true
+}
+
+// scopeTableRestricted rejects the requests lacking the scopes of the first ScopeRule they match,
+// and those matching none if DenyUnlistedRoutes is set.
+func (mw *JWTMiddleware) scopeTableRestricted(writer rest.ResponseWriter, request *rest.Request) bool {
+	if mw.scopeTable == nil {
+		return false
+	}
+	rule, ok := mw.scopeTable.match(mw.guardMethod(request.Method), request.URL)
+	if !ok {
+		if mw.DenyUnlistedRoutes {
+			errorWithCode(writer, "Route not allowed", "route_not_listed", http.StatusForbidden)
+			return true
+		}
+		return false
+	}
+	if !mw.hasScopes(ExtractScopes(request), rule.Scopes) {
+		mw.insufficientScope(writer, rule.Scopes)
+		return true
+	}
+	return false
+}
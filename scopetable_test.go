@@ -0,0 +1,103 @@
+package jwt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestScopeTable(t *testing.T) {
+	rules, err := ParseScopeTable([]byte(`[
+		{"method": "GET", "path": "/users/:id", "scopes": ["users:read"]},
+		{"method": "delete", "path": "/users/:id", "scopes": ["users:admin"]},
+		{"method": "*", "path": "/admin/*path", "scopes": ["admin"]},
+		{"method": "GET", "path": "/admin/status", "scopes": []},
+		{"method": "GET", "path": "/health"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authMiddleware := &JWTMiddleware{
+		Realm:              "test zone",
+		Key:                key,
+		Timeout:            time.Hour,
+		Authenticator:      rejectLogin,
+		ScopeTable:         rules,
+		DenyUnlistedRoutes: true,
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {}))
+	handler := api.MakeHandler()
+	request := func(method, url, scope string) *test.Recorded {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "admin"
+		token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token.Claims["iat"] = time.Now().Unix()
+		token.Claims["scope"] = scope
+		tokenString, _ := token.SignedString(key)
+		req := test.MakeSimpleRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	request("GET", "http://localhost/users/42", "users:read").CodeIs(200)
+	recorded := request("DELETE", "http://localhost/users/42", "users:read")
+	recorded.CodeIs(403)
+	recorded.HeaderIs("WWW-Authenticate", `JWT realm=test zone, error="insufficient_scope", scope="users:admin"`)
+	request("DELETE", "http://localhost/users/42", "users:admin").CodeIs(200)
+
+	// the first matching rule applies, whatever the method
+	request("POST", "http://localhost/admin/status", "").CodeIs(403)
+	request("GET", "http://localhost/admin/status", "").CodeIs(403)
+	request("PUT", "http://localhost/admin/users/42", "admin").CodeIs(200)
+	request("GET", "http://localhost/health", "").CodeIs(200)
+
+	// paths are matched escaped, like the router does
+	request("GET", "http://localhost/users/a%2Fb", "users:read").CodeIs(200)
+	request("GET", "http://localhost/users/42/avatar", "users:read").CodeIs(403)
+
+	recorded = request("GET", "http://localhost/reports", "admin")
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Route not allowed","code":"route_not_listed"}`)
+}
+
+func TestParseScopeTable(t *testing.T) {
+	invalid := []string{
+		`{"method": "GET", "path": "/users"}`,
+		`[{"method": "GET", "path": "/users", "scope": ["users:read"]}]`,
+		`[{"path": "/users"}]`,
+		`[{"method": "GET", "path": "users"}]`,
+		`[{"method": "GET", "path": "/users?all=1"}]`,
+		`[{"method": "GET", "path": "/users"}, {"method": "GET", "path": "/users"}]`,
+		`[{"method": "GET", "path": "/users/:id"}, {"method": "GET", "path": "/users/:userId/avatar"}]`,
+	}
+	for _, data := range invalid {
+		if _, err := ParseScopeTable([]byte(data)); err == nil {
+			t.Errorf("Scope table %s should be rejected", data)
+		}
+	}
+
+	authMiddleware := &JWTMiddleware{
+		Realm:              "test zone",
+		Key:                key,
+		Authenticator:      rejectLogin,
+		ScopeTable:         []ScopeRule{{Method: "GET", Path: "users"}},
+		DenyUnlistedRoutes: true,
+	}
+	if err := authMiddleware.Init(); err == nil {
+		t.Error("Init should reject an invalid ScopeTable")
+	}
+	reported := false
+	for _, problem := range authMiddleware.Validate() {
+		reported = reported || strings.HasPrefix(problem.Error(), "ScopeTable[0]")
+	}
+	if !reported {
+		t.Error("Validate should report the invalid rule")
+	}
+}
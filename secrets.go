@@ -0,0 +1,322 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SecretProvider provides the HMAC secret of the middleware from a central place, so that it can
+// be rotated without code changes. The secret is fetched by Init and again in the background once
+// SecretRefreshInterval has passed; requests don't wait for it. Implementations must be safe for
+// concurrent use.
+type SecretProvider interface {
+	// GetSecret returns the current secret along with its version, which changes whenever the
+	// secret does.
+	GetSecret(ctx context.Context) ([]byte, string, error)
+}
+
+// SecretProviderFunc adapts a function to the SecretProvider interface.
+type SecretProviderFunc func(ctx context.Context) ([]byte, string, error)
+
+// GetSecret calls f(ctx).
+func (f SecretProviderFunc) GetSecret(ctx context.Context) ([]byte, string, error) {
+	return f(ctx)
+}
+
+// ErrEmptySecret is returned by the SecretProviders for missing or empty secrets.
+var ErrEmptySecret = errors.New("Empty secret")
+
+// NewFileSecretProvider returns a SecretProvider reading the secret from a file, e.g. mounted from
+// a Kubernetes secret. Surrounding whitespace is trimmed, and the version is a hash of the secret.
+func NewFileSecretProvider(path string) SecretProvider {
+	return SecretProviderFunc(func(ctx context.Context) ([]byte, string, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, "", err
+		}
+		return hashedSecret(bytes.TrimSpace(data))
+	})
+}
+
+// NewEnvSecretProvider returns a SecretProvider reading the secret from the environment variable
+// name. The version is a hash of the secret.
+func NewEnvSecretProvider(name string) SecretProvider {
+	return SecretProviderFunc(func(ctx context.Context) ([]byte, string, error) {
+		return hashedSecret([]byte(os.Getenv(name)))
+	})
+}
+
+func hashedSecret(secret []byte) ([]byte, string, error) {
+	if len(secret) == 0 {
+		return nil, "", ErrEmptySecret
+	}
+	hash := sha256.Sum256(secret)
+	return secret, hex.EncodeToString(hash[:8]), nil
+}
+
+// VaultSecretProvider reads the secret from a HashiCorp Vault KV version 2 secrets engine. The
+// version is the version of the Vault secret.
+type VaultSecretProvider struct {
+	// Address of Vault, e.g. "https://vault.example.com:8200". Required.
+	Address string
+
+	// Vault token. Required.
+	Token string
+
+	// Mount path of the secrets engine. Optional, defaults to "secret".
+	Mount string
+
+	// Path of the secret within the secrets engine. Required.
+	Path string
+
+	// Key of the secret holding the HMAC secret. Optional, defaults to "key".
+	Field string
+
+	// HTTP client used to call Vault. Optional, defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+type vaultSecret struct {
+	Data struct {
+		Data     map[string]string `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+// GetSecret reads the secret from Vault.
+func (p *VaultSecretProvider) GetSecret(ctx context.Context) ([]byte, string, error) {
+	mount := p.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	field := p.Field
+	if field == "" {
+		field = "key"
+	}
+
+	request, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(p.Address, "/")+"/v1/"+mount+"/data/"+strings.TrimPrefix(p.Path, "/"), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	request.Header.Set("X-Vault-Token", p.Token)
+
+	secret := vaultSecret{}
+	if err := fetchSecret(ctx, p.Client, request, &secret); err != nil {
+		return nil, "", err
+	}
+	if secret.Data.Data[field] == "" {
+		return nil, "", ErrEmptySecret
+	}
+	return []byte(secret.Data.Data[field]), strconv.Itoa(secret.Data.Metadata.Version), nil
+}
+
+// AWSSecretsManagerProvider reads the secret from AWS Secrets Manager. Binary secrets are used
+// as is, string secrets as their bytes. The version is the VersionId of the secret.
+type AWSSecretsManagerProvider struct {
+	// Region of the secret, e.g. "eu-west-1". Required.
+	Region string
+
+	// Name or ARN of the secret. Required.
+	SecretId string
+
+	// Credentials signing the requests.
+	// Optional, default to the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+	// environment variables.
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// Endpoint of Secrets Manager. Optional, defaults to the endpoint of the Region.
+	Endpoint string
+
+	// HTTP client used to call Secrets Manager. Optional, defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+type awsSecretValue struct {
+	SecretString string `json:"SecretString"`
+	SecretBinary []byte `json:"SecretBinary"`
+	VersionId    string `json:"VersionId"`
+}
+
+// GetSecret reads the secret from Secrets Manager.
+func (p *AWSSecretsManagerProvider) GetSecret(ctx context.Context) ([]byte, string, error) {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + p.Region + ".amazonaws.com"
+	}
+	credentials := awsCredentials{p.AccessKeyId, p.SecretAccessKey, p.SessionToken}
+	if credentials.accessKeyId == "" {
+		credentials = awsCredentials{os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}
+	}
+
+	body, _ := json.Marshal(map[string]string{"SecretId": p.SecretId})
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	request.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	request.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(request, body, "secretsmanager", p.Region, credentials, time.Now())
+
+	value := awsSecretValue{}
+	if err := fetchSecret(ctx, p.Client, request, &value); err != nil {
+		return nil, "", err
+	}
+	secret := value.SecretBinary
+	if secret == nil {
+		secret = []byte(value.SecretString)
+	}
+	if len(secret) == 0 {
+		return nil, "", ErrEmptySecret
+	}
+	return secret, value.VersionId, nil
+}
+
+// fetchSecret sends request and decodes the json response into v.
+func fetchSecret(ctx context.Context, client *http.Client, request *http.Request, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Fetching secret failed with status %d", response.StatusCode)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+type awsCredentials struct {
+	accessKeyId, secretAccessKey, sessionToken string
+}
+
+// signAWSRequest signs a request with AWS Signature Version 4. All the headers of the request
+// are signed.
+func signAWSRequest(request *http.Request, body []byte, service, region string, credentials awsCredentials, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	request.Header.Set("X-Amz-Date", amzDate)
+	if credentials.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := request.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	query := request.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{request.Method, path, strings.Join(params, "&"), canonicalHeaders, signedHeaders, hex.EncodeToString(bodyHash[:])}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte("AWS4" + credentials.secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+credentials.accessKeyId+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// awsEscape escapes a query parameter as required by Signature Version 4, which only leaves the
+// unreserved characters unescaped.
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// fetchSecretKey fetches the secret of the SecretProvider and installs it as key, unless its
+// version is the current one. The replaced key keeps verifying tokens for Timeout plus MaxRefresh,
+// the longest that a token signed with it can still be used, since other instances may keep
+// issuing tokens with it until they fetch the new version.
+func (mw *JWTMiddleware) fetchSecretKey() error {
+	secret, version, err := mw.SecretProvider.GetSecret(context.Background())
+	mw.secretFetchedAt.Store(mw.Clock.Now())
+	if err != nil {
+		mw.Metrics.IncCounter("secret_refresh_failures")
+		return err
+	}
+	if current, ok := mw.secretVersion.Load().(string); !ok || current != version {
+		keys := mw.newSigningKeys(secret)
+		if previous, ok := mw.keys.Load().(*signingKeys); ok {
+			keys.previous = &signingKeys{key: previous.key, privateKey: previous.privateKey, publicKey: previous.publicKey}
+			keys.previousUntil = mw.Clock.Now().Add(mw.Timeout + mw.MaxRefresh)
+		}
+		mw.keys.Store(keys)
+		mw.secretVersion.Store(version)
+	}
+	return nil
+}
+
+// refreshSecretKey fetches the secret again in the background once SecretRefreshInterval has
+// passed. The current key stays in use if the fetch fails.
+func (mw *JWTMiddleware) refreshSecretKey() {
+	if mw.SecretProvider == nil || atomic.LoadUint32(&mw.initialized) == 0 {
+		return
+	}
+	fetchedAt, _ := mw.secretFetchedAt.Load().(time.Time)
+	if mw.Clock.Now().Sub(fetchedAt) < mw.SecretRefreshInterval || !atomic.CompareAndSwapUint32(&mw.secretRefreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreUint32(&mw.secretRefreshing, 0)
+		mw.fetchSecretKey()
+	}()
+}
@@ -0,0 +1,207 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestSecretProviderRefresh(t *testing.T) {
+	var mutex sync.Mutex
+	version := 1
+	provider := SecretProviderFunc(func(ctx context.Context) ([]byte, string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return []byte(strings.Repeat(strconv.Itoa(version), 32)), strconv.Itoa(version), nil
+	})
+
+	clock := &frozenClock{now: time.Now()}
+	authMiddleware := &JWTMiddleware{
+		Realm:          "test zone",
+		SecretProvider: provider,
+		Timeout:        time.Hour,
+		Clock:          clock,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/login"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Get("/", func(writer rest.ResponseWriter, request *rest.Request) {
+			writer.WriteJson(map[string]string{"status": "ok"})
+		}),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	login := func() string {
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"}))
+		recorded.CodeIs(200)
+		token := DecoderToken{}
+		recorded.DecodeJsonPayload(&token)
+		return token.Token
+	}
+	get := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	oldToken := login()
+	get(oldToken).CodeIs(200)
+
+	mutex.Lock()
+	version = 2
+	mutex.Unlock()
+
+	// the secret isn't fetched before SecretRefreshInterval has passed
+	get(oldToken).CodeIs(200)
+
+	clock.now = clock.now.Add(6 * time.Minute)
+	get(oldToken)
+	for i := 0; authMiddleware.secretVersion.Load() != "2"; i++ {
+		if i == 100 {
+			t.Fatal("The secret should have been fetched again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// tokens signed with the previous secret are accepted until they can no longer be used
+	get(oldToken).CodeIs(200)
+	if report, _, _ := authMiddleware.inspectToken(oldToken); !report.Valid || report.Key != "previous" {
+		t.Errorf("The token should be reported as verified by the previous secret, got %+v", report)
+	}
+	get(login()).CodeIs(200)
+
+	clock.now = clock.now.Add(59 * time.Minute)
+	if _, err := authMiddleware.parseSignedToken(oldToken); !isSignatureVerified(err) {
+		t.Errorf("The signature of the expired token should still be verified, got %v", err)
+	}
+	// wait for the secret fetch started by the parse before moving the clock
+	for atomic.LoadUint32(&authMiddleware.secretRefreshing) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.now = clock.now.Add(6 * time.Minute)
+	if _, err := authMiddleware.parseSignedToken(oldToken); isSignatureVerified(err) {
+		t.Error("The previous secret should no longer be accepted")
+	}
+}
+
+func TestSecretProviderUnavailable(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm: "test zone",
+		SecretProvider: SecretProviderFunc(func(ctx context.Context) ([]byte, string, error) {
+			return nil, "", ErrEmptySecret
+		}),
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+	if err := authMiddleware.Init(); err != ErrEmptySecret {
+		t.Errorf("Init should fail without secret, got %v", err)
+	}
+}
+
+func TestFileAndEnvSecretProviders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	ioutil.WriteFile(path, []byte("file secret\n"), 0600)
+	secret, version, err := NewFileSecretProvider(path).GetSecret(context.Background())
+	if err != nil || string(secret) != "file secret" || version == "" {
+		t.Errorf("Unexpected file secret %q version %q error %v", secret, version, err)
+	}
+
+	os.Setenv("JWT_TEST_SECRET", "env secret")
+	defer os.Unsetenv("JWT_TEST_SECRET")
+	secret, envVersion, err := NewEnvSecretProvider("JWT_TEST_SECRET").GetSecret(context.Background())
+	if err != nil || string(secret) != "env secret" || envVersion == version {
+		t.Errorf("Unexpected env secret %q version %q error %v", secret, envVersion, err)
+	}
+
+	if _, _, err := NewEnvSecretProvider("JWT_TEST_MISSING").GetSecret(context.Background()); err != ErrEmptySecret {
+		t.Errorf("Missing secrets should be rejected, got %v", err)
+	}
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/v1/kv/data/jwt/api" || request.Header.Get("X-Vault-Token") != "vault-token" {
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		writer.Write([]byte(`{"data":{"data":{"key":"vault secret"},"metadata":{"version":3}}}`))
+	}))
+	defer server.Close()
+
+	provider := &VaultSecretProvider{Address: server.URL, Token: "vault-token", Mount: "kv", Path: "jwt/api"}
+	secret, version, err := provider.GetSecret(context.Background())
+	if err != nil || string(secret) != "vault secret" || version != "3" {
+		t.Errorf("Unexpected Vault secret %q version %q error %v", secret, version, err)
+	}
+
+	provider.Token = "wrong"
+	if _, _, err := provider.GetSecret(context.Background()); err == nil {
+		t.Error("Failed fetches should be reported")
+	}
+}
+
+func TestAWSSecretsManagerProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body := map[string]string{}
+		json.NewDecoder(request.Body).Decode(&body)
+		if request.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || body["SecretId"] != "jwt/api" ||
+			!strings.HasPrefix(request.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			request.Header.Get("X-Amz-Security-Token") != "session" {
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		writer.Write([]byte(`{"SecretString":"aws secret","VersionId":"v1"}`))
+	}))
+	defer server.Close()
+
+	provider := &AWSSecretsManagerProvider{
+		Region:          "eu-west-1",
+		SecretId:        "jwt/api",
+		AccessKeyId:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+		Endpoint:        server.URL,
+	}
+	secret, version, err := provider.GetSecret(context.Background())
+	if err != nil || string(secret) != "aws secret" || version != "v1" {
+		t.Errorf("Unexpected AWS secret %q version %q error %v", secret, version, err)
+	}
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	// example of the AWS documentation on Signature Version 4
+	request, _ := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	credentials := awsCredentials{accessKeyId: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequest(request, nil, "iam", "us-east-1", credentials, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if authorization := request.Header.Get("Authorization"); authorization != expected {
+		t.Errorf("Expected %s, got %s", expected, authorization)
+	}
+}
@@ -0,0 +1,206 @@
+package jwt
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Session is a login of a user, kept across refreshes of its token.
+type Session struct {
+	// Id of the session, the "sid" claim of its tokens.
+	Id string `json:"id"`
+
+	// Time of the login.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Expiry of the latest token of the session.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Metadata of SessionMetadataFunc at the latest login or refresh, e.g. IP and user agent.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SessionStore keeps the sessions of users listed by SessionsHandler. Deployments running several
+// instances should use a shared implementation, e.g. backed by Redis. Implementations must be safe
+// for concurrent use.
+type SessionStore interface {
+	// SaveSession creates or replaces the session of userId with the same id, for ttl.
+	SaveSession(userId string, session Session, ttl time.Duration)
+
+	// Sessions returns the sessions of userId that haven't expired.
+	Sessions(userId string) []Session
+}
+
+// SessionEnder is implemented by SessionStores that can end a session before it expires, which
+// logouts then do.
+type SessionEnder interface {
+	// EndSession removes the session of userId with the given id.
+	EndSession(userId string, sessionId string)
+}
+
+type memorySessionStore struct {
+	// the sessions of each user are kept until the last one expires, and are only modified under
+	// the mutex
+	mutex sync.Mutex
+	cache *ttlCache
+}
+
+type memorySession struct {
+	session   Session
+	expiresAt time.Time
+}
+
+// NewMemorySessionStore returns a SessionStore keeping the sessions in memory.
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{cache: newTTLCache()}
+}
+
+func (s *memorySessionStore) memoryCache() *ttlCache {
+	return s.cache
+}
+
+// userSessions returns the sessions of userId that haven't expired, along with the expiry of the
+// last one.
+func (s *memorySessionStore) userSessions(userId string, now time.Time) (map[string]memorySession, time.Time) {
+	sessions := make(map[string]memorySession)
+	lastExpiry := now
+	if cached, ok := s.cache.Get(userId); ok {
+		for id, entry := range cached.(map[string]memorySession) {
+			if now.After(entry.expiresAt) {
+				continue
+			}
+			sessions[id] = entry
+			if entry.expiresAt.After(lastExpiry) {
+				lastExpiry = entry.expiresAt
+			}
+		}
+	}
+	return sessions, lastExpiry
+}
+
+func (s *memorySessionStore) SaveSession(userId string, session Session, ttl time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	sessions, lastExpiry := s.userSessions(userId, now)
+	sessions[session.Id] = memorySession{session: session, expiresAt: now.Add(ttl)}
+	if now.Add(ttl).After(lastExpiry) {
+		lastExpiry = now.Add(ttl)
+	}
+	s.cache.Set(userId, sessions, lastExpiry.Sub(now))
+}
+
+func (s *memorySessionStore) EndSession(userId string, sessionId string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	sessions, lastExpiry := s.userSessions(userId, now)
+	if _, ok := sessions[sessionId]; !ok {
+		return
+	}
+	delete(sessions, sessionId)
+	s.cache.Set(userId, sessions, lastExpiry.Sub(now))
+}
+
+func (s *memorySessionStore) Sessions(userId string) []Session {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries, _ := s.userSessions(userId, time.Now())
+	sessions := []Session{}
+	for _, entry := range entries {
+		sessions = append(sessions, entry.session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.Before(sessions[j].CreatedAt) })
+	return sessions
+}
+
+// endSession ends the session of a logged out token, if the SessionStore supports it.
+func (mw *JWTMiddleware) endSession(userId string, token *jwt.Token) {
+	ender, ok := mw.SessionStore.(SessionEnder)
+	if !ok {
+		return
+	}
+	if sid, ok := token.Claims["sid"].(string); ok {
+		ender.EndSession(userId, sid)
+	}
+}
+
+// setSessionId sets the "sid" claim of a token issued at login, if sessions are tracked.
+func (mw *JWTMiddleware) setSessionId(token *jwt.Token) error {
+	if mw.SessionStore == nil {
+		return nil
+	}
+	sid, err := newTokenId(mw.RandReader)
+	if err != nil {
+		return err
+	}
+	token.Claims["sid"] = sid
+	return nil
+}
+
+// saveSession records the session of a token issued at login or refresh, along with the metadata
+// of the request.
+func (mw *JWTMiddleware) saveSession(userId string, token *jwt.Token, request *rest.Request) {
+	if mw.SessionStore == nil {
+		return
+	}
+	sid, ok := token.Claims["sid"].(string)
+	if !ok {
+		return
+	}
+
+	now := mw.Clock.Now()
+	session := Session{Id: sid, CreatedAt: now, ExpiresAt: now.Add(mw.Timeout)}
+	if origIat, ok := GetTime(token.Claims, "orig_iat"); ok {
+		session.CreatedAt = origIat
+	}
+	if exp, ok := GetTime(token.Claims, "exp"); ok {
+		session.ExpiresAt = exp
+	}
+	if mw.SessionMetadataFunc != nil {
+		session.Metadata = mw.SessionMetadataFunc(userId, request)
+	}
+	mw.SessionStore.SaveSession(userId, session, session.ExpiresAt.Sub(now))
+}
+
+// sessionInfo is a Session as listed by SessionsHandler.
+type sessionInfo struct {
+	Session
+	Current bool `json:"current"`
+}
+
+// SessionsHandler lists the sessions of the user, e.g. for an "active devices" page, with the
+// session of the request marked as current. It needs to be put under an endpoint that is using the
+// JWTMiddleware, and responds with a 404 unless SessionStore is set.
+// Reply will be of the form {"sessions": [{"id": "...", "created_at": "...", "expires_at": "...",
+// "metadata": {...}, "current": true}]}.
+func (mw *JWTMiddleware) SessionsHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	if mw.SessionStore == nil {
+		rest.NotFound(writer, request)
+		return
+	}
+	userId, ok := request.Env["REMOTE_USER"].(string)
+	if !ok {
+		mw.unauthorized(writer)
+		return
+	}
+
+	currentSid := ExtractClaims(request)["sid"]
+	sessions := []sessionInfo{}
+	for _, session := range mw.SessionStore.Sessions(userId) {
+		sessions = append(sessions, sessionInfo{Session: session, Current: session.Id == currentSid})
+	}
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteJson(map[string]interface{}{"sessions": sessions})
+}
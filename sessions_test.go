@@ -0,0 +1,106 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestSessions(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+	authMiddleware := &JWTMiddleware{
+		Realm:        "test zone",
+		Key:          key,
+		Timeout:      time.Hour,
+		MaxRefresh:   time.Hour * 24,
+		Clock:        clock,
+		SessionStore: NewMemorySessionStore(),
+		SessionMetadataFunc: func(userId string, request *rest.Request) map[string]string {
+			return map[string]string{"user_agent": request.UserAgent()}
+		},
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/login"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+		rest.Get("/sessions", authMiddleware.SessionsHandler),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	login := func(userAgent string) string {
+		req := test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"})
+		req.Header.Set("User-Agent", userAgent)
+		recorded := test.RunRequest(t, handler, req)
+		recorded.CodeIs(200)
+		token := DecoderToken{}
+		recorded.DecodeJsonPayload(&token)
+		return token.Token
+	}
+	get := func(path, tokenString, userAgent string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		req.Header.Set("User-Agent", userAgent)
+		return test.RunRequest(t, handler, req)
+	}
+	sessions := func(tokenString string) []sessionInfo {
+		recorded := get("/sessions", tokenString, "phone")
+		recorded.CodeIs(200)
+		result := struct{ Sessions []sessionInfo }{}
+		recorded.DecodeJsonPayload(&result)
+		return result.Sessions
+	}
+
+	laptopToken := login("laptop")
+	clock.now = clock.now.Add(time.Minute)
+	phoneToken := login("phone")
+
+	listed := sessions(phoneToken)
+	if len(listed) != 2 || listed[0].Metadata["user_agent"] != "laptop" || listed[0].Current || !listed[1].Current {
+		t.Fatalf("Both sessions should be listed, got %+v", listed)
+	}
+	laptopSession := listed[0]
+
+	// refreshing keeps the session and updates its metadata
+	clock.now = clock.now.Add(time.Minute)
+	recorded := get("/refresh", laptopToken, "laptop v2")
+	recorded.CodeIs(200)
+	token := DecoderToken{}
+	recorded.DecodeJsonPayload(&token)
+
+	listed = sessions(token.Token)
+	if len(listed) != 2 || listed[0].Id != laptopSession.Id || listed[0].Metadata["user_agent"] != "laptop v2" || !listed[0].Current {
+		t.Errorf("Refreshed session should be updated, got %+v", listed)
+	}
+	if !listed[0].CreatedAt.Equal(laptopSession.CreatedAt) || !listed[0].ExpiresAt.After(laptopSession.ExpiresAt) {
+		t.Errorf("Refreshed session should be extended, got %+v", listed[0])
+	}
+
+	// sessions aren't tracked without a SessionStore
+	authMiddleware = &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+	api = rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(authMiddleware.SessionsHandler))
+	req := test.MakeSimpleRequest("GET", "http://localhost/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	test.RunRequest(t, api.MakeHandler(), req).CodeIs(404)
+}
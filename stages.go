@@ -0,0 +1,100 @@
+package jwt
+
+import (
+	"errors"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrTokenNotVerified is returned if the VerificationStages don't include a stage verifying the
+// token, such as ParseStage.
+var ErrTokenNotVerified = errors.New("Token not verified")
+
+// VerificationState is passed along the VerificationStages of a request, which fill it in.
+type VerificationState struct {
+	// Middleware verifying the request.
+	Middleware *JWTMiddleware
+
+	// Raw token of the request, set by ExtractStage.
+	TokenString string
+
+	// Token whose signature has been verified, set by ParseStage.
+	Token *jwt.Token
+
+	// Middleware whose key verified Token, i.e. Middleware or one of its AdditionalVerifiers, set
+	// by ParseStage. The claims of the token are checked according to its configuration.
+	Verifier *JWTMiddleware
+}
+
+// VerificationStage is a step of the verification of the token of a request. Deployments can
+// insert their own stages into VerificationStages, e.g. to look up a denylist after ClaimsStage.
+type VerificationStage interface {
+	// VerifyRequest returns an error to reject the request with a 401, which is reported with the
+	// "not_authorized" code unless it is one of the errors of the middleware.
+	VerifyRequest(request *rest.Request, state *VerificationState) error
+}
+
+// VerificationStageFunc adapts a function to a VerificationStage.
+type VerificationStageFunc func(request *rest.Request, state *VerificationState) error
+
+// VerifyRequest calls f(request, state).
+func (f VerificationStageFunc) VerifyRequest(request *rest.Request, state *VerificationState) error {
+	return f(request, state)
+}
+
+// The stages of the middleware. Stages after ParseStage rely on the token it verified.
+var (
+	// ExtractStage reads the token of the request with the TokenExtractor and the TokenDecoders.
+	ExtractStage VerificationStage = VerificationStageFunc(func(request *rest.Request, state *VerificationState) error {
+		tokenString, err := state.Middleware.extractToken(request)
+		if err != nil {
+			return err
+		}
+		state.TokenString = tokenString
+		return nil
+	})
+
+	// ParseStage verifies the signature, exp and nbf of the token with the key of the middleware,
+	// or else with the AdditionalVerifiers. Verified tokens are cached for VerificationCacheTTL.
+	ParseStage VerificationStage = VerificationStageFunc(func(request *rest.Request, state *VerificationState) error {
+		token, verifier, err := state.Middleware.parseCachedToken(state.TokenString)
+		if err != nil {
+			return err
+		}
+		state.Token, state.Verifier = token, verifier
+		return nil
+	})
+
+	// ClaimsStage checks the claims of the token, i.e. exp, token_use, iss, aud, the access token
+	// profile and the ClaimsValidator. Behind RequireBodyBoundToken, only body bound tokens are
+	// accepted, see validateBodyBoundClaims.
+	ClaimsStage VerificationStage = VerificationStageFunc(func(request *rest.Request, state *VerificationState) error {
+		if bodyBoundRoute(request) {
+			return state.Verifier.validateBodyBoundClaims(state.Token)
+		}
+		return state.Verifier.validateClaims(state.Token)
+	})
+
+	// RevocationStage rejects tokens of the RevocationList and the RevocationStore, and logged out
+	// tokens, of the middleware and of the verifier that accepted them.
+	RevocationStage VerificationStage = VerificationStageFunc(func(request *rest.Request, state *VerificationState) error {
+		return state.Middleware.checkTokenRevocation(state.Token, state.Verifier)
+	})
+
+	// FingerprintStage checks that the token is used by the client it was issued to.
+	FingerprintStage VerificationStage = VerificationStageFunc(func(request *rest.Request, state *VerificationState) error {
+		return state.Verifier.checkFingerprint(state.Token, request)
+	})
+
+	// ActivityStage rejects tokens unused for longer than the InactivityTimeout.
+	ActivityStage VerificationStage = VerificationStageFunc(func(request *rest.Request, state *VerificationState) error {
+		return state.Verifier.checkActivity(state.Token)
+	})
+)
+
+// DefaultVerificationStages returns the stages of the middleware in their default order.
+// The Authorizator is called once all of them passed.
+func DefaultVerificationStages() []VerificationStage {
+	return []VerificationStage{ExtractStage, ParseStage, ClaimsStage, RevocationStage, FingerprintStage, BodyHashStage, ActivityStage}
+}
@@ -0,0 +1,101 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestVerificationStages(t *testing.T) {
+	stages := []string{}
+	denylist := VerificationStageFunc(func(request *rest.Request, state *VerificationState) error {
+		stages = append(stages, "denylist")
+		if state.Token.Claims["id"] == "blocked" {
+			return errors.New("User blocked")
+		}
+		return nil
+	})
+
+	authMiddleware := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		VerificationStages: append(DefaultVerificationStages()[:3], denylist, VerificationStageFunc(func(request *rest.Request, state *VerificationState) error {
+			stages = append(stages, "last")
+			return nil
+		})),
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "blocked"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	blockedToken, _ := token.SignedString(key)
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+
+	req.Header.Set("Authorization", "Bearer "+blockedToken)
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"not_authorized","detail":"User blocked"}`)
+
+	// the custom stages only run after the token has been verified
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", []byte("wrong key")))
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(401)
+
+	if len(stages) != 3 || stages[0] != "denylist" || stages[1] != "last" || stages[2] != "denylist" {
+		t.Errorf("Stages should run in order, got %v", stages)
+	}
+}
+
+func TestVerificationStagesInIsolation(t *testing.T) {
+	mw := &JWTMiddleware{
+		Realm:   "test zone",
+		Key:     key,
+		Issuer:  "https://auth.example.com",
+		Timeout: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+	mw.initDefaults()
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "admin"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	state := &VerificationState{Middleware: mw, Token: token, Verifier: mw}
+
+	if err := ClaimsStage.VerifyRequest(&rest.Request{}, state); err != ErrInvalidIssuer {
+		t.Errorf("Token without issuer should be rejected, got %v", err)
+	}
+	token.Claims["iss"] = "https://auth.example.com"
+	if err := ClaimsStage.VerifyRequest(&rest.Request{}, state); err != nil {
+		t.Errorf("Token should be accepted, got %v", err)
+	}
+
+	// without ParseStage, tokens are never accepted
+	mw.VerificationStages = []VerificationStage{ExtractStage}
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	if _, _, err := mw.verifyToken(&rest.Request{Request: req, Env: map[string]interface{}{}}); err != ErrTokenNotVerified {
+		t.Errorf("Unverified token should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// accountSuspended rejects the requests of suspended users, and revokes their token if
+// RevokeSuspendedTokens is set.
+func (mw *JWTMiddleware) accountSuspended(writer rest.ResponseWriter, request *rest.Request) bool {
+	userId, _ := request.Env["REMOTE_USER"].(string)
+	claims := ExtractClaims(request)
+	if !mw.suspended(userId, claims) {
+		return false
+	}
+	mw.Metrics.IncCounter("suspended_requests")
+
+	if mw.RevokeSuspendedTokens {
+		mw.revokeSuspendedToken(request, userId, claims)
+	}
+	errorWithCode(writer, errAccountSuspended.Message, errAccountSuspended.Code, http.StatusForbidden)
+	return true
+}
+
+// suspended reports whether the user with the token claims is suspended, according to the
+// SuspendedClaim or the SuspensionChecker.
+func (mw *JWTMiddleware) suspended(userId string, claims map[string]interface{}) bool {
+	switch suspended := claims[mw.SuspendedClaim].(type) {
+	case bool:
+		if suspended {
+			return true
+		}
+	case string:
+		if suspended == "true" {
+			return true
+		}
+	}
+	return mw.SuspensionChecker != nil && mw.SuspensionChecker(userId)
+}
+
+// revokeSuspendedToken revokes the token of a request and rejects the other tokens of its token
+// family, which may be refreshed until MaxRefresh has passed.
+func (mw *JWTMiddleware) revokeSuspendedToken(request *rest.Request, userId string, claims map[string]interface{}) {
+	if tokenString, err := mw.extractToken(request); err == nil {
+		// fails for the tokens of the AdditionalVerifiers, which aren't revoked
+		mw.RevokeToken(tokenString)
+	}
+	keys := []string{"token:" + ExtractTokenId(request), "family:" + tokenFamily(userId, claims)}
+	mw.denyLoggedOut(keys, mw.Clock.Now().Add(mw.Timeout+mw.MaxRefresh))
+	mw.Metrics.IncCounter("suspended_tokens_revoked")
+}
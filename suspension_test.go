@@ -0,0 +1,147 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestAccountSuspension(t *testing.T) {
+	suspended := map[string]bool{}
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		MaxRefresh:    24 * time.Hour,
+		Authenticator: rejectLogin,
+		SuspensionChecker: func(userId string) bool {
+			return suspended[userId]
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {}))
+	handler := api.MakeHandler()
+	request := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "bob"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["iat"] = time.Now().Unix()
+	token.Claims["suspended"] = true
+	suspendedToken, _ := token.SignedString(key)
+	recorded := request(suspendedToken)
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Account suspended","code":"account_suspended"}`)
+
+	tokenString := makeTokenString("admin", key)
+	request(tokenString).CodeIs(200)
+	suspended["admin"] = true
+	request(tokenString).CodeIs(403)
+	suspended["admin"] = false
+	request(tokenString).CodeIs(200)
+
+	info, err := authMiddleware.Authenticate(suspendedToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := authMiddleware.Check(info, "read", "report"); err != errAccountSuspended {
+		t.Errorf("Check should reject suspended users, got %v", err)
+	}
+}
+
+func TestRevokeSuspendedTokens(t *testing.T) {
+	suspended := map[string]bool{}
+	authMiddleware := &JWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		MaxRefresh:      24 * time.Hour,
+		Authenticator:   rejectLogin,
+		RevocationStore: NewMemoryRevocationStore(),
+		SuspensionChecker: func(userId string) bool {
+			return suspended[userId]
+		},
+		RevokeSuspendedTokens: true,
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	router, _ := rest.MakeRouter(
+		rest.Get("/", func(w rest.ResponseWriter, r *rest.Request) {}),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+	request := func(url string, tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", url, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["id"] = "admin"
+	token.Claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token.Claims["orig_iat"] = time.Now().Add(-time.Minute).Unix()
+	tokenString, _ := token.SignedString(key)
+
+	recorded := request("http://localhost/refresh", tokenString)
+	recorded.CodeIs(200)
+	refreshed := DecoderToken{}
+	recorded.DecodeJsonPayload(&refreshed)
+
+	suspended["admin"] = true
+	request("http://localhost/", tokenString).CodeIs(403)
+	if revoked := authMiddleware.RevocationStore.(*memoryRevocationStore).RevokedKeys(); len(revoked) != 1 {
+		t.Errorf("The token should be revoked in the RevocationStore, got %v", revoked)
+	}
+
+	// once the suspension is lifted, the user has to log in again
+	suspended["admin"] = false
+	request("http://localhost/", tokenString).CodeIs(401)
+	request("http://localhost/", refreshed.Token).CodeIs(401)
+	// a new login
+	request("http://localhost/", makeTokenString("admin", key)).CodeIs(200)
+}
+
+func TestSuspensionOfAuthRequests(t *testing.T) {
+	suspended := map[string]bool{}
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: rejectLogin,
+		SuspensionChecker: func(userId string) bool {
+			return suspended[userId]
+		},
+	}
+
+	authApi := rest.NewApi()
+	authApi.SetApp(rest.AppSimple(authMiddleware.AuthRequestHandler))
+	verifyApi := rest.NewApi()
+	verifyApi.SetApp(rest.AppSimple(authMiddleware.VerifyHandler))
+	request := func(api *rest.Api) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/auth", nil)
+		req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+		req.Header.Set("X-Original-Method", "GET")
+		req.Header.Set("X-Original-URI", "/reports")
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request(authApi).CodeIs(200)
+	request(verifyApi).CodeIs(204)
+
+	suspended["admin"] = true
+	recorded := request(authApi)
+	recorded.CodeIs(403)
+	recorded.HeaderIs("X-Auth-User", "")
+	recorded.BodyIs(`{"Error":"Account suspended","code":"account_suspended"}`)
+	request(verifyApi).CodeIs(403)
+}
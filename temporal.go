@@ -0,0 +1,126 @@
+package jwt
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// TemporalPolicy restricts when tokens may be used, in the time zone of the user. The schedule is
+// evaluated on every request, so that tokens issued during the allowed hours stop working when
+// they end.
+type TemporalPolicy struct {
+	// Callback function that reports whether the policy applies to a token, e.g. whether its
+	// "role" claim is "contractor". Optional, by default the policy applies to all tokens.
+	Applies func(claims map[string]interface{}) bool
+
+	// Time of day from which tokens may be used, as duration since midnight, e.g. 8 * time.Hour.
+	// Start and End are both zero if tokens may be used all day long.
+	Start time.Duration
+
+	// Time of day until which tokens may be used, e.g. 18 * time.Hour. If it is before Start, the
+	// allowed hours span midnight.
+	End time.Duration
+
+	// Days on which tokens may be used, in the time zone of the user.
+	// Optional, by default tokens may be used every day.
+	Weekdays []time.Weekday
+
+	// Name of the claim holding the IANA time zone of the user, e.g. "Europe/Berlin".
+	// Optional, defaults to "tz".
+	TimeZoneClaim string
+
+	// Time zone of the users whose tokens lack the TimeZoneClaim. Optional, defaults to UTC.
+	Location *time.Location
+}
+
+// locations caches the time zones loaded for the TimeZoneClaim of tokens.
+var locations sync.Map
+
+// outsideSchedule rejects the requests made outside of the schedule of a TemporalPolicy that
+// applies to their token.
+func (mw *JWTMiddleware) outsideSchedule(writer rest.ResponseWriter, request *rest.Request) bool {
+	if len(mw.TemporalPolicies) == 0 {
+		return false
+	}
+	if err := mw.checkSchedule(ExtractClaims(request)); err != nil {
+		errorWithCode(writer, err.Message, err.Code, http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
+// checkSchedule returns an error if the token with claims may not be used now according to the
+// TemporalPolicies that apply to it.
+func (mw *JWTMiddleware) checkSchedule(claims map[string]interface{}) *AuthorizationError {
+	now := mw.Clock.Now()
+	for _, policy := range mw.TemporalPolicies {
+		if policy.Applies != nil && !policy.Applies(claims) {
+			continue
+		}
+		if err := policy.check(claims, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check returns an error if the token with claims may not be used at now.
+func (p *TemporalPolicy) check(claims map[string]interface{}, now time.Time) *AuthorizationError {
+	location := p.Location
+	if tz, ok := claims[p.TimeZoneClaim].(string); ok && tz != "" {
+		var err error
+		if location, err = loadLocation(tz); err != nil {
+			return &AuthorizationError{Message: "Invalid time zone", Code: "invalid_time_zone"}
+		}
+	}
+	local := now.In(location)
+
+	if len(p.Weekdays) > 0 && !containsWeekday(p.Weekdays, local.Weekday()) {
+		return &AuthorizationError{Message: "Access not allowed on this day", Code: "outside_allowed_days"}
+	}
+
+	if p.Start == 0 && p.End == 0 {
+		return nil
+	}
+	// wall clock time, which differs from the time elapsed since midnight on DST changes
+	hour, minute, second := local.Clock()
+	sinceMidnight := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second
+	allowed := sinceMidnight >= p.Start && sinceMidnight < p.End
+	if p.End < p.Start {
+		allowed = sinceMidnight >= p.Start || sinceMidnight < p.End
+	}
+	if !allowed {
+		return &AuthorizationError{Message: "Access not allowed at this time", Code: "outside_allowed_hours"}
+	}
+	return nil
+}
+
+// loadLocation returns the time zone with the given IANA name, which is loaded once.
+func loadLocation(name string) (*time.Location, error) {
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+	if name == "Local" {
+		// the time zone of the server isn't the one of the user
+		return nil, errors.New("Unknown time zone Local")
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, location)
+	return location, nil
+}
+
+func containsWeekday(weekdays []time.Weekday, weekday time.Weekday) bool {
+	for _, w := range weekdays {
+		if w == weekday {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestTemporalPolicies(t *testing.T) {
+	// Monday 2024-01-08, 09:30 UTC
+	clock := &frozenClock{now: time.Date(2024, 1, 8, 9, 30, 0, 0, time.UTC)}
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Clock:         clock,
+		Authenticator: rejectLogin,
+		TemporalPolicies: []TemporalPolicy{{
+			Applies: func(claims map[string]interface{}) bool {
+				return claims["role"] == "contractor"
+			},
+			Start:    8 * time.Hour,
+			End:      18 * time.Hour,
+			Weekdays: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		}},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {}))
+	handler := api.MakeHandler()
+	request := func(claims map[string]interface{}) *test.Recorded {
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "admin"
+		token.Claims["exp"] = clock.now.Add(time.Hour).Unix()
+		token.Claims["iat"] = clock.now.Unix()
+		for name, value := range claims {
+			token.Claims[name] = value
+		}
+		tokenString, _ := token.SignedString(key)
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	request(map[string]interface{}{"role": "contractor"}).CodeIs(200)
+	// 09:30 UTC is 18:30 in Tokyo
+	recorded := request(map[string]interface{}{"role": "contractor", "tz": "Asia/Tokyo"})
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Access not allowed at this time","code":"outside_allowed_hours"}`)
+	// 04:30 in New York
+	request(map[string]interface{}{"role": "contractor", "tz": "America/New_York"}).CodeIs(403)
+	request(map[string]interface{}{"role": "contractor", "tz": "Europe/Berlin"}).CodeIs(200)
+
+	recorded = request(map[string]interface{}{"role": "contractor", "tz": "Mars/Olympus_Mons"})
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Invalid time zone","code":"invalid_time_zone"}`)
+	request(map[string]interface{}{"role": "contractor", "tz": "Local"}).CodeIs(403)
+
+	// employees aren't restricted
+	request(map[string]interface{}{"role": "employee", "tz": "Asia/Tokyo"}).CodeIs(200)
+
+	// Saturday
+	clock.now = clock.now.Add(5 * 24 * time.Hour)
+	recorded = request(map[string]interface{}{"role": "contractor"})
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Access not allowed on this day","code":"outside_allowed_days"}`)
+}
+
+func TestTemporalPolicyOvernight(t *testing.T) {
+	policy := TemporalPolicy{Start: 22 * time.Hour, End: 6 * time.Hour, TimeZoneClaim: "tz", Location: time.UTC}
+	for hour, allowed := range map[int]bool{21: false, 22: true, 23: true, 0: true, 5: true, 6: false, 12: false} {
+		now := time.Date(2024, 1, 8, hour, 0, 0, 0, time.UTC)
+		if err := policy.check(map[string]interface{}{}, now); (err == nil) != allowed {
+			t.Errorf("At %02d:00 allowed should be %v, got %v", hour, allowed, err)
+		}
+	}
+}
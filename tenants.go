@@ -0,0 +1,128 @@
+package jwt
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// switchTenant is the payload of SwitchTenantHandler.
+type switchTenant struct {
+	Tenant string `json:"tenant"`
+}
+
+// SwitchTenantHandler issues a token scoped to another tenant (organization) of the user without
+// asking for credentials again. It needs to be put under an endpoint that is using the
+// JWTMiddleware, and responds with a 404 unless TenantFunc is set.
+// Payload needs to be json in the form of {"tenant": "TENANT"}. The new token has the claims of
+// the current one, the tenant in TenantClaim and the claims returned by TenantFunc, a new "jti"
+// and "iat", and expires with the current token, so that switching tenants doesn't extend
+// sessions. The current token
+// is revoked if RevokeOnTenantSwitch is set.
+// Reply will be of the form {"token": "TOKEN"}, or a 403 with the "tenant_forbidden" error code if
+// the user doesn't belong to the tenant.
+func (mw *JWTMiddleware) SwitchTenantHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.initDefaults()
+	writer = mw.encodeResponses(writer, request)
+	defer mw.recoverHandlerPanic(writer, request)
+
+	if mw.TenantFunc == nil {
+		rest.NotFound(writer, request)
+		return
+	}
+
+	if mw.handleCORS(writer, request) {
+		return
+	}
+
+	if mw.crossSiteRequest(writer, request) {
+		return
+	}
+
+	token, err := mw.parseToken(request)
+	if err != nil {
+		mw.unauthorizedError(writer, err)
+		return
+	}
+	userId, err := mw.IdentityHandler(token.Claims)
+	if err != nil {
+		mw.unauthorized(writer)
+		return
+	}
+
+	payload := switchTenant{}
+	if err := json.NewDecoder(io.LimitReader(request.Body, mw.MaxLoginPayloadSize)).Decode(&payload); err != nil || payload.Tenant == "" {
+		rest.Error(writer, "Invalid tenant", http.StatusBadRequest)
+		return
+	}
+	io.Copy(ioutil.Discard, request.Body)
+
+	tenantClaims, ok := mw.TenantFunc(userId, payload.Tenant)
+	if !ok {
+		errorWithCode(writer, "Not a member of the tenant", "tenant_forbidden", http.StatusForbidden)
+		return
+	}
+
+	format := mw.tokenFormat(userId)
+	newToken := jwt.New(jwt.GetSigningMethod(format.SigningAlgorithm))
+	for key, value := range token.Claims {
+		newToken.Claims[key] = value
+	}
+	for key, value := range tenantClaims {
+		newToken.Claims[key] = value
+	}
+	// the claims identifying the user and the lifetime of the token stay the same
+	for _, key := range []string{"id", "exp", "orig_iat", "refresh_count", "sid", "token_use"} {
+		if value, ok := token.Claims[key]; ok {
+			newToken.Claims[key] = value
+		} else {
+			delete(newToken.Claims, key)
+		}
+	}
+	// the new token is told apart from the current one, which RevokeOnTenantSwitch revokes by jti
+	jti, err := newTokenId(mw.RandReader)
+	if err != nil {
+		mw.unauthorized(writer)
+		return
+	}
+	newToken.Claims["jti"] = jti
+	newToken.Claims["iat"] = mw.Clock.Now().Unix()
+	newToken.Claims[mw.TenantClaim] = payload.Tenant
+	newToken.Claims["token_use"] = TokenUseAccess
+	mw.setFingerprint(newToken, request)
+	if mw.AccessTokenProfile {
+		if err := mw.setAccessTokenProfileClaims(newToken, userId); err != nil {
+			mw.unauthorized(writer)
+			return
+		}
+	}
+
+	if !mw.validIssuedClaims(writer, request, newToken.Claims) {
+		return
+	}
+
+	tokenString, err := mw.signToken(newToken, format, userId)
+	if err != nil {
+		mw.unauthorized(writer)
+		return
+	}
+
+	mw.storeToken(userId, tokenString)
+	mw.recordActivity(tokenString)
+	mw.saveSession(userId, newToken, request)
+
+	if mw.RevokeOnTenantSwitch {
+		mw.removeToken(userId, token.Raw)
+		if err := mw.RevokeToken(token.Raw); err != nil {
+			mw.unauthorizedError(writer, err)
+			return
+		}
+	}
+
+	mw.exposeIssuedUser(request, userId)
+	mw.RefreshCallback(tokenString, request, writer)
+}
@@ -0,0 +1,122 @@
+package jwt
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestSwitchTenant(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+	newHandler := func(revoke bool) http.Handler {
+		authMiddleware := &JWTMiddleware{
+			Realm:                "test zone",
+			Key:                  key,
+			Timeout:              time.Hour,
+			MaxRefresh:           time.Hour * 24,
+			Clock:                clock,
+			RevocationStore:      NewMemoryRevocationStore(),
+			RevokeOnTenantSwitch: revoke,
+			PayloadFunc: func(userId string) map[string]interface{} {
+				return map[string]interface{}{"jti": "login"}
+			},
+			TenantFunc: func(userId string, tenant string) (map[string]interface{}, bool) {
+				if tenant != "acme" {
+					return nil, false
+				}
+				return map[string]interface{}{"role": "owner", "exp": 0}, true
+			},
+			Authenticator: func(userId string, password string) bool {
+				return true
+			},
+		}
+
+		api := rest.NewApi()
+		api.Use(&rest.IfMiddleware{
+			Condition: func(request *rest.Request) bool {
+				return request.URL.Path != "/login"
+			},
+			IfTrue: authMiddleware,
+		})
+		router, _ := rest.MakeRouter(
+			rest.Post("/login", authMiddleware.LoginHandler),
+			rest.Post("/tenant", authMiddleware.SwitchTenantHandler),
+			rest.Get("/", func(writer rest.ResponseWriter, request *rest.Request) {
+				writer.WriteJson(ExtractClaims(request))
+			}),
+		)
+		api.SetApp(router)
+		return api.MakeHandler()
+	}
+
+	for _, revoke := range []bool{false, true} {
+		handler := newHandler(revoke)
+
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"}))
+		recorded.CodeIs(200)
+		token := DecoderToken{}
+		recorded.DecodeJsonPayload(&token)
+		oldToken := token.Token
+
+		switchTenant := func(tenant interface{}) *test.Recorded {
+			req := test.MakeSimpleRequest("POST", "http://localhost/tenant", tenant)
+			req.Header.Set("Authorization", "Bearer "+oldToken)
+			return test.RunRequest(t, handler, req)
+		}
+
+		switchTenant(map[string]string{"tenant": "initech"}).CodeIs(403)
+		switchTenant(map[string]string{}).CodeIs(400)
+
+		clock.now = clock.now.Add(time.Minute)
+		recorded = switchTenant(map[string]string{"tenant": "acme"})
+		recorded.CodeIs(200)
+		token = DecoderToken{}
+		recorded.DecodeJsonPayload(&token)
+
+		parsed, err := jwt.Parse(token.Token, func(*jwt.Token) (interface{}, error) { return key, nil })
+		if err != nil {
+			t.Fatalf("The tenant token should be valid, got %v", err)
+		}
+		oldParsed, _ := jwt.Parse(oldToken, func(*jwt.Token) (interface{}, error) { return key, nil })
+		if parsed.Claims["tenant"] != "acme" || parsed.Claims["role"] != "owner" || parsed.Claims["id"] != "admin" {
+			t.Errorf("The tenant token should carry the tenant claims, got %v", parsed.Claims)
+		}
+		if parsed.Claims["exp"] != oldParsed.Claims["exp"] || parsed.Claims["orig_iat"] != oldParsed.Claims["orig_iat"] {
+			t.Errorf("Switching tenants shouldn't extend the token, got %v", parsed.Claims)
+		}
+		if parsed.Claims["jti"] == oldParsed.Claims["jti"] || parsed.Claims["iat"] != float64(clock.now.Unix()) {
+			t.Errorf("The tenant token should have its own jti and iat, got %v", parsed.Claims)
+		}
+
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+		test.RunRequest(t, handler, req).CodeIs(200)
+
+		req = test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+oldToken)
+		if revoke {
+			test.RunRequest(t, handler, req).CodeIs(401)
+		} else {
+			test.RunRequest(t, handler, req).CodeIs(200)
+		}
+	}
+
+	// without TenantFunc, there are no tenants to switch to
+	authMiddleware := &JWTMiddleware{Realm: "test zone", Key: key, Authenticator: rejectLogin}
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(authMiddleware.SwitchTenantHandler))
+	req := test.MakeSimpleRequest("POST", "http://localhost/", map[string]string{"tenant": "acme"})
+	req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+	test.RunRequest(t, api.MakeHandler(), req).CodeIs(404)
+
+	// revoking requires a store
+	authMiddleware = &JWTMiddleware{Realm: "test zone", Key: key, Authenticator: rejectLogin, RevokeOnTenantSwitch: true, TenantFunc: func(string, string) (map[string]interface{}, bool) { return nil, true }}
+	if err := authMiddleware.Init(); err == nil {
+		t.Error("RevokeOnTenantSwitch without RevocationStore should be rejected")
+	}
+}
@@ -0,0 +1,103 @@
+package jwt
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// loginThrottled is the response body of logins denied by the lockout, and of failed logins
+// while MaxLoginAttempts is set.
+type loginThrottled struct {
+	Error             string     `json:"Error"`
+	Code              string     `json:"code,omitempty"`
+	RetryAfterSeconds int64      `json:"retry_after_seconds,omitempty"`
+	AttemptsRemaining int        `json:"attempts_remaining"`
+	LockoutUntil      *time.Time `json:"lockout_until,omitempty"`
+}
+
+type loginAttempts struct {
+	failures    int
+	lockedUntil time.Time
+}
+
+// loginThrottle counts the failed logins of each user and locks users out after too many.
+type loginThrottle struct {
+	mutex sync.Mutex
+	cache *ttlCache
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{cache: newTTLCache()}
+}
+
+func (lt *loginThrottle) get(userId string) loginAttempts {
+	attempts, ok := lt.cache.Get(userId)
+	if !ok {
+		return loginAttempts{}
+	}
+	return attempts.(loginAttempts)
+}
+
+// lockedUntil returns the end of the lockout of userId, which is in the past if the user isn't
+// locked out.
+func (lt *loginThrottle) lockedUntil(userId string) time.Time {
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+
+	return lt.get(userId).lockedUntil
+}
+
+// fail records a failed login and returns the remaining attempts of userId along with the end of
+// the lockout once there are none left.
+func (lt *loginThrottle) fail(userId string, now time.Time, maxAttempts int, lockout time.Duration) (int, time.Time) {
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+
+	attempts := lt.get(userId)
+	attempts.failures++
+	if attempts.failures >= maxAttempts {
+		attempts = loginAttempts{lockedUntil: now.Add(lockout)}
+		lt.cache.Set(userId, attempts, lockout)
+		return 0, attempts.lockedUntil
+	}
+	lt.cache.Set(userId, attempts, lockout)
+	return maxAttempts - attempts.failures, time.Time{}
+}
+
+func (lt *loginThrottle) reset(userId string) {
+	lt.cache.Delete(userId)
+}
+
+// loginLocked denies the login of a locked out user with 429 and the time at which to retry.
+func (mw *JWTMiddleware) loginLocked(writer rest.ResponseWriter, lockedUntil time.Time) {
+	mw.Metrics.IncCounter("logins_throttled")
+
+	retryAfter := int64(lockedUntil.Sub(mw.Clock.Now()) / time.Second)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	lockedUntil = lockedUntil.UTC()
+
+	writer.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	writer.WriteHeader(http.StatusTooManyRequests)
+	writer.WriteJson(loginThrottled{
+		Error:             "Too many failed login attempts",
+		RetryAfterSeconds: retryAfter,
+		LockoutUntil:      &lockedUntil,
+	})
+}
+
+// loginFailed denies a login with 401, reporting the attempts left before the lockout.
+func (mw *JWTMiddleware) loginFailed(writer rest.ResponseWriter, attemptsRemaining int) {
+	mw.challenge(writer, "")
+	writer.WriteHeader(http.StatusUnauthorized)
+	writer.WriteJson(loginThrottled{
+		Error:             "Not Authorized",
+		Code:              CodeNotAuthorized,
+		AttemptsRemaining: attemptsRemaining,
+	})
+}
@@ -0,0 +1,64 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestLoginLockout(t *testing.T) {
+	clock := &frozenClock{now: time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)}
+	metrics := newCountingMetrics()
+
+	authMiddleware := &JWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Timeout:          time.Hour,
+		MaxLoginAttempts: 3,
+		LockoutDuration:  10 * time.Minute,
+		Clock:            clock,
+		Metrics:          metrics,
+		Authenticator: func(userId string, password string) bool {
+			return password == "admin"
+		},
+	}
+
+	api := rest.NewApi()
+	api.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+
+	login := func(userId, password string) *test.Recorded {
+		loginCreds := map[string]string{"username": userId, "password": password}
+		return test.RunRequest(t, api.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	}
+
+	recorded := login("admin", "wrong")
+	recorded.CodeIs(401)
+	recorded.HeaderIs("WWW-Authenticate", "JWT realm=test zone")
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"not_authorized","attempts_remaining":2}`)
+
+	// a successful login resets the count
+	login("admin", "admin").CodeIs(200)
+	login("admin", "wrong").BodyIs(`{"Error":"Not Authorized","code":"not_authorized","attempts_remaining":2}`)
+	login("admin", "wrong").BodyIs(`{"Error":"Not Authorized","code":"not_authorized","attempts_remaining":1}`)
+
+	recorded = login("admin", "wrong")
+	recorded.CodeIs(429)
+	recorded.HeaderIs("Retry-After", "600")
+	recorded.BodyIs(`{"Error":"Too many failed login attempts","retry_after_seconds":600,"attempts_remaining":0,"lockout_until":"2015-10-21T16:39:00Z"}`)
+
+	// the right password doesn't help during the lockout, other users aren't affected
+	clock.now = clock.now.Add(9 * time.Minute)
+	recorded = login("admin", "admin")
+	recorded.CodeIs(429)
+	recorded.HeaderIs("Retry-After", "60")
+	login("other", "admin").CodeIs(200)
+
+	clock.now = clock.now.Add(time.Minute + time.Second)
+	login("admin", "admin").CodeIs(200)
+
+	if metrics.counter("logins_throttled") != 2 {
+		t.Errorf("Expected 2 throttled logins, got %d", metrics.counter("logins_throttled"))
+	}
+}
@@ -0,0 +1,70 @@
+package jwt
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// callbackPanic carries a panic of a callback run by callWithTimeout back to the request goroutine.
+type callbackPanic struct {
+	recovered interface{}
+}
+
+// callWithTimeout runs callback and waits for at most CallbackTimeout for it to return. It reports
+// whether the callback returned in time, a callback that didn't keeps running in the background.
+// Panics of the callback are propagated to the caller.
+func (mw *JWTMiddleware) callWithTimeout(callback func()) bool {
+	if mw.CallbackTimeout == 0 {
+		callback()
+		return true
+	}
+
+	done := make(chan *callbackPanic, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- &callbackPanic{recovered}
+			}
+		}()
+		callback()
+		done <- nil
+	}()
+
+	timer := time.NewTimer(mw.CallbackTimeout)
+	defer timer.Stop()
+
+	select {
+	case p := <-done:
+		if p != nil {
+			panic(p.recovered)
+		}
+		return true
+	case <-timer.C:
+		mw.Metrics.IncCounter("callback_timeouts")
+		return false
+	}
+}
+
+// authenticate calls the Authenticator, ok is false if it timed out.
+func (mw *JWTMiddleware) authenticate(userId string, password string) (bool, bool) {
+	authenticated := false
+	if !mw.callWithTimeout(func() { authenticated = mw.Authenticator(userId, password) }) {
+		return false, false
+	}
+	return authenticated, true
+}
+
+// authorize calls the Authorizator, ok is false if it timed out.
+func (mw *JWTMiddleware) authorize(userId string, request *rest.Request) (bool, bool) {
+	authorized := false
+	if !mw.callWithTimeout(func() { authorized = mw.Authorizator(userId, request) }) {
+		return false, false
+	}
+	return authorized, true
+}
+
+func callbackTimedOut(writer rest.ResponseWriter) {
+	errorWithCode(writer, "Service Unavailable", "callback_timeout", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,66 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestCallbackTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+	metrics := newCountingMetrics()
+
+	authMiddleware := &JWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		CallbackTimeout: 50 * time.Millisecond,
+		Metrics:         metrics,
+		Authenticator: func(userId string, password string) bool {
+			if userId == "hang" {
+				<-hang
+			}
+			return true
+		},
+		Authorizator: func(userId string, request *rest.Request) bool {
+			if request.Method == "POST" {
+				<-hang
+			}
+			return request.Method != "DELETE"
+		},
+	}
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(authMiddleware.LoginHandler))
+	login := func(userId string) *test.Recorded {
+		loginCreds := map[string]string{"username": userId, "password": "secret"}
+		return test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", loginCreds))
+	}
+
+	login("admin").CodeIs(200)
+	recorded := login("hang")
+	recorded.CodeIs(503)
+	recorded.BodyIs(`{"Error":"Service Unavailable","code":"callback_timeout"}`)
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	request := func(method string) *test.Recorded {
+		req := test.MakeSimpleRequest(method, "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+makeTokenString("admin", key))
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	request("GET").CodeIs(200)
+	request("DELETE").CodeIs(401)
+	request("POST").CodeIs(503)
+
+	if metrics.counter("callback_timeouts") != 2 {
+		t.Errorf("Expected 2 callback timeouts, got %d", metrics.counter("callback_timeouts"))
+	}
+}
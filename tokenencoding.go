@@ -0,0 +1,97 @@
+package jwt
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// ErrInvalidTokenEncoding is returned for tokens whose transport encoding can't be undone by the
+// TokenDecoders with StrictTokenDecoding.
+var ErrInvalidTokenEncoding = errors.New("Invalid token encoding")
+
+// TokenDecoder undoes an encoding legacy clients wrap tokens in, e.g. quotes. If strict is false,
+// tokens without the encoding are returned unchanged, otherwise they are rejected with
+// ErrInvalidTokenEncoding.
+type TokenDecoder func(tokenString string, strict bool) (string, error)
+
+// UnquoteToken removes the double quotes around a token, e.g. "eyJ...".
+func UnquoteToken(tokenString string, strict bool) (string, error) {
+	if len(tokenString) >= 2 && strings.HasPrefix(tokenString, `"`) && strings.HasSuffix(tokenString, `"`) {
+		return tokenString[1 : len(tokenString)-1], nil
+	}
+	if strict {
+		return "", ErrInvalidTokenEncoding
+	}
+	return tokenString, nil
+}
+
+// URLDecodeToken decodes a percent-encoded token, e.g. eyJ...%2EeyJ.... Plus signs are kept, they
+// aren't part of base64url. Tokens with invalid escapes are rejected if strict is set.
+func URLDecodeToken(tokenString string, strict bool) (string, error) {
+	decoded, err := url.PathUnescape(tokenString)
+	if err != nil {
+		if strict {
+			return "", ErrInvalidTokenEncoding
+		}
+		return tokenString, nil
+	}
+	return decoded, nil
+}
+
+// StripTokenWrapping returns a TokenDecoder removing the given prefix and suffix around a token,
+// e.g. StripTokenWrapping("token=", ";").
+func StripTokenWrapping(prefix, suffix string) TokenDecoder {
+	return func(tokenString string, strict bool) (string, error) {
+		if len(tokenString) >= len(prefix)+len(suffix) && strings.HasPrefix(tokenString, prefix) && strings.HasSuffix(tokenString, suffix) {
+			return tokenString[len(prefix) : len(tokenString)-len(suffix)], nil
+		}
+		if strict {
+			return "", ErrInvalidTokenEncoding
+		}
+		return tokenString, nil
+	}
+}
+
+// extractToken reads the token of the request with the TokenExtractor and undoes its transport
+// encodings with the TokenDecoders.
+func (mw *JWTMiddleware) extractToken(request *rest.Request) (string, error) {
+	tokenString, err := mw.TokenExtractor(request)
+	if err != nil {
+		return "", tokenMissingError{err}
+	}
+	return mw.decodeToken(tokenString)
+}
+
+// decodeToken runs the TokenDecoders in order. With StrictTokenDecoding, the decoded token must
+// consist of base64url segments.
+func (mw *JWTMiddleware) decodeToken(tokenString string) (string, error) {
+	if len(mw.TokenDecoders) == 0 {
+		return tokenString, nil
+	}
+	for _, decoder := range mw.TokenDecoders {
+		var err error
+		if tokenString, err = decoder(tokenString, mw.StrictTokenDecoding); err != nil {
+			return "", err
+		}
+	}
+	if mw.StrictTokenDecoding && !isBase64URLToken(tokenString) {
+		return "", ErrInvalidTokenEncoding
+	}
+	return tokenString, nil
+}
+
+// isBase64URLToken reports whether a token only consists of dot separated base64url segments.
+func isBase64URLToken(tokenString string) bool {
+	if tokenString == "" {
+		return false
+	}
+	for _, c := range tokenString {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package jwt
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+func TestTokenDecoders(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: rejectLogin,
+		TokenDecoders: []TokenDecoder{URLDecodeToken, UnquoteToken, StripTokenWrapping("<", ">")},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {}))
+	handler := api.MakeHandler()
+	request := func(header string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+header)
+		return test.RunRequest(t, handler, req)
+	}
+
+	tokenString := makeTokenString("admin", key)
+	wrapped := `"<` + tokenString + `>"`
+	request(tokenString).CodeIs(200)
+	request(wrapped).CodeIs(200)
+	request(url.PathEscape(wrapped)).CodeIs(200)
+	request(`"` + tokenString + `"`).CodeIs(200)
+	request(`"<` + tokenString + `"`).CodeIs(401)
+
+	// strictly, every encoding must be there
+	authMiddleware.StrictTokenDecoding = true
+	request(url.PathEscape(wrapped)).CodeIs(200)
+	request(wrapped).CodeIs(200)
+	recorded := request(`"` + tokenString + `"`)
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"not_authorized","detail":"Invalid token encoding"}`)
+	request(tokenString).CodeIs(401)
+	request(`"<` + tokenString + ` >"`).CodeIs(401)
+	request(`%zz`).CodeIs(401)
+}
+
+func TestTokenDecoderFuncs(t *testing.T) {
+	cases := []struct {
+		decoder  TokenDecoder
+		input    string
+		strict   bool
+		expected string
+		err      error
+	}{
+		{UnquoteToken, `"a.b.c"`, true, "a.b.c", nil},
+		{UnquoteToken, `a.b.c`, false, "a.b.c", nil},
+		{UnquoteToken, `"`, true, "", ErrInvalidTokenEncoding},
+		{URLDecodeToken, "a%2Eb.c", true, "a.b.c", nil},
+		{URLDecodeToken, "a+b", true, "a+b", nil},
+		{URLDecodeToken, "a%zz", false, "a%zz", nil},
+		{URLDecodeToken, "a%zz", true, "", ErrInvalidTokenEncoding},
+		{StripTokenWrapping("token=", ";"), "token=a.b.c;", true, "a.b.c", nil},
+		{StripTokenWrapping("token=", ";"), "a.b.c", false, "a.b.c", nil},
+		{StripTokenWrapping("token=", ";"), "token=;", true, "", nil},
+		{StripTokenWrapping("ab", "ba"), "aba", true, "", ErrInvalidTokenEncoding},
+	}
+	for _, c := range cases {
+		decoded, err := c.decoder(c.input, c.strict)
+		if decoded != c.expected || err != c.err {
+			t.Errorf("Decoding %q (strict %v) should give %q, %v, got %q, %v", c.input, c.strict, c.expected, c.err, decoded, err)
+		}
+	}
+}
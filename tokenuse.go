@@ -0,0 +1,37 @@
+package jwt
+
+import "errors"
+
+// Values of the "token_use" claim, which tells the purpose of a token so that e.g. a refresh
+// token can't be used to call the API.
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+	TokenUseAction  = "action"
+
+	// TokenUseInternal is the token use of the tokens minted by MintInternalToken, which aren't
+	// accepted as access tokens.
+	TokenUseInternal = "internal"
+
+	// TokenUseLogout is the token use of the logout tickets minted by LogoutHandler.
+	TokenUseLogout = "logout"
+
+	// TokenUseBodyBound is the token use of the tokens minted by MintBodyBoundToken, which are
+	// only accepted by RequireBodyBoundToken.
+	TokenUseBodyBound = "body_bound"
+)
+
+// ErrInvalidTokenUse is returned for tokens whose "token_use" claim is not one of AcceptedTokenUses.
+var ErrInvalidTokenUse = errors.New("Invalid token use")
+
+// validTokenUse reports whether a token may be used as access token. Tokens without "token_use"
+// claim, e.g. issued before it was introduced, are accepted. Body bound tokens never are, even if
+// listed in AcceptedTokenUses.
+func (mw *JWTMiddleware) validTokenUse(claims map[string]interface{}) bool {
+	tokenUse, ok := claims["token_use"]
+	if !ok {
+		return true
+	}
+	tokenUseStr, ok := tokenUse.(string)
+	return ok && tokenUseStr != TokenUseBodyBound && containsString(mw.AcceptedTokenUses, tokenUseStr)
+}
@@ -0,0 +1,82 @@
+package jwt
+
+import (
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// traceRequest records the verification steps of the request in request.Env["JWT_TRACE"] as
+// []TokenCheck and, if TraceHeader is set, in the response header. The token is verified like
+// inspectToken does, independently of the actual verification, so tracing can't change the
+// outcome of a request.
+func (mw *JWTMiddleware) traceRequest(writer rest.ResponseWriter, request *rest.Request) {
+	trace := []TokenCheck{}
+
+	tokenString, err := mw.extractToken(request)
+	extractorCheck := TokenCheck{Name: "extractor", Passed: err == nil}
+	if err != nil {
+		extractorCheck.Error = err.Error()
+	}
+	trace = append(trace, extractorCheck)
+
+	if err == nil {
+		report, token, verifier := mw.inspectToken(tokenString)
+		trace = append(trace, report.Checks...)
+
+		if report.Valid {
+			fingerprintCheck := TokenCheck{Name: "fingerprint", Passed: true}
+			if err := verifier.checkFingerprint(token, request); err != nil {
+				fingerprintCheck = TokenCheck{Name: "fingerprint", Error: err.Error()}
+			}
+			trace = append(trace, fingerprintCheck)
+
+			if mw.RevocationList != nil || mw.RevocationStore != nil || verifier.RevocationList != nil || verifier.RevocationStore != nil {
+				revocationCheck := TokenCheck{Name: "revocation", Passed: true}
+				if err := mw.checkTokenRevocation(token, verifier); err != nil {
+					revocationCheck = TokenCheck{Name: "revocation", Error: err.Error()}
+				}
+				trace = append(trace, revocationCheck)
+			}
+
+			if verifier.InactivityTimeout != 0 {
+				// only read the activity, checkActivity records it
+				activityCheck := TokenCheck{Name: "activity", Passed: true}
+				lastSeen, ok := verifier.ActivityStore.LastSeen(activityStoreKey(token.Raw))
+				if !ok || verifier.Clock.Now().Sub(lastSeen) > verifier.InactivityTimeout {
+					activityCheck = TokenCheck{Name: "activity", Error: ErrInactiveToken.Error()}
+				}
+				trace = append(trace, activityCheck)
+			}
+		}
+	}
+
+	request.Env["JWT_TRACE"] = trace
+	if mw.TraceHeader != "" {
+		writer.Header().Set(mw.TraceHeader, formatTrace(trace))
+	}
+}
+
+// formatTrace formats a trace for a header, e.g. "extractor=ok, signature=ok (HS256, key default),
+// time=failed (Token is expired)".
+func formatTrace(trace []TokenCheck) string {
+	steps := make([]string, len(trace))
+	for i, check := range trace {
+		step := check.Name + "=ok"
+		if !check.Passed {
+			step = check.Name + "=failed"
+		}
+		details := []string{}
+		if check.Detail != "" {
+			details = append(details, check.Detail)
+		}
+		if check.Error != "" {
+			details = append(details, check.Error)
+		}
+		if len(details) > 0 {
+			step += " (" + strings.Join(details, ", ") + ")"
+		}
+		steps[i] = step
+	}
+	return strings.Join(steps, ", ")
+}
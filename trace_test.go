@@ -0,0 +1,73 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestTrace(t *testing.T) {
+	authMiddleware := &JWTMiddleware{
+		Realm:       "test zone",
+		Key:         key,
+		Timeout:     time.Hour,
+		Trace:       true,
+		TraceHeader: "X-JWT-Trace",
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	var trace []TokenCheck
+	api := rest.NewApi()
+	api.Use(rest.MiddlewareSimple(func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return func(writer rest.ResponseWriter, request *rest.Request) {
+			handler(writer, request)
+			trace, _ = request.Env["JWT_TRACE"].([]TokenCheck)
+		}
+	}))
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	request := func(authHeader string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		return test.RunRequest(t, api.MakeHandler(), req)
+	}
+
+	recorded := request("Bearer " + makeTokenString("admin", key))
+	recorded.CodeIs(200)
+	recorded.HeaderIs("X-JWT-Trace", "extractor=ok, signature=ok (HS256 default), time=ok, token_use=ok, issuer=ok, audience=ok, identity=ok, fingerprint=ok")
+	if len(trace) != 8 {
+		t.Errorf("Trace should record 8 steps, got %v", trace)
+	}
+
+	recorded = request("")
+	recorded.CodeIs(401)
+	recorded.HeaderIs("X-JWT-Trace", "extractor=failed (Auth header empty)")
+
+	expired := jwt.New(jwt.GetSigningMethod("HS256"))
+	expired.Claims["id"] = "admin"
+	expired.Claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	expired.Claims["iat"] = time.Now().Unix()
+	expiredString, _ := expired.SignedString(key)
+	recorded = request("Bearer " + expiredString)
+	recorded.CodeIs(401)
+	recorded.HeaderIs("X-JWT-Trace", "extractor=ok, signature=ok (HS256 default), time=failed (Token is expired), token_use=ok, issuer=ok, audience=ok, identity=ok")
+	if len(trace) != 7 || trace[2].Name != "time" || trace[2].Passed {
+		t.Errorf("Trace should record the failed time check, got %v", trace)
+	}
+
+	forged, _ := expired.SignedString([]byte("other key"))
+	recorded = request("Bearer " + forged)
+	recorded.CodeIs(401)
+	if len(trace) < 2 || trace[1].Name != "signature" || trace[1].Passed || trace[1].Detail != "HS256" {
+		t.Errorf("Trace should record the failed signature check, got %v", trace)
+	}
+}
@@ -0,0 +1,39 @@
+package jwt
+
+import (
+	"time"
+
+	v1 "github.com/StephanDollberg/go-json-rest-middleware-jwt"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// Claims are the claims of a verified token.
+type Claims map[string]interface{}
+
+// ExtractClaims returns the claims of the token of an authenticated request.
+func ExtractClaims(request *rest.Request) Claims {
+	return Claims(v1.ExtractClaims(request))
+}
+
+// String returns the string claim name.
+func (c Claims) String(name string) (string, bool) {
+	value, ok := c[name].(string)
+	return value, ok
+}
+
+// Int64 returns the integer claim name, see v1.GetInt64.
+func (c Claims) Int64(name string) (int64, bool) {
+	return v1.GetInt64(c, name)
+}
+
+// Time returns the numeric date claim name, e.g. "exp" or "iat".
+func (c Claims) Time(name string) (time.Time, bool) {
+	return v1.GetTime(c, name)
+}
+
+// Strings returns the claim name as list of strings, accepting both a single string and an array
+// like the "aud" claim does.
+func (c Claims) Strings(name string) []string {
+	strs, _ := v1.GetStringSlice(c, name)
+	return strs
+}
@@ -0,0 +1,145 @@
+// Package jwt is version 2 of the JWT middleware for Go-Json-Rest. It is built on the v1 package,
+// whose JWTMiddleware keeps working unchanged, and adds:
+//
+//   - New, which returns configuration errors instead of calling log.Fatal on the first request
+//   - ErrorHandler, to write the error responses of the middleware and its handlers
+//   - Claims, typed accessors for the claims of the authenticated request
+//
+// Existing v1 middlewares are migrated with FromV1.
+package jwt
+
+import (
+	"encoding/json"
+
+	v1 "github.com/StephanDollberg/go-json-rest-middleware-jwt"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// Config is the configuration of the middleware. Its fields are documented on the v1 JWTMiddleware.
+type Config = v1.JWTMiddleware
+
+// ErrorHandler writes the response for an error of the middleware, where status is the HTTP
+// status code and message the error message of the default response.
+type ErrorHandler func(writer rest.ResponseWriter, request *rest.Request, status int, message string)
+
+// Middleware provides a JWT authentication middleware along with the login, refresh, verify and
+// auth request handlers.
+type Middleware struct {
+	*v1.JWTMiddleware
+
+	// Callback writing the error responses of the middleware and its handlers, e.g. to use the
+	// error format of the API. Headers like WWW-Authenticate and Retry-After are set before it is
+	// called.
+	// Optional, by default the v1 error responses are written.
+	ErrorHandler ErrorHandler
+}
+
+// New returns a Middleware for config, or an error if the configuration is invalid. The config
+// holds the state of the middleware and is used from then on, it must not be copied.
+func New(config *Config) (*Middleware, error) {
+	return FromV1(config)
+}
+
+// FromV1 returns a Middleware sharing the configuration and state of a v1 middleware, so that
+// both can be used side by side during a migration.
+func FromV1(mw *v1.JWTMiddleware) (*Middleware, error) {
+	if err := mw.Init(); err != nil {
+		return nil, err
+	}
+	return &Middleware{JWTMiddleware: mw}, nil
+}
+
+// V1 returns the underlying v1 middleware.
+func (mw *Middleware) V1() *v1.JWTMiddleware {
+	return mw.JWTMiddleware
+}
+
+// MiddlewareFunc makes Middleware implement the rest.Middleware interface.
+func (mw *Middleware) MiddlewareFunc(handler rest.HandlerFunc) rest.HandlerFunc {
+	return mw.handleErrors(mw.JWTMiddleware.MiddlewareFunc(passErrors(handler)))
+}
+
+// LoginHandler can be used by clients to get a jwt token, see the v1 LoginHandler.
+func (mw *Middleware) LoginHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.handleErrors(mw.JWTMiddleware.LoginHandler)(writer, request)
+}
+
+// RefreshHandler can be used to refresh a token, see the v1 RefreshHandler.
+func (mw *Middleware) RefreshHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.handleErrors(mw.JWTMiddleware.RefreshHandler)(writer, request)
+}
+
+// VerifyHandler checks the validity of a token, see the v1 VerifyHandler.
+func (mw *Middleware) VerifyHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.handleErrors(mw.JWTMiddleware.VerifyHandler)(writer, request)
+}
+
+// AuthRequestHandler authenticates subrequests of edge proxies, see the v1 AuthRequestHandler.
+func (mw *Middleware) AuthRequestHandler(writer rest.ResponseWriter, request *rest.Request) {
+	mw.handleErrors(mw.JWTMiddleware.AuthRequestHandler)(writer, request)
+}
+
+// RequireScopes returns a middleware rejecting requests without all of the given scopes, see the
+// v1 RequireScopes.
+func (mw *Middleware) RequireScopes(scopes ...string) rest.MiddlewareSimple {
+	requireScopes := mw.JWTMiddleware.RequireScopes(scopes...)
+	return func(handler rest.HandlerFunc) rest.HandlerFunc {
+		return mw.handleErrors(requireScopes(passErrors(handler)))
+	}
+}
+
+// handleErrors hands the error responses written by handler to the ErrorHandler. The handlers
+// wrapped by the middleware must be wrapped by passErrors, so that only the errors of the
+// middleware itself are handed over.
+func (mw *Middleware) handleErrors(handler rest.HandlerFunc) rest.HandlerFunc {
+	return func(writer rest.ResponseWriter, request *rest.Request) {
+		if mw.ErrorHandler == nil {
+			handler(writer, request)
+			return
+		}
+		handler(&errorWriter{ResponseWriter: writer, request: request, handler: mw.ErrorHandler}, request)
+	}
+}
+
+// passErrors calls handler with the writer wrapped by handleErrors, so that the responses of the
+// application, errors included, are written unchanged, and its writer still implements
+// http.ResponseWriter, http.Flusher and http.Hijacker.
+func passErrors(handler rest.HandlerFunc) rest.HandlerFunc {
+	return func(writer rest.ResponseWriter, request *rest.Request) {
+		if errorWriter, ok := writer.(*errorWriter); ok {
+			writer = errorWriter.ResponseWriter
+		}
+		handler(writer, request)
+	}
+}
+
+// errorWriter hands the error responses of the v1 middleware to an ErrorHandler.
+type errorWriter struct {
+	rest.ResponseWriter
+	request *rest.Request
+	handler ErrorHandler
+	status  int
+}
+
+func (w *errorWriter) WriteHeader(code int) {
+	if code >= 400 {
+		w.status = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *errorWriter) WriteJson(v interface{}) error {
+	if w.status == 0 {
+		return w.ResponseWriter.WriteJson(v)
+	}
+
+	body := struct{ Error string }{}
+	if data, err := json.Marshal(v); err == nil {
+		json.Unmarshal(data, &body)
+	}
+	status := w.status
+	w.status = 0
+	w.handler(w.ResponseWriter, w.request, status, body.Error)
+	return nil
+}
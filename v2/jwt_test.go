@@ -0,0 +1,127 @@
+package jwt
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "github.com/StephanDollberg/go-json-rest-middleware-jwt"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+var key = []byte("secret key")
+
+func makeTokenString(claims map[string]interface{}) string {
+	token := jwt.New(jwt.GetSigningMethod("HS256"))
+	token.Claims["iat"] = time.Now().Unix()
+	for name, value := range claims {
+		token.Claims[name] = value
+	}
+	tokenString, _ := token.SignedString(key)
+	return tokenString
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(&Config{Key: key, Authenticator: func(userId, password string) bool { return true }}); err == nil {
+		t.Errorf("Missing Realm should fail")
+	}
+
+	mw, err := New(&Config{Realm: "test zone", Key: key, Authenticator: func(userId, password string) bool { return true }})
+	if err != nil {
+		t.Fatalf("Valid configuration failed: %v", err)
+	}
+	if mw.Timeout != time.Hour {
+		t.Errorf("Defaults should be filled in, got Timeout %v", mw.Timeout)
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	mw, _ := New(&Config{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId, password string) bool {
+			return password == "admin"
+		},
+	})
+	mw.ErrorHandler = func(writer rest.ResponseWriter, request *rest.Request, status int, message string) {
+		writer.WriteHeader(status)
+		writer.WriteJson(map[string]interface{}{"error": map[string]interface{}{"status": status, "message": message}})
+	}
+
+	api := rest.NewApi()
+	api.Use(mw)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		if r.URL.Path == "/missing" {
+			// the application gets the writer of go-json-rest, not the one of the ErrorHandler
+			if _, ok := w.(http.Flusher); !ok {
+				t.Error("The writer of the application should implement http.Flusher")
+			}
+			rest.Error(w, "app not found", http.StatusNotFound)
+			return
+		}
+		claims := ExtractClaims(r)
+		id, _ := claims.String("id")
+		exp, _ := claims.Time("exp")
+		w.WriteJson(map[string]interface{}{"id": id, "aud": claims.Strings("aud"), "exp": exp.Unix()})
+	}))
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(401)
+	recorded.HeaderIs("WWW-Authenticate", "JWT realm=test zone")
+	recorded.BodyIs(`{"error":{"message":"Not Authorized","status":401}}`)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	req.Header.Set("Authorization", "Bearer "+makeTokenString(map[string]interface{}{"id": "admin", "exp": exp, "aud": "api"}))
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+	recorded.BodyIs(`{"aud":["api"],"exp":` + strconv.FormatInt(exp, 10) + `,"id":"admin"}`)
+
+	// errors of the application are left alone
+	req.URL.Path = "/missing"
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(404)
+	recorded.BodyIs(`{"Error":"app not found"}`)
+
+	loginApi := rest.NewApi()
+	loginApi.SetApp(rest.AppSimple(mw.LoginHandler))
+	recorded = test.RunRequest(t, loginApi.MakeHandler(), test.MakeSimpleRequest("POST", "http://localhost/", map[string]string{"username": "admin", "password": "wrong"}))
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"error":{"message":"Not Authorized","status":401}}`)
+}
+
+func TestFromV1(t *testing.T) {
+	v1mw := &v1.JWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(userId, password string) bool {
+			return true
+		},
+	}
+	mw, err := FromV1(v1mw)
+	if err != nil {
+		t.Fatalf("Migrating valid v1 middleware failed: %v", err)
+	}
+	if mw.V1() != v1mw {
+		t.Errorf("Migrated middleware should share the v1 middleware")
+	}
+
+	api := rest.NewApi()
+	api.Use(mw)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"id": r.Env["REMOTE_USER"].(string)})
+	}))
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeTokenString(map[string]interface{}{"id": "admin", "exp": time.Now().Add(time.Hour).Unix()}))
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(200)
+
+	// without ErrorHandler the v1 responses are kept
+	req.Header.Del("Authorization")
+	recorded = test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"token_missing","detail":"Auth header empty"}`)
+}
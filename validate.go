@@ -0,0 +1,231 @@
+package jwt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// minimum key sizes of the HMAC algorithms, the size of their hash (RFC 7518 section 3.2)
+var minHMACKeySizes = map[string]int{"HS256": 32, "HS384": 48, "HS512": 64}
+
+// Validate checks the configuration of the middleware more thoroughly than Init, and returns all
+// the problems found rather than the first one: missing required fields, keys too weak for their
+// HMAC algorithm or not matching the algorithm, insecure CORS settings and options that conflict
+// with each other. It doesn't modify the middleware, and can be called before or after Init, e.g.
+// from a -check-auth-config flag of the application that exits after reporting the problems:
+//
+//	if *checkAuthConfig {
+//		for _, err := range authMiddleware.Validate() {
+//			log.Println(err)
+//		}
+//		os.Exit(...)
+//	}
+func (mw *JWTMiddleware) Validate() []error {
+	problems := []error{}
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if mw.Realm == "" && !mw.verifyOnly {
+		problem("Realm is required")
+	}
+	if mw.Authenticator == nil && !mw.verifyOnly {
+		problem("Authenticator is required")
+	}
+
+	algorithm := mw.SigningAlgorithm
+	if algorithm == "" {
+		algorithm = "HS256"
+	}
+	if mw.Key == nil && mw.PublicKey == nil && mw.KeySet == nil && mw.SecretProvider == nil {
+		problem("Key required")
+	}
+	if mw.Key != nil && mw.KeySet != nil {
+		problem("Key and KeySet are both set, KeySet is never used")
+	}
+	if err := validateKey(algorithm, mw.Key); err != nil {
+		problems = append(problems, err)
+	}
+	if mw.PublicKey != nil {
+		if err := validatePublicKey(algorithm, mw.PublicKey); err != nil {
+			problems = append(problems, err)
+		} else if publicKey := parsePublicKey(algorithm, mw.Key, nil); publicKey != nil && !samePublicKey(publicKey, parsePublicKey(algorithm, nil, mw.PublicKey)) {
+			problem("PublicKey doesn't match Key, tokens signed with Key are rejected")
+		}
+		if mw.Key == nil && !mw.verifyOnly {
+			problem("Key required to issue tokens, PublicKey only verifies them")
+		}
+		if mw.KeySet != nil {
+			problem("PublicKey and KeySet are both set, KeySet is never used")
+		}
+	}
+	if mw.CanaryFormat != nil {
+		canaryAlgorithm := mw.CanaryFormat.SigningAlgorithm
+		if canaryAlgorithm == "" {
+			canaryAlgorithm = algorithm
+		}
+		if mw.CanaryFormat.Key == nil {
+			problem("Key required for CanaryFormat")
+		} else if err := validateKey(canaryAlgorithm, mw.CanaryFormat.Key); err != nil {
+			problem("CanaryFormat: %v", err)
+		}
+	}
+
+	if mw.Timeout < 0 || mw.MaxRefresh < 0 {
+		problem("Timeout and MaxRefresh can't be negative")
+	}
+	if mw.MaxRefresh != 0 && mw.Timeout > mw.MaxRefresh {
+		problem("MaxRefresh %v is shorter than Timeout %v, tokens can't be refreshed after they were issued", mw.MaxRefresh, mw.Timeout)
+	}
+	if mw.InactivityTimeout != 0 && mw.ActivityUpdateInterval >= mw.InactivityTimeout {
+		problem("ActivityUpdateInterval must be shorter than InactivityTimeout")
+	}
+	if mw.RevokeOnTenantSwitch && mw.RevocationStore == nil {
+		problem("RevocationStore is required for RevokeOnTenantSwitch")
+	}
+	if mw.AccessTokenProfile && (mw.Issuer == "" || mw.Audience == "" || mw.ClientId == "") {
+		problem("Issuer, Audience and ClientId are required for AccessTokenProfile")
+	}
+
+	if mw.CORS != nil && len(mw.AllowedOrigins) == 0 {
+		problem("AllowedOrigins are required for CORS")
+	}
+	for _, origin := range mw.AllowedOrigins {
+		parsed, err := url.Parse(origin)
+		if err != nil || parsed.Host == "" || parsed.Path != "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			problem("Allowed origin %q isn't of the form scheme://host[:port]", origin)
+			continue
+		}
+		if parsed.Scheme == "http" && mw.CORS != nil && mw.CORS.AllowCredentials && !isLoopback(parsed.Hostname()) {
+			problem("Allowed origin %q isn't secure, credentials would be sent in the clear", origin)
+		}
+	}
+
+	for i, policy := range mw.TemporalPolicies {
+		if policy.Start < 0 || policy.Start > 24*time.Hour || policy.End < 0 || policy.End > 24*time.Hour {
+			problem("TemporalPolicies[%d]: Start and End must be times of day between 0 and 24h", i)
+		}
+	}
+
+	for i, check := range mw.AuthorizationChecks {
+		if check.Name == "" || check.Check == nil {
+			problem("AuthorizationChecks[%d]: Name and Check are required", i)
+		}
+	}
+
+	if _, err := newScopeTable(mw.ScopeTable); err != nil {
+		problems = append(problems, err)
+	}
+	if mw.DenyUnlistedRoutes && len(mw.ScopeTable) == 0 {
+		problem("DenyUnlistedRoutes without ScopeTable rejects all requests")
+	}
+
+	for _, uri := range mw.PostLogoutRedirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" {
+			problem("Post logout redirect URI %q isn't an absolute URL without fragment", uri)
+		}
+	}
+
+	if mw.WriteTokenTimeout != 0 && mw.Timeout != 0 && mw.WriteTokenTimeout >= mw.Timeout {
+		problem("WriteTokenTimeout isn't shorter than Timeout, write tokens live as long as read tokens")
+	}
+	for i, migration := range mw.ClaimMigrations {
+		if migration.Name == "" || migration.Migrate == nil {
+			problem("ClaimMigrations[%d]: Name and Migrate are required", i)
+		}
+	}
+	if policy := mw.OverridePolicy; policy != nil {
+		if len(policy.Key) < minHMACKeySizes["HS256"] {
+			problem("OverridePolicy Key of %d bytes is too weak, overrides are disabled", len(policy.Key))
+		}
+		if policy.Enabled == nil {
+			problem("OverridePolicy without Enabled, overrides are disabled")
+		}
+		if mw.Key != nil && bytes.Equal(policy.Key, mw.Key) {
+			problem("OverridePolicy Key must not be the Key of the middleware")
+		}
+	}
+	switch mw.CookieScope {
+	case "", CookieScopeHost:
+	case CookieScopeParent:
+		if mw.PublicSuffixList == nil {
+			problem("CookieScopeParent without PublicSuffixList sets host-only cookies")
+		}
+	default:
+		problem("Unknown CookieScope %q", mw.CookieScope)
+	}
+	for host, domain := range mw.CookieDomainOverrides {
+		domain = normalizeDomain(domain)
+		if domain != "" && (!domainMatch(normalizeDomain(host), domain) || mw.publicSuffix(domain)) {
+			problem("Cookie domain %q of %q in CookieDomainOverrides is ignored", domain, host)
+		}
+	}
+
+	for _, verifier := range mw.AdditionalVerifiers {
+		for _, err := range verifier.Validate() {
+			problem("AdditionalVerifiers: %v", err)
+		}
+	}
+	return problems
+}
+
+// validateKey checks that key is suitable for signing or verifying with algorithm.
+func validateKey(algorithm string, key []byte) error {
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil {
+		return fmt.Errorf("Unknown signing algorithm %s", algorithm)
+	}
+	if key == nil {
+		return nil
+	}
+
+	pem := bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN"))
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if pem {
+			return fmt.Errorf("Key is a PEM encoded key, which must not be used as %s secret", algorithm)
+		}
+		if len(key) < minHMACKeySizes[algorithm] {
+			return fmt.Errorf("Key of %d bytes is too weak for %s, which requires at least %d", len(key), algorithm, minHMACKeySizes[algorithm])
+		}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, err := jwt.ParseRSAPrivateKeyFromPEM(key); err != nil {
+			if _, err := jwt.ParseRSAPublicKeyFromPEM(key); err != nil {
+				return fmt.Errorf("Key isn't a PEM encoded RSA key as required by %s", algorithm)
+			}
+		}
+	case *jwt.SigningMethodECDSA:
+		if _, err := jwt.ParseECPrivateKeyFromPEM(key); err != nil {
+			if _, err := jwt.ParseECPublicKeyFromPEM(key); err != nil {
+				return fmt.Errorf("Key isn't a PEM encoded EC key as required by %s", algorithm)
+			}
+		}
+	default:
+		return errors.New("Key can't be validated for " + algorithm)
+	}
+	return nil
+}
+
+// validatePublicKey checks that key is a public key verifying the tokens signed with algorithm.
+func validatePublicKey(algorithm string, key []byte) error {
+	if !asymmetricAlgorithm(algorithm) {
+		return fmt.Errorf("PublicKey is only used by RSA and ECDSA algorithms, not %s", algorithm)
+	}
+	if parsePrivateKey(algorithm, key) != nil {
+		return errors.New("PublicKey is a private key, which services verifying tokens shouldn't hold")
+	}
+	if parsePublicKey(algorithm, nil, key) == nil {
+		return fmt.Errorf("PublicKey isn't a PEM encoded public key as required by %s", algorithm)
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
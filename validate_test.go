@@ -0,0 +1,74 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	authenticator := func(userId string, password string) bool {
+		return true
+	}
+	strongKey := []byte(strings.Repeat("k", 32))
+
+	valid := &JWTMiddleware{
+		Realm:         "test zone",
+		Key:           strongKey,
+		Timeout:       time.Hour,
+		MaxRefresh:    24 * time.Hour,
+		Authenticator: authenticator,
+	}
+	if problems := valid.Validate(); len(problems) != 0 {
+		t.Errorf("A valid configuration shouldn't have problems, got %v", problems)
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	rsaMiddleware := &JWTMiddleware{Realm: "test zone", SigningAlgorithm: "RS256", Key: rsaKey, Authenticator: authenticator}
+	if problems := rsaMiddleware.Validate(); len(problems) != 0 {
+		t.Errorf("A PEM encoded RSA key should be valid for RS256, got %v", problems)
+	}
+
+	// all problems are reported at once
+	invalid := &JWTMiddleware{
+		Realm:                "test zone",
+		Key:                  []byte("secret"),
+		Timeout:              time.Hour,
+		MaxRefresh:           time.Minute,
+		RevokeOnTenantSwitch: true,
+		CORS:                 &CORS{AllowCredentials: true},
+		AllowedOrigins:       []string{"http://app.example.com", "app.example.com"},
+		CanaryFormat:         &TokenFormat{SigningAlgorithm: "ES256", Key: rsaKey},
+	}
+	expected := []string{
+		"Authenticator is required",
+		"Key of 6 bytes is too weak for HS256, which requires at least 32",
+		"CanaryFormat: Key isn't a PEM encoded EC key as required by ES256",
+		"MaxRefresh 1m0s is shorter than Timeout 1h0m0s, tokens can't be refreshed after they were issued",
+		"RevocationStore is required for RevokeOnTenantSwitch",
+		`Allowed origin "http://app.example.com" isn't secure, credentials would be sent in the clear`,
+		`Allowed origin "app.example.com" isn't of the form scheme://host[:port]`,
+	}
+	problems := invalid.Validate()
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %v", len(expected), problems)
+	}
+	for i, problem := range problems {
+		if problem.Error() != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], problem)
+		}
+	}
+
+	mismatched := &JWTMiddleware{Realm: "test zone", Key: rsaKey, Authenticator: authenticator}
+	if problems := mismatched.Validate(); len(problems) != 1 || !strings.Contains(problems[0].Error(), "PEM encoded key") {
+		t.Errorf("A PEM key shouldn't be accepted as HMAC secret, got %v", problems)
+	}
+}
@@ -0,0 +1,66 @@
+package jwt
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// verifiedToken is an entry of the cache of VerificationCacheTTL.
+type verifiedToken struct {
+	token     *jwt.Token
+	verifier  *JWTMiddleware
+	expiresAt time.Time
+}
+
+// parseCachedToken is parseWithVerifiers with the cache of VerificationCacheTTL in front of it.
+// Cache hits and misses are reported as "verification_cache_hits" and
+// "verification_cache_misses" counters.
+func (mw *JWTMiddleware) parseCachedToken(tokenString string) (*jwt.Token, *JWTMiddleware, error) {
+	cache := mw.signingKeys().verifiedTokens
+	if cache == nil {
+		return mw.parseWithVerifiers(tokenString)
+	}
+
+	key := tokenId(tokenString)
+	now := mw.Clock.Now()
+	if entry, ok := cache.Get(key); ok {
+		if entry := entry.(verifiedToken); !now.After(entry.expiresAt) {
+			mw.Metrics.IncCounter("verification_cache_hits")
+			return mw.cachedTokenCopy(entry.token), entry.verifier, nil
+		}
+		cache.Delete(key)
+	}
+	mw.Metrics.IncCounter("verification_cache_misses")
+
+	token, verifier, err := mw.parseWithVerifiers(tokenString)
+	if err != nil {
+		return token, verifier, err
+	}
+
+	expiresAt := now.Add(mw.VerificationCacheTTL)
+	if exp, ok := GetTime(token.Claims, "exp"); ok && exp.Before(expiresAt) {
+		expiresAt = exp
+	}
+	if ttl := expiresAt.Sub(now); ttl > 0 {
+		cache.Set(key, verifiedToken{token: mw.cachedTokenCopy(token), verifier: verifier, expiresAt: expiresAt}, ttl)
+	}
+	return token, verifier, nil
+}
+
+// cachedTokenCopy copies a token going in or out of the cache, so that requests don't share the
+// claims they may modify with ShareClaims.
+func (mw *JWTMiddleware) cachedTokenCopy(token *jwt.Token) *jwt.Token {
+	copied := *token
+	if mw.ShareClaims {
+		copied.Claims = copyClaims(token.Claims)
+	}
+	return &copied
+}
+
+// forgetVerifiedToken drops a token from the cache of VerificationCacheTTL.
+func (mw *JWTMiddleware) forgetVerifiedToken(tokenString string) {
+	if cache := mw.signingKeys().verifiedTokens; cache != nil {
+		cache.Delete(tokenId(tokenString))
+	}
+}
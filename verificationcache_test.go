@@ -0,0 +1,92 @@
+package jwt
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestVerificationCache(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+	metrics := newCountingMetrics()
+	authMiddleware := &JWTMiddleware{
+		Realm:                "test zone",
+		Key:                  key,
+		Timeout:              time.Hour,
+		Clock:                clock,
+		Metrics:              metrics,
+		RevocationStore:      NewMemoryRevocationStore(),
+		VerificationCacheTTL: time.Hour,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+	}
+
+	api := rest.NewApi()
+	api.Use(authMiddleware)
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(map[string]string{"Id": r.Env["REMOTE_USER"].(string)})
+	}))
+	handler := api.MakeHandler()
+
+	tokens := 0
+	makeToken := func(signingKey []byte) string {
+		tokens++
+		token := jwt.New(jwt.GetSigningMethod("HS256"))
+		token.Claims["id"] = "admin"
+		token.Claims["jti"] = strconv.Itoa(tokens)
+		token.Claims["exp"] = clock.now.Add(30 * time.Minute).Unix()
+		token.Claims["iat"] = clock.now.Unix()
+		tokenString, _ := token.SignedString(signingKey)
+		return tokenString
+	}
+	request := func(tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+	checkCounters := func(hits, misses int) {
+		t.Helper()
+		if metrics.counter("verification_cache_hits") != hits || metrics.counter("verification_cache_misses") != misses {
+			t.Errorf("Expected %d hits and %d misses, got %v", hits, misses, metrics.counters)
+		}
+	}
+
+	tokenString := makeToken(key)
+	request(tokenString).CodeIs(200)
+	request(tokenString).CodeIs(200)
+	checkCounters(1, 1)
+
+	// invalid tokens aren't cached
+	request(makeToken([]byte("wrong key"))).CodeIs(401)
+	request(makeToken([]byte("wrong key"))).CodeIs(401)
+	checkCounters(1, 3)
+
+	// cached tokens still expire
+	clock.now = clock.now.Add(31 * time.Minute)
+	recorded := request(tokenString)
+	recorded.CodeIs(401)
+	recorded.BodyIs(`{"Error":"Not Authorized","code":"token_expired","detail":"Token is expired"}`)
+	checkCounters(1, 4)
+
+	// revoked tokens are dropped
+	tokenString = makeToken(key)
+	request(tokenString).CodeIs(200)
+	if err := authMiddleware.RevokeToken(tokenString); err != nil {
+		t.Fatal(err)
+	}
+	request(tokenString).CodeIs(401)
+	checkCounters(1, 6)
+
+	// rotating the key drops all tokens
+	tokenString = makeToken(key)
+	request(tokenString).CodeIs(200)
+	request(tokenString).CodeIs(200)
+	authMiddleware.SetKey([]byte("rotated key"))
+	request(tokenString).CodeIs(401)
+	checkCounters(2, 8)
+}
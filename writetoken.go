@@ -0,0 +1,68 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Values of the "token_access" claim of the token pairs issued with WriteTokenTimeout.
+const (
+	// The token may only be used for safe requests (GET, HEAD and OPTIONS).
+	TokenAccessRead = "read"
+
+	// The token may be used for all requests, but expires after WriteTokenTimeout and can't be
+	// refreshed.
+	TokenAccessWrite = "write"
+)
+
+// ExtractWriteToken returns the write token issued along with the token of a login when
+// WriteTokenTimeout is set, e.g. for a LoginCallback returning the tokens as cookies. The default
+// LoginCallback returns it in the "write_token" field.
+func ExtractWriteToken(request *rest.Request) string {
+	writeToken, _ := request.Env["JWT_WRITE_TOKEN"].(string)
+	return writeToken
+}
+
+// safeMethod reports whether requests with method only read resources.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// writeTokenRequired rejects the unsafe requests made with read tokens.
+func (mw *JWTMiddleware) writeTokenRequired(writer rest.ResponseWriter, request *rest.Request) bool {
+	if safeMethod(request.Method) || ExtractClaims(request)["token_access"] != TokenAccessRead {
+		return false
+	}
+	errorWithCode(writer, "Write token required", "write_token_required", http.StatusForbidden)
+	return true
+}
+
+// issueWriteToken signs a write token with the claims of the read token, which expires after
+// WriteTokenTimeout unless the read token expires first. It is made available through
+// ExtractWriteToken.
+func (mw *JWTMiddleware) issueWriteToken(request *rest.Request, token *jwt.Token, format *TokenFormat, userId string) error {
+	writeToken := jwt.New(jwt.GetSigningMethod(format.SigningAlgorithm))
+	for key, value := range token.Claims {
+		writeToken.Claims[key] = value
+	}
+	writeToken.Claims["token_access"] = TokenAccessWrite
+	writeExp := mw.Clock.Now().Add(mw.WriteTokenTimeout)
+	if exp, ok := GetTime(token.Claims, "exp"); !ok || writeExp.Before(exp) {
+		writeToken.Claims["exp"] = writeExp.Unix()
+	}
+
+	writeTokenString, err := mw.signToken(writeToken, format, userId)
+	if err != nil {
+		return err
+	}
+	mw.storeToken(userId, writeTokenString)
+	mw.recordActivity(writeTokenString)
+	request.Env["JWT_WRITE_TOKEN"] = writeTokenString
+	return nil
+}
@@ -0,0 +1,83 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+)
+
+type decoderTokenPair struct {
+	Token      string `json:"token"`
+	WriteToken string `json:"write_token"`
+}
+
+func TestWriteTokens(t *testing.T) {
+	clock := &frozenClock{now: time.Now()}
+	authMiddleware := &JWTMiddleware{
+		Realm:      "test zone",
+		Key:        key,
+		Timeout:    24 * time.Hour,
+		MaxRefresh: 7 * 24 * time.Hour,
+		Clock:      clock,
+		Authenticator: func(userId string, password string) bool {
+			return true
+		},
+		WriteTokenTimeout: 5 * time.Minute,
+	}
+
+	api := rest.NewApi()
+	api.Use(&rest.IfMiddleware{
+		Condition: func(request *rest.Request) bool {
+			return request.URL.Path != "/login"
+		},
+		IfTrue: authMiddleware,
+	})
+	router, _ := rest.MakeRouter(
+		rest.Post("/login", authMiddleware.LoginHandler),
+		rest.Get("/refresh", authMiddleware.RefreshHandler),
+		rest.Get("/documents", func(w rest.ResponseWriter, r *rest.Request) {}),
+		rest.Post("/documents", func(w rest.ResponseWriter, r *rest.Request) {}),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+	request := func(method, path, tokenString string) *test.Recorded {
+		req := test.MakeSimpleRequest(method, "http://localhost"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		return test.RunRequest(t, handler, req)
+	}
+
+	recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/login", map[string]string{"username": "admin", "password": "admin"}))
+	recorded.CodeIs(200)
+	tokens := decoderTokenPair{}
+	recorded.DecodeJsonPayload(&tokens)
+	if tokens.Token == "" || tokens.WriteToken == "" || tokens.Token == tokens.WriteToken {
+		t.Fatalf("A read and a write token should be issued, got %+v", tokens)
+	}
+
+	request("GET", "/documents", tokens.Token).CodeIs(200)
+	recorded = request("POST", "/documents", tokens.Token)
+	recorded.CodeIs(403)
+	recorded.BodyIs(`{"Error":"Write token required","code":"write_token_required"}`)
+	request("GET", "/documents", tokens.WriteToken).CodeIs(200)
+	request("POST", "/documents", tokens.WriteToken).CodeIs(200)
+
+	// write tokens can't be refreshed, refreshed read tokens stay read tokens
+	request("GET", "/refresh", tokens.WriteToken).CodeIs(401)
+	recorded = request("GET", "/refresh", tokens.Token)
+	recorded.CodeIs(200)
+	refreshed := decoderTokenPair{}
+	recorded.DecodeJsonPayload(&refreshed)
+	if refreshed.WriteToken != "" {
+		t.Errorf("Refreshing shouldn't issue a write token, got %+v", refreshed)
+	}
+	request("POST", "/documents", refreshed.Token).CodeIs(403)
+
+	clock.now = clock.now.Add(10 * time.Minute)
+	request("POST", "/documents", tokens.WriteToken).CodeIs(401)
+	request("GET", "/documents", tokens.Token).CodeIs(200)
+
+	// tokens issued without write tokens are valid for all requests
+	request("POST", "/documents", makeTokenString("admin", key)).CodeIs(200)
+}